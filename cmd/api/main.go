@@ -1,31 +1,140 @@
 package main
 
 import (
+	"context"
 	"expo-open-ota/config"
+	"expo-open-ota/internal/apps"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/metadataStore"
 	"expo-open-ota/internal/metrics"
 	infrastructure "expo-open-ota/internal/router"
+	"expo-open-ota/internal/update"
+	"expo-open-ota/internal/uploadSessions"
+	"flag"
 	"log"
-	"net/http"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/handlers"
 )
 
 func init() {
-	config.LoadConfig()
 	metrics.InitMetrics()
 }
 
+func loadConfig() {
+	configFile := flag.String("config", "", "YAML or TOML config file, CONFIG_FILE_PATH by default")
+	printConfig := flag.Bool("print-config", false, "Print the configuration in effect, secrets redacted, and exit")
+	flag.Parse()
+	config.SetConfigFilePath(*configFile)
+	if !*printConfig {
+		config.LoadConfig()
+		return
+	}
+	err := config.Load()
+	if printErr := config.Print(os.Stdout); printErr != nil {
+		log.Fatalf("Error printing configuration: %v", printErr)
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	os.Exit(0)
+}
+
+// reloadConfigOnHangup applies the reloadable settings of the config file on SIGHUP.
+func reloadConfigOnHangup() {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if err := config.Reload(); err != nil {
+				log.Printf("Error reloading configuration, keeping the current one: %v", err)
+			}
+		}
+	}()
+}
+
+func initMetadataStore(updates *update.Manager) {
+	store := metadataStore.GetMetadataStore()
+	if store == nil {
+		return
+	}
+	count, err := store.CountUpdates()
+	if err != nil {
+		log.Fatalf("Error reading metadata store: %v", err)
+	}
+	if count > 0 {
+		return
+	}
+	log.Println("Metadata store is empty, synchronizing it from the bucket...")
+	synchronized, err := updates.SyncMetadataStoreFromBucket()
+	if err != nil {
+		log.Fatalf("Error synchronizing metadata store: %v", err)
+	}
+	log.Printf("Metadata store synchronized with %d updates", synchronized)
+}
+
+// flushReplication waits for the writes of the servers to reach the storage replicas before exiting.
+func flushReplication(servers []*infrastructure.Server, timeout time.Duration) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for _, s := range servers {
+		replicated, ok := s.Updates().Bucket().(*bucket.ReplicatedBucket)
+		if !ok {
+			continue
+		}
+		if err := replicated.Flush(ctx); err != nil {
+			log.Printf("Error replicating storage before exiting: %v", err)
+		}
+	}
+}
+
 func main() {
-	router := infrastructure.NewRouter()
+	loadConfig()
+	reloadConfigOnHangup()
+	server, err := infrastructure.NewServerFromEnv()
+	if err != nil {
+		log.Fatalf("Error building server: %v", err)
+	}
+	initMetadataStore(server.Updates())
+	uploadSessions.StartSweeper(server.Updates())
+	hostedApps, err := apps.GetApps()
+	if err != nil {
+		log.Fatalf("Error reading apps: %v", err)
+	}
+	appServers := make([]*infrastructure.Server, 0, len(hostedApps))
+	for _, app := range hostedApps {
+		appServer, err := infrastructure.NewAppServerFromEnv(app)
+		if err != nil {
+			log.Fatalf("Error building server of app %s: %v", app.Id, err)
+		}
+		uploadSessions.StartSweeper(appServer.Updates())
+		appServers = append(appServers, appServer)
+	}
+	router := server.NewAppsRouter(appServers)
 	log.Println("Server is running on port " + config.GetPort())
 	corsOptions := handlers.CORS(
 		handlers.AllowedHeaders([]string{"Authorization", "Content-Type"}),
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+		handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
 		handlers.AllowedOrigins([]string{"*"}),
 		handlers.AllowCredentials(),
 	)
-	err := http.ListenAndServe(":" + config.GetPort(), corsOptions(router))
+	listener, err := net.Listen("tcp", ":"+config.GetPort())
 	if err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	options := infrastructure.HTTPServerOptionsFromEnv()
+	if err := server.Serve(ctx, listener, corsOptions(router), options); err != nil {
+		log.Printf("Server stopped: %v", err)
+	}
+	flushReplication(append([]*infrastructure.Server{server}, appServers...), options.ShutdownTimeout)
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/storageMigration"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Copies every update of a bucket, the ones of its apps included, into another one, then prints the report
+// as JSON. Exits with status 1 if any folder could not be copied.
+func main() {
+	from := flag.String("from", "", "Bucket to copy, local:<folder> or s3://<bucket>[/<prefix>][?region=<region>], the configured bucket by default")
+	to := flag.String("to", "", "Bucket to copy into, local:<folder> or s3://<bucket>[/<prefix>][?region=<region>]")
+	concurrency := flag.Int("concurrency", 4, "Number of updates copied at once")
+	dryRun := flag.Bool("dry-run", false, "Only report the differences between the buckets")
+	verify := flag.Bool("verify", false, "Also compare the content of the updates already committed in the target")
+	internal := flag.Bool("internal", false, "Also copy the audit log and the upload sessions")
+	quiet := flag.Bool("quiet", false, "Do not print progress")
+	configFile := flag.String("config", "", "YAML or TOML config file, CONFIG_FILE_PATH by default")
+	flag.Parse()
+	if *to == "" || flag.NArg() != 0 || *concurrency < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	config.SetConfigFilePath(*configFile)
+	config.LoadConfig()
+
+	source := bucket.GetBucket()
+	if *from != "" {
+		var err error
+		if source, err = bucket.ParseLocation(*from); err != nil {
+			log.Fatalf("Invalid source: %v", err)
+		}
+	}
+	target, err := bucket.ParseLocation(*to)
+	if err != nil {
+		log.Fatalf("Invalid target: %v", err)
+	}
+
+	options := storageMigration.Options{Concurrency: *concurrency, DryRun: *dryRun, Verify: *verify, Internal: *internal}
+	report, err := storageMigration.Migrate(source, target, options, func(progress storageMigration.Progress) {
+		if *quiet {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\rfolders: %d/%d  copied: %d  failed: %d", progress.Done, progress.Folders, progress.Copied, progress.Failed)
+	})
+	if !*quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		log.Fatalf("Error migrating storage: %v", err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatalf("Error printing report: %v", err)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiBackend calls the /api routes of a server with the token of a dashboard user.
+type apiBackend struct {
+	server string
+	token  string
+	client *http.Client
+}
+
+func newApiBackend(server string, token string, username string, password string) (*apiBackend, error) {
+	if server == "" {
+		return nil, fmt.Errorf("no server, set --server or OTA_SERVER_URL")
+	}
+	b := &apiBackend{server: strings.TrimRight(server, "/"), token: token, client: &http.Client{Timeout: 5 * time.Minute}}
+	if b.token != "" {
+		return b, nil
+	}
+	if password == "" {
+		return nil, fmt.Errorf("no credentials, set --token (OTA_ADMIN_TOKEN) or OTA_ADMIN_PASSWORD")
+	}
+	form := url.Values{}
+	form.Set("username", username)
+	form.Set("password", password)
+	resp, err := b.client.PostForm(b.server+"/auth/login", form)
+	if err != nil {
+		return nil, fmt.Errorf("error logging in: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("logging in", resp)
+	}
+	var response auth.AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding login response: %w", err)
+	}
+	b.token = response.Token
+	return b, nil
+}
+
+func responseError(action string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("error %s: %s: %s", action, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// send sends a request to the API, the caller closing the body of the successful response.
+func (b *apiBackend) send(action string, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, b.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error %s: %w", action, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, responseError(action, resp)
+	}
+	return resp, nil
+}
+
+// do sends a request to the API and decodes the JSON response into result, if not nil.
+func (b *apiBackend) do(action string, method string, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+		contentType = "application/json"
+	}
+	resp, err := b.send(action, method, path, contentType, reader)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error decoding response of %s: %w", action, err)
+	}
+	return nil
+}
+
+func runtimeVersionPath(branch string, runtimeVersion string) string {
+	return "/api/branch/" + url.PathEscape(branch) + "/runtimeVersion/" + url.PathEscape(runtimeVersion)
+}
+
+func updatePath(u types.Update) string {
+	return runtimeVersionPath(u.Branch, u.RuntimeVersion) + "/updates/" + url.PathEscape(u.UpdateId)
+}
+
+func (b *apiBackend) Branches() ([]handlers.BranchMapping, error) {
+	var branches []handlers.BranchMapping
+	err := b.do("listing branches", http.MethodGet, "/api/branches", nil, &branches)
+	return branches, err
+}
+
+func (b *apiBackend) RuntimeVersions(branch string) ([]bucket.RuntimeVersionWithStats, error) {
+	var runtimeVersions []bucket.RuntimeVersionWithStats
+	err := b.do("listing runtime versions", http.MethodGet, "/api/branch/"+url.PathEscape(branch)+"/runtimeVersions", nil, &runtimeVersions)
+	return runtimeVersions, err
+}
+
+func (b *apiBackend) Updates(branch string, runtimeVersion string) ([]handlers.UpdateItem, error) {
+	var updates []handlers.UpdateItem
+	err := b.do("listing updates", http.MethodGet, runtimeVersionPath(branch, runtimeVersion)+"/updates", nil, &updates)
+	return updates, err
+}
+
+// Manifest requests the manifest the way an expo-updates client does, through the public /manifest route.
+func (b *apiBackend) Manifest(request manifestRequest) (manifestResponse, error) {
+	var response manifestResponse
+	if request.Channel == "" {
+		return response, fmt.Errorf("--channel is required, the server resolves it to a branch")
+	}
+	req, err := http.NewRequest(http.MethodGet, b.server+"/manifest", nil)
+	if err != nil {
+		return response, err
+	}
+	req.Header.Set("expo-platform", request.Platform)
+	req.Header.Set("expo-runtime-version", request.RuntimeVersion)
+	req.Header.Set("expo-channel-name", request.Channel)
+	req.Header.Set("expo-protocol-version", "1")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return response, fmt.Errorf("error requesting manifest: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return response, responseError("requesting manifest", resp)
+	}
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return response, fmt.Errorf("error parsing manifest response: %w", err)
+	}
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return response, nil
+		}
+		if err != nil {
+			return response, fmt.Errorf("error reading manifest response: %w", err)
+		}
+		switch part.FormName() {
+		case "manifest":
+			response.Manifest = &types.UpdateManifest{}
+			err = json.NewDecoder(part).Decode(response.Manifest)
+		case "directive":
+			response.Directive = &directive{}
+			err = json.NewDecoder(part).Decode(response.Directive)
+		}
+		if err != nil {
+			return response, fmt.Errorf("error decoding %s: %w", part.FormName(), err)
+		}
+	}
+}
+
+func (b *apiBackend) Promote(source types.Update, targetBranch string) (types.Update, error) {
+	var promoted types.Update
+	err := b.do("promoting update", http.MethodPost, updatePath(source)+"/promote", handlers.PromoteUpdateRequest{Branch: targetBranch}, &promoted)
+	return promoted, err
+}
+
+func (b *apiBackend) Rollback(branch string, runtimeVersion string, request handlers.RollbackRequest) (types.Update, error) {
+	var published types.Update
+	err := b.do("rolling back", http.MethodPost, runtimeVersionPath(branch, runtimeVersion)+"/rollback", request, &published)
+	return published, err
+}
+
+func (b *apiBackend) Export(exported types.Update, w io.Writer) error {
+	resp, err := b.send("exporting update", http.MethodGet, updatePath(exported)+"/export", "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("error downloading archive: %w", err)
+	}
+	return nil
+}
+
+func (b *apiBackend) Import(archive io.Reader, branch string) (handlers.ImportUpdateResponse, error) {
+	var response handlers.ImportUpdateResponse
+	resp, err := b.send("importing update", http.MethodPost, "/api/branch/"+url.PathEscape(branch)+"/import", "application/gzip", archive)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return response, fmt.Errorf("error decoding response of importing update: %w", err)
+	}
+	return response, nil
+}
+
+func (b *apiBackend) DeleteUpdate(deleted types.Update) error {
+	return b.do("deleting update", http.MethodDelete, updatePath(deleted), nil, nil)
+}
+
+func (b *apiBackend) DeleteRuntimeVersion(branch string, runtimeVersion string) (int, error) {
+	var response struct {
+		DeletedCount int `json:"deletedCount"`
+	}
+	err := b.do("deleting runtime version", http.MethodDelete, runtimeVersionPath(branch, runtimeVersion), nil, &response)
+	return response.DeletedCount, err
+}
+
+func (b *apiBackend) CollectGarbage(options update.GCOptions) (handlers.GarbageCollectionResponse, error) {
+	query := url.Values{}
+	query.Set("keep", strconv.Itoa(options.KeepUpdates))
+	query.Set("minAge", options.MinAge.String())
+	query.Set("dryRun", strconv.FormatBool(options.DryRun))
+	var response handlers.GarbageCollectionResponse
+	err := b.do("collecting garbage", http.MethodPost, "/api/gc?"+query.Encode(), nil, &response)
+	return response, err
+}
+
+func (b *apiBackend) Verify() (update.ReindexReport, error) {
+	var report update.ReindexReport
+	err := b.do("verifying storage", http.MethodGet, "/api/verify", nil, &report)
+	return report, err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"io"
+)
+
+type manifestRequest struct {
+	Platform       string
+	RuntimeVersion string
+	// Channel is resolved to a branch by the server, the direct backend reads Branch instead
+	Channel string
+	Branch  string
+}
+
+type directive struct {
+	Type       string                 `json:"type"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// manifestResponse holds either the manifest or the directive a client would get.
+type manifestResponse struct {
+	Manifest  *types.UpdateManifest `json:"manifest,omitempty"`
+	Directive *directive            `json:"directive,omitempty"`
+}
+
+// backend runs the commands either through the /api routes of a server or directly against the bucket.
+type backend interface {
+	Branches() ([]handlers.BranchMapping, error)
+	RuntimeVersions(branch string) ([]bucket.RuntimeVersionWithStats, error)
+	Updates(branch string, runtimeVersion string) ([]handlers.UpdateItem, error)
+	Manifest(request manifestRequest) (manifestResponse, error)
+	Promote(source types.Update, targetBranch string) (types.Update, error)
+	Rollback(branch string, runtimeVersion string, request handlers.RollbackRequest) (types.Update, error)
+	// Export writes the signed archive of an update
+	Export(exported types.Update, w io.Writer) error
+	Import(archive io.Reader, branch string) (handlers.ImportUpdateResponse, error)
+	DeleteUpdate(deleted types.Update) error
+	DeleteRuntimeVersion(branch string, runtimeVersion string) (int, error)
+	CollectGarbage(options update.GCOptions) (handlers.GarbageCollectionResponse, error)
+	Verify() (update.ReindexReport, error)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/crypto"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/keyStore"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"expo-open-ota/internal/uploadSessions"
+	"fmt"
+	"io"
+	"time"
+)
+
+// directBackend reads and writes the configured bucket itself, without a running server. It neither
+// records audit events nor sends webhooks.
+type directBackend struct {
+	updates *update.Manager
+}
+
+func newDirectBackend() *directBackend {
+	return &directBackend{updates: update.DefaultManager()}
+}
+
+func (b *directBackend) Branches() ([]handlers.BranchMapping, error) {
+	branches, err := b.updates.GetBranches()
+	if err != nil {
+		return nil, err
+	}
+	mappings := make([]handlers.BranchMapping, 0, len(branches))
+	for _, branch := range branches {
+		mappings = append(mappings, handlers.BranchMapping{BranchName: branch})
+	}
+	return mappings, nil
+}
+
+func (b *directBackend) RuntimeVersions(branch string) ([]bucket.RuntimeVersionWithStats, error) {
+	return b.updates.GetRuntimeVersions(branch)
+}
+
+func (b *directBackend) Updates(branch string, runtimeVersion string) ([]handlers.UpdateItem, error) {
+	updates, err := b.updates.GetAllUpdatesForRuntimeVersion(branch, runtimeVersion)
+	if err != nil {
+		return nil, err
+	}
+	items := []handlers.UpdateItem{}
+	for _, u := range updates {
+		if !b.updates.IsUpdateValid(u) {
+			continue
+		}
+		item := handlers.UpdateItem{
+			UpdateId:  u.UpdateId,
+			CreatedAt: time.UnixMilli(int64(u.CreatedAt / time.Millisecond)).UTC().Format(time.RFC3339),
+		}
+		// Rollbacks have no metadata, hence no UUID
+		if metadata, err := b.updates.GetMetadata(u); err == nil {
+			item.UpdateUUID = crypto.ConvertSHA256HashToUUID(metadata.ID)
+		}
+		item.CommitHash, item.Platform, _ = b.updates.RetrieveUpdateCommitHashAndPlatform(u)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func toDirective(value interface{}) (*directive, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result directive
+	return &result, json.Unmarshal(encoded, &result)
+}
+
+// Manifest composes the manifest of the latest update of a branch, channels are only known to Expo.
+func (b *directBackend) Manifest(request manifestRequest) (manifestResponse, error) {
+	var response manifestResponse
+	if request.Branch == "" {
+		return response, fmt.Errorf("--branch is required with --direct")
+	}
+	latest, err := b.updates.GetLatestUpdateBundlePathForRuntimeVersion(request.Branch, request.RuntimeVersion)
+	if err != nil {
+		return response, err
+	}
+	switch {
+	case latest == nil:
+		response.Directive, err = toDirective(update.CreateNoUpdateAvailableDirective())
+	case b.updates.GetUpdateType(*latest) == types.Rollback:
+		rollback, rollbackErr := b.updates.CreateRollbackDirective(*latest)
+		if rollbackErr != nil {
+			return response, rollbackErr
+		}
+		response.Directive, err = toDirective(rollback)
+	default:
+		metadata, metadataErr := b.updates.GetMetadata(*latest)
+		if metadataErr != nil {
+			return response, metadataErr
+		}
+		manifest, manifestErr := b.updates.ComposeUpdateManifest(&metadata, *latest, request.Platform)
+		if manifestErr != nil {
+			return response, manifestErr
+		}
+		response.Manifest = &manifest
+	}
+	return response, err
+}
+
+func (b *directBackend) Promote(source types.Update, targetBranch string) (types.Update, error) {
+	return b.updates.PromoteUpdate(source, targetBranch)
+}
+
+func (b *directBackend) Rollback(branch string, runtimeVersion string, request handlers.RollbackRequest) (types.Update, error) {
+	if request.UpdateId != "" {
+		return b.updates.PromoteUpdate(types.Update{Branch: branch, RuntimeVersion: runtimeVersion, UpdateId: request.UpdateId}, branch)
+	}
+	return b.updates.RollbackToEmbedded(branch, runtimeVersion, request.Platform)
+}
+
+func (b *directBackend) Export(exported types.Update, w io.Writer) error {
+	_, err := b.updates.ExportUpdate(exported, w, keyStore.GetPrivateExpoKey())
+	return err
+}
+
+func (b *directBackend) Import(archive io.Reader, branch string) (handlers.ImportUpdateResponse, error) {
+	var response handlers.ImportUpdateResponse
+	publicKeys, err := update.ArchivePublicKeys(keyStore.GetPublicExpoKey())
+	if err != nil {
+		return response, err
+	}
+	response.Update, response.Source, err = b.updates.ImportUpdate(archive, branch, publicKeys)
+	return response, err
+}
+
+func (b *directBackend) DeleteUpdate(deleted types.Update) error {
+	return b.updates.DeleteUpdate(deleted)
+}
+
+func (b *directBackend) DeleteRuntimeVersion(branch string, runtimeVersion string) (int, error) {
+	updates, err := b.updates.Bucket().GetUpdates(branch, runtimeVersion)
+	if err != nil {
+		return 0, err
+	}
+	for deleted, u := range updates {
+		if err := b.updates.DeleteUpdate(u); err != nil {
+			return deleted, err
+		}
+	}
+	return len(updates), nil
+}
+
+func (b *directBackend) CollectGarbage(options update.GCOptions) (handlers.GarbageCollectionResponse, error) {
+	report, err := b.updates.CollectGarbage(options)
+	response := handlers.GarbageCollectionResponse{GCReport: report}
+	if err != nil || options.DryRun {
+		return response, err
+	}
+	response.SweptUploadSessions, err = uploadSessions.SweepExpired(b.updates, time.Now())
+	return response, err
+}
+
+func (b *directBackend) Verify() (update.ReindexReport, error) {
+	return b.updates.VerifyStorage()
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const usage = `Usage: ota-admin [global flags] <command> [arguments]
+
+Commands:
+  branches                                  List the branches
+  runtime-versions <branch>                 List the runtime versions of a branch
+  updates <branch> <runtimeVersion>         List the committed updates of a runtime version
+  manifest --platform P --runtime-version RV (--channel C | --branch B)
+                                            Show the manifest or directive a client would get
+  promote <branch> <runtimeVersion> <updateId> --to <branch>
+                                            Publish a copy of an update on another branch
+  rollback <branch> <runtimeVersion> [--to <updateId>] [--platform P]
+                                            Publish an older update again, or roll back to the embedded update
+  export <branch> <runtimeVersion> <updateId> [--output <file>]
+                                            Write the signed archive of an update
+  import <archive> --branch <branch>        Publish the update of an archive on a branch
+  delete <branch> <runtimeVersion> [<updateId>] --yes
+                                            Delete an update, or every update of a runtime version
+  gc [--keep N] [--min-age 24h] [--dry-run] Delete abandoned uploads and old updates
+  verify                                    Report the consistency errors of the bucket, exits with 1 if any
+
+Global flags:
+`
+
+var errUsage = errors.New("invalid arguments")
+
+// parseArgs parses the flags of a command wherever they are among its positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func expectArgs(args []string, min int, max int) error {
+	if len(args) < min || len(args) > max {
+		return errUsage
+	}
+	return nil
+}
+
+type command func(b backend, p printer, args []string) error
+
+var commands = map[string]command{
+	"branches": func(b backend, p printer, args []string) error {
+		if err := expectArgs(args, 0, 0); err != nil {
+			return err
+		}
+		branches, err := b.Branches()
+		if err != nil {
+			return err
+		}
+		return p.branches(branches)
+	},
+	"runtime-versions": func(b backend, p printer, args []string) error {
+		if err := expectArgs(args, 1, 1); err != nil {
+			return err
+		}
+		runtimeVersions, err := b.RuntimeVersions(args[0])
+		if err != nil {
+			return err
+		}
+		return p.runtimeVersions(runtimeVersions)
+	},
+	"updates": func(b backend, p printer, args []string) error {
+		if err := expectArgs(args, 2, 2); err != nil {
+			return err
+		}
+		updates, err := b.Updates(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		return p.updates(updates)
+	},
+	"manifest": func(b backend, p printer, args []string) error {
+		flags := flag.NewFlagSet("manifest", flag.ContinueOnError)
+		var request manifestRequest
+		flags.StringVar(&request.Platform, "platform", "", "ios or android")
+		flags.StringVar(&request.RuntimeVersion, "runtime-version", "", "Runtime version of the client")
+		flags.StringVar(&request.Channel, "channel", "", "Channel of the client, resolved to a branch by the server")
+		flags.StringVar(&request.Branch, "branch", "", "Branch to read with --direct")
+		args, err := parseArgs(flags, args)
+		if err != nil {
+			return err
+		}
+		if len(args) != 0 || (request.Platform != "ios" && request.Platform != "android") || request.RuntimeVersion == "" {
+			return errUsage
+		}
+		response, err := b.Manifest(request)
+		if err != nil {
+			return err
+		}
+		return p.manifest(response)
+	},
+	"promote": func(b backend, p printer, args []string) error {
+		flags := flag.NewFlagSet("promote", flag.ContinueOnError)
+		target := flags.String("to", "", "Branch to publish the update on")
+		args, err := parseArgs(flags, args)
+		if err != nil {
+			return err
+		}
+		if err := expectArgs(args, 3, 3); err != nil || *target == "" {
+			return errUsage
+		}
+		promoted, err := b.Promote(types.Update{Branch: args[0], RuntimeVersion: args[1], UpdateId: args[2]}, *target)
+		if err != nil {
+			return err
+		}
+		return p.published("Promoted", promoted)
+	},
+	"rollback": func(b backend, p printer, args []string) error {
+		flags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+		var request handlers.RollbackRequest
+		flags.StringVar(&request.UpdateId, "to", "", "Update of the branch to publish again, the embedded update by default")
+		flags.StringVar(&request.Platform, "platform", "", "Platform recorded with a rollback to the embedded update")
+		args, err := parseArgs(flags, args)
+		if err != nil {
+			return err
+		}
+		if err := expectArgs(args, 2, 2); err != nil {
+			return err
+		}
+		published, err := b.Rollback(args[0], args[1], request)
+		if err != nil {
+			return err
+		}
+		return p.published("Rolled back", published)
+	},
+	"export": func(b backend, p printer, args []string) error {
+		flags := flag.NewFlagSet("export", flag.ContinueOnError)
+		output := flags.String("output", "", "File to write, <branch>-<runtimeVersion>-<updateId>.tar.gz by default")
+		args, err := parseArgs(flags, args)
+		if err != nil {
+			return err
+		}
+		if err := expectArgs(args, 3, 3); err != nil {
+			return err
+		}
+		exported := types.Update{Branch: args[0], RuntimeVersion: args[1], UpdateId: args[2]}
+		path := *output
+		if path == "" {
+			path = fmt.Sprintf("%s-%s-%s.tar.gz", exported.Branch, exported.RuntimeVersion, exported.UpdateId)
+		}
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = b.Export(exported, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return err
+		}
+		return p.exported(exported, path)
+	},
+	"import": func(b backend, p printer, args []string) error {
+		flags := flag.NewFlagSet("import", flag.ContinueOnError)
+		branch := flags.String("branch", "", "Branch to publish the update on")
+		args, err := parseArgs(flags, args)
+		if err != nil {
+			return err
+		}
+		if err := expectArgs(args, 1, 1); err != nil || *branch == "" {
+			return errUsage
+		}
+		archive, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		response, err := b.Import(archive, *branch)
+		if err != nil {
+			return err
+		}
+		return p.imported(response)
+	},
+	"delete": func(b backend, p printer, args []string) error {
+		flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+		confirmed := flags.Bool("yes", false, "Confirm the deletion")
+		args, err := parseArgs(flags, args)
+		if err != nil {
+			return err
+		}
+		if err := expectArgs(args, 2, 3); err != nil {
+			return err
+		}
+		if !*confirmed {
+			return errors.New("deleting cannot be undone, add --yes to confirm")
+		}
+		if len(args) == 2 {
+			deleted, err := b.DeleteRuntimeVersion(args[0], args[1])
+			if err != nil {
+				return err
+			}
+			return p.deleted(deleted)
+		}
+		if err := b.DeleteUpdate(types.Update{Branch: args[0], RuntimeVersion: args[1], UpdateId: args[2]}); err != nil {
+			return err
+		}
+		return p.deleted(1)
+	},
+	"gc": func(b backend, p printer, args []string) error {
+		flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+		var options update.GCOptions
+		flags.IntVar(&options.KeepUpdates, "keep", 0, "Committed updates to keep per runtime version, 0 keeps them all")
+		flags.DurationVar(&options.MinAge, "min-age", 24*time.Hour, "Never delete updates younger than this")
+		flags.BoolVar(&options.DryRun, "dry-run", false, "Only report what would be deleted")
+		args, err := parseArgs(flags, args)
+		if err != nil {
+			return err
+		}
+		if err := expectArgs(args, 0, 0); err != nil || options.KeepUpdates < 0 || options.MinAge < 0 {
+			return errUsage
+		}
+		response, err := b.CollectGarbage(options)
+		if err != nil {
+			return err
+		}
+		return p.garbage(response)
+	},
+	"verify": func(b backend, p printer, args []string) error {
+		if err := expectArgs(args, 0, 0); err != nil {
+			return err
+		}
+		report, err := b.Verify()
+		if err != nil {
+			return err
+		}
+		if err := p.verification(report); err != nil {
+			return err
+		}
+		if len(report.Issues) > 0 {
+			return errIssuesFound
+		}
+		return nil
+	},
+}
+
+var errIssuesFound = errors.New("issues found")
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// run returns the exit status: 1 when the command failed or found issues, 2 on invalid arguments.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ota-admin", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	server := flags.String("server", firstNonEmpty(os.Getenv("OTA_SERVER_URL"), os.Getenv("BASE_URL")), "URL of the server, OTA_SERVER_URL by default")
+	token := flags.String("token", os.Getenv("OTA_ADMIN_TOKEN"), "Access token of a dashboard user, OTA_ADMIN_TOKEN by default. Without it, ota-admin logs in as OTA_ADMIN_USERNAME with OTA_ADMIN_PASSWORD")
+	direct := flags.Bool("direct", false, "Work on the configured bucket instead of calling a server")
+	configFile := flags.String("config", "", "YAML or TOML config file used with --direct, CONFIG_FILE_PATH by default")
+	jsonOutput := flags.Bool("json", false, "Print the results as JSON")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown command %q\n\n", flags.Arg(0))
+		flags.Usage()
+		return 2
+	}
+
+	var b backend
+	if *direct {
+		config.SetConfigFilePath(*configFile)
+		config.LoadConfig()
+		b = newDirectBackend()
+	} else {
+		apiBackend, err := newApiBackend(*server, *token, os.Getenv("OTA_ADMIN_USERNAME"), os.Getenv("OTA_ADMIN_PASSWORD"))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		b = apiBackend
+	}
+
+	err := cmd(b, printer{w: stdout, json: *jsonOutput}, flags.Args()[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(stderr, "Invalid arguments for %s\n\n", flags.Arg(0))
+		flags.Usage()
+		return 2
+	case errors.Is(err, errIssuesFound):
+		return 1
+	default:
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
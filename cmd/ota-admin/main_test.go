@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"expo-open-ota/testkit"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(t *testing.T) (*testkit.Harness, string) {
+	harness := testkit.New(t)
+	t.Setenv("USE_DASHBOARD", "true")
+	t.Setenv("ADMIN_PASSWORD", "admin")
+	t.Setenv("OTA_ADMIN_TOKEN", "")
+	t.Setenv("OTA_ADMIN_USERNAME", "")
+	t.Setenv("OTA_ADMIN_PASSWORD", "admin")
+	server := httptest.NewServer(harness.Handler())
+	t.Cleanup(server.Close)
+	return harness, server.URL
+}
+
+func runCommand(t *testing.T, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestCommandsThroughTheApi(t *testing.T) {
+	harness, server := serve(t)
+	harness.Expo.MapChannel("production", "production")
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	staging, err := harness.AddUpdate(testkit.NewUpdate("staging", "1", createdAt).WithBundle("ios", "tested").WithCommitHash("abc"))
+	assert.Nil(t, err)
+
+	status, stdout, stderr := runCommand(t, "--server", server, "--json", "updates", "staging", "1")
+	assert.Equal(t, 0, status, stderr)
+	var updates []handlers.UpdateItem
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &updates))
+	assert.Len(t, updates, 1)
+	assert.Equal(t, staging.UpdateId, updates[0].UpdateId)
+	assert.Equal(t, "abc", updates[0].CommitHash)
+
+	status, stdout, stderr = runCommand(t, "--server", server, "--json", "promote", "staging", "1", staging.UpdateId, "--to", "production")
+	assert.Equal(t, 0, status, stderr)
+	var promoted types.Update
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &promoted))
+	assert.Equal(t, "production", promoted.Branch)
+
+	status, stdout, stderr = runCommand(t, "--server", server, "manifest", "--channel", "production", "--platform", "ios", "--runtime-version", "1")
+	assert.Equal(t, 0, status, stderr)
+	assert.Contains(t, stdout, "launch asset:")
+	assert.Contains(t, stdout, "bundles%2Fios-")
+
+	status, stdout, stderr = runCommand(t, "--server", server, "branches")
+	assert.Equal(t, 0, status, stderr)
+	assert.Contains(t, stdout, "production")
+	assert.Contains(t, stdout, "staging")
+
+	status, _, stderr = runCommand(t, "--server", server, "delete", "staging", "1", staging.UpdateId)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "--yes")
+	status, _, stderr = runCommand(t, "--server", server, "delete", "staging", "1", staging.UpdateId, "--yes")
+	assert.Equal(t, 0, status, stderr)
+	status, _, stderr = runCommand(t, "--server", server, "delete", "staging", "1", staging.UpdateId, "--yes")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "404")
+
+	status, _, _ = runCommand(t, "--server", server, "promote", "staging", "1")
+	assert.Equal(t, 2, status)
+	status, _, _ = runCommand(t, "--server", server, "unknown")
+	assert.Equal(t, 2, status)
+}
+
+func TestVerifyExitsWithIssues(t *testing.T) {
+	harness, server := serve(t)
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, err := harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt).WithBundle("ios", "bundle"))
+	assert.Nil(t, err)
+
+	status, stdout, stderr := runCommand(t, "--server", server, "verify")
+	assert.Equal(t, 0, status, stderr)
+	assert.Contains(t, stdout, "0 issue(s)")
+
+	_, err = harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt.Add(time.Hour)).WithBundle("ios", "partial").Uncommitted())
+	assert.Nil(t, err)
+	status, stdout, _ = runCommand(t, "--server", server, "--json", "verify")
+	assert.Equal(t, 1, status)
+	var report update.ReindexReport
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &report))
+	assert.Len(t, report.Issues, 1)
+	assert.Equal(t, update.UncheckedUpdateIssue, report.Issues[0].Type)
+}
+
+func TestCommandsOnTheBucket(t *testing.T) {
+	serve(t)
+	// The memory bucket of the harness is not a valid configuration, --direct works on a local one
+	localBucket := &bucket.LocalBucket{BasePath: t.TempDir()}
+	t.Setenv("STORAGE_MODE", "local")
+	t.Setenv("LOCAL_BUCKET_BASE_PATH", localBucket.BasePath)
+	bucket.ResetBucketInstance()
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		_, err := testkit.NewUpdate("main", "1", createdAt.Add(time.Duration(i)*time.Hour)).WithBundle("android", "bundle").Build(localBucket)
+		assert.Nil(t, err)
+	}
+
+	status, stdout, stderr := runCommand(t, "--direct", "gc", "--keep", "2", "--dry-run")
+	assert.Equal(t, 0, status, stderr)
+	assert.Contains(t, stdout, "1 of 3 update(s) would be deleted")
+	status, stdout, stderr = runCommand(t, "--direct", "--json", "gc", "--keep", "2")
+	assert.Equal(t, 0, status, stderr)
+	var response handlers.GarbageCollectionResponse
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &response))
+	assert.Len(t, response.Deleted, 1)
+
+	status, stdout, stderr = runCommand(t, "--direct", "rollback", "main", "1", "--platform", "android")
+	assert.Equal(t, 0, status, stderr)
+	assert.True(t, strings.HasPrefix(stdout, "Rolled back as update "))
+	status, stdout, stderr = runCommand(t, "--direct", "--json", "manifest", "--branch", "main", "--platform", "android", "--runtime-version", "1")
+	assert.Equal(t, 0, status, stderr)
+	var manifest manifestResponse
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &manifest))
+	assert.Nil(t, manifest.Manifest)
+	assert.Equal(t, "rollBackToEmbedded", manifest.Directive.Type)
+
+	status, stdout, stderr = runCommand(t, "--direct", "delete", "main", "1", "--yes")
+	assert.Equal(t, 0, status, stderr)
+	assert.Contains(t, stdout, "3 update(s) deleted")
+}
+
+func TestExportAndImport(t *testing.T) {
+	harness, server := serve(t)
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	staging, err := harness.AddUpdate(testkit.NewUpdate("staging", "1", createdAt).WithBundle("ios", "tested"))
+	assert.Nil(t, err)
+	archive := filepath.Join(t.TempDir(), "update.tar.gz")
+
+	status, stdout, stderr := runCommand(t, "--server", server, "export", "staging", "1", staging.UpdateId, "--output", archive)
+	assert.Equal(t, 0, status, stderr)
+	assert.Contains(t, stdout, "to "+archive)
+	status, stdout, stderr = runCommand(t, "--server", server, "--json", "import", archive, "--branch", "production")
+	assert.Equal(t, 0, status, stderr)
+	var response handlers.ImportUpdateResponse
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &response))
+	assert.Equal(t, "production", response.Update.Branch)
+	assert.Equal(t, staging.UpdateId, response.Source.UpdateId)
+
+	missing := filepath.Join(t.TempDir(), "missing.tar.gz")
+	status, _, stderr = runCommand(t, "--server", server, "export", "staging", "1", "1", "--output", missing)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "404")
+	assert.NoFileExists(t, missing)
+	status, _, _ = runCommand(t, "--server", server, "import", archive)
+	assert.Equal(t, 2, status)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// printer writes the results as indented JSON with --json, as aligned columns otherwise.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func (p printer) print(value interface{}, table func(w io.Writer)) error {
+	if p.json {
+		encoder := json.NewEncoder(p.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func (p printer) branches(branches []handlers.BranchMapping) error {
+	return p.print(branches, func(w io.Writer) {
+		fmt.Fprintln(w, "BRANCH\tCHANNEL")
+		for _, branch := range branches {
+			channel := ""
+			if branch.ReleaseChannel != nil {
+				channel = *branch.ReleaseChannel
+			}
+			fmt.Fprintf(w, "%s\t%s\n", branch.BranchName, orDash(channel))
+		}
+	})
+}
+
+func (p printer) runtimeVersions(runtimeVersions []bucket.RuntimeVersionWithStats) error {
+	return p.print(runtimeVersions, func(w io.Writer) {
+		fmt.Fprintln(w, "RUNTIME VERSION\tUPDATES\tCREATED AT\tLAST UPDATED AT")
+		for _, rv := range runtimeVersions {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", rv.RuntimeVersion, rv.NumberOfUpdates, rv.CreatedAt, rv.LastUpdatedAt)
+		}
+	})
+}
+
+func (p printer) updates(updates []handlers.UpdateItem) error {
+	return p.print(updates, func(w io.Writer) {
+		fmt.Fprintln(w, "UPDATE ID\tUUID\tCREATED AT\tPLATFORM\tCOMMIT")
+		for _, u := range updates {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", u.UpdateId, orDash(u.UpdateUUID), u.CreatedAt, orDash(u.Platform), orDash(u.CommitHash))
+		}
+	})
+}
+
+func (p printer) manifest(response manifestResponse) error {
+	return p.print(response, func(w io.Writer) {
+		if response.Directive != nil {
+			fmt.Fprintf(w, "directive:\t%s\n", response.Directive.Type)
+			for key, value := range response.Directive.Parameters {
+				fmt.Fprintf(w, "%s:\t%v\n", key, value)
+			}
+			return
+		}
+		if response.Manifest == nil {
+			fmt.Fprintln(w, "no manifest")
+			return
+		}
+		manifest := response.Manifest
+		fmt.Fprintf(w, "id:\t%s\n", manifest.Id)
+		fmt.Fprintf(w, "created at:\t%s\n", manifest.CreatedAt)
+		fmt.Fprintf(w, "runtime version:\t%s\n", manifest.RunTimeVersion)
+		fmt.Fprintf(w, "launch asset:\t%s\n", manifest.LaunchAsset.Url)
+		fmt.Fprintf(w, "assets:\t%d\n", len(manifest.Assets))
+		for _, asset := range manifest.Assets {
+			fmt.Fprintf(w, "\t%s (%s)\n", asset.Key, asset.ContentType)
+		}
+	})
+}
+
+func (p printer) published(action string, published types.Update) error {
+	return p.print(published, func(w io.Writer) {
+		fmt.Fprintf(w, "%s as update %s of %s (runtime version %s)\n", action, published.UpdateId, published.Branch, published.RuntimeVersion)
+	})
+}
+
+func (p printer) exported(exported types.Update, path string) error {
+	return p.print(map[string]string{"archive": path}, func(w io.Writer) {
+		fmt.Fprintf(w, "Exported update %s of %s (runtime version %s) to %s\n", exported.UpdateId, exported.Branch, exported.RuntimeVersion, path)
+	})
+}
+
+func (p printer) imported(response handlers.ImportUpdateResponse) error {
+	return p.print(response, func(w io.Writer) {
+		source, imported := response.Source, response.Update
+		fmt.Fprintf(w, "Imported update %s of %s as update %s of %s (runtime version %s)\n", source.UpdateId, source.Branch, imported.UpdateId, imported.Branch, imported.RuntimeVersion)
+	})
+}
+
+func (p printer) deleted(deleted int) error {
+	return p.print(map[string]int{"deletedCount": deleted}, func(w io.Writer) {
+		fmt.Fprintf(w, "%d update(s) deleted\n", deleted)
+	})
+}
+
+func (p printer) garbage(response handlers.GarbageCollectionResponse) error {
+	return p.print(response, func(w io.Writer) {
+		verb := "deleted"
+		if response.DryRun {
+			verb = "would be deleted"
+		}
+		if len(response.Deleted) > 0 {
+			fmt.Fprintln(w, "BRANCH\tRUNTIME VERSION\tUPDATE ID\tREASON")
+			for _, deletion := range response.Deleted {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", deletion.Branch, deletion.RuntimeVersion, deletion.UpdateId, deletion.Reason)
+			}
+		}
+		fmt.Fprintf(w, "%d of %d update(s) %s, %d expired upload session(s) swept in %s\n", len(response.Deleted), response.Scanned, verb, response.SweptUploadSessions, response.Duration)
+	})
+}
+
+func (p printer) verification(report update.ReindexReport) error {
+	return p.print(report, func(w io.Writer) {
+		if len(report.Issues) > 0 {
+			fmt.Fprintln(w, "ISSUE\tBRANCH\tRUNTIME VERSION\tUPDATE ID\tFILE\tMESSAGE")
+			for _, issue := range report.Issues {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", issue.Type, issue.Branch, orDash(issue.RuntimeVersion), orDash(issue.UpdateId), orDash(issue.File), issue.Message)
+			}
+		}
+		fmt.Fprintf(w, "%d branch(es), %d runtime version(s), %d update(s), %d committed, %d issue(s) in %s\n",
+			report.Branches, report.RuntimeVersions, report.Updates, report.CheckedUpdates, len(report.Issues), report.Duration)
+	})
+}
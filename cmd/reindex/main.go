@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/update"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Rebuilds every cached listing, manifest and the metadata store from the bucket, then prints
+// the consistency report as JSON. Exits with status 1 if any issue was found.
+func main() {
+	quiet := flag.Bool("quiet", false, "Do not print progress")
+	configFile := flag.String("config", "", "YAML or TOML config file, CONFIG_FILE_PATH by default")
+	flag.Parse()
+	config.SetConfigFilePath(*configFile)
+	config.LoadConfig()
+	report, err := update.DefaultManager().RebuildIndex(func(progress update.ReindexProgress) {
+		if *quiet {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\rbranches: %d  runtime versions: %d  updates: %d  manifests: %d",
+			progress.Branches, progress.RuntimeVersions, progress.Updates, progress.WarmedManifests)
+	})
+	if !*quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		log.Fatalf("Error rebuilding index: %v", err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatalf("Error printing report: %v", err)
+	}
+	if len(report.Issues) > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,16 +1,34 @@
 package config
 
 import (
+	"errors"
 	"expo-open-ota/internal/helpers"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
-func validateStorageMode(storageMode string) bool {
-	return storageMode == "local" || storageMode == "s3"
+func validateStorageMode(storageMode string) error {
+	if storageMode != "local" && storageMode != "s3" && storageMode != "memory" {
+		return fmt.Errorf("invalid STORAGE_MODE: %s", storageMode)
+	}
+	return nil
+}
+
+// validateStorageReplicas checks the form of the replica locations, the buckets themselves are only reached once serving.
+func validateStorageReplicas(replicas string) error {
+	var errs []error
+	for _, replica := range splitList(replicas) {
+		if !strings.HasPrefix(replica, "local:") && !strings.HasPrefix(replica, "s3://") {
+			errs = append(errs, fmt.Errorf("invalid STORAGE_REPLICAS entry %q, expected local:<folder> or s3://<bucket>[/<prefix>][?region=<region>]", replica))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func GetPort() string {
@@ -21,30 +39,146 @@ func GetPort() string {
 	return port
 }
 
-func validateBucketParams(storageMode string) bool {
+func validateBucketParams(get func(string) string, storageMode string) error {
 	switch storageMode {
 	case "s3":
-		bucketName := GetEnv("S3_BUCKET_NAME")
-		if bucketName == "" {
-			log.Printf("S3_BUCKET_NAME not set")
-			return false
+		var errs []error
+		if get("S3_BUCKET_NAME") == "" {
+			errs = append(errs, errors.New("S3_BUCKET_NAME not set"))
 		}
-		region := GetEnv("AWS_REGION")
-		if region == "" {
-			log.Printf("AWS_REGION not set")
-			return false
+		if get("AWS_REGION") == "" {
+			errs = append(errs, errors.New("AWS_REGION not set"))
 		}
+		return errors.Join(errs...)
 	case "local":
 		// Already handled by default values
-		return true
+		return nil
+	case "memory":
+		return nil
+	default:
+		return fmt.Errorf("no bucket parameters for STORAGE_MODE %s", storageMode)
+	}
+}
+
+func validateKeysStorageParams(get func(string) string, keysStorageType string) error {
+	var required []string
+	switch keysStorageType {
+	case "local":
+		required = []string{"PUBLIC_LOCAL_EXPO_KEY_PATH", "PRIVATE_LOCAL_EXPO_KEY_PATH"}
+	case "environment":
+		required = []string{"PUBLIC_EXPO_KEY_B64", "PRIVATE_EXPO_KEY_B64"}
+	case "aws-secrets-manager":
+		required = []string{"AWSSM_EXPO_PUBLIC_KEY_SECRET_ID", "AWSSM_EXPO_PRIVATE_KEY_SECRET_ID", "AWS_REGION"}
+	default:
+		return fmt.Errorf("invalid KEYS_STORAGE_TYPE: %s", keysStorageType)
+	}
+	var errs []error
+	for _, key := range required {
+		if get(key) == "" {
+			errs = append(errs, fmt.Errorf("%s must be set when KEYS_STORAGE_TYPE is %s", key, keysStorageType))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateCDNParams(get func(string) string, cloudfrontDomain string) error {
+	if cloudfrontDomain == "" {
+		return nil
+	}
+	var errs []error
+	if !helpers.IsValidURL(cloudfrontDomain) {
+		errs = append(errs, fmt.Errorf("invalid CLOUDFRONT_DOMAIN: %s", cloudfrontDomain))
+	}
+	if get("CLOUDFRONT_KEY_PAIR_ID") == "" {
+		errs = append(errs, errors.New("CLOUDFRONT_KEY_PAIR_ID must be set when CLOUDFRONT_DOMAIN is set"))
+	}
+	privateKey := map[string]string{
+		"local":               "PRIVATE_CLOUDFRONT_KEY_PATH",
+		"environment":         "PRIVATE_CLOUDFRONT_KEY_B64",
+		"aws-secrets-manager": "AWSSM_CLOUDFRONT_PRIVATE_KEY_SECRET_ID",
+	}[get("KEYS_STORAGE_TYPE")]
+	if privateKey != "" && get(privateKey) == "" {
+		errs = append(errs, fmt.Errorf("%s must be set when CLOUDFRONT_DOMAIN is set", privateKey))
+	}
+	return errors.Join(errs...)
+}
+
+func validateCacheParams(get func(string) string, cacheMode string) error {
+	switch cacheMode {
+	case "", "local":
+		return nil
+	case "redis", "layered":
+		switch get("REDIS_MODE") {
+		case "standalone":
+			if get("REDIS_HOST") == "" || get("REDIS_PORT") == "" {
+				return errors.New("REDIS_HOST and REDIS_PORT must be set")
+			}
+		case "sentinel":
+			if get("REDIS_SENTINEL_MASTER_NAME") == "" || get("REDIS_SENTINEL_ADDRS") == "" {
+				return errors.New("REDIS_SENTINEL_MASTER_NAME and REDIS_SENTINEL_ADDRS must be set")
+			}
+		case "cluster":
+			if get("REDIS_CLUSTER_ADDRS") == "" {
+				return errors.New("REDIS_CLUSTER_ADDRS must be set")
+			}
+		default:
+			return fmt.Errorf("invalid REDIS_MODE: %s", get("REDIS_MODE"))
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid CACHE_MODE: %s", cacheMode)
+	}
+}
+
+func validateMetadataStoreParams(get func(string) string, storeType string) error {
+	switch storeType {
+	case "":
+		return nil
+	case "sqlite", "postgres":
+		if get("METADATA_STORE_DSN") == "" {
+			return errors.New("METADATA_STORE_DSN must be set")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid METADATA_STORE_TYPE: %s", storeType)
+	}
+}
+
+func validateAuditLogParams(get func(string) string, sink string) error {
+	switch sink {
+	case "bucket", "log", "none":
+		return nil
+	case "sql":
+		if get("METADATA_STORE_TYPE") == "" {
+			return errors.New("AUDIT_LOG_SINK=sql requires METADATA_STORE_TYPE to be set")
+		}
+		return nil
 	default:
-		return false
+		return fmt.Errorf("invalid AUDIT_LOG_SINK: %s", sink)
 	}
-	return true
 }
 
-func validateBaseUrl(baseUrl string) bool {
-	return baseUrl != "" && helpers.IsValidURL(baseUrl)
+func validateOIDCParams(get func(string) string, issuerUrl string) error {
+	if issuerUrl == "" {
+		return nil
+	}
+	var errs []error
+	if get("OIDC_CLIENT_ID") == "" {
+		errs = append(errs, errors.New("OIDC_CLIENT_ID must be set"))
+	}
+	switch get("OIDC_DEFAULT_ROLE") {
+	case "", "viewer", "publisher", "admin":
+	default:
+		errs = append(errs, fmt.Errorf("invalid OIDC_DEFAULT_ROLE: %s", get("OIDC_DEFAULT_ROLE")))
+	}
+	return errors.Join(errs...)
+}
+
+func validateBaseUrl(baseUrl string) error {
+	if baseUrl == "" || !helpers.IsValidURL(baseUrl) {
+		return fmt.Errorf("invalid BASE_URL: %s", baseUrl)
+	}
+	return nil
 }
 
 func IsTestMode() bool {
@@ -59,35 +193,54 @@ func resolveDefaultBaseUrl() string {
 	return "http://localhost:" + port
 }
 
+// Validate checks every setting resolved by get and reports all the problems found at once.
+func Validate(get func(string) string) error {
+	_, parseErr := parse(get)
+	errs := []error{
+		parseErr,
+		validateBaseUrl(get("BASE_URL")),
+		validateStorageMode(get("STORAGE_MODE")),
+		validateStorageReplicas(get("STORAGE_REPLICAS")),
+		validateKeysStorageParams(get, get("KEYS_STORAGE_TYPE")),
+		validateCDNParams(get, get("CLOUDFRONT_DOMAIN")),
+		validateCacheParams(get, get("CACHE_MODE")),
+		validateMetadataStoreParams(get, get("METADATA_STORE_TYPE")),
+		validateAuditLogParams(get, get("AUDIT_LOG_SINK")),
+		validateOIDCParams(get, get("OIDC_ISSUER_URL")),
+	}
+	if validateStorageMode(get("STORAGE_MODE")) == nil {
+		errs = append(errs, validateBucketParams(get, get("STORAGE_MODE")))
+	}
+	for _, key := range []string{"EXPO_ACCESS_TOKEN", "EXPO_APP_ID", "JWT_SECRET"} {
+		if get(key) == "" {
+			errs = append(errs, fmt.Errorf("%s not set", key))
+		}
+	}
+	return errors.Join(errs...)
+}
 
-func LoadConfig() {
+// Load reads the .env file and the config file named by CONFIG_FILE_PATH, then validates the settings.
+func Load() error {
 	err := godotenv.Load()
 	if err != nil {
 		log.Printf("No .env file found, continuing with runtime environment variables.")
 	}
-	storageMode := GetEnv("STORAGE_MODE")
-	if !validateStorageMode(storageMode) {
-		log.Fatalf("Invalid STORAGE_MODE: %s", storageMode)
-	}
-	bucketParamsValid := validateBucketParams(storageMode)
-	if !bucketParamsValid {
-		log.Fatalf("Invalid bucket parameters")
-	}
-	baseUrl := GetEnv("BASE_URL")
-	if !validateBaseUrl(baseUrl) {
-		log.Fatalf("Invalid BASE_URL: %s", baseUrl)
+	if err := loadConfigFile(GetEnv("CONFIG_FILE_PATH")); err != nil {
+		return err
 	}
-	expoToken := GetEnv("EXPO_ACCESS_TOKEN")
-	if expoToken == "" {
-		log.Fatalf("EXPO_ACCESS_TOKEN not set")
-	}
-	expoAppId := GetEnv("EXPO_APP_ID")
-	if expoAppId == "" {
-		log.Fatalf("EXPO_APP_ID not set")
+	return Validate(GetEnv)
+}
+
+// SetConfigFilePath points CONFIG_FILE_PATH to the file given on the command line, if any.
+func SetConfigFilePath(path string) {
+	if path != "" {
+		os.Setenv("CONFIG_FILE_PATH", path)
 	}
-	jwtSecret := GetEnv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatalf("JWT_SECRET not set")
+}
+
+func LoadConfig() {
+	if err := Load(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 }
 
@@ -100,17 +253,57 @@ var DefaultEnvValues = map[string]string{
 	"KEYS_STORAGE_TYPE":           "local",
 	"JWT_SECRET":                  "",
 	"AWS_REGION":                  "eu-west-3",
+	"LOCAL_CACHE_MAX_ENTRIES":     "10000",
+	"LOCAL_CACHE_MAX_BYTES":       "268435456",
+	"LOCAL_CACHE_SWEEP_INTERVAL":  "60",
+	"LAYERED_CACHE_L1_TTL":        "5",
+	"REDIS_MODE":                  "standalone",
+	"REDIS_DB":                    "0",
+	"REDIS_KEY_PREFIX":            "expo-open-ota",
+	"API_KEYS_FILE_PATH":          "./apiKeys.json",
+	"USERS_FILE_PATH":             "./users.json",
+	"AUDIT_LOG_SINK":              "bucket",
+	"WEBHOOKS_FILE_PATH":          "./webhooks.json",
+	"WEBHOOKS_MAX_ATTEMPTS":       "5",
+	"WEBHOOKS_RETRY_DELAY_MS":     "1000",
+	"UPLOAD_SESSIONS_TTL_MINUTES": "60",
+	"UPLOAD_SWEEP_INTERVAL":       "300",
+	"LOCAL_UPLOAD_MAX_BYTES":      "536870912",
+	"ARCHIVE_MAX_BYTES":           "536870912",
+	"ARCHIVE_PUBLIC_KEY_PATH":     "",
+	"STORAGE_REPLICAS":            "",
+	"STORAGE_READ_TIMEOUT_MS":     "2000",
+	"STORAGE_REPLICATION_RETRIES": "5",
+	"SERVER_READ_HEADER_TIMEOUT":  "10",
+	"SERVER_READ_TIMEOUT":         "600",
+	"SERVER_WRITE_TIMEOUT":        "600",
+	"SERVER_IDLE_TIMEOUT":         "120",
+	"SERVER_SHUTDOWN_DELAY":       "5",
+	"SERVER_SHUTDOWN_TIMEOUT":     "20",
+	"MAX_REQUEST_BODY_BYTES":      "1048576",
+	"EXPO_GRAPHQL_URL":            "https://api.expo.dev/graphql",
+	"OIDC_SCOPES":                 "openid profile email",
+	"OIDC_GROUPS_CLAIM":           "groups",
+	"APPS_CONFIG_PATH":            "",
+	"CONFIG_FILE_PATH":            "",
 }
 
 
 func GetEnv(key string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		defaultValue := DefaultEnvValues[key]
-		if defaultValue != "" {
-			return defaultValue
-		}
-		return ""
+	return resolve(currentFileValues(), key)
+}
+
+// GetIntEnv reads an integer setting. A malformed value, or one below min, is logged and replaced by the
+// default. A setting without value nor default is 0.
+func GetIntEnv(key string, min int64) int64 {
+	raw := GetEnv(key)
+	if raw == "" {
+		return 0
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || value < min {
+		log.Printf("Invalid %s: %s, falling back to %s", key, raw, DefaultEnvValues[key])
+		value, _ = strconv.ParseInt(DefaultEnvValues[key], 10, 64)
 	}
 	return value
 }
@@ -14,53 +14,130 @@ func setup(t *testing2.T) func() {
 func TestNotValidStorage(t *testing2.T) {
 	teardown := setup(t)
 	defer teardown()
-	isValid := validateStorageMode("bag")
-	assert.False(t, isValid)
+	assert.Error(t, validateStorageMode("bag"))
 }
 
 func TestValidLocalStorage(t *testing2.T) {
 	teardown := setup(t)
 	defer teardown()
-	isValid := validateStorageMode("local")
-	assert.True(t, isValid)
+	assert.NoError(t, validateStorageMode("local"))
+}
+
+func TestValidMemoryStorage(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	assert.NoError(t, validateStorageMode("memory"))
+	assert.NoError(t, validateBucketParams(func(string) string { return "" }, "memory"))
 }
 
 func TestNotValidEmptyBaseUrl(t *testing2.T) {
 	teardown := setup(t)
 	defer teardown()
-	isValid := validateBaseUrl("")
-	assert.False(t, isValid)
+	assert.Error(t, validateBaseUrl(""))
 }
 
 func TestNotValidBaseUrl(t *testing2.T) {
 	teardown := setup(t)
 	defer teardown()
-	isValid := validateBaseUrl("test.com")
-	assert.False(t, isValid)
+	assert.Error(t, validateBaseUrl("test.com"))
 }
 
 func TestMissingBucketParamsForS3(t *testing2.T) {
 	teardown := setup(t)
 	defer teardown()
 	os.Setenv("S3_BUCKET_NAME", "")
-	bucketParams := validateBucketParams("s3")
-	assert.False(t, bucketParams)
+	assert.Error(t, validateBucketParams(GetEnv, "s3"))
 }
 
 func TestMissingBucketParamsForLocal(t *testing2.T) {
 	teardown := setup(t)
 	defer teardown()
 	os.Setenv("LOCAL_BUCKET_BASE_PATH", "")
-	bucketParams := validateBucketParams("local")
 	// Should be set as ./updates by default config values
-	assert.True(t, bucketParams)
+	assert.NoError(t, validateBucketParams(GetEnv, "local"))
+}
+
+func TestValidCacheParams(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	assert.NoError(t, validateCacheParams(GetEnv, "local"))
+	assert.Error(t, validateCacheParams(GetEnv, "memcached"))
+	os.Setenv("REDIS_MODE", "standalone")
+	os.Setenv("REDIS_HOST", "")
+	assert.Error(t, validateCacheParams(GetEnv, "redis"))
+	os.Setenv("REDIS_HOST", "localhost")
+	os.Setenv("REDIS_PORT", "6379")
+	assert.NoError(t, validateCacheParams(GetEnv, "redis"))
+	os.Setenv("REDIS_MODE", "sentinel")
+	os.Setenv("REDIS_SENTINEL_MASTER_NAME", "mymaster")
+	os.Setenv("REDIS_SENTINEL_ADDRS", "")
+	assert.Error(t, validateCacheParams(GetEnv, "layered"))
+	os.Setenv("REDIS_SENTINEL_ADDRS", "localhost:26379,localhost:26380")
+	assert.NoError(t, validateCacheParams(GetEnv, "layered"))
+	os.Setenv("REDIS_MODE", "cluster")
+	os.Setenv("REDIS_CLUSTER_ADDRS", "")
+	assert.Error(t, validateCacheParams(GetEnv, "redis"))
+	os.Setenv("REDIS_MODE", "unknown")
+	assert.Error(t, validateCacheParams(GetEnv, "redis"))
+	os.Unsetenv("REDIS_MODE")
+	os.Unsetenv("REDIS_HOST")
+	os.Unsetenv("REDIS_PORT")
+	os.Unsetenv("REDIS_SENTINEL_MASTER_NAME")
+	os.Unsetenv("REDIS_SENTINEL_ADDRS")
+	os.Unsetenv("REDIS_CLUSTER_ADDRS")
+}
+
+func TestValidMetadataStoreParams(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	assert.NoError(t, validateMetadataStoreParams(GetEnv, ""))
+	assert.Error(t, validateMetadataStoreParams(GetEnv, "mysql"))
+	os.Setenv("METADATA_STORE_DSN", "")
+	assert.Error(t, validateMetadataStoreParams(GetEnv, "sqlite"))
+	os.Setenv("METADATA_STORE_DSN", "./metadata.db")
+	assert.NoError(t, validateMetadataStoreParams(GetEnv, "sqlite"))
+	assert.NoError(t, validateMetadataStoreParams(GetEnv, "postgres"))
+	os.Unsetenv("METADATA_STORE_DSN")
+}
+
+func TestValidateAuditLogParams(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	assert.NoError(t, validateAuditLogParams(GetEnv, "bucket"))
+	assert.NoError(t, validateAuditLogParams(GetEnv, "none"))
+	assert.Error(t, validateAuditLogParams(GetEnv, "kafka"))
+	assert.Error(t, validateAuditLogParams(GetEnv, "sql"))
+	os.Setenv("METADATA_STORE_TYPE", "sqlite")
+	assert.NoError(t, validateAuditLogParams(GetEnv, "sql"))
+	os.Unsetenv("METADATA_STORE_TYPE")
+}
+
+func TestValidateOIDCParams(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	assert.NoError(t, validateOIDCParams(GetEnv, ""))
+	os.Setenv("OIDC_CLIENT_ID", "")
+	assert.Error(t, validateOIDCParams(GetEnv, "https://idp.example.com"))
+	os.Setenv("OIDC_CLIENT_ID", "expo-open-ota")
+	assert.NoError(t, validateOIDCParams(GetEnv, "https://idp.example.com"))
+	os.Setenv("OIDC_DEFAULT_ROLE", "owner")
+	assert.Error(t, validateOIDCParams(GetEnv, "https://idp.example.com"))
+	os.Setenv("OIDC_DEFAULT_ROLE", "viewer")
+	assert.NoError(t, validateOIDCParams(GetEnv, "https://idp.example.com"))
+	os.Unsetenv("OIDC_CLIENT_ID")
+	os.Unsetenv("OIDC_DEFAULT_ROLE")
+}
+
+func TestValidateStorageReplicas(t *testing2.T) {
+	assert.NoError(t, validateStorageReplicas(""))
+	assert.NoError(t, validateStorageReplicas("local:/data/replica, s3://ota-updates-eu?region=eu-west-1"))
+	assert.Error(t, validateStorageReplicas("s3://ota-updates-eu,gs://ota-updates-us"))
 }
 
 func TestValidBaseUrl(t *testing2.T) {
 	teardown := setup(t)
 	defer teardown()
-	isValid := validateBaseUrl("http://test.com")
-	assert.True(t, isValid)
+	assert.NoError(t, validateBaseUrl("http://test.com"))
 }
 
 func TestNotValidConfigStorage(t *testing2.T) {
@@ -131,3 +208,14 @@ func TestTestMode(t *testing2.T) {
 	testMode := IsTestMode()
 	assert.True(t, testMode)
 }
+
+func TestGetIntEnv(t *testing2.T) {
+	t.Setenv("LOCAL_CACHE_MAX_ENTRIES", "0")
+	assert.Equal(t, int64(0), GetIntEnv("LOCAL_CACHE_MAX_ENTRIES", 0))
+	t.Setenv("UPLOAD_SESSIONS_TTL_MINUTES", "0")
+	assert.Equal(t, int64(60), GetIntEnv("UPLOAD_SESSIONS_TTL_MINUTES", 1))
+	t.Setenv("UPLOAD_SESSIONS_TTL_MINUTES", "ten")
+	assert.Equal(t, int64(60), GetIntEnv("UPLOAD_SESSIONS_TTL_MINUTES", 1))
+	t.Setenv("UPLOAD_SESSIONS_TTL_MINUTES", "10")
+	assert.Equal(t, int64(10), GetIntEnv("UPLOAD_SESSIONS_TTL_MINUTES", 1))
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileValues holds the settings read from the config file, keyed by environment variable
+var fileValues atomic.Pointer[map[string]string]
+
+var reloadMutex sync.Mutex
+
+const redacted = "[REDACTED]"
+
+func currentFileValues() map[string]string {
+	if values := fileValues.Load(); values != nil {
+		return *values
+	}
+	return nil
+}
+
+// resolve reads a setting from the environment first, then from values, then from DefaultEnvValues.
+func resolve(values map[string]string, key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	if value := values[key]; value != "" {
+		return value
+	}
+	return DefaultEnvValues[key]
+}
+
+func lookup(values map[string]string) func(string) string {
+	return func(key string) string {
+		return resolve(values, key)
+	}
+}
+
+// readConfigFile reads a YAML or TOML file, chosen by extension, into settings keyed by environment variable.
+func readConfigFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	var document map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &document)
+	case ".toml":
+		err = toml.Unmarshal(content, &document)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s: expected .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return flattenDocument(document)
+}
+
+// flattenDocument checks the sections and keys of the file against Config and converts the values to their
+// environment form, reporting every unknown key and mistyped value at once.
+func flattenDocument(document map[string]interface{}) (map[string]string, error) {
+	known := map[string]setting{}
+	sections := map[string]bool{}
+	for _, s := range settings {
+		known[s.path()] = s
+		sections[s.section] = true
+	}
+	values := map[string]string{}
+	var errs []error
+	for section, content := range document {
+		if !sections[section] {
+			errs = append(errs, fmt.Errorf("unknown section %s", section))
+			continue
+		}
+		keys, ok := content.(map[string]interface{})
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s must be a table of settings", section))
+			continue
+		}
+		for key, value := range keys {
+			s, ok := known[section+"."+key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("unknown setting %s.%s", section, key))
+				continue
+			}
+			if value == nil {
+				continue
+			}
+			raw, err := formatValue(s, value)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			values[s.env] = raw
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func formatValue(s setting, value interface{}) (string, error) {
+	switch s.kind {
+	case reflect.String:
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+		return "", fmt.Errorf("%s must be a string", s.path())
+	case reflect.Int:
+		switch number := value.(type) {
+		case int:
+			return strconv.Itoa(number), nil
+		case int64:
+			return strconv.FormatInt(number, 10), nil
+		}
+		return "", fmt.Errorf("%s must be an integer", s.path())
+	case reflect.Bool:
+		if enabled, ok := value.(bool); ok {
+			return strconv.FormatBool(enabled), nil
+		}
+		return "", fmt.Errorf("%s must be true or false", s.path())
+	case reflect.Slice:
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			return "", fmt.Errorf("%s must be a list of strings", s.path())
+		}
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			text, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("%s must be a list of strings", s.path())
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("%s has an unsupported type", s.path())
+}
+
+// loadConfigFile replaces the settings read from the config file, none when path is empty.
+func loadConfigFile(path string) error {
+	values := map[string]string{}
+	if path != "" {
+		read, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		values = read
+	}
+	fileValues.Store(&values)
+	return nil
+}
+
+// Reload reads the config file again and applies the settings that can change while the server runs. Other
+// changed settings are only reported, they are applied on the next start. Nothing is applied if the file
+// or the resulting configuration is invalid.
+func Reload() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	path := GetEnv("CONFIG_FILE_PATH")
+	if path == "" {
+		return errors.New("no config file to reload, set CONFIG_FILE_PATH or --config")
+	}
+	read, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	current := currentFileValues()
+	next := map[string]string{}
+	for key, value := range current {
+		next[key] = value
+	}
+	var applied []string
+	for _, s := range settings {
+		if read[s.env] == current[s.env] {
+			continue
+		}
+		if !s.reload {
+			log.Printf("[Config] %s changed, restart the server to apply it", s.path())
+			continue
+		}
+		if value, ok := read[s.env]; ok {
+			next[s.env] = value
+		} else {
+			delete(next, s.env)
+		}
+		if os.Getenv(s.env) != "" {
+			log.Printf("[Config] %s changed but is overridden by %s", s.path(), s.env)
+			continue
+		}
+		applied = append(applied, s.path())
+	}
+	if err := Validate(lookup(next)); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	fileValues.Store(&next)
+	if len(applied) == 0 {
+		log.Printf("[Config] Reloaded %s, nothing to apply", path)
+	} else {
+		log.Printf("[Config] Reloaded %s, applied %s", path, strings.Join(applied, ", "))
+	}
+	return nil
+}
+
+// Print writes the settings in effect as a YAML config file, secrets redacted.
+func Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	var section *yaml.Node
+	for _, s := range settings {
+		if section == nil || root.Content[len(root.Content)-2].Value != s.section {
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.section}, section)
+		}
+		value := printedValue(s, GetEnv(s.env))
+		section.Content = append(section.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.key}, value)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func printedValue(s setting, raw string) *yaml.Node {
+	if s.secret && raw != "" {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: redacted}
+	}
+	switch s.kind {
+	case reflect.Int:
+		if raw == "" {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+		}
+		if _, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: raw}
+		}
+	case reflect.Bool:
+		if raw == "" {
+			raw = "false"
+		}
+		if enabled, err := strconv.ParseBool(raw); err == nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(enabled)}
+		}
+	case reflect.Slice:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range splitList(raw) {
+			list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+		}
+		return list
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: raw}
+}
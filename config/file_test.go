@@ -0,0 +1,195 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func useConfigFile(t *testing.T, path string) {
+	t.Setenv("CONFIG_FILE_PATH", path)
+	assert.Nil(t, loadConfigFile(path))
+	t.Cleanup(func() {
+		loadConfigFile("")
+	})
+}
+
+func validSettings(t *testing.T) {
+	t.Setenv("BASE_URL", "http://test.com")
+	t.Setenv("EXPO_ACCESS_TOKEN", "test")
+	t.Setenv("EXPO_APP_ID", "test")
+	t.Setenv("JWT_SECRET", "test")
+	t.Setenv("STORAGE_MODE", "")
+	t.Setenv("KEYS_STORAGE_TYPE", "")
+}
+
+func TestYamlConfigFile(t *testing.T) {
+	t.Setenv("STORAGE_MODE", "")
+	t.Setenv("S3_BUCKET_NAME", "")
+	t.Setenv("REDIS_PORT", "")
+	t.Setenv("REDIS_SENTINEL_ADDRS", "")
+	useConfigFile(t, writeConfigFile(t, "config.yaml", `
+storage:
+  mode: s3
+  s3BucketName: updates
+redis:
+  port: 6380
+  useTls: true
+  sentinelAddrs: [sentinel-1:26379, sentinel-2:26379]
+`))
+	assert.Equal(t, "s3", GetEnv("STORAGE_MODE"))
+	assert.Equal(t, "updates", GetEnv("S3_BUCKET_NAME"))
+	assert.Equal(t, "6380", GetEnv("REDIS_PORT"))
+	assert.Equal(t, "sentinel-1:26379,sentinel-2:26379", GetEnv("REDIS_SENTINEL_ADDRS"))
+	// Settings missing from the file keep their default
+	assert.Equal(t, "eu-west-3", GetEnv("AWS_REGION"))
+
+	parsed, err := Current()
+	assert.Nil(t, err)
+	assert.Equal(t, 6380, parsed.Redis.Port)
+	assert.True(t, parsed.Redis.UseTLS)
+	assert.Equal(t, []string{"sentinel-1:26379", "sentinel-2:26379"}, parsed.Redis.SentinelAddrs)
+	assert.Equal(t, 10000, parsed.Cache.LocalMaxEntries)
+}
+
+func TestEnvironmentOverridesConfigFile(t *testing.T) {
+	useConfigFile(t, writeConfigFile(t, "config.toml", `
+[storage]
+mode = "s3"
+s3BucketName = "updates"
+
+[webhooks]
+maxAttempts = 3
+`))
+	assert.Equal(t, "3", GetEnv("WEBHOOKS_MAX_ATTEMPTS"))
+	t.Setenv("S3_BUCKET_NAME", "other-updates")
+	assert.Equal(t, "other-updates", GetEnv("S3_BUCKET_NAME"))
+}
+
+func TestConfigFileSchemaErrorsAreAggregated(t *testing.T) {
+	_, err := readConfigFile(writeConfigFile(t, "config.yaml", `
+server:
+  baseUrl: http://test.com
+  basePath: /ota
+redis:
+  port: "6379"
+  useTls: yes please
+queue:
+  size: 3
+`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown setting server.basePath")
+	assert.Contains(t, err.Error(), "redis.port must be an integer")
+	assert.Contains(t, err.Error(), "redis.useTls must be true or false")
+	assert.Contains(t, err.Error(), "unknown section queue")
+
+	_, err = readConfigFile(writeConfigFile(t, "config.json", `{}`))
+	assert.NotNil(t, err)
+}
+
+func TestValidateAggregatesErrors(t *testing.T) {
+	validSettings(t)
+	assert.Nil(t, Validate(GetEnv))
+
+	t.Setenv("STORAGE_MODE", "bag")
+	t.Setenv("CACHE_MODE", "memcached")
+	t.Setenv("KEYS_STORAGE_TYPE", "vault")
+	t.Setenv("LOCAL_CACHE_MAX_ENTRIES", "many")
+	t.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.example.com")
+	t.Setenv("CLOUDFRONT_KEY_PAIR_ID", "")
+	t.Setenv("JWT_SECRET", "")
+	err := Validate(GetEnv)
+	assert.NotNil(t, err)
+	for _, expected := range []string{
+		"invalid STORAGE_MODE: bag",
+		"invalid CACHE_MODE: memcached",
+		"invalid KEYS_STORAGE_TYPE: vault",
+		"LOCAL_CACHE_MAX_ENTRIES (cache.localMaxEntries) must be a positive integer",
+		"CLOUDFRONT_KEY_PAIR_ID must be set when CLOUDFRONT_DOMAIN is set",
+		"JWT_SECRET not set",
+	} {
+		assert.Contains(t, err.Error(), expected)
+	}
+}
+
+func TestValidateKeysStorageParams(t *testing.T) {
+	t.Setenv("PUBLIC_EXPO_KEY_B64", "")
+	t.Setenv("PRIVATE_EXPO_KEY_B64", "")
+	assert.NoError(t, validateKeysStorageParams(GetEnv, "local"))
+	assert.Error(t, validateKeysStorageParams(GetEnv, "environment"))
+	t.Setenv("PUBLIC_EXPO_KEY_B64", "public")
+	t.Setenv("PRIVATE_EXPO_KEY_B64", "private")
+	assert.NoError(t, validateKeysStorageParams(GetEnv, "environment"))
+	t.Setenv("AWSSM_EXPO_PUBLIC_KEY_SECRET_ID", "")
+	assert.Error(t, validateKeysStorageParams(GetEnv, "aws-secrets-manager"))
+	assert.Error(t, validateKeysStorageParams(GetEnv, "local-files"))
+}
+
+func TestReloadAppliesOnlyReloadableSettings(t *testing.T) {
+	validSettings(t)
+	t.Setenv("WEBHOOKS_MAX_ATTEMPTS", "")
+	t.Setenv("LOCAL_BUCKET_BASE_PATH", "")
+	path := writeConfigFile(t, "config.yaml", `
+storage:
+  localBasePath: ./updates-a
+webhooks:
+  maxAttempts: 3
+`)
+	useConfigFile(t, path)
+	assert.Nil(t, os.WriteFile(path, []byte(`
+storage:
+  localBasePath: ./updates-b
+webhooks:
+  maxAttempts: 7
+`), 0644))
+	assert.Nil(t, Reload())
+	assert.Equal(t, "7", GetEnv("WEBHOOKS_MAX_ATTEMPTS"))
+	assert.Equal(t, "./updates-a", GetEnv("LOCAL_BUCKET_BASE_PATH"))
+
+	// An invalid file is not applied
+	assert.Nil(t, os.WriteFile(path, []byte(`
+webhooks:
+  maxAttempts: -1
+`), 0644))
+	assert.NotNil(t, Reload())
+	assert.Equal(t, "7", GetEnv("WEBHOOKS_MAX_ATTEMPTS"))
+	assert.Nil(t, os.WriteFile(path, []byte(`webhooks: [1]`), 0644))
+	assert.NotNil(t, Reload())
+	assert.Equal(t, "7", GetEnv("WEBHOOKS_MAX_ATTEMPTS"))
+}
+
+func TestReloadWithoutConfigFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE_PATH", "")
+	assert.NotNil(t, Reload())
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	validSettings(t)
+	t.Setenv("JWT_SECRET", "super-secret")
+	t.Setenv("REDIS_PASSWORD", "")
+	t.Setenv("REDIS_PORT", "")
+	t.Setenv("REDIS_CLUSTER_ADDRS", "redis-1:6379,redis-2:6379")
+	var output bytes.Buffer
+	assert.Nil(t, Print(&output))
+	printed := output.String()
+	assert.NotContains(t, printed, "super-secret")
+	assert.Contains(t, printed, "jwtSecret: '[REDACTED]'")
+	assert.Contains(t, printed, `password: ""`)
+	assert.Contains(t, printed, "baseUrl: http://test.com")
+	assert.Contains(t, printed, "localMaxEntries: 10000")
+	assert.Contains(t, printed, "port: null")
+	assert.Contains(t, printed, "clusterAddrs: ['redis-1:6379', 'redis-2:6379']")
+
+	// The printed configuration can be read back as a config file
+	_, err := readConfigFile(writeConfigFile(t, "printed.yaml", printed))
+	assert.Nil(t, err)
+}
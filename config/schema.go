@@ -0,0 +1,247 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Config is the typed view of the settings. Each field is read from the environment variable named by its
+// env tag, then from the config file under the section and key named by the config tags, then from
+// DefaultEnvValues. Fields tagged reload are applied on SIGHUP, secret ones are redacted when printed.
+type Config struct {
+	Server        ServerConfig        `config:"server"`
+	Expo          ExpoConfig          `config:"expo"`
+	Storage       StorageConfig       `config:"storage"`
+	AWS           AWSConfig           `config:"aws"`
+	Keys          KeysConfig          `config:"keys"`
+	CDN           CDNConfig           `config:"cdn"`
+	Cache         CacheConfig         `config:"cache"`
+	Redis         RedisConfig         `config:"redis"`
+	MetadataStore MetadataStoreConfig `config:"metadataStore"`
+	Auth          AuthConfig          `config:"auth"`
+	OIDC          OIDCConfig          `config:"oidc"`
+	Audit         AuditConfig         `config:"audit"`
+	Webhooks      WebhooksConfig      `config:"webhooks"`
+	Uploads       UploadsConfig       `config:"uploads"`
+	Metrics       MetricsConfig       `config:"metrics"`
+	Apps          AppsConfig          `config:"apps"`
+}
+
+type ServerConfig struct {
+	BaseURL             string `config:"baseUrl" env:"BASE_URL"`
+	Port                int    `config:"port" env:"PORT"`
+	JWTSecret           string `config:"jwtSecret" env:"JWT_SECRET" secret:"true"`
+	ReadHeaderTimeout   int    `config:"readHeaderTimeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout         int    `config:"readTimeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout        int    `config:"writeTimeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout         int    `config:"idleTimeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownDelay       int    `config:"shutdownDelay" env:"SERVER_SHUTDOWN_DELAY"`
+	ShutdownTimeout     int    `config:"shutdownTimeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	MaxRequestBodyBytes int    `config:"maxRequestBodyBytes" env:"MAX_REQUEST_BODY_BYTES" reload:"true"`
+}
+
+type ExpoConfig struct {
+	AppId       string `config:"appId" env:"EXPO_APP_ID"`
+	AccessToken string `config:"accessToken" env:"EXPO_ACCESS_TOKEN" secret:"true" reload:"true"`
+	GraphqlURL  string `config:"graphqlUrl" env:"EXPO_GRAPHQL_URL" reload:"true"`
+}
+
+type StorageConfig struct {
+	Mode               string   `config:"mode" env:"STORAGE_MODE"`
+	LocalBasePath      string   `config:"localBasePath" env:"LOCAL_BUCKET_BASE_PATH"`
+	S3BucketName       string   `config:"s3BucketName" env:"S3_BUCKET_NAME"`
+	Replicas           []string `config:"replicas" env:"STORAGE_REPLICAS"`
+	ReadTimeoutMs      int      `config:"readTimeoutMs" env:"STORAGE_READ_TIMEOUT_MS"`
+	ReplicationRetries int      `config:"replicationRetries" env:"STORAGE_REPLICATION_RETRIES"`
+}
+
+type AWSConfig struct {
+	Region          string `config:"region" env:"AWS_REGION"`
+	AccessKeyId     string `config:"accessKeyId" env:"AWS_ACCESS_KEY_ID"`
+	SecretAccessKey string `config:"secretAccessKey" env:"AWS_SECRET_ACCESS_KEY" secret:"true"`
+}
+
+type KeysConfig struct {
+	StorageType                  string `config:"storageType" env:"KEYS_STORAGE_TYPE"`
+	PublicExpoKeyPath            string `config:"publicExpoKeyPath" env:"PUBLIC_LOCAL_EXPO_KEY_PATH"`
+	PrivateExpoKeyPath           string `config:"privateExpoKeyPath" env:"PRIVATE_LOCAL_EXPO_KEY_PATH"`
+	PrivateCloudfrontKeyPath     string `config:"privateCloudfrontKeyPath" env:"PRIVATE_CLOUDFRONT_KEY_PATH"`
+	PublicExpoKeyB64             string `config:"publicExpoKeyB64" env:"PUBLIC_EXPO_KEY_B64"`
+	PrivateExpoKeyB64            string `config:"privateExpoKeyB64" env:"PRIVATE_EXPO_KEY_B64" secret:"true"`
+	PrivateCloudfrontKeyB64      string `config:"privateCloudfrontKeyB64" env:"PRIVATE_CLOUDFRONT_KEY_B64" secret:"true"`
+	PublicExpoKeySecretId        string `config:"publicExpoKeySecretId" env:"AWSSM_EXPO_PUBLIC_KEY_SECRET_ID"`
+	PrivateExpoKeySecretId       string `config:"privateExpoKeySecretId" env:"AWSSM_EXPO_PRIVATE_KEY_SECRET_ID"`
+	PrivateCloudfrontKeySecretId string `config:"privateCloudfrontKeySecretId" env:"AWSSM_CLOUDFRONT_PRIVATE_KEY_SECRET_ID"`
+	ArchivePublicKeyPath         string `config:"archivePublicKeyPath" env:"ARCHIVE_PUBLIC_KEY_PATH"`
+}
+
+type CDNConfig struct {
+	CloudfrontDomain    string `config:"cloudfrontDomain" env:"CLOUDFRONT_DOMAIN"`
+	CloudfrontKeyPairId string `config:"cloudfrontKeyPairId" env:"CLOUDFRONT_KEY_PAIR_ID"`
+}
+
+type CacheConfig struct {
+	Mode               string `config:"mode" env:"CACHE_MODE"`
+	LocalMaxEntries    int    `config:"localMaxEntries" env:"LOCAL_CACHE_MAX_ENTRIES"`
+	LocalMaxBytes      int    `config:"localMaxBytes" env:"LOCAL_CACHE_MAX_BYTES"`
+	LocalSweepInterval int    `config:"localSweepInterval" env:"LOCAL_CACHE_SWEEP_INTERVAL"`
+	LayeredL1TTL       int    `config:"layeredL1Ttl" env:"LAYERED_CACHE_L1_TTL"`
+}
+
+type RedisConfig struct {
+	Mode               string   `config:"mode" env:"REDIS_MODE"`
+	Host               string   `config:"host" env:"REDIS_HOST"`
+	Port               int      `config:"port" env:"REDIS_PORT"`
+	Username           string   `config:"username" env:"REDIS_USERNAME"`
+	Password           string   `config:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB                 int      `config:"db" env:"REDIS_DB"`
+	UseTLS             bool     `config:"useTls" env:"REDIS_USE_TLS"`
+	KeyPrefix          string   `config:"keyPrefix" env:"REDIS_KEY_PREFIX"`
+	SentinelMasterName string   `config:"sentinelMasterName" env:"REDIS_SENTINEL_MASTER_NAME"`
+	SentinelAddrs      []string `config:"sentinelAddrs" env:"REDIS_SENTINEL_ADDRS"`
+	SentinelUsername   string   `config:"sentinelUsername" env:"REDIS_SENTINEL_USERNAME"`
+	SentinelPassword   string   `config:"sentinelPassword" env:"REDIS_SENTINEL_PASSWORD" secret:"true"`
+	ClusterAddrs       []string `config:"clusterAddrs" env:"REDIS_CLUSTER_ADDRS"`
+}
+
+type MetadataStoreConfig struct {
+	Type string `config:"type" env:"METADATA_STORE_TYPE"`
+	DSN  string `config:"dsn" env:"METADATA_STORE_DSN" secret:"true"`
+}
+
+type AuthConfig struct {
+	UseDashboard    bool   `config:"useDashboard" env:"USE_DASHBOARD"`
+	AdminPassword   string `config:"adminPassword" env:"ADMIN_PASSWORD" secret:"true" reload:"true"`
+	UsersFilePath   string `config:"usersFilePath" env:"USERS_FILE_PATH"`
+	ApiKeysFilePath string `config:"apiKeysFilePath" env:"API_KEYS_FILE_PATH"`
+}
+
+type OIDCConfig struct {
+	IssuerURL       string   `config:"issuerUrl" env:"OIDC_ISSUER_URL"`
+	ClientId        string   `config:"clientId" env:"OIDC_CLIENT_ID"`
+	ClientSecret    string   `config:"clientSecret" env:"OIDC_CLIENT_SECRET" secret:"true"`
+	Scopes          string   `config:"scopes" env:"OIDC_SCOPES"`
+	GroupsClaim     string   `config:"groupsClaim" env:"OIDC_GROUPS_CLAIM" reload:"true"`
+	DefaultRole     string   `config:"defaultRole" env:"OIDC_DEFAULT_ROLE" reload:"true"`
+	AdminGroups     []string `config:"adminGroups" env:"OIDC_ADMIN_GROUPS" reload:"true"`
+	PublisherGroups []string `config:"publisherGroups" env:"OIDC_PUBLISHER_GROUPS" reload:"true"`
+	ViewerGroups    []string `config:"viewerGroups" env:"OIDC_VIEWER_GROUPS" reload:"true"`
+}
+
+type AuditConfig struct {
+	Sink string `config:"sink" env:"AUDIT_LOG_SINK"`
+}
+
+type WebhooksConfig struct {
+	FilePath     string `config:"filePath" env:"WEBHOOKS_FILE_PATH"`
+	MaxAttempts  int    `config:"maxAttempts" env:"WEBHOOKS_MAX_ATTEMPTS" reload:"true"`
+	RetryDelayMs int    `config:"retryDelayMs" env:"WEBHOOKS_RETRY_DELAY_MS" reload:"true"`
+}
+
+type UploadsConfig struct {
+	SessionsTTLMinutes int `config:"sessionsTtlMinutes" env:"UPLOAD_SESSIONS_TTL_MINUTES" reload:"true"`
+	SweepInterval      int `config:"sweepInterval" env:"UPLOAD_SWEEP_INTERVAL"`
+	LocalMaxBytes      int `config:"localMaxBytes" env:"LOCAL_UPLOAD_MAX_BYTES" reload:"true"`
+	ArchiveMaxBytes    int `config:"archiveMaxBytes" env:"ARCHIVE_MAX_BYTES" reload:"true"`
+}
+
+type MetricsConfig struct {
+	PrometheusEnabled bool `config:"prometheusEnabled" env:"PROMETHEUS_ENABLED"`
+}
+
+type AppsConfig struct {
+	ConfigPath string `config:"configPath" env:"APPS_CONFIG_PATH"`
+}
+
+// setting is a field of Config along with where it is read from.
+type setting struct {
+	section string
+	key     string
+	env     string
+	kind    reflect.Kind
+	secret  bool
+	reload  bool
+	index   []int
+}
+
+func (s setting) path() string {
+	return s.section + "." + s.key
+}
+
+var settings = func() []setting {
+	var all []setting
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		section := configType.Field(i)
+		for j := 0; j < section.Type.NumField(); j++ {
+			field := section.Type.Field(j)
+			all = append(all, setting{
+				section: section.Tag.Get("config"),
+				key:     field.Tag.Get("config"),
+				env:     field.Tag.Get("env"),
+				kind:    field.Type.Kind(),
+				secret:  field.Tag.Get("secret") == "true",
+				reload:  field.Tag.Get("reload") == "true",
+				index:   []int{i, j},
+			})
+		}
+	}
+	return all
+}()
+
+func splitList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// parse builds the typed settings from get, reporting every value that does not fit its type.
+func parse(get func(string) string) (Config, error) {
+	var parsed Config
+	var errs []error
+	value := reflect.ValueOf(&parsed).Elem()
+	for _, s := range settings {
+		raw := get(s.env)
+		field := value.FieldByIndex(s.index)
+		switch s.kind {
+		case reflect.String:
+			field.SetString(raw)
+		case reflect.Int:
+			if raw == "" {
+				continue
+			}
+			number, err := strconv.Atoi(raw)
+			if err != nil || number < 0 {
+				errs = append(errs, fmt.Errorf("%s (%s) must be a positive integer, got %q", s.env, s.path(), raw))
+				continue
+			}
+			field.SetInt(int64(number))
+		case reflect.Bool:
+			if raw == "" {
+				continue
+			}
+			enabled, err := strconv.ParseBool(raw)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s (%s) must be true or false, got %q", s.env, s.path(), raw))
+				continue
+			}
+			field.SetBool(enabled)
+		case reflect.Slice:
+			field.Set(reflect.ValueOf(splitList(raw)))
+		}
+	}
+	return parsed, errors.Join(errs...)
+}
+
+// Current returns the typed settings in effect.
+func Current() (Config, error) {
+	return parse(GetEnv)
+}
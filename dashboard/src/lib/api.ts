@@ -61,8 +61,11 @@ export class ApiClient {
     }
   }
 
-  public async login(password: string) {
+  public async login(password: string, username?: string) {
     const form = new URLSearchParams();
+    if (username) {
+      form.append('username', username);
+    }
     form.append('password', password);
     return this.request<{ token: string; refreshToken: string }>(`/auth/login`, {
       method: 'POST',
@@ -71,6 +74,36 @@ export class ApiClient {
     });
   }
 
+  public async logout(refreshToken: string) {
+    const form = new URLSearchParams();
+    form.append('refreshToken', refreshToken);
+    await fetch(`${this.baseUrl}/auth/logout`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+      body: form.toString(),
+    });
+  }
+
+  public async getAuthMethods() {
+    return this.request<{ password: boolean; oidc: boolean }>('/auth/methods', {
+      method: 'GET',
+    });
+  }
+
+  public getOIDCLoginUrl() {
+    return `${this.baseUrl}/auth/oidc/login`;
+  }
+
+  public async exchangeOIDCCode(code: string) {
+    const form = new URLSearchParams();
+    form.append('code', code);
+    return this.request<{ token: string; refreshToken: string }>(`/auth/oidc/token`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+      body: form.toString(),
+    });
+  }
+
   public async getBranches() {
     return this.request<
       {
@@ -114,6 +147,9 @@ export class ApiClient {
       CACHE_MODE: string;
       REDIS_HOST: string;
       REDIS_PORT: string;
+      REDIS_MODE: string;
+      REDIS_DB: string;
+      REDIS_KEY_PREFIX: string;
       STORAGE_MODE: string;
       S3_BUCKET_NAME: string;
       LOCAL_BUCKET_BASE_PATH: string;
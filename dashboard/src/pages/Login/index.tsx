@@ -5,12 +5,13 @@ import { useForm } from 'react-hook-form';
 import { z } from 'zod';
 import { zodResolver } from '@hookform/resolvers/zod';
 import { Form, FormControl, FormField, FormItem, FormMessage } from '@/components/ui/form.tsx';
-import { useCallback } from 'react';
+import { useCallback, useEffect, useState } from 'react';
 import { setTokens } from '@/lib/auth.ts';
-import { useNavigate } from 'react-router';
+import { useNavigate, useSearchParams } from 'react-router';
 import { api } from '@/lib/api.ts';
 
 const FormSchema = z.object({
+  username: z.string().optional(),
   password: z.string().min(1, {
     message: 'Password is required',
   }),
@@ -20,15 +21,42 @@ export const Login = () => {
   const form = useForm<z.infer<typeof FormSchema>>({
     resolver: zodResolver(FormSchema),
     defaultValues: {
+      username: '',
       password: '',
     },
   });
   const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const [isOIDCEnabled, setIsOIDCEnabled] = useState(false);
+  const [ssoError, setSsoError] = useState<string | null>(
+    searchParams.get('error') ? 'Error signing in with SSO' : null
+  );
+
+  useEffect(() => {
+    api
+      .getAuthMethods()
+      .then(methods => setIsOIDCEnabled(methods.oidc))
+      .catch(() => setIsOIDCEnabled(false));
+  }, []);
+
+  useEffect(() => {
+    const code = searchParams.get('code');
+    if (!code) {
+      return;
+    }
+    api
+      .exchangeOIDCCode(code)
+      .then(response => {
+        setTokens(response.token, response.refreshToken);
+        navigate('/');
+      })
+      .catch(() => setSsoError('Error signing in with SSO'));
+  }, [searchParams, navigate]);
 
   const onSubmit = useCallback(
     async (data: z.infer<typeof FormSchema>) => {
       try {
-        const response = await api.login(data.password);
+        const response = await api.login(data.password, data.username);
         setTokens(response.token, response.refreshToken);
         navigate('/');
       } catch {
@@ -45,11 +73,24 @@ export const Login = () => {
     <div className="flex-1 w-full h-screen flex items-center justify-center">
       <Card className="w-[350px]">
         <CardHeader>
-          <CardTitle>Admin password</CardTitle>
+          <CardTitle>Sign in</CardTitle>
         </CardHeader>
         <CardContent>
           <Form {...form}>
             <form onSubmit={form.handleSubmit(onSubmit)} className="w-full gap-5 flex flex-col">
+              <FormField
+                control={form.control}
+                name="username"
+                render={({ field }) => {
+                  return (
+                    <FormItem>
+                      <FormControl>
+                        <Input placeholder="Username (leave empty for the admin password)" {...field} />
+                      </FormControl>
+                    </FormItem>
+                  );
+                }}
+              />
               <FormField
                 control={form.control}
                 name="password"
@@ -57,7 +98,7 @@ export const Login = () => {
                   return (
                     <FormItem>
                       <FormControl>
-                        <Input type={'password'} {...field} />
+                        <Input type={'password'} placeholder="Password" {...field} />
                       </FormControl>
                       <FormMessage>{fieldState.error?.message}</FormMessage>
                     </FormItem>
@@ -67,6 +108,17 @@ export const Login = () => {
               <Button type="submit">Submit</Button>
             </form>
           </Form>
+          {isOIDCEnabled && (
+            <Button
+              variant="outline"
+              className="w-full mt-3"
+              onClick={() => {
+                window.location.href = api.getOIDCLoginUrl();
+              }}>
+              Sign in with SSO
+            </Button>
+          )}
+          {ssoError && <p className="text-sm text-destructive mt-3">{ssoError}</p>}
         </CardContent>
       </Card>
     </div>
@@ -1,13 +1,20 @@
 import { useEffect } from 'react';
-import { logout } from '@/lib/auth.ts';
+import { getRefreshToken, logout } from '@/lib/auth.ts';
+import { api } from '@/lib/api.ts';
 import { useNavigate } from 'react-router';
 
 export const Logout = () => {
   const navigate = useNavigate();
 
   useEffect(() => {
-    logout();
-    navigate('/login');
+    const refreshToken = getRefreshToken();
+    const endSession = refreshToken ? api.logout(refreshToken) : Promise.resolve();
+    endSession
+      .catch(() => undefined)
+      .finally(() => {
+        logout();
+        navigate('/login');
+      });
   }, [navigate]);
 
   return null;
@@ -1,12 +1,16 @@
 import { Platform } from '@expo/eas-build-job';
 import spawnAsync from '@expo/spawn-async';
 import { Command, Flags } from '@oclif/core';
-import FormData from 'form-data';
 import fs from 'fs-extra';
 import mime from 'mime';
 import path from 'path';
 
-import { RequestUploadUrlItem, computeFilesRequests, requestUploadUrls } from '../lib/assets';
+import {
+  RequestUploadUrlItem,
+  computeFilesRequests,
+  declareFiles,
+  requestUploadUrls,
+} from '../lib/assets';
 import { getAuthExpoHeaders, retrieveExpoCredentials } from '../lib/auth';
 import {
   RequestedPlatform,
@@ -15,6 +19,7 @@ import {
   getPublicExpoConfigAsync,
 } from '../lib/expoConfig';
 import { fetchWithRetries } from '../lib/fetch';
+import { uploadLocalFileAsync } from '../lib/localUpload';
 import Log from '../lib/log';
 import { ora } from '../lib/ora';
 import { isExpoInstalled } from '../lib/package';
@@ -209,6 +214,7 @@ export default class Publish extends Command {
       uploadFilesSpinner.fail('No files to upload');
       process.exit(1);
     }
+    const declaredFiles = declareFiles(path.join(projectDir, outputDir), files);
     let uploadUrls: {
       uploadRequests: RequestUploadUrlItem[];
       updateId: string;
@@ -225,6 +231,7 @@ export default class Publish extends Command {
             ...(await requestUploadUrls({
               body: {
                 fileNames: files.map(file => file.path),
+                files: declaredFiles,
               },
               requestUploadUrl: `${baseUrl}/requestUploadUrl/${branch}`,
               auth: credentials,
@@ -243,28 +250,17 @@ export default class Publish extends Command {
           const isLocalBucketFileUpload = itm.requestUploadUrl.startsWith(
             `${baseUrl}/uploadLocalFile`
           );
-          const formData = new FormData();
-          let file: fs.ReadStream;
-          try {
-            file = fs.createReadStream(path.join(projectDir, outputDir, itm.filePath));
-          } catch {
-            throw new Error(`Failed to read file ${itm.filePath}`);
-          }
-          formData.append(itm.fileName, file);
           if (isLocalBucketFileUpload) {
-            const response = await fetchWithRetries(itm.requestUploadUrl, {
-              method: 'PUT',
-              headers: {
-                ...formData.getHeaders(),
-                ...getAuthExpoHeaders(credentials),
-              },
-              body: formData,
-            });
-            if (!response.ok) {
-              Log.error('Failed to upload file', await response.text());
+            try {
+              await uploadLocalFileAsync(
+                itm.requestUploadUrl,
+                path.join(projectDir, outputDir, itm.filePath),
+                getAuthExpoHeaders(credentials)
+              );
+            } catch (e) {
+              Log.error('Failed to upload file', (e as Error).message);
               throw new Error('Failed to upload file');
             }
-            file.close();
             return;
           }
           const findFile = files.find(f => f.path === itm.filePath || f.name === itm.fileName);
@@ -289,7 +285,6 @@ export default class Publish extends Command {
             Log.error('❌ File upload failed', await response.text());
             process.exit(1);
           }
-          file.close();
         })
       );
       uploadFilesSpinner.succeed('✅ Files uploaded successfully');
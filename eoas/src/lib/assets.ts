@@ -1,5 +1,6 @@
 // This file is partially copied from eas-cli[https://github.com/expo/eas-cli] to ensure consistent user experience across the CLI.
 import { Platform } from '@expo/config';
+import crypto from 'crypto';
 import fs from 'fs-extra';
 import Joi from 'joi';
 import path from 'path';
@@ -92,6 +93,27 @@ export function computeFilesRequests(
   return assets;
 }
 
+export interface DeclaredFile {
+  path: string;
+  size: number;
+  sha256: string;
+}
+
+// The server checks the uploaded files against these sizes and hashes before publishing the update
+export function declareFiles(distRoot: string, assets: AssetToUpload[]): DeclaredFile[] {
+  // Platforms can share assets, each file must only be declared once
+  const paths = [...new Set(assets.map(asset => asset.path))];
+  return paths.map(assetPath => {
+    // eslint-disable-next-line
+    const content = fs.readFileSync(path.join(distRoot, assetPath));
+    return {
+      path: assetPath,
+      size: content.length,
+      sha256: crypto.createHash('sha256').update(content).digest('hex'),
+    };
+  });
+}
+
 export interface RequestUploadUrlItem {
   requestUploadUrl: string;
   fileName: string;
@@ -106,7 +128,7 @@ export async function requestUploadUrls({
   platform,
   commitHash,
 }: {
-  body: { fileNames: string[] };
+  body: { fileNames: string[]; files: DeclaredFile[] };
   requestUploadUrl: string;
   auth: ExpoCredentials;
   runtimeVersion: string;
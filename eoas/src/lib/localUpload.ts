@@ -0,0 +1,81 @@
+import crypto from 'crypto';
+import fs from 'fs-extra';
+import fetch, { Response } from 'node-fetch';
+
+import Log from './log';
+
+const CHUNK_SIZE = 8 * 1024 * 1024;
+const MAX_ATTEMPTS = 5;
+
+async function readChunkAsync(fd: number, offset: number, length: number): Promise<Buffer> {
+  const buffer = Buffer.alloc(length);
+  const { bytesRead } = await fs.read(fd, buffer, 0, length, offset);
+  return buffer.subarray(0, bytesRead);
+}
+
+async function fetchUploadOffsetAsync(
+  url: string,
+  headers: Record<string, string>
+): Promise<number | null> {
+  try {
+    const response = await fetch(url, { method: 'HEAD', headers });
+    return response.ok ? Number(response.headers.get('Upload-Offset') ?? 0) : null;
+  } catch {
+    return null;
+  }
+}
+
+// Uploads a file to a local storage server in chunks, resuming from the offset the server reports
+// after a network error instead of sending the whole file again.
+export async function uploadLocalFileAsync(
+  url: string,
+  filePath: string,
+  headers: Record<string, string>
+): Promise<void> {
+  const { size } = await fs.stat(filePath);
+  const fd = await fs.open(filePath, 'r');
+  try {
+    let offset = 0;
+    let attempt = 0;
+    do {
+      const chunk = await readChunkAsync(fd, offset, Math.min(CHUNK_SIZE, size - offset));
+      const requestHeaders: Record<string, string> = {
+        ...headers,
+        'Content-Type': 'application/octet-stream',
+        'X-Content-Sha256': crypto.createHash('sha256').update(chunk).digest('hex'),
+      };
+      // Empty files cannot be described by a Content-Range, they are sent in a single request
+      if (size > 0) {
+        requestHeaders['Content-Range'] = `bytes ${offset}-${offset + chunk.length - 1}/${size}`;
+      }
+      let response: Response | null = null;
+      try {
+        response = await fetch(url, { method: 'PUT', headers: requestHeaders, body: chunk });
+      } catch (e) {
+        Log.warn(`Upload of ${filePath} interrupted: ${(e as Error).message}`);
+      }
+      if (response?.ok) {
+        offset = Number(response.headers.get('Upload-Offset') ?? size);
+        attempt = 0;
+        continue;
+      }
+      if (response && response.status !== 409 && response.status < 500) {
+        throw new Error(`Failed to upload ${filePath}: ${await response.text()}`);
+      }
+      attempt++;
+      if (attempt >= MAX_ATTEMPTS) {
+        throw new Error(`Failed to upload ${filePath} after ${MAX_ATTEMPTS} attempts`);
+      }
+      await new Promise(resolve => setTimeout(resolve, Math.pow(2, attempt) * 500));
+      const resumeOffset =
+        response?.status === 409
+          ? Number(response.headers.get('Upload-Offset'))
+          : await fetchUploadOffsetAsync(url, headers);
+      if (resumeOffset !== null && !Number.isNaN(resumeOffset)) {
+        offset = resumeOffset;
+      }
+    } while (offset < size);
+  } finally {
+    await fs.close(fd);
+  }
+}
@@ -0,0 +1,247 @@
+package apiKeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/metadataStore"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Action string
+
+const (
+	PublishAction  Action = "publish"
+	PromoteAction  Action = "promote"
+	RollbackAction Action = "rollback"
+)
+
+var ValidActions = []Action{PublishAction, PromoteAction, RollbackAction}
+
+// Every generated key starts with this prefix, which tells API keys apart from Expo tokens
+const KeyPrefix = "eoota_"
+
+// Grants access to every branch, including branch names containing a "/"
+const AllBranches = "*"
+
+var (
+	ErrApiKeyNotFound = errors.New("api key not found")
+	ErrInvalidApiKey  = errors.New("invalid api key")
+	ErrRevokedApiKey  = errors.New("api key has been revoked")
+	ErrExpiredApiKey  = errors.New("api key has expired")
+)
+
+type ApiKey struct {
+	Id string `json:"id"`
+	// App is the id of the app the key publishes to, empty for the default app
+	App    string `json:"app,omitempty"`
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	// SHA-256 of the key, the key itself is only returned once at creation
+	Hash      string     `json:"hash,omitempty"`
+	Branches  []string   `json:"branches"`
+	Actions   []Action   `json:"actions"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+type ApiKeyStore interface {
+	Create(key ApiKey) error
+	List() ([]ApiKey, error)
+	GetByHash(hash string) (*ApiKey, error)
+	Revoke(id string, revokedAt time.Time) error
+}
+
+var (
+	apiKeyStoreInstance ApiKeyStore
+	once                sync.Once
+)
+
+// GetApiKeyStore stores the keys in the metadata store when it is enabled, so that they are shared
+// between replicas, and in a local JSON file otherwise.
+func GetApiKeyStore() ApiKeyStore {
+	once.Do(func() {
+		if store, ok := metadataStore.GetMetadataStore().(*metadataStore.SQLMetadataStore); ok {
+			sqlStore, err := NewSQLApiKeyStore(store)
+			if err != nil {
+				log.Fatalf("Error initializing api key store: %v", err)
+			}
+			apiKeyStoreInstance = sqlStore
+			return
+		}
+		apiKeyStoreInstance = NewFileApiKeyStore(config.GetEnv("API_KEYS_FILE_PATH"))
+	})
+	return apiKeyStoreInstance
+}
+
+func ResetApiKeyStoreInstance() {
+	apiKeyStoreInstance = nil
+	once = sync.Once{}
+}
+
+func IsApiKey(token string) bool {
+	return strings.HasPrefix(token, KeyPrefix)
+}
+
+func HashKey(rawKey string) string {
+	hash := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(hash[:])
+}
+
+func IsValidAction(action Action) bool {
+	for _, validAction := range ValidActions {
+		if action == validAction {
+			return true
+		}
+	}
+	return false
+}
+
+func validateScopes(name string, branches []string, actions []Action) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("name is required")
+	}
+	if len(branches) == 0 {
+		return errors.New("at least one branch is required")
+	}
+	for _, branch := range branches {
+		if branch == "" {
+			return errors.New("branch pattern cannot be empty")
+		}
+		if _, err := path.Match(branch, ""); err != nil {
+			return fmt.Errorf("invalid branch pattern %q: %w", branch, err)
+		}
+	}
+	if len(actions) == 0 {
+		return errors.New("at least one action is required")
+	}
+	for _, action := range actions {
+		if !IsValidAction(action) {
+			return fmt.Errorf("invalid action: %s", action)
+		}
+	}
+	return nil
+}
+
+// CreateApiKey generates and stores a new key for app. The returned raw key is never stored and cannot be retrieved later.
+func CreateApiKey(app string, name string, branches []string, actions []Action, expiresAt *time.Time) (ApiKey, string, error) {
+	if err := validateScopes(name, branches, actions); err != nil {
+		return ApiKey{}, "", err
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return ApiKey{}, "", errors.New("expiration date is in the past")
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return ApiKey{}, "", fmt.Errorf("error generating api key: %w", err)
+	}
+	rawKey := KeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	key := ApiKey{
+		Id:        uuid.New().String(),
+		App:       app,
+		Name:      strings.TrimSpace(name),
+		Prefix:    rawKey[:len(KeyPrefix)+6],
+		Hash:      HashKey(rawKey),
+		Branches:  branches,
+		Actions:   actions,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+	if err := GetApiKeyStore().Create(key); err != nil {
+		return ApiKey{}, "", err
+	}
+	return key, rawKey, nil
+}
+
+// ListApiKeys returns the keys created for app.
+func ListApiKeys(app string) ([]ApiKey, error) {
+	keys, err := GetApiKeyStore().List()
+	if err != nil {
+		return nil, err
+	}
+	appKeys := []ApiKey{}
+	for _, key := range keys {
+		if key.App == app {
+			appKeys = append(appKeys, key)
+		}
+	}
+	return appKeys, nil
+}
+
+// RevokeApiKey revokes a key of app, the keys of other apps are reported as not found.
+func RevokeApiKey(app string, id string, revokedAt time.Time) error {
+	keys, err := ListApiKeys(app)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.Id == id {
+			return GetApiKeyStore().Revoke(id, revokedAt)
+		}
+	}
+	return ErrApiKeyNotFound
+}
+
+// Authenticate resolves a raw key into a usable (known, not revoked, not expired) API key of app.
+// A key created for another app is as invalid as an unknown one.
+func Authenticate(app string, rawKey string) (*ApiKey, error) {
+	if !IsApiKey(rawKey) {
+		return nil, ErrInvalidApiKey
+	}
+	key, err := GetApiKeyStore().GetByHash(HashKey(rawKey))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || key.App != app {
+		return nil, ErrInvalidApiKey
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrRevokedApiKey
+	}
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
+		return nil, ErrExpiredApiKey
+	}
+	return key, nil
+}
+
+func (k ApiKey) HasAction(action Action) bool {
+	for _, keyAction := range k.Actions {
+		if keyAction == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows checks that the key grants action on branch. Branch scopes are glob patterns (e.g. "release-*").
+func (k ApiKey) Allows(action Action, branch string) bool {
+	if !k.HasAction(action) {
+		return false
+	}
+	for _, pattern := range k.Branches {
+		if pattern == AllBranches {
+			return true
+		}
+		if matched, _ := path.Match(pattern, branch); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted strips the hash before the key is sent to a client.
+func (k ApiKey) Redacted() ApiKey {
+	k.Hash = ""
+	return k
+}
@@ -0,0 +1,185 @@
+package apiKeys
+
+import (
+	"expo-open-ota/internal/metadataStore"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useFileStore(t *testing.T) {
+	t.Helper()
+	os.Setenv("API_KEYS_FILE_PATH", filepath.Join(t.TempDir(), "apiKeys.json"))
+	ResetApiKeyStoreInstance()
+	t.Cleanup(func() {
+		os.Unsetenv("API_KEYS_FILE_PATH")
+		ResetApiKeyStoreInstance()
+	})
+}
+
+func TestAllows(t *testing.T) {
+	key := ApiKey{Branches: []string{"main", "release-*"}, Actions: []Action{PublishAction}}
+	assert.True(t, key.Allows(PublishAction, "main"))
+	assert.True(t, key.Allows(PublishAction, "release-1.2"))
+	assert.False(t, key.Allows(PublishAction, "staging"))
+	assert.False(t, key.Allows(RollbackAction, "main"))
+
+	everyBranch := ApiKey{Branches: []string{AllBranches}, Actions: []Action{RollbackAction}}
+	assert.True(t, everyBranch.Allows(RollbackAction, "feature/with-slash"))
+}
+
+func TestCreateApiKeyValidatesScopes(t *testing.T) {
+	useFileStore(t)
+	_, _, err := CreateApiKey("", "", []string{"main"}, []Action{PublishAction}, nil)
+	assert.NotNil(t, err)
+	_, _, err = CreateApiKey("", "ci", nil, []Action{PublishAction}, nil)
+	assert.NotNil(t, err)
+	_, _, err = CreateApiKey("", "ci", []string{"[invalid"}, []Action{PublishAction}, nil)
+	assert.NotNil(t, err)
+	_, _, err = CreateApiKey("", "ci", []string{"main"}, []Action{"delete"}, nil)
+	assert.NotNil(t, err)
+	past := time.Now().Add(-time.Hour)
+	_, _, err = CreateApiKey("", "ci", []string{"main"}, []Action{PublishAction}, &past)
+	assert.NotNil(t, err)
+}
+
+func TestAuthenticate(t *testing.T) {
+	useFileStore(t)
+	key, rawKey, err := CreateApiKey("", "ci", []string{"main"}, []Action{PublishAction}, nil)
+	assert.Nil(t, err)
+	assert.NotEqual(t, rawKey, key.Hash)
+
+	authenticated, err := Authenticate("", rawKey)
+	assert.Nil(t, err)
+	assert.Equal(t, key.Id, authenticated.Id)
+
+	_, err = Authenticate("", rawKey+"x")
+	assert.ErrorIs(t, err, ErrInvalidApiKey)
+	_, err = Authenticate("", "expo_token")
+	assert.ErrorIs(t, err, ErrInvalidApiKey)
+
+	assert.Nil(t, GetApiKeyStore().Revoke(key.Id, time.Now()))
+	_, err = Authenticate("", rawKey)
+	assert.ErrorIs(t, err, ErrRevokedApiKey)
+	assert.ErrorIs(t, GetApiKeyStore().Revoke("unknown", time.Now()), ErrApiKeyNotFound)
+}
+
+func TestApiKeysAreBoundToTheirApp(t *testing.T) {
+	useFileStore(t)
+	key, rawKey, err := CreateApiKey("second", "ci", []string{"main"}, []Action{PublishAction}, nil)
+	assert.Nil(t, err)
+	_, defaultRawKey, err := CreateApiKey("", "ci", []string{"main"}, []Action{PublishAction}, nil)
+	assert.Nil(t, err)
+
+	authenticated, err := Authenticate("second", rawKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", authenticated.App)
+	_, err = Authenticate("", rawKey)
+	assert.ErrorIs(t, err, ErrInvalidApiKey)
+	_, err = Authenticate("second", defaultRawKey)
+	assert.ErrorIs(t, err, ErrInvalidApiKey)
+
+	keys, err := ListApiKeys("second")
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, key.Id, keys[0].Id)
+
+	assert.ErrorIs(t, RevokeApiKey("", key.Id, time.Now()), ErrApiKeyNotFound)
+	_, err = Authenticate("second", rawKey)
+	assert.Nil(t, err)
+	assert.Nil(t, RevokeApiKey("second", key.Id, time.Now()))
+	_, err = Authenticate("second", rawKey)
+	assert.ErrorIs(t, err, ErrRevokedApiKey)
+}
+
+func TestAuthenticateExpiredKey(t *testing.T) {
+	useFileStore(t)
+	expiresAt := time.Now().Add(time.Hour)
+	_, rawKey, err := CreateApiKey("", "ci", []string{"main"}, []Action{PublishAction}, &expiresAt)
+	assert.Nil(t, err)
+	key, err := GetApiKeyStore().GetByHash(HashKey(rawKey))
+	assert.Nil(t, err)
+	past := time.Now().Add(-time.Minute)
+	key.ExpiresAt = &past
+	store := GetApiKeyStore().(*FileApiKeyStore)
+	assert.Nil(t, store.save([]ApiKey{*key}))
+	_, err = Authenticate("", rawKey)
+	assert.ErrorIs(t, err, ErrExpiredApiKey)
+}
+
+func TestFileStoreDoesNotStoreRawKey(t *testing.T) {
+	useFileStore(t)
+	_, rawKey, err := CreateApiKey("", "ci", []string{"main"}, []Action{PublishAction}, nil)
+	assert.Nil(t, err)
+	content, err := os.ReadFile(os.Getenv("API_KEYS_FILE_PATH"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(content), rawKey)
+	assert.Contains(t, string(content), HashKey(rawKey))
+}
+
+func TestSQLApiKeyStore(t *testing.T) {
+	metadata, err := metadataStore.NewSQLMetadataStore(metadataStore.SQLiteMetadataStoreType, filepath.Join(t.TempDir(), "metadata.db"))
+	assert.Nil(t, err)
+	defer metadata.Close()
+	store, err := NewSQLApiKeyStore(metadata)
+	assert.Nil(t, err)
+
+	expiresAt := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli()).UTC()
+	key := ApiKey{
+		Id:        "id",
+		App:       "second",
+		Name:      "ci",
+		Prefix:    "eoota_abcdef",
+		Hash:      HashKey("eoota_abcdef"),
+		Branches:  []string{"main"},
+		Actions:   []Action{PublishAction, RollbackAction},
+		CreatedAt: time.UnixMilli(1000).UTC(),
+		ExpiresAt: &expiresAt,
+	}
+	assert.Nil(t, store.Create(key))
+	found, err := store.GetByHash(key.Hash)
+	assert.Nil(t, err)
+	assert.Equal(t, key, *found)
+
+	assert.Nil(t, store.Revoke("id", time.UnixMilli(2000)))
+	keys, err := store.List()
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, int64(2000), keys[0].RevokedAt.UnixMilli())
+	assert.ErrorIs(t, store.Revoke("unknown", time.Now()), ErrApiKeyNotFound)
+
+	missing, err := store.GetByHash("unknown")
+	assert.Nil(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestSQLApiKeyStoreMigratesKeysWithoutApp(t *testing.T) {
+	metadata, err := metadataStore.NewSQLMetadataStore(metadataStore.SQLiteMetadataStoreType, filepath.Join(t.TempDir(), "metadata.db"))
+	assert.Nil(t, err)
+	defer metadata.Close()
+	_, err = metadata.DB().Exec(`CREATE TABLE api_keys (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		hash TEXT NOT NULL UNIQUE,
+		branches TEXT NOT NULL,
+		actions TEXT NOT NULL,
+		created_at BIGINT NOT NULL,
+		expires_at BIGINT,
+		revoked_at BIGINT
+	)`)
+	assert.Nil(t, err)
+	_, err = metadata.DB().Exec(`INSERT INTO api_keys (id, name, prefix, hash, branches, actions, created_at) VALUES ('id', 'ci', 'eoota_abcdef', 'hash', '["main"]', '["publish"]', 1000)`)
+	assert.Nil(t, err)
+
+	store, err := NewSQLApiKeyStore(metadata)
+	assert.Nil(t, err)
+	key, err := store.GetByHash("hash")
+	assert.Nil(t, err)
+	assert.Equal(t, "", key.App)
+	_, err = NewSQLApiKeyStore(metadata)
+	assert.Nil(t, err)
+}
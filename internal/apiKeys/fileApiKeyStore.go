@@ -0,0 +1,111 @@
+package apiKeys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type FileApiKeyStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileApiKeyStore(path string) *FileApiKeyStore {
+	return &FileApiKeyStore{path: path}
+}
+
+func (s *FileApiKeyStore) load() ([]ApiKey, error) {
+	content, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []ApiKey{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading api keys: %w", err)
+	}
+	var keys []ApiKey
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, fmt.Errorf("error parsing api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// save writes into a temporary file first so that a crash never leaves a truncated key file
+func (s *FileApiKeyStore) save(keys []ApiKey) error {
+	content, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.path), ".apiKeys-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), s.path)
+}
+
+func (s *FileApiKeyStore) Create(key ApiKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	return s.save(append(keys, key))
+}
+
+func (s *FileApiKeyStore) List() ([]ApiKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *FileApiKeyStore) GetByHash(hash string) (*ApiKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Hash == hash {
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *FileApiKeyStore) Revoke(id string, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range keys {
+		if keys[i].Id == id {
+			if keys[i].RevokedAt == nil {
+				keys[i].RevokedAt = &revokedAt
+			}
+			return s.save(keys)
+		}
+	}
+	return ErrApiKeyNotFound
+}
@@ -0,0 +1,140 @@
+package apiKeys
+
+import (
+	"database/sql"
+	"encoding/json"
+	"expo-open-ota/internal/metadataStore"
+	"fmt"
+	"time"
+)
+
+type SQLApiKeyStore struct {
+	store *metadataStore.SQLMetadataStore
+}
+
+const apiKeysSchema = `CREATE TABLE IF NOT EXISTS api_keys (
+	id TEXT PRIMARY KEY,
+	app TEXT NOT NULL DEFAULT '',
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	branches TEXT NOT NULL,
+	actions TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	expires_at BIGINT,
+	revoked_at BIGINT
+)`
+
+// Tables created before keys were bound to an app only hold keys of the default app
+const addAppColumn = `ALTER TABLE api_keys ADD COLUMN app TEXT NOT NULL DEFAULT ''`
+
+const apiKeyColumns = "id, app, name, prefix, hash, branches, actions, created_at, expires_at, revoked_at"
+
+func NewSQLApiKeyStore(store *metadataStore.SQLMetadataStore) (*SQLApiKeyStore, error) {
+	if _, err := store.DB().Exec(apiKeysSchema); err != nil {
+		return nil, fmt.Errorf("error migrating api keys table: %w", err)
+	}
+	if _, err := store.DB().Exec(`SELECT app FROM api_keys LIMIT 1`); err != nil {
+		if _, err := store.DB().Exec(addAppColumn); err != nil {
+			return nil, fmt.Errorf("error migrating api keys table: %w", err)
+		}
+	}
+	return &SQLApiKeyStore{store: store}, nil
+}
+
+func nullableMillis(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixMilli(), Valid: true}
+}
+
+func fromNullableMillis(value sql.NullInt64) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t := time.UnixMilli(value.Int64).UTC()
+	return &t
+}
+
+func (s *SQLApiKeyStore) Create(key ApiKey) error {
+	branches, err := json.Marshal(key.Branches)
+	if err != nil {
+		return err
+	}
+	actions, err := json.Marshal(key.Actions)
+	if err != nil {
+		return err
+	}
+	query := s.store.Rebind(`INSERT INTO api_keys (` + apiKeyColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	_, err = s.store.DB().Exec(query,
+		key.Id,
+		key.App,
+		key.Name,
+		key.Prefix,
+		key.Hash,
+		string(branches),
+		string(actions),
+		key.CreatedAt.UnixMilli(),
+		nullableMillis(key.ExpiresAt),
+		nullableMillis(key.RevokedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating api key: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLApiKeyStore) List() ([]ApiKey, error) {
+	return s.query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at`)
+}
+
+func (s *SQLApiKeyStore) GetByHash(hash string) (*ApiKey, error) {
+	keys, err := s.query(s.store.Rebind(`SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = ?`), hash)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	return &keys[0], nil
+}
+
+func (s *SQLApiKeyStore) Revoke(id string, revokedAt time.Time) error {
+	query := s.store.Rebind(`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`)
+	result, err := s.store.DB().Exec(query, revokedAt.UnixMilli(), id)
+	if err != nil {
+		return fmt.Errorf("error revoking api key: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrApiKeyNotFound
+	}
+	return nil
+}
+
+func (s *SQLApiKeyStore) query(query string, args ...interface{}) ([]ApiKey, error) {
+	rows, err := s.store.DB().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying api keys: %w", err)
+	}
+	defer rows.Close()
+	keys := []ApiKey{}
+	for rows.Next() {
+		var key ApiKey
+		var branches, actions string
+		var createdAt int64
+		var expiresAt, revokedAt sql.NullInt64
+		if err := rows.Scan(&key.Id, &key.App, &key.Name, &key.Prefix, &key.Hash, &branches, &actions, &createdAt, &expiresAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(branches), &key.Branches); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(actions), &key.Actions); err != nil {
+			return nil, err
+		}
+		key.CreatedAt = time.UnixMilli(createdAt).UTC()
+		key.ExpiresAt = fromNullableMillis(expiresAt)
+		key.RevokedAt = fromNullableMillis(revokedAt)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
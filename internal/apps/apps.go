@@ -0,0 +1,85 @@
+package apps
+
+import (
+	"encoding/json"
+	"errors"
+	"expo-open-ota/config"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// App is an Expo app hosted next to the default one configured by EXPO_APP_ID. Its routes are served
+// under /apps/{id} and its updates are stored apart from the other apps.
+type App struct {
+	Id              string `json:"id"`
+	ExpoAppId       string `json:"expoAppId"`
+	ExpoAccessToken string `json:"expoAccessToken"`
+	PublicKeyPath   string `json:"publicKeyPath"`
+	PrivateKeyPath  string `json:"privateKeyPath"`
+}
+
+// Ids end up in URLs, storage paths and cache keys
+var validId = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+func (a App) validate() error {
+	if !validId.MatchString(a.Id) {
+		return fmt.Errorf("invalid app id %q: lowercase letters, digits and dashes only", a.Id)
+	}
+	if a.ExpoAppId == "" || a.ExpoAccessToken == "" {
+		return fmt.Errorf("app %s: expoAppId and expoAccessToken are required", a.Id)
+	}
+	if a.PublicKeyPath == "" || a.PrivateKeyPath == "" {
+		return fmt.Errorf("app %s: publicKeyPath and privateKeyPath are required", a.Id)
+	}
+	return nil
+}
+
+// ReadKeys reads the PEM encoded key pair the manifests of the app are signed with.
+func (a App) ReadKeys() (string, string, error) {
+	publicKey, err := os.ReadFile(a.PublicKeyPath)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading public key of app %s: %w", a.Id, err)
+	}
+	privateKey, err := os.ReadFile(a.PrivateKeyPath)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading private key of app %s: %w", a.Id, err)
+	}
+	return string(publicKey), string(privateKey), nil
+}
+
+func Load(path string) ([]App, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading apps config: %w", err)
+	}
+	var apps []App
+	if err := json.Unmarshal(content, &apps); err != nil {
+		return nil, fmt.Errorf("error parsing apps config: %w", err)
+	}
+	ids := map[string]struct{}{}
+	expoAppIds := map[string]struct{}{config.GetEnv("EXPO_APP_ID"): {}}
+	for _, app := range apps {
+		if err := app.validate(); err != nil {
+			return nil, err
+		}
+		if _, exists := ids[app.Id]; exists {
+			return nil, fmt.Errorf("duplicate app id %s", app.Id)
+		}
+		if _, exists := expoAppIds[app.ExpoAppId]; exists {
+			return nil, errors.New("each app must have its own expoAppId, also distinct from EXPO_APP_ID")
+		}
+		ids[app.Id] = struct{}{}
+		expoAppIds[app.ExpoAppId] = struct{}{}
+	}
+	return apps, nil
+}
+
+// GetApps returns the apps listed in APPS_CONFIG_PATH, none if it is not set.
+func GetApps() ([]App, error) {
+	path := config.GetEnv("APPS_CONFIG_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	return Load(path)
+}
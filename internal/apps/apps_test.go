@@ -0,0 +1,69 @@
+package apps
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "apps.json")
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("EXPO_APP_ID", "DEFAULT_APP_ID")
+	apps, err := Load(writeConfig(t, `[
+		{"id": "second", "expoAppId": "SECOND", "expoAccessToken": "token", "publicKeyPath": "public.pem", "privateKeyPath": "private.pem"},
+		{"id": "third-app", "expoAppId": "THIRD", "expoAccessToken": "token", "publicKeyPath": "public.pem", "privateKeyPath": "private.pem"}
+	]`))
+	assert.Nil(t, err)
+	assert.Len(t, apps, 2)
+	assert.Equal(t, "third-app", apps[1].Id)
+	assert.Equal(t, "THIRD", apps[1].ExpoAppId)
+}
+
+func TestLoadRejectsInvalidApps(t *testing.T) {
+	t.Setenv("EXPO_APP_ID", "DEFAULT_APP_ID")
+	app := `{"id": "%s", "expoAppId": "%s", "expoAccessToken": "token", "publicKeyPath": "public.pem", "privateKeyPath": "private.pem"}`
+	cases := map[string]string{
+		"invalid id":            `[` + fmt.Sprintf(app, "../other", "SECOND") + `]`,
+		"uppercase id":          `[` + fmt.Sprintf(app, "Second", "SECOND") + `]`,
+		"duplicate id":          `[` + fmt.Sprintf(app, "second", "SECOND") + `,` + fmt.Sprintf(app, "second", "THIRD") + `]`,
+		"duplicate expo app id": `[` + fmt.Sprintf(app, "second", "SECOND") + `,` + fmt.Sprintf(app, "third", "SECOND") + `]`,
+		"default expo app id":   `[` + fmt.Sprintf(app, "second", "DEFAULT_APP_ID") + `]`,
+		"missing keys":          `[{"id": "second", "expoAppId": "SECOND", "expoAccessToken": "token"}]`,
+		"missing expo project":  `[{"id": "second", "publicKeyPath": "public.pem", "privateKeyPath": "private.pem"}]`,
+		"not a list":            `{"id": "second"}`,
+	}
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, content))
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestGetAppsWithoutConfig(t *testing.T) {
+	t.Setenv("APPS_CONFIG_PATH", "")
+	apps, err := GetApps()
+	assert.Nil(t, err)
+	assert.Empty(t, apps)
+}
+
+func TestReadKeys(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "public.pem"), []byte("public"), 0644))
+	app := App{Id: "second", PublicKeyPath: filepath.Join(dir, "public.pem"), PrivateKeyPath: filepath.Join(dir, "private.pem")}
+	_, _, err := app.ReadKeys()
+	assert.NotNil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "private.pem"), []byte("private"), 0644))
+	publicKey, privateKey, err := app.ReadKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, "public", publicKey)
+	assert.Equal(t, "private", privateKey)
+}
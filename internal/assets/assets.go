@@ -26,7 +26,7 @@ type AssetsResponse struct {
 	URL         string
 }
 
-func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *types.BucketFile, string, error) {
+func getAssetMetadata(updates *update.Manager, req AssetsRequest, returnAsset bool) (AssetsResponse, *types.BucketFile, string, error) {
 	requestID := req.RequestID
 
 	if req.AssetName == "" {
@@ -44,7 +44,19 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 		return AssetsResponse{StatusCode: http.StatusBadRequest, Body: []byte("No runtime version provided")}, nil, "", nil
 	}
 
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(req.Branch, req.RuntimeVersion)
+	if err := bucket.ValidateRuntimeVersion(req.RuntimeVersion); err != nil {
+		log.Printf("[RequestID: %s] Invalid runtime version: %v", requestID, err)
+		return AssetsResponse{StatusCode: http.StatusBadRequest, Body: []byte("Invalid runtime version")}, nil, "", nil
+	}
+
+	assetName, err := bucket.CleanAssetPath(req.AssetName)
+	if err != nil {
+		log.Printf("[RequestID: %s] Invalid asset name: %v", requestID, err)
+		return AssetsResponse{StatusCode: http.StatusBadRequest, Body: []byte("Invalid asset name")}, nil, "", nil
+	}
+	req.AssetName = assetName
+
+	lastUpdate, err := updates.GetLatestUpdateBundlePathForRuntimeVersion(req.Branch, req.RuntimeVersion)
 	if err != nil || lastUpdate == nil {
 		log.Printf("[RequestID: %s] No update found for runtimeVersion: %s", requestID, req.RuntimeVersion)
 		return AssetsResponse{StatusCode: http.StatusNotFound, Body: []byte("No update found")}, nil, "", nil
@@ -62,7 +74,7 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 		}, nil, lastUpdate.UpdateId, nil
 	}
 
-	metadata, err := update.GetMetadata(*lastUpdate)
+	metadata, err := updates.GetMetadata(*lastUpdate)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error getting metadata: %v", requestID, err)
 		return AssetsResponse{StatusCode: http.StatusInternalServerError, Body: []byte("Error getting metadata")}, nil, "", nil
@@ -88,7 +100,7 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 		}
 	}
 
-	resolvedBucket := bucket.GetBucket()
+	resolvedBucket := updates.Bucket()
 	asset, err := resolvedBucket.GetFile(*lastUpdate, req.AssetName)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error getting asset: %v", requestID, err)
@@ -116,8 +128,8 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 	}, &asset, lastUpdate.UpdateId, nil
 }
 
-func HandleAssetsWithFile(req AssetsRequest) (AssetsResponse, error) {
-	resp, asset, _, err := getAssetMetadata(req, true)
+func HandleAssetsWithFile(updates *update.Manager, req AssetsRequest) (AssetsResponse, error) {
+	resp, asset, _, err := getAssetMetadata(updates, req, true)
 	if err != nil {
 		return resp, err
 	}
@@ -150,8 +162,8 @@ func HandleAssetsWithFile(req AssetsRequest) (AssetsResponse, error) {
 	return resp, nil
 }
 
-func HandleAssetsWithURL(req AssetsRequest, resolvedCDN cdn.CDN) (AssetsResponse, error) {
-	resp, _, updateId, err := getAssetMetadata(req, false)
+func HandleAssetsWithURL(updates *update.Manager, req AssetsRequest, resolvedCDN cdn.CDN) (AssetsResponse, error) {
+	resp, _, updateId, err := getAssetMetadata(updates, req, false)
 	if err != nil {
 		return resp, err
 	}
@@ -0,0 +1,264 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/metadataStore"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Action string
+
+const (
+	LoginAction                Action = "auth.login"
+	OIDCLoginAction            Action = "auth.oidcLogin"
+	LogoutAction               Action = "auth.logout"
+	RevokeSessionsAction       Action = "auth.revokeSessions"
+	ReadSettingsAction         Action = "settings.read"
+	RequestUploadUrlAction     Action = "update.requestUploadUrl"
+	UploadLocalFileAction      Action = "update.uploadLocalFile"
+	MarkUpdateAsUploadedAction Action = "update.markAsUploaded"
+	DeleteRuntimeVersionAction Action = "runtimeVersion.delete"
+	PromoteUpdateAction        Action = "update.promote"
+	RollbackAction             Action = "update.rollback"
+	DeleteUpdateAction         Action = "update.delete"
+	ExportUpdateAction         Action = "update.export"
+	ImportUpdateAction         Action = "update.import"
+	ReindexAction              Action = "bucket.reindex"
+	CollectGarbageAction       Action = "bucket.gc"
+	CreateApiKeyAction         Action = "apiKey.create"
+	RevokeApiKeyAction         Action = "apiKey.revoke"
+	CreateUserAction           Action = "user.create"
+	UpdateUserAction           Action = "user.update"
+	DeleteUserAction           Action = "user.delete"
+	CreateWebhookAction        Action = "webhook.create"
+	DeleteWebhookAction        Action = "webhook.delete"
+	PingWebhookAction          Action = "webhook.ping"
+)
+
+type ActorType string
+
+const (
+	AnonymousActor ActorType = "anonymous"
+	// A dashboard session, opened with the admin password, a user account or SSO
+	UserActor   ActorType = "user"
+	ApiKeyActor ActorType = "apiKey"
+	ExpoActor   ActorType = "expo"
+)
+
+type Actor struct {
+	Type ActorType `json:"type"`
+	Id   string    `json:"id,omitempty"`
+	Name string    `json:"name,omitempty"`
+}
+
+type Target struct {
+	Branch         string `json:"branch,omitempty"`
+	RuntimeVersion string `json:"runtimeVersion,omitempty"`
+	UpdateId       string `json:"updateId,omitempty"`
+	// Any other resource the action applies to, such as a user or an api key id
+	Resource string `json:"resource,omitempty"`
+}
+
+type Outcome string
+
+const (
+	SuccessOutcome Outcome = "success"
+	// The caller was not authenticated or not allowed to perform the action
+	DeniedOutcome  Outcome = "denied"
+	FailureOutcome Outcome = "failure"
+)
+
+type Event struct {
+	Id        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Action    Action    `json:"action"`
+	Actor     Actor     `json:"actor"`
+	Target    Target    `json:"target"`
+	RequestId string    `json:"requestId,omitempty"`
+	Ip        string    `json:"ip,omitempty"`
+	// Raw X-Forwarded-For header, as sent by the client or the proxies in front of the server
+	ForwardedFor string  `json:"forwardedFor,omitempty"`
+	Outcome      Outcome `json:"outcome"`
+	StatusCode   int     `json:"statusCode,omitempty"`
+	Reason       string  `json:"reason,omitempty"`
+}
+
+func NewEvent(action Action) *Event {
+	return &Event{
+		Id:     uuid.New().String(),
+		Time:   time.Now().UTC(),
+		Action: action,
+		Actor:  Actor{Type: AnonymousActor},
+	}
+}
+
+// Fail marks the event as failed whatever the status code of the response is.
+func (e *Event) Fail(outcome Outcome, reason string) {
+	e.Outcome = outcome
+	e.Reason = reason
+}
+
+type Filter struct {
+	Action         Action
+	Actor          string
+	Branch         string
+	RuntimeVersion string
+	UpdateId       string
+	Outcome        Outcome
+	From           time.Time
+	To             time.Time
+	Limit          int
+}
+
+const (
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 1000
+)
+
+func (f Filter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultQueryLimit
+	}
+	if f.Limit > MaxQueryLimit {
+		return MaxQueryLimit
+	}
+	return f.Limit
+}
+
+func (f Filter) Matches(event Event) bool {
+	if f.Action != "" && event.Action != f.Action {
+		return false
+	}
+	if f.Actor != "" && event.Actor.Id != f.Actor && event.Actor.Name != f.Actor {
+		return false
+	}
+	if f.Branch != "" && event.Target.Branch != f.Branch {
+		return false
+	}
+	if f.RuntimeVersion != "" && event.Target.RuntimeVersion != f.RuntimeVersion {
+		return false
+	}
+	if f.UpdateId != "" && event.Target.UpdateId != f.UpdateId {
+		return false
+	}
+	if f.Outcome != "" && event.Outcome != f.Outcome {
+		return false
+	}
+	if !f.From.IsZero() && event.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && event.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+var ErrQueryNotSupported = errors.New("the audit log sink cannot be queried")
+
+type Sink interface {
+	Write(event Event) error
+	// Query returns the matching events, most recent first
+	Query(filter Filter) ([]Event, error)
+}
+
+type SinkType string
+
+const (
+	BucketSinkType SinkType = "bucket"
+	SQLSinkType    SinkType = "sql"
+	LogSinkType    SinkType = "log"
+	NoSinkType     SinkType = "none"
+)
+
+func ResolveSinkType() SinkType {
+	switch strings.ToLower(config.GetEnv("AUDIT_LOG_SINK")) {
+	case "sql":
+		return SQLSinkType
+	case "log":
+		return LogSinkType
+	case "none":
+		return NoSinkType
+	}
+	return BucketSinkType
+}
+
+var (
+	sinkInstance Sink
+	once         sync.Once
+)
+
+// sharedSink returns the sink shared by every server of the process, nil when the audit log is disabled or
+// kept in the bucket of each server.
+func sharedSink() Sink {
+	once.Do(func() {
+		switch ResolveSinkType() {
+		case NoSinkType, BucketSinkType:
+			return
+		case LogSinkType:
+			sinkInstance = &LogSink{}
+		case SQLSinkType:
+			store, ok := metadataStore.GetMetadataStore().(*metadataStore.SQLMetadataStore)
+			if !ok {
+				log.Fatalf("AUDIT_LOG_SINK=sql requires a metadata store")
+			}
+			sqlSink, err := NewSQLSink(store)
+			if err != nil {
+				log.Fatalf("Error initializing audit log sink: %v", err)
+			}
+			sinkInstance = sqlSink
+		}
+	})
+	return sinkInstance
+}
+
+// SinkForBucket returns the sink of a server keeping its updates in b: the bucket sink writes the events next
+// to the updates, the other sinks are shared by the process. It returns nil when the audit log is disabled.
+func SinkForBucket(b bucket.Bucket) (Sink, error) {
+	if ResolveSinkType() != BucketSinkType {
+		return sharedSink(), nil
+	}
+	storage, ok := b.(bucket.ObjectStorage)
+	if !ok {
+		return nil, errors.New("the bucket cannot store the audit log")
+	}
+	return NewBucketSink(storage), nil
+}
+
+func ResetSinkInstance() {
+	sinkInstance = nil
+	once = sync.Once{}
+}
+
+// Record writes the event to sink, nil when the audit log is disabled. Audit failures are logged but never
+// fail the audited request.
+func Record(sink Sink, event Event) {
+	if sink == nil {
+		return
+	}
+	if err := sink.Write(event); err != nil {
+		log.Printf("[RequestID: %s] Error writing audit event %s: %v", event.RequestId, event.Action, err)
+	}
+}
+
+type eventContextKey struct{}
+
+func WithEvent(ctx context.Context, event *Event) context.Context {
+	return context.WithValue(ctx, eventContextKey{}, event)
+}
+
+// EventFromContext gives handlers access to the event of an audited route, so that they can
+// complete it. On routes that are not audited it returns a detached event that is never recorded.
+func EventFromContext(ctx context.Context) *Event {
+	if event, ok := ctx.Value(eventContextKey{}).(*Event); ok {
+		return event
+	}
+	return NewEvent("")
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/metadataStore"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEvent(action Action, at time.Time, branch string, outcome Outcome) Event {
+	event := *NewEvent(action)
+	event.Time = at.UTC()
+	event.Actor = Actor{Type: UserActor, Id: "user:1", Name: "jane"}
+	event.Target.Branch = branch
+	event.Outcome = outcome
+	return event
+}
+
+func TestFilterMatches(t *testing.T) {
+	now := time.Now()
+	event := newTestEvent(LoginAction, now, "main", SuccessOutcome)
+	assert.True(t, Filter{}.Matches(event))
+	assert.True(t, Filter{Action: LoginAction, Actor: "jane", Branch: "main", Outcome: SuccessOutcome}.Matches(event))
+	assert.True(t, Filter{Actor: "user:1"}.Matches(event))
+	assert.False(t, Filter{Action: LogoutAction}.Matches(event))
+	assert.False(t, Filter{Actor: "john"}.Matches(event))
+	assert.False(t, Filter{Outcome: DeniedOutcome}.Matches(event))
+	assert.False(t, Filter{From: now.Add(time.Minute)}.Matches(event))
+	assert.False(t, Filter{To: now.Add(-time.Minute)}.Matches(event))
+}
+
+func TestFilterLimit(t *testing.T) {
+	assert.Equal(t, DefaultQueryLimit, Filter{}.limit())
+	assert.Equal(t, 10, Filter{Limit: 10}.limit())
+	assert.Equal(t, MaxQueryLimit, Filter{Limit: MaxQueryLimit + 1}.limit())
+}
+
+func assertSinkQueries(t *testing.T, sink Sink) {
+	t.Helper()
+	now := time.Now()
+	older := newTestEvent(LoginAction, now.Add(-48*time.Hour), "", SuccessOutcome)
+	denied := newTestEvent(RequestUploadUrlAction, now.Add(-time.Hour), "main", DeniedOutcome)
+	latest := newTestEvent(MarkUpdateAsUploadedAction, now, "main", SuccessOutcome)
+	for _, event := range []Event{older, denied, latest} {
+		assert.Nil(t, sink.Write(event))
+	}
+
+	events, err := sink.Query(Filter{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{latest.Id, denied.Id, older.Id}, eventIds(events))
+	assert.Equal(t, latest.Actor, events[0].Actor)
+
+	events, err = sink.Query(Filter{Branch: "main"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{latest.Id, denied.Id}, eventIds(events))
+
+	events, err = sink.Query(Filter{Outcome: DeniedOutcome})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{denied.Id}, eventIds(events))
+
+	events, err = sink.Query(Filter{From: now.Add(-24 * time.Hour)})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{latest.Id, denied.Id}, eventIds(events))
+
+	events, err = sink.Query(Filter{Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{latest.Id}, eventIds(events))
+}
+
+func eventIds(events []Event) []string {
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, event.Id)
+	}
+	return ids
+}
+
+func TestBucketSink(t *testing.T) {
+	assertSinkQueries(t, NewBucketSink(&bucket.LocalBucket{BasePath: t.TempDir()}))
+}
+
+func TestBucketSinkIsHiddenFromBranches(t *testing.T) {
+	localBucket := &bucket.LocalBucket{BasePath: t.TempDir()}
+	assert.Nil(t, NewBucketSink(localBucket).Write(newTestEvent(LoginAction, time.Now(), "", SuccessOutcome)))
+	branches, err := localBucket.GetBranches()
+	assert.Nil(t, err)
+	assert.Empty(t, branches)
+}
+
+func TestSQLSink(t *testing.T) {
+	store, err := metadataStore.NewSQLMetadataStore(metadataStore.SQLiteMetadataStoreType, filepath.Join(t.TempDir(), "metadata.db"))
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	sink, err := NewSQLSink(store)
+	assert.Nil(t, err)
+	assertSinkQueries(t, sink)
+}
+
+func TestLogSinkCannotBeQueried(t *testing.T) {
+	sink := &LogSink{}
+	assert.Nil(t, sink.Write(newTestEvent(LoginAction, time.Now(), "", SuccessOutcome)))
+	_, err := sink.Query(Filter{})
+	assert.ErrorIs(t, err, ErrQueryNotSupported)
+}
@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	"fmt"
+	"time"
+)
+
+const auditFolder = bucket.InternalFolder + "/audit/"
+
+// Without a lower bound, queries on the bucket sink look this far back
+const defaultBucketQueryWindow = 30 * 24 * time.Hour
+
+// BucketSink stores one object per event, grouped by day so that queries only list the days they cover.
+type BucketSink struct {
+	storage bucket.ObjectStorage
+}
+
+func NewBucketSink(storage bucket.ObjectStorage) *BucketSink {
+	return &BucketSink{storage: storage}
+}
+
+func dayPrefix(t time.Time) string {
+	return auditFolder + t.UTC().Format("2006/01/02") + "/"
+}
+
+func (s *BucketSink) Write(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	// Zero padded timestamps keep the lexical order of the keys chronological
+	key := fmt.Sprintf("%s%019d-%s.json", dayPrefix(event.Time), event.Time.UnixNano(), event.Id)
+	return s.storage.PutObject(key, bytes.NewReader(payload))
+}
+
+func (s *BucketSink) Query(filter Filter) ([]Event, error) {
+	to := filter.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	from := filter.From
+	if from.IsZero() {
+		from = to.Add(-defaultBucketQueryWindow)
+	}
+	storage := s.storage
+	events := []Event{}
+	for day := to.UTC(); !day.Before(from.UTC().Truncate(24 * time.Hour)); day = day.Add(-24 * time.Hour) {
+		keys, err := storage.ListObjects(dayPrefix(day))
+		if err != nil {
+			return nil, fmt.Errorf("error listing audit events: %w", err)
+		}
+		for i := len(keys) - 1; i >= 0; i-- {
+			event, err := readEvent(storage, keys[i])
+			if err != nil {
+				return nil, err
+			}
+			if !filter.Matches(event) {
+				continue
+			}
+			events = append(events, event)
+			if len(events) >= filter.limit() {
+				return events, nil
+			}
+		}
+	}
+	return events, nil
+}
+
+func readEvent(storage bucket.ObjectStorage, key string) (Event, error) {
+	reader, err := storage.GetObject(key)
+	if err != nil {
+		return Event{}, fmt.Errorf("error reading audit event %s: %w", key, err)
+	}
+	defer reader.Close()
+	var event Event
+	if err := json.NewDecoder(reader).Decode(&event); err != nil {
+		return Event{}, fmt.Errorf("error decoding audit event %s: %w", key, err)
+	}
+	return event, nil
+}
@@ -0,0 +1,22 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// LogSink writes the events as JSON lines in the server logs, to be shipped by an external collector.
+type LogSink struct{}
+
+func (s *LogSink) Write(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Audit] %s", payload)
+	return nil
+}
+
+func (s *LogSink) Query(filter Filter) ([]Event, error) {
+	return nil, ErrQueryNotSupported
+}
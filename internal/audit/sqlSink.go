@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"expo-open-ota/internal/metadataStore"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type SQLSink struct {
+	store *metadataStore.SQLMetadataStore
+}
+
+var auditSchema = []string{
+	`CREATE TABLE IF NOT EXISTS audit_events (
+		id TEXT PRIMARY KEY,
+		time BIGINT NOT NULL,
+		action TEXT NOT NULL,
+		actor_type TEXT NOT NULL,
+		actor_id TEXT NOT NULL DEFAULT '',
+		actor_name TEXT NOT NULL DEFAULT '',
+		branch TEXT NOT NULL DEFAULT '',
+		runtime_version TEXT NOT NULL DEFAULT '',
+		update_id TEXT NOT NULL DEFAULT '',
+		resource TEXT NOT NULL DEFAULT '',
+		request_id TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		forwarded_for TEXT NOT NULL DEFAULT '',
+		outcome TEXT NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_events_time_idx ON audit_events (time)`,
+}
+
+const auditColumns = "id, time, action, actor_type, actor_id, actor_name, branch, runtime_version, update_id, resource, request_id, ip, forwarded_for, outcome, status_code, reason"
+
+func NewSQLSink(store *metadataStore.SQLMetadataStore) (*SQLSink, error) {
+	for _, statement := range auditSchema {
+		if _, err := store.DB().Exec(statement); err != nil {
+			return nil, fmt.Errorf("error migrating audit events table: %w", err)
+		}
+	}
+	return &SQLSink{store: store}, nil
+}
+
+func (s *SQLSink) Write(event Event) error {
+	query := s.store.Rebind(`INSERT INTO audit_events (` + auditColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	_, err := s.store.DB().Exec(query,
+		event.Id,
+		event.Time.UnixMilli(),
+		string(event.Action),
+		string(event.Actor.Type),
+		event.Actor.Id,
+		event.Actor.Name,
+		event.Target.Branch,
+		event.Target.RuntimeVersion,
+		event.Target.UpdateId,
+		event.Target.Resource,
+		event.RequestId,
+		event.Ip,
+		event.ForwardedFor,
+		string(event.Outcome),
+		event.StatusCode,
+		event.Reason,
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting audit event: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLSink) Query(filter Filter) ([]Event, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, value interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, value)
+	}
+	if filter.Action != "" {
+		addCondition("action = ?", string(filter.Action))
+	}
+	if filter.Actor != "" {
+		conditions = append(conditions, "(actor_id = ? OR actor_name = ?)")
+		args = append(args, filter.Actor, filter.Actor)
+	}
+	if filter.Branch != "" {
+		addCondition("branch = ?", filter.Branch)
+	}
+	if filter.RuntimeVersion != "" {
+		addCondition("runtime_version = ?", filter.RuntimeVersion)
+	}
+	if filter.UpdateId != "" {
+		addCondition("update_id = ?", filter.UpdateId)
+	}
+	if filter.Outcome != "" {
+		addCondition("outcome = ?", string(filter.Outcome))
+	}
+	if !filter.From.IsZero() {
+		addCondition("time >= ?", filter.From.UnixMilli())
+	}
+	if !filter.To.IsZero() {
+		addCondition("time <= ?", filter.To.UnixMilli())
+	}
+	query := `SELECT ` + auditColumns + ` FROM audit_events`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY time DESC LIMIT ?`
+	args = append(args, filter.limit())
+	rows, err := s.store.DB().Query(s.store.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit events: %w", err)
+	}
+	defer rows.Close()
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		var eventTime int64
+		var action, actorType, outcome string
+		if err := rows.Scan(
+			&event.Id,
+			&eventTime,
+			&action,
+			&actorType,
+			&event.Actor.Id,
+			&event.Actor.Name,
+			&event.Target.Branch,
+			&event.Target.RuntimeVersion,
+			&event.Target.UpdateId,
+			&event.Target.Resource,
+			&event.RequestId,
+			&event.Ip,
+			&event.ForwardedFor,
+			&outcome,
+			&event.StatusCode,
+			&event.Reason,
+		); err != nil {
+			return nil, err
+		}
+		event.Time = time.UnixMilli(eventTime).UTC()
+		event.Action = Action(action)
+		event.Actor.Type = ActorType(actorType)
+		event.Outcome = Outcome(outcome)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -1,16 +1,52 @@
 package auth
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"expo-open-ota/config"
 	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/users"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"strings"
 	"time"
 )
 
+// Auth signs in the users of an app and keeps track of their sessions.
 type Auth struct {
 	Secret string
+	// App is the id of the app the users sign in to, empty for the default app
+	App      string
+	Sessions SessionStore
+}
+
+// Subject of the tokens issued with the shared ADMIN_PASSWORD
+const AdminDashboardSubject = "admin-dashboard"
+
+const userSubjectPrefix = "user:"
+
+type Principal struct {
+	Subject  string     `json:"subject"`
+	Username string     `json:"username"`
+	Role     users.Role `json:"role"`
+	// passwordHash is the hash of the password of a user account, the tokens issued with it are rejected
+	// once it changes
+	passwordHash string
+}
+
+type principalContextKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalContextKey{}).(*Principal)
+	return principal
 }
 
 func getAdminPassword() string {
@@ -20,81 +56,180 @@ func getAdminPassword() string {
 func isPasswordValid(password string) bool {
 	adminPassword := getAdminPassword()
 	if adminPassword == "" {
-		fmt.Errorf("admin password is not set, all requests will be rejected")
+		log.Printf("admin password is not set, all requests will be rejected")
 		return false
 	}
 	return password == getAdminPassword()
 }
 
+func adminDashboardPrincipal() *Principal {
+	return &Principal{Subject: AdminDashboardSubject, Username: "admin", Role: users.AdminRole}
+}
+
+func UserSubject(userId string) string {
+	return userSubjectPrefix + userId
+}
+
+func userPrincipal(user *users.User) *Principal {
+	return &Principal{Subject: UserSubject(user.Id), Username: user.Username, Role: user.Role, passwordHash: user.PasswordHash}
+}
+
+// passwordFingerprint identifies the password a token was issued with, without revealing anything about it
+func (a *Auth) passwordFingerprint(passwordHash string) string {
+	mac := hmac.New(sha256.New, []byte(a.Secret))
+	mac.Write([]byte(passwordHash))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
 type AuthResponse struct {
 	Token        string `json:"token"`
 	RefreshToken string `json:"refreshToken"`
 }
 
+// NewAuth signs in the users of the default app.
 func NewAuth() *Auth {
-	return &Auth{Secret: config.GetEnv("JWT_SECRET")}
+	return NewAppAuth("", GetSessionStore())
+}
+
+// NewAppAuth signs in the users of app, the tokens issued are only accepted with the same sessions.
+func NewAppAuth(app string, sessions SessionStore) *Auth {
+	return &Auth{Secret: config.GetEnv("JWT_SECRET"), App: app, Sessions: sessions}
 }
 
-func (a *Auth) generateAuthToken() (*string, error) {
-	token, err := services.GenerateJWTToken(a.Secret, jwt.MapClaims{
-		"sub":  "admin-dashboard",
-		"exp":  time.Now().Add(time.Hour * 2).Unix(),
-		"iat":  time.Now().Unix(),
-		"type": "token",
-	})
+// principalClaims are the claims describing the principal in both tokens of a session.
+func (a *Auth) principalClaims(principal *Principal, s *Session) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub":      principal.Subject,
+		"username": principal.Username,
+		"role":     string(principal.Role),
+		"sid":      s.Id,
+		"iat":      time.Now().Unix(),
+	}
+	if principal.passwordHash != "" {
+		claims["pwd"] = a.passwordFingerprint(principal.passwordHash)
+	}
+	return claims
+}
+
+func (a *Auth) generateAuthToken(principal *Principal, s *Session) (*string, error) {
+	claims := a.principalClaims(principal, s)
+	claims["exp"] = time.Now().Add(time.Hour * 2).Unix()
+	claims["type"] = "token"
+	token, err := services.GenerateJWTToken(a.Secret, claims)
 	if err != nil {
 		return nil, fmt.Errorf("error while generating the jwt token: %w", err)
 	}
 	return &token, nil
 }
 
-func (a *Auth) generateRefreshToken() (*string, error) {
-	refreshToken, err := services.GenerateJWTToken(a.Secret, jwt.MapClaims{
-		"sub":  "admin-dashboard",
-		"exp":  time.Now().Add(time.Hour * 24 * 7).Unix(),
-		"iat":  time.Now().Unix(),
-		"type": "refreshToken",
-	})
+func (a *Auth) generateRefreshToken(principal *Principal, s *Session) (*string, error) {
+	claims := a.principalClaims(principal, s)
+	claims["jti"] = s.TokenId
+	claims["exp"] = time.Now().Add(refreshTokenLifetime).Unix()
+	claims["type"] = "refreshToken"
+	refreshToken, err := services.GenerateJWTToken(a.Secret, claims)
 	if err != nil {
 		return nil, fmt.Errorf("error while generating the jwt token: %w", err)
 	}
 	return &refreshToken, nil
 }
 
-func (a *Auth) LoginWithPassword(password string) (*AuthResponse, error) {
-	if !isPasswordValid(password) {
-		return nil, errors.New("invalid password")
-	}
-	token, err := a.generateAuthToken()
+func (a *Auth) issueSessionTokens(principal *Principal, s *Session) (*AuthResponse, error) {
+	token, err := a.generateAuthToken(principal, s)
 	if err != nil {
 		return nil, err
 	}
-	refreshToken, err := a.generateRefreshToken()
+	refreshToken, err := a.generateRefreshToken(principal, s)
 	if err != nil {
 		return nil, err
 	}
-
 	return &AuthResponse{
 		Token:        *token,
 		RefreshToken: *refreshToken,
 	}, nil
 }
 
-func (a *Auth) ValidateToken(tokenString string) (*jwt.Token, error) {
+// issueTokens starts a new session, every successful login goes through here.
+func (a *Auth) issueTokens(principal *Principal) (*AuthResponse, error) {
+	s, err := a.startSession()
+	if err != nil {
+		return nil, err
+	}
+	return a.issueSessionTokens(principal, s)
+}
+
+func (a *Auth) LoginWithPassword(password string) (*AuthResponse, error) {
+	if !isPasswordValid(password) {
+		return nil, errors.New("invalid password")
+	}
+	return a.issueTokens(adminDashboardPrincipal())
+}
+
+func (a *Auth) LoginWithCredentials(username string, password string) (*AuthResponse, error) {
+	user, err := users.Authenticate(a.App, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return a.issueTokens(userPrincipal(user))
+}
+
+func principalFromClaims(claims jwt.MapClaims) (*Principal, error) {
+	subject, _ := claims["sub"].(string)
+	role, _ := claims["role"].(string)
+	if !users.IsValidRole(users.Role(role)) {
+		return nil, errors.New("invalid token role")
+	}
+	username, _ := claims["username"].(string)
+	return &Principal{Subject: subject, Username: username, Role: users.Role(role)}, nil
+}
+
+// resolvePrincipal loads the current state of the subject, so that the tokens of deleted users or issued
+// before a password change are rejected and role changes apply right away.
+// OIDC users are not stored locally, their role is kept until they log in again.
+func (a *Auth) resolvePrincipal(subject string, claims jwt.MapClaims) (*Principal, error) {
+	if subject == AdminDashboardSubject {
+		return adminDashboardPrincipal(), nil
+	}
+	if strings.HasPrefix(subject, oidcSubjectPrefix) {
+		return principalFromClaims(claims)
+	}
+	if !strings.HasPrefix(subject, userSubjectPrefix) {
+		return nil, errors.New("invalid token subject")
+	}
+	user, err := users.GetUser(a.App, strings.TrimPrefix(subject, userSubjectPrefix))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token subject")
+	}
+	if !hmac.Equal([]byte(stringClaim(claims, "pwd")), []byte(a.passwordFingerprint(user.PasswordHash))) {
+		return nil, errors.New("password changed since the token was issued")
+	}
+	return userPrincipal(user), nil
+}
+
+func (a *Auth) ValidateToken(tokenString string) (*Principal, error) {
 	claims := jwt.MapClaims{}
-	token, err := services.DecodeAndExtractJWTToken(a.Secret, tokenString, &claims)
+	_, err := services.DecodeAndExtractJWTToken(a.Secret, tokenString, &claims)
 	if err != nil {
 		return nil, err
 	}
 	if claims["type"] != "token" {
 		return nil, errors.New("invalid token type")
 	}
-	if claims["sub"] != "admin-dashboard" {
-		return nil, errors.New("invalid token subject")
+	if !a.isSessionActive(stringClaim(claims, "sid")) {
+		return nil, ErrSessionRevoked
 	}
-	return token, nil
+	return a.resolvePrincipal(stringClaim(claims, "sub"), claims)
 }
 
+func stringClaim(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// RefreshToken rotates the refresh token: the given one can only be used once.
 func (a *Auth) RefreshToken(tokenString string) (*AuthResponse, error) {
 	claims := jwt.MapClaims{}
 	_, err := services.DecodeAndExtractJWTToken(a.Secret, tokenString, &claims)
@@ -104,19 +239,33 @@ func (a *Auth) RefreshToken(tokenString string) (*AuthResponse, error) {
 	if claims["type"] != "refreshToken" {
 		return nil, errors.New("invalid token type")
 	}
-	if claims["sub"] != "admin-dashboard" {
-		return nil, errors.New("invalid token subject")
+	sessionId := stringClaim(claims, "sid")
+	s, err := a.rotateSession(sessionId, stringClaim(claims, "jti"))
+	if errors.Is(err, ErrRefreshTokenReused) {
+		log.Printf("Refresh token reuse detected for %s, session %s revoked", stringClaim(claims, "sub"), sessionId)
 	}
-	newToken, err := a.generateAuthToken()
 	if err != nil {
 		return nil, err
 	}
-	refreshToken, err := a.generateRefreshToken()
+	principal, err := a.resolvePrincipal(stringClaim(claims, "sub"), claims)
 	if err != nil {
+		a.endSession(sessionId)
 		return nil, err
 	}
-	return &AuthResponse{
-		Token:        *newToken,
-		RefreshToken: *refreshToken,
-	}, nil
+	return a.issueSessionTokens(principal, s)
+}
+
+// Logout ends the session of the given access or refresh token.
+func (a *Auth) Logout(tokenString string) error {
+	claims := jwt.MapClaims{}
+	_, err := services.DecodeAndExtractJWTToken(a.Secret, tokenString, &claims)
+	if err != nil {
+		return err
+	}
+	sessionId := stringClaim(claims, "sid")
+	if sessionId == "" {
+		return errors.New("token has no session")
+	}
+	a.endSession(sessionId)
+	return nil
 }
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// MemorySessionStore keeps the sessions in the memory of the process, they are lost on restart.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]Session{}}
+}
+
+// Create also drops the expired sessions, so that the store does not grow with the logins
+func (s *MemorySessionStore) Create(session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, existing := range s.sessions {
+		if !existing.ExpiresAt.After(now) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[session.Id] = session
+	return nil
+}
+
+func (s *MemorySessionStore) Get(id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (s *MemorySessionStore) Rotate(id string, tokenId string, next string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || !session.ExpiresAt.After(time.Now()) || session.TokenId != tokenId {
+		return false, nil
+	}
+	session.TokenId = next
+	session.ExpiresAt = expiresAt
+	s.sessions[id] = session
+	return true, nil
+}
+
+func (s *MemorySessionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = map[string]Session{}
+	return nil
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/config"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/users"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const oidcSubjectPrefix = "oidc:"
+
+const (
+	// Time left to the user to authenticate on the identity provider
+	OIDCStateTTL = 600
+	// Time left to the dashboard to exchange the one-time login code for tokens
+	oidcLoginCodeTTL = 60
+)
+
+var (
+	ErrInvalidOIDCState   = errors.New("invalid or expired OIDC state")
+	ErrNoRoleForOIDCUser  = errors.New("none of the OIDC groups of the user is mapped to a role")
+	ErrInvalidLoginCode   = errors.New("invalid or expired login code")
+	ErrOIDCNotConfigured  = errors.New("OIDC is not configured")
+	ErrMissingOIDCIdToken = errors.New("no id_token in the OIDC token response")
+)
+
+type oidcLoginState struct {
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+type oidcClient struct {
+	verifier     *oidc.IDTokenVerifier
+	oauth2Config oauth2.Config
+}
+
+var (
+	oidcClientInstance *oidcClient
+	oidcMutex          sync.Mutex
+)
+
+func IsOIDCEnabled() bool {
+	return config.GetEnv("OIDC_ISSUER_URL") != ""
+}
+
+func OIDCRedirectURL() string {
+	return strings.TrimSuffix(config.GetEnv("BASE_URL"), "/") + "/auth/oidc/callback"
+}
+
+// getOIDCClient runs the discovery of the identity provider on first use. Unlike the other
+// singletons a failed discovery is not kept, so that the provider being down at boot is not fatal.
+func getOIDCClient() (*oidcClient, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+	if oidcClientInstance != nil {
+		return oidcClientInstance, nil
+	}
+	if !IsOIDCEnabled() {
+		return nil, ErrOIDCNotConfigured
+	}
+	// The provider keeps this context to fetch the signing keys later on, it must outlive the request
+	provider, err := oidc.NewProvider(context.Background(), config.GetEnv("OIDC_ISSUER_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("error discovering OIDC provider: %w", err)
+	}
+	clientId := config.GetEnv("OIDC_CLIENT_ID")
+	oidcClientInstance = &oidcClient{
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientId}),
+		oauth2Config: oauth2.Config{
+			ClientID:     clientId,
+			ClientSecret: config.GetEnv("OIDC_CLIENT_SECRET"),
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  OIDCRedirectURL(),
+			Scopes:       strings.Fields(config.GetEnv("OIDC_SCOPES")),
+		},
+	}
+	return oidcClientInstance, nil
+}
+
+func ResetOIDCClientInstance() {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+	oidcClientInstance = nil
+}
+
+func randomToken() (string, error) {
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+func oidcStateCacheKey(state string) string {
+	return "oidc:state:" + state
+}
+
+func loginCodeCacheKey(code string) string {
+	return "oidc:loginCode:" + code
+}
+
+// oidcStateBinding is the value kept in the browser that started the login, the state itself only
+// travels through the identity provider.
+func oidcStateBinding(state string) string {
+	hash := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// StartOIDCLogin returns the authorization URL of the identity provider the browser must be
+// redirected to, and the binding the browser must present to the callback so that a login started
+// elsewhere cannot be completed in it. The PKCE verifier and the nonce are kept in the cache until the callback.
+func StartOIDCLogin() (string, string, error) {
+	client, err := getOIDCClient()
+	if err != nil {
+		return "", "", err
+	}
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	loginState := oidcLoginState{Verifier: oauth2.GenerateVerifier(), Nonce: nonce}
+	payload, err := json.Marshal(loginState)
+	if err != nil {
+		return "", "", err
+	}
+	ttl := OIDCStateTTL
+	if err := cache2.GetCache().Set(oidcStateCacheKey(state), string(payload), &ttl); err != nil {
+		return "", "", fmt.Errorf("error storing OIDC state: %w", err)
+	}
+	authorizationUrl := client.oauth2Config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(loginState.Verifier))
+	return authorizationUrl, oidcStateBinding(state), nil
+}
+
+func consumeOIDCState(state string, binding string) (*oidcLoginState, error) {
+	if state == "" || subtle.ConstantTimeCompare([]byte(binding), []byte(oidcStateBinding(state))) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+	cache := cache2.GetCache()
+	payload := cache.Get(oidcStateCacheKey(state))
+	if payload == "" {
+		return nil, ErrInvalidOIDCState
+	}
+	cache.Delete(oidcStateCacheKey(state))
+	var loginState oidcLoginState
+	if err := json.Unmarshal([]byte(payload), &loginState); err != nil {
+		return nil, ErrInvalidOIDCState
+	}
+	return &loginState, nil
+}
+
+// LoginWithOIDC completes the authorization code flow started by StartOIDCLogin in the browser presenting
+// binding and issues the same tokens as the other login methods.
+func (a *Auth) LoginWithOIDC(ctx context.Context, state string, code string, binding string) (*AuthResponse, error) {
+	loginState, err := consumeOIDCState(state, binding)
+	if err != nil {
+		return nil, err
+	}
+	client, err := getOIDCClient()
+	if err != nil {
+		return nil, err
+	}
+	token, err := client.oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(loginState.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging OIDC authorization code: %w", err)
+	}
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIdToken == "" {
+		return nil, ErrMissingOIDCIdToken
+	}
+	idToken, err := client.verifier.Verify(ctx, rawIdToken)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying OIDC id_token: %w", err)
+	}
+	if idToken.Nonce != loginState.Nonce {
+		return nil, errors.New("invalid OIDC nonce")
+	}
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("error decoding OIDC claims: %w", err)
+	}
+	principal, err := oidcPrincipal(idToken.Subject, claims)
+	if err != nil {
+		return nil, err
+	}
+	return a.issueTokens(principal)
+}
+
+func oidcPrincipal(subject string, claims map[string]interface{}) (*Principal, error) {
+	role, ok := ResolveOIDCRole(extractGroups(claims[config.GetEnv("OIDC_GROUPS_CLAIM")]))
+	if !ok {
+		return nil, ErrNoRoleForOIDCUser
+	}
+	username := subject
+	for _, claim := range []string{"preferred_username", "email", "name"} {
+		if value, _ := claims[claim].(string); value != "" {
+			username = value
+			break
+		}
+	}
+	return &Principal{Subject: oidcSubjectPrefix + subject, Username: username, Role: role}, nil
+}
+
+func extractGroups(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		groups := make([]string, 0, len(value))
+		for _, group := range value {
+			if name, ok := group.(string); ok {
+				groups = append(groups, name)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// ResolveOIDCRole returns the highest role mapped to one of the groups, falling back to
+// OIDC_DEFAULT_ROLE. It returns false when the user must not be let in.
+func ResolveOIDCRole(groups []string) (users.Role, bool) {
+	mappings := []struct {
+		role users.Role
+		env  string
+	}{
+		{users.AdminRole, "OIDC_ADMIN_GROUPS"},
+		{users.PublisherRole, "OIDC_PUBLISHER_GROUPS"},
+		{users.ViewerRole, "OIDC_VIEWER_GROUPS"},
+	}
+	for _, mapping := range mappings {
+		for _, mappedGroup := range splitList(config.GetEnv(mapping.env)) {
+			for _, group := range groups {
+				if group == mappedGroup {
+					return mapping.role, true
+				}
+			}
+		}
+	}
+	defaultRole := users.Role(config.GetEnv("OIDC_DEFAULT_ROLE"))
+	if users.IsValidRole(defaultRole) {
+		return defaultRole, true
+	}
+	return "", false
+}
+
+// CreateLoginCode keeps the tokens behind a short-lived single-use code, so that they never
+// appear in the URL the identity provider callback redirects the browser to.
+func CreateLoginCode(response *AuthResponse) (string, error) {
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+	ttl := oidcLoginCodeTTL
+	if err := cache2.GetCache().Set(loginCodeCacheKey(code), string(payload), &ttl); err != nil {
+		return "", fmt.Errorf("error storing login code: %w", err)
+	}
+	return code, nil
+}
+
+func ExchangeLoginCode(code string) (*AuthResponse, error) {
+	if code == "" {
+		return nil, ErrInvalidLoginCode
+	}
+	cache := cache2.GetCache()
+	payload := cache.Get(loginCodeCacheKey(code))
+	if payload == "" {
+		return nil, ErrInvalidLoginCode
+	}
+	cache.Delete(loginCodeCacheKey(code))
+	var response AuthResponse
+	if err := json.Unmarshal([]byte(payload), &response); err != nil {
+		return nil, ErrInvalidLoginCode
+	}
+	return &response, nil
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"expo-open-ota/internal/users"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveOIDCRole(t *testing.T) {
+	os.Setenv("OIDC_ADMIN_GROUPS", "ota-admins")
+	os.Setenv("OIDC_PUBLISHER_GROUPS", "ota-publishers, release-managers")
+	os.Setenv("OIDC_VIEWER_GROUPS", "developers")
+	defer func() {
+		os.Unsetenv("OIDC_ADMIN_GROUPS")
+		os.Unsetenv("OIDC_PUBLISHER_GROUPS")
+		os.Unsetenv("OIDC_VIEWER_GROUPS")
+		os.Unsetenv("OIDC_DEFAULT_ROLE")
+	}()
+
+	role, ok := ResolveOIDCRole([]string{"developers", "ota-admins"})
+	assert.True(t, ok)
+	assert.Equal(t, users.AdminRole, role)
+	role, ok = ResolveOIDCRole([]string{"release-managers"})
+	assert.True(t, ok)
+	assert.Equal(t, users.PublisherRole, role)
+	_, ok = ResolveOIDCRole([]string{"marketing"})
+	assert.False(t, ok)
+	_, ok = ResolveOIDCRole(nil)
+	assert.False(t, ok)
+
+	os.Setenv("OIDC_DEFAULT_ROLE", "viewer")
+	role, ok = ResolveOIDCRole([]string{"marketing"})
+	assert.True(t, ok)
+	assert.Equal(t, users.ViewerRole, role)
+}
+
+func TestExtractGroups(t *testing.T) {
+	assert.Equal(t, []string{"admins"}, extractGroups("admins"))
+	assert.Equal(t, []string{"a", "b"}, extractGroups([]interface{}{"a", 3, "b"}))
+	assert.Nil(t, extractGroups(nil))
+}
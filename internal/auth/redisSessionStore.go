@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	cache2 "expo-open-ota/internal/cache"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisSessionStore keeps each session in a key expiring with it. Every session is ended at once by
+// bumping the generation in the keys, which has no expiration: the Redis must not evict keys without
+// one (maxmemory-policy noeviction or volatile-*), or the revoked sessions would come back.
+type RedisSessionStore struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// Replaces the token id only when it still is the expected one, in a single step
+var rotateSessionScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	return 1
+end
+return 0
+`)
+
+func NewRedisSessionStore(opts cache2.RedisOptions) *RedisSessionStore {
+	return &RedisSessionStore{client: cache2.NewRedisClient(opts), keyPrefix: opts.Prefix()}
+}
+
+func (s *RedisSessionStore) generationKey() string {
+	return s.keyPrefix + ":sessions:generation"
+}
+
+func (s *RedisSessionStore) sessionKey(ctx context.Context, id string) (string, error) {
+	generation, err := s.client.Get(ctx, s.generationKey()).Result()
+	if errors.Is(err, redis.Nil) {
+		generation = "0"
+	} else if err != nil {
+		return "", err
+	}
+	return s.keyPrefix + ":session:" + generation + ":" + id, nil
+}
+
+func (s *RedisSessionStore) Create(session Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	key, err := s.sessionKey(ctx, session.Id)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, key, session.TokenId, time.Until(session.ExpiresAt)).Err()
+}
+
+func (s *RedisSessionStore) Get(id string) (*Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	key, err := s.sessionKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	tokenId, err := s.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := s.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Id: id, TokenId: tokenId, ExpiresAt: time.Now().Add(ttl)}, nil
+}
+
+func (s *RedisSessionStore) Rotate(id string, tokenId string, next string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	key, err := s.sessionKey(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	rotated, err := rotateSessionScript.Run(ctx, s.client, []string{key}, tokenId, next, time.Until(expiresAt).Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return rotated == 1, nil
+}
+
+func (s *RedisSessionStore) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	key, err := s.sessionKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.client.Del(ctx, key).Err()
+}
+
+// DeleteAll leaves the keys of the previous generation to expire by themselves
+func (s *RedisSessionStore) DeleteAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return s.client.Incr(ctx, s.generationKey()).Err()
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"errors"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/metadataStore"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const refreshTokenLifetime = time.Hour * 24 * 7
+
+var (
+	ErrSessionRevoked     = errors.New("session has been revoked or has expired")
+	ErrRefreshTokenReused = errors.New("refresh token has already been used, session revoked")
+)
+
+// A Session is the chain of refresh tokens issued from a single login. Only the id of the latest
+// refresh token of the chain is kept: presenting an older one means it leaked.
+type Session struct {
+	Id        string
+	TokenId   string
+	ExpiresAt time.Time
+}
+
+// SessionStore keeps the sessions of an app until they expire. Unlike the cache, it must never drop a session
+// early nor forget a revocation, so it is never bounded by size.
+type SessionStore interface {
+	Create(session Session) error
+	// Get returns nil when the session is unknown, ended or expired
+	Get(id string) (*Session, error)
+	// Rotate replaces the token id of the session with next only if it still is tokenId, in a single
+	// atomic step, so that two refreshes with the same token cannot both succeed.
+	Rotate(id string, tokenId string, next string, expiresAt time.Time) (bool, error)
+	Delete(id string) error
+	// DeleteAll ends every session of the app
+	DeleteAll() error
+}
+
+var (
+	sessionStoreInstance SessionStore
+	sessionStoreOnce     sync.Once
+	appSessionStores     = map[string]SessionStore{}
+	appSessionStoresMu   sync.Mutex
+)
+
+// newSessionStore keeps the sessions of app in the metadata store when it is enabled, then in Redis when
+// the cache uses it, so that every replica shares them, and in the memory of the process otherwise.
+func newSessionStore(app string) SessionStore {
+	if store, ok := metadataStore.GetMetadataStore().(*metadataStore.SQLMetadataStore); ok {
+		sqlStore, err := NewSQLSessionStore(store, app)
+		if err != nil {
+			log.Fatalf("Error initializing session store: %v", err)
+		}
+		return sqlStore
+	}
+	switch cache2.ResolveCacheType() {
+	case cache2.RedisCacheType, cache2.LayeredCacheType:
+		opts := cache2.ResolveRedisOptions()
+		if app != "" {
+			opts.KeyPrefix = opts.Prefix() + ":apps:" + app
+		}
+		return NewRedisSessionStore(opts)
+	default:
+		return NewMemorySessionStore()
+	}
+}
+
+// GetSessionStore returns the sessions of the default app.
+func GetSessionStore() SessionStore {
+	sessionStoreOnce.Do(func() {
+		sessionStoreInstance = newSessionStore("")
+	})
+	return sessionStoreInstance
+}
+
+// GetAppSessionStore returns the sessions of an app hosted next to the default one, they are kept apart
+// from the sessions of the other apps.
+func GetAppSessionStore(app string) SessionStore {
+	if app == "" {
+		return GetSessionStore()
+	}
+	appSessionStoresMu.Lock()
+	defer appSessionStoresMu.Unlock()
+	store, ok := appSessionStores[app]
+	if !ok {
+		store = newSessionStore(app)
+		appSessionStores[app] = store
+	}
+	return store
+}
+
+func ResetSessionStoreInstance() {
+	sessionStoreInstance = nil
+	sessionStoreOnce = sync.Once{}
+	appSessionStoresMu.Lock()
+	appSessionStores = map[string]SessionStore{}
+	appSessionStoresMu.Unlock()
+}
+
+func sessionExpiration() time.Time {
+	return time.Now().Add(refreshTokenLifetime)
+}
+
+func (a *Auth) startSession() (*Session, error) {
+	s := &Session{Id: uuid.New().String(), TokenId: uuid.New().String(), ExpiresAt: sessionExpiration()}
+	if err := a.Sessions.Create(*s); err != nil {
+		return nil, fmt.Errorf("error storing session: %w", err)
+	}
+	return s, nil
+}
+
+func (a *Auth) isSessionActive(sessionId string) bool {
+	if sessionId == "" {
+		return false
+	}
+	s, err := a.Sessions.Get(sessionId)
+	if err != nil {
+		log.Printf("Error reading session %s: %v", sessionId, err)
+		return false
+	}
+	return s != nil
+}
+
+// rotateSession consumes the refresh token tokenId and returns the session with the id of the
+// next refresh token. Reusing a consumed refresh token revokes the whole session.
+func (a *Auth) rotateSession(sessionId string, tokenId string) (*Session, error) {
+	if !a.isSessionActive(sessionId) {
+		return nil, ErrSessionRevoked
+	}
+	s := &Session{Id: sessionId, TokenId: uuid.New().String(), ExpiresAt: sessionExpiration()}
+	rotated, err := a.Sessions.Rotate(sessionId, tokenId, s.TokenId, s.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("error storing session: %w", err)
+	}
+	if !rotated {
+		a.endSession(sessionId)
+		return nil, ErrRefreshTokenReused
+	}
+	return s, nil
+}
+
+func (a *Auth) endSession(sessionId string) {
+	if err := a.Sessions.Delete(sessionId); err != nil {
+		log.Printf("Error ending session %s: %v", sessionId, err)
+	}
+}
+
+// RevokeAllSessions invalidates every access and refresh token issued so far for the app.
+func (a *Auth) RevokeAllSessions() error {
+	if err := a.Sessions.DeleteAll(); err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+	return nil
+}
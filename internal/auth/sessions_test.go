@@ -0,0 +1,118 @@
+package auth
+
+import (
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/metadataStore"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func sessionStores(t *testing.T) map[string]SessionStore {
+	metadata, err := metadataStore.NewSQLMetadataStore(metadataStore.SQLiteMetadataStoreType, filepath.Join(t.TempDir(), "metadata.db"))
+	assert.Nil(t, err)
+	t.Cleanup(func() { metadata.Close() })
+	sqlStore, err := NewSQLSessionStore(metadata, "")
+	assert.Nil(t, err)
+	redisServer := miniredis.RunT(t)
+	return map[string]SessionStore{
+		"memory": NewMemorySessionStore(),
+		"sql":    sqlStore,
+		"redis":  NewRedisSessionStore(cache2.RedisOptions{Host: redisServer.Host(), Port: redisServer.Port()}),
+	}
+}
+
+func TestSessionStores(t *testing.T) {
+	for name, store := range sessionStores(t) {
+		t.Run(name, func(t *testing.T) {
+			expiresAt := time.Now().Add(time.Hour)
+			assert.Nil(t, store.Create(Session{Id: "a", TokenId: "1", ExpiresAt: expiresAt}))
+			assert.Nil(t, store.Create(Session{Id: "b", TokenId: "1", ExpiresAt: expiresAt}))
+			session, err := store.Get("a")
+			assert.Nil(t, err)
+			assert.Equal(t, "1", session.TokenId)
+
+			rotated, err := store.Rotate("a", "1", "2", expiresAt)
+			assert.Nil(t, err)
+			assert.True(t, rotated)
+			rotated, err = store.Rotate("a", "1", "3", expiresAt)
+			assert.Nil(t, err)
+			assert.False(t, rotated)
+			session, err = store.Get("a")
+			assert.Nil(t, err)
+			assert.Equal(t, "2", session.TokenId)
+
+			assert.Nil(t, store.Delete("a"))
+			session, err = store.Get("a")
+			assert.Nil(t, err)
+			assert.Nil(t, session)
+			rotated, err = store.Rotate("a", "2", "3", expiresAt)
+			assert.Nil(t, err)
+			assert.False(t, rotated)
+
+			assert.Nil(t, store.DeleteAll())
+			session, err = store.Get("b")
+			assert.Nil(t, err)
+			assert.Nil(t, session)
+			assert.Nil(t, store.Create(Session{Id: "c", TokenId: "1", ExpiresAt: expiresAt}))
+			session, err = store.Get("c")
+			assert.Nil(t, err)
+			assert.NotNil(t, session)
+		})
+	}
+}
+
+func TestSessionStoresRotateOnce(t *testing.T) {
+	for name, store := range sessionStores(t) {
+		t.Run(name, func(t *testing.T) {
+			expiresAt := time.Now().Add(time.Hour)
+			assert.Nil(t, store.Create(Session{Id: "a", TokenId: "1", ExpiresAt: expiresAt}))
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			rotations := 0
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rotated, err := store.Rotate("a", "1", "2", expiresAt)
+					assert.Nil(t, err)
+					if rotated {
+						mu.Lock()
+						rotations++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, 1, rotations)
+		})
+	}
+}
+
+func TestSQLSessionStoresOfApps(t *testing.T) {
+	metadata, err := metadataStore.NewSQLMetadataStore(metadataStore.SQLiteMetadataStoreType, filepath.Join(t.TempDir(), "metadata.db"))
+	assert.Nil(t, err)
+	t.Cleanup(func() { metadata.Close() })
+	defaultStore, err := NewSQLSessionStore(metadata, "")
+	assert.Nil(t, err)
+	appStore, err := NewSQLSessionStore(metadata, "second")
+	assert.Nil(t, err)
+	expiresAt := time.Now().Add(time.Hour)
+	assert.Nil(t, defaultStore.Create(Session{Id: "a", TokenId: "1", ExpiresAt: expiresAt}))
+	assert.Nil(t, appStore.Create(Session{Id: "b", TokenId: "1", ExpiresAt: expiresAt}))
+
+	session, err := appStore.Get("a")
+	assert.Nil(t, err)
+	assert.Nil(t, session)
+	rotated, err := appStore.Rotate("a", "1", "2", expiresAt)
+	assert.Nil(t, err)
+	assert.False(t, rotated)
+	assert.Nil(t, appStore.DeleteAll())
+	session, err = defaultStore.Get("a")
+	assert.Nil(t, err)
+	assert.NotNil(t, session)
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"expo-open-ota/internal/metadataStore"
+	"fmt"
+	"time"
+)
+
+// SQLSessionStore keeps the sessions of a single app, the apps share the table.
+type SQLSessionStore struct {
+	store *metadataStore.SQLMetadataStore
+	app   string
+}
+
+const sessionsSchema = `CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	app TEXT NOT NULL DEFAULT '',
+	token_id TEXT NOT NULL,
+	expires_at BIGINT NOT NULL
+)`
+
+func NewSQLSessionStore(store *metadataStore.SQLMetadataStore, app string) (*SQLSessionStore, error) {
+	if _, err := store.DB().Exec(sessionsSchema); err != nil {
+		return nil, fmt.Errorf("error migrating sessions table: %w", err)
+	}
+	return &SQLSessionStore{store: store, app: app}, nil
+}
+
+// Create also drops the expired sessions, so that the table does not grow with the logins
+func (s *SQLSessionStore) Create(session Session) error {
+	if _, err := s.store.DB().Exec(s.store.Rebind(`DELETE FROM sessions WHERE expires_at <= ?`), time.Now().UnixMilli()); err != nil {
+		return fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+	query := s.store.Rebind(`INSERT INTO sessions (id, app, token_id, expires_at) VALUES (?, ?, ?, ?)`)
+	if _, err := s.store.DB().Exec(query, session.Id, s.app, session.TokenId, session.ExpiresAt.UnixMilli()); err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLSessionStore) Get(id string) (*Session, error) {
+	query := s.store.Rebind(`SELECT id, token_id, expires_at FROM sessions WHERE id = ? AND app = ? AND expires_at > ?`)
+	rows, err := s.store.DB().Query(query, id, s.app, time.Now().UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("error querying sessions: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var session Session
+	var expiresAt int64
+	if err := rows.Scan(&session.Id, &session.TokenId, &expiresAt); err != nil {
+		return nil, err
+	}
+	session.ExpiresAt = time.UnixMilli(expiresAt)
+	return &session, nil
+}
+
+// Rotate relies on the condition of the UPDATE, only one of two concurrent rotations matches the row
+func (s *SQLSessionStore) Rotate(id string, tokenId string, next string, expiresAt time.Time) (bool, error) {
+	query := s.store.Rebind(`UPDATE sessions SET token_id = ?, expires_at = ? WHERE id = ? AND app = ? AND token_id = ? AND expires_at > ?`)
+	result, err := s.store.DB().Exec(query, next, expiresAt.UnixMilli(), id, s.app, tokenId, time.Now().UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("error rotating session: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (s *SQLSessionStore) Delete(id string) error {
+	if _, err := s.store.DB().Exec(s.store.Rebind(`DELETE FROM sessions WHERE id = ? AND app = ?`), id, s.app); err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLSessionStore) DeleteAll() error {
+	if _, err := s.store.DB().Exec(s.store.Rebind(`DELETE FROM sessions WHERE app = ?`), s.app); err != nil {
+		return fmt.Errorf("error deleting sessions: %w", err)
+	}
+	return nil
+}
@@ -6,12 +6,16 @@ import (
 )
 
 func UpsertBranch(branch string) error {
-	branches, err := services.FetchExpoBranches()
+	return UpsertProjectBranch(services.DefaultExpoProject(), branch)
+}
+
+func UpsertProjectBranch(project services.ExpoProject, branch string) error {
+	branches, err := project.FetchBranches()
 	if err != nil {
 		return err
 	}
 	if !helpers.StringInSlice(branch, branches) {
-		return services.CreateBranch(branch)
+		return project.CreateBranch(branch)
 	}
 	return nil
 }
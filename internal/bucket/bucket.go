@@ -6,7 +6,10 @@ import (
 	"expo-open-ota/internal/types"
 	"fmt"
 	"io"
+	"net/url"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -22,7 +25,7 @@ type Bucket interface {
 	GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error)
 	GetUpdates(branch string, runtimeVersion string) ([]types.Update, error)
 	GetFile(update types.Update, assetPath string) (types.BucketFile, error)
-	RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string) (string, error)
+	RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string, subject string) (string, error)
 	UploadFileIntoUpdate(update types.Update, fileName string, file io.Reader) error
 	DeleteUpdateFolder(branch string, runtimeVersion string, updateId string) error
 }
@@ -30,8 +33,9 @@ type Bucket interface {
 type BucketType string
 
 const (
-	S3BucketType    BucketType = "s3"
-	LocalBucketType BucketType = "local"
+	S3BucketType     BucketType = "s3"
+	LocalBucketType  BucketType = "local"
+	MemoryBucketType BucketType = "memory"
 )
 
 func ResolveBucketType() BucketType {
@@ -39,6 +43,9 @@ func ResolveBucketType() BucketType {
 	if bucketType == "" || bucketType == "local" {
 		return LocalBucketType
 	}
+	if bucketType == "memory" {
+		return MemoryBucketType
+	}
 	return S3BucketType
 }
 
@@ -62,14 +69,85 @@ func GetBucket() Bucket {
 				bucketInstance = &LocalBucket{
 					BasePath: basePath,
 				}
+			case MemoryBucketType:
+				bucketInstance = NewMemoryBucket()
 			default:
 				panic(fmt.Sprintf("Unknown bucket type: %s", bucketType))
 			}
+			replicated, err := replicateFromEnv(bucketInstance, "")
+			if err != nil {
+				panic(fmt.Sprintf("Invalid storage replicas: %v", err))
+			}
+			bucketInstance = replicated
 		}
 	})
 	return bucketInstance
 }
 
+// AppsFolder is the hidden folder holding the updates of the apps hosted next to the default one.
+const AppsFolder = ".apps"
+
+// NewAppBucket keeps the updates of an app in its own folder of the storage configured by STORAGE_MODE and of
+// its replicas, the local uploads being served under baseURL.
+func NewAppBucket(app string, baseURL string) (Bucket, error) {
+	primary, err := newAppPrimaryBucket(app, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return replicateFromEnv(primary, app)
+}
+
+func newAppPrimaryBucket(app string, baseURL string) (Bucket, error) {
+	switch bucketType := ResolveBucketType(); bucketType {
+	case S3BucketType:
+		return &S3Bucket{
+			BucketName: config.GetEnv("S3_BUCKET_NAME"),
+			Prefix:     AppsFolder + "/" + app,
+		}, nil
+	case LocalBucketType:
+		basePath := filepath.Join(config.GetEnv("LOCAL_BUCKET_BASE_PATH"), AppsFolder, app)
+		if err := os.MkdirAll(basePath, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("error creating bucket folder of app %s: %w", app, err)
+		}
+		return &LocalBucket{BasePath: basePath, BaseURL: baseURL}, nil
+	case MemoryBucketType:
+		memoryBucket := NewMemoryBucket()
+		memoryBucket.BaseURL = baseURL
+		return memoryBucket, nil
+	default:
+		return nil, fmt.Errorf("unknown bucket type: %s", bucketType)
+	}
+}
+
+// ParseLocation resolves "local:/path/to/folder" and "s3://bucket-name/optional/prefix?region=eu-west-1", the
+// S3 buckets being reached with the AWS credentials of the environment, in AWS_REGION unless region is set.
+func ParseLocation(location string) (Bucket, error) {
+	switch {
+	case strings.HasPrefix(location, "local:"):
+		basePath := strings.TrimPrefix(location, "local:")
+		if basePath == "" {
+			return nil, fmt.Errorf("missing folder in %q", location)
+		}
+		if err := os.MkdirAll(basePath, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("error creating bucket folder %s: %w", basePath, err)
+		}
+		return &LocalBucket{BasePath: basePath}, nil
+	case strings.HasPrefix(location, "s3://"):
+		path, query, _ := strings.Cut(strings.TrimPrefix(location, "s3://"), "?")
+		bucketName, prefix, _ := strings.Cut(path, "/")
+		if bucketName == "" {
+			return nil, fmt.Errorf("missing bucket name in %q", location)
+		}
+		parameters, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameters in %q: %w", location, err)
+		}
+		return &S3Bucket{BucketName: bucketName, Prefix: strings.Trim(prefix, "/"), Region: parameters.Get("region")}, nil
+	default:
+		return nil, fmt.Errorf("unknown bucket %q, expected local:<folder> or s3://<bucket>[/<prefix>][?region=<region>]", location)
+	}
+}
+
 func ConvertReadCloserToBytes(rc io.ReadCloser) ([]byte, error) {
 	defer rc.Close()
 	var buf bytes.Buffer
@@ -80,24 +158,31 @@ func ConvertReadCloserToBytes(rc io.ReadCloser) ([]byte, error) {
 }
 
 func ResetBucketInstance() {
+	if replicated, ok := bucketInstance.(*ReplicatedBucket); ok {
+		replicated.Close()
+	}
 	bucketInstance = nil
 	once = sync.Once{}
 }
 
+// SetBucketInstance serves the updates from the given bucket instead of the one configured by STORAGE_MODE.
+func SetBucketInstance(b Bucket) {
+	ResetBucketInstance()
+	bucketInstance = b
+}
+
 type FileUploadRequest struct {
 	RequestUploadUrl string `json:"requestUploadUrl"`
 	FileName         string `json:"fileName"`
 	FilePath         string `json:"filePath"`
 }
 
-func RequestUploadUrlsForFileUpdates(branch string, runtimeVersion string, updateId string, fileNames []string) ([]FileUploadRequest, error) {
+func RequestUploadUrlsForFileUpdates(resolvedBucket Bucket, branch string, runtimeVersion string, updateId string, fileNames []string, subject string) ([]FileUploadRequest, error) {
 	uniqueFileNames := make(map[string]struct{})
 	for _, fileName := range fileNames {
 		uniqueFileNames[fileName] = struct{}{}
 	}
 
-	bucket := GetBucket()
-
 	var requests []FileUploadRequest
 	var mu sync.Mutex
 	var wg sync.WaitGroup
@@ -107,7 +192,7 @@ func RequestUploadUrlsForFileUpdates(branch string, runtimeVersion string, updat
 	for fileName := range uniqueFileNames {
 		go func(fileName string) {
 			defer wg.Done()
-			requestUploadUrl, err := bucket.RequestUploadUrlForFileUpdate(branch, runtimeVersion, updateId, fileName)
+			requestUploadUrl, err := resolvedBucket.RequestUploadUrlForFileUpdate(branch, runtimeVersion, updateId, fileName, subject)
 			if err != nil {
 				errChan <- err
 				return
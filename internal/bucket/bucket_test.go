@@ -85,3 +85,33 @@ func TestGetLocalBucket(t *testing2.T) {
 	bucket := GetBucket()
 	assert.IsType(t, &LocalBucket{}, bucket)
 }
+
+func TestParseLocation(t *testing2.T) {
+	basePath := t.TempDir() + "/replica"
+	parsed, err := ParseLocation("local:" + basePath)
+	assert.Nil(t, err)
+	assert.Equal(t, &LocalBucket{BasePath: basePath}, parsed)
+	assert.DirExists(t, basePath)
+
+	parsed, err = ParseLocation("s3://ota-updates/apps/main?region=us-east-1")
+	assert.Nil(t, err)
+	assert.Equal(t, &S3Bucket{BucketName: "ota-updates", Prefix: "apps/main", Region: "us-east-1"}, parsed)
+
+	for _, location := range []string{"local:", "s3://", "gs://ota-updates", "/data"} {
+		_, err = ParseLocation(location)
+		assert.NotNil(t, err, location)
+	}
+}
+
+func TestGetReplicatedBucket(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	t.Setenv("STORAGE_MODE", "local")
+	t.Setenv("LOCAL_BUCKET_BASE_PATH", t.TempDir())
+	t.Setenv("STORAGE_REPLICAS", "local:"+t.TempDir()+", s3://ota-updates-eu?region=eu-west-1")
+	replicated, ok := GetBucket().(*ReplicatedBucket)
+	if assert.True(t, ok) {
+		assert.IsType(t, &LocalBucket{}, Primary(replicated))
+		assert.Len(t, replicated.replicators, 2)
+	}
+}
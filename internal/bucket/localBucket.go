@@ -8,46 +8,83 @@ import (
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"io"
-	"mime/multipart"
 	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type LocalBucket struct {
 	BasePath string
+	// BaseURL is the URL the upload route is served under, BASE_URL when empty
+	BaseURL string
 }
 
 func (b *LocalBucket) DeleteUpdateFolder(branch string, runtimeVersion string, updateId string) error {
 	if b.BasePath == "" {
 		return errors.New("BasePath not set")
 	}
-	dirPath := filepath.Join(b.BasePath, branch, runtimeVersion, updateId)
+	folder, err := updateFolderKey(branch, runtimeVersion, updateId)
+	if err != nil {
+		return err
+	}
+	dirPath, err := resolveWithin(b.BasePath, folder)
+	if err != nil {
+		return err
+	}
 	return os.RemoveAll(dirPath)
 }
 
-func (b *LocalBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string) (string, error) {
+func (b *LocalBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string, subject string) (string, error) {
 	if b.BasePath == "" {
 		return "", errors.New("BasePath not set")
 	}
-	dirPath := filepath.Join(b.BasePath, branch, runtimeVersion, updateId)
-	err := os.MkdirAll(dirPath, os.ModePerm)
+	key, err := updateFileKey(branch, runtimeVersion, updateId, fileName)
 	if err != nil {
 		return "", err
 	}
-	token, err := services.GenerateJWTToken(config.GetEnv("JWT_SECRET"), jwt.MapClaims{
-		"sub":      services.FetchSelfExpoUsername(),
+	filePath, err := resolveWithin(b.BasePath, key)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+	return requestLocalUploadUrl(b.BaseURL, filePath, subject)
+}
+
+func resolveUploadBaseURL(baseURL string) string {
+	if baseURL != "" {
+		return baseURL
+	}
+	return config.GetEnv("BASE_URL")
+}
+
+// requestLocalUploadUrl signs the URL of the upload handler served under baseURL writing to filePath, a path
+// on disk for the local storage or a key for the memory one, for the principal named by subject.
+func requestLocalUploadUrl(baseURL string, filePath string, subject string) (string, error) {
+	if subject == "" {
+		return "", errors.New("no subject for the upload token")
+	}
+	claims := jwt.MapClaims{
+		"sub":      subject,
 		"exp":      time.Now().Add(time.Minute * 10).Unix(),
-		"filePath": filepath.Join(dirPath, fileName),
+		"filePath": filePath,
 		"action":   "uploadLocalFile",
-	})
+	}
+	if baseURL != "" {
+		// Binds the token to the bucket of its app, memory buckets of several apps share their keys
+		claims["aud"] = baseURL
+	}
+	token, err := services.GenerateJWTToken(config.GetEnv("JWT_SECRET"), claims)
 	if err != nil {
 		return "", err
 	}
-	parsedURL, err := url.Parse(config.GetEnv("BASE_URL"))
+	parsedURL, err := url.Parse(resolveUploadBaseURL(baseURL))
 	if err != nil {
 		return "", fmt.Errorf("invalid base URL: %w", err)
 	}
@@ -65,6 +102,12 @@ func (b *LocalBucket) GetUpdates(branch string, runtimeVersion string) ([]types.
 	if b.BasePath == "" {
 		return nil, errors.New("BasePath not set")
 	}
+	if err := ValidateBranch(branch); err != nil {
+		return nil, err
+	}
+	if err := ValidateRuntimeVersion(runtimeVersion); err != nil {
+		return nil, err
+	}
 	dirPath := filepath.Join(b.BasePath, branch, runtimeVersion)
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
@@ -92,7 +135,14 @@ func (b *LocalBucket) GetFile(update types.Update, assetPath string) (types.Buck
 		return types.BucketFile{}, errors.New("BasePath not set")
 	}
 
-	filePath := filepath.Join(b.BasePath, update.Branch, update.RuntimeVersion, update.UpdateId, assetPath)
+	key, err := updateFileKey(update.Branch, update.RuntimeVersion, update.UpdateId, assetPath)
+	if err != nil {
+		return types.BucketFile{}, err
+	}
+	filePath, err := resolveWithin(b.BasePath, key)
+	if err != nil {
+		return types.BucketFile{}, err
+	}
 
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -120,17 +170,103 @@ func (b *LocalBucket) GetBranches() ([]string, error) {
 	}
 	var branches []string
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() && !isHiddenFolder(entry.Name()) {
 			branches = append(branches, entry.Name())
 		}
 	}
 	return branches, nil
 }
 
+func (b *LocalBucket) PutObject(key string, body io.Reader) error {
+	if b.BasePath == "" {
+		return errors.New("BasePath not set")
+	}
+	filePath, err := b.resolveObjectKey(key)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(filePath, func(out io.Writer) error {
+		_, err := io.Copy(out, body)
+		return err
+	})
+}
+
+func (b *LocalBucket) GetObject(key string) (io.ReadCloser, error) {
+	if b.BasePath == "" {
+		return nil, errors.New("BasePath not set")
+	}
+	filePath, err := b.resolveObjectKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filePath)
+}
+
+func (b *LocalBucket) DeleteObject(key string) error {
+	if b.BasePath == "" {
+		return errors.New("BasePath not set")
+	}
+	filePath, err := b.resolveObjectKey(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *LocalBucket) ListObjects(prefix string) ([]string, error) {
+	if b.BasePath == "" {
+		return nil, errors.New("BasePath not set")
+	}
+	if err := ValidateObjectPrefix(prefix); err != nil {
+		return nil, err
+	}
+	// Only walk the folder holding the prefix instead of the whole bucket
+	root := filepath.Join(b.BasePath, filepath.FromSlash(prefix[:strings.LastIndex(prefix, "/")+1]))
+	var keys []string
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || isStagedFile(entry.Name()) {
+			return nil
+		}
+		relativePath, err := filepath.Rel(b.BasePath, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(relativePath); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (b *LocalBucket) resolveObjectKey(key string) (string, error) {
+	if err := ValidateObjectKey(key); err != nil {
+		return "", err
+	}
+	return resolveWithin(b.BasePath, key)
+}
+
 func (b *LocalBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error) {
 	if b.BasePath == "" {
 		return nil, errors.New("BasePath not set")
 	}
+	if err := ValidateBranch(branch); err != nil {
+		return nil, err
+	}
 	dirPath := filepath.Join(b.BasePath, branch)
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
@@ -176,24 +312,22 @@ func (b *LocalBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithSta
 }
 
 func (b *LocalBucket) UploadFileIntoUpdate(update types.Update, fileName string, file io.Reader) error {
-	filePath := filepath.Join(b.BasePath, update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
-	err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+	key, err := updateFileKey(update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
 	if err != nil {
 		return err
 	}
-	out, err := os.Create(filePath)
+	filePath, err := resolveWithin(b.BasePath, key)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-	_, err = io.Copy(out, file)
-	if err != nil {
+	return writeFileAtomically(filePath, func(out io.Writer) error {
+		_, err := io.Copy(out, file)
 		return err
-	}
-	return nil
+	})
 }
 
-func ValidateUploadTokenAndResolveFilePath(token string) (string, error) {
+// ValidateUploadTokenAndResolveFilePath only accepts the upload tokens issued to the principal named by subject
+func ValidateUploadTokenAndResolveFilePath(resolvedBucket Bucket, token string, subject string) (string, error) {
 	claims := jwt.MapClaims{}
 	decodedToken, err := services.DecodeAndExtractJWTToken(config.GetEnv("JWT_SECRET"), token, claims)
 	if err != nil {
@@ -202,31 +336,32 @@ func ValidateUploadTokenAndResolveFilePath(token string) (string, error) {
 	if !decodedToken.Valid {
 		return "", errors.New("invalid token")
 	}
-	action := claims["action"].(string)
-	filePath := claims["filePath"].(string)
-	sub := claims["sub"].(string)
-	if sub != services.FetchSelfExpoUsername() {
+	action, _ := claims["action"].(string)
+	filePath, _ := claims["filePath"].(string)
+	sub, _ := claims["sub"].(string)
+	if sub == "" || sub != subject {
 		return "", errors.New("invalid token sub")
 	}
 	if action != "uploadLocalFile" {
 		return "", errors.New("invalid token action")
 	}
-	return filePath, nil
-}
-
-func HandleUploadFile(filePath string, body multipart.File) (bool, error) {
-	err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
-	if err != nil {
-		return false, err
-	}
-	file, err := os.Create(filePath)
-	if err != nil {
-		return false, err
-	}
-	defer file.Close()
-	_, err = io.Copy(file, body)
-	if err != nil {
-		return false, err
+	audience, _ := claims["aud"].(string)
+	// Tokens are signed by the server, this only guards against a leaked secret
+	switch b := Primary(resolvedBucket).(type) {
+	case *MemoryBucket:
+		if audience != b.BaseURL {
+			return "", errors.New("invalid token audience")
+		}
+		return filePath, ValidateObjectKey(filePath)
+	case *LocalBucket:
+		if audience != b.BaseURL {
+			return "", errors.New("invalid token audience")
+		}
+		if !isWithin(b.BasePath, filePath) {
+			return "", unsafePath("file path", filePath, "leaves the bucket")
+		}
+		return filePath, nil
+	default:
+		return "", errors.New("bucket does not accept local uploads")
 	}
-	return true, nil
 }
@@ -0,0 +1,278 @@
+package bucket
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expo-open-ota/config"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUploadTooLarge       = errors.New("upload exceeds the maximum size")
+	ErrChecksumMismatch     = errors.New("checksum mismatch")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrInvalidContentRange  = errors.New("invalid content range")
+)
+
+// PartialUploadsFolder holds the chunks of the resumable uploads in progress on the local storage
+const PartialUploadsFolder = InternalFolder + "/partialUploads"
+
+// UploadChecksums are the optional digests a client sends along with a body, verified before it is kept.
+type UploadChecksums struct {
+	MD5    []byte
+	Sha256 []byte
+}
+
+// ContentRange is a chunk of a resumable upload, "bytes 0-1023/4096" covers the first KiB of a 4 KiB file.
+type ContentRange struct {
+	Start int64
+	End   int64
+	Total int64
+}
+
+func (c ContentRange) Length() int64 {
+	return c.End - c.Start + 1
+}
+
+func ParseContentRange(header string) (ContentRange, error) {
+	var contentRange ContentRange
+	value, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return contentRange, fmt.Errorf("%w: %q", ErrInvalidContentRange, header)
+	}
+	byteRange, total, found := strings.Cut(value, "/")
+	if !found {
+		return contentRange, fmt.Errorf("%w: %q", ErrInvalidContentRange, header)
+	}
+	start, end, found := strings.Cut(byteRange, "-")
+	if !found {
+		return contentRange, fmt.Errorf("%w: %q", ErrInvalidContentRange, header)
+	}
+	var errs [3]error
+	contentRange.Start, errs[0] = strconv.ParseInt(start, 10, 64)
+	contentRange.End, errs[1] = strconv.ParseInt(end, 10, 64)
+	contentRange.Total, errs[2] = strconv.ParseInt(total, 10, 64)
+	if errors.Join(errs[:]...) != nil || contentRange.Start < 0 || contentRange.End < contentRange.Start || contentRange.End >= contentRange.Total {
+		return ContentRange{}, fmt.Errorf("%w: %q", ErrInvalidContentRange, header)
+	}
+	return contentRange, nil
+}
+
+func MaxLocalUploadSize() int64 {
+	return config.GetIntEnv("LOCAL_UPLOAD_MAX_BYTES", 1)
+}
+
+type checksumWriter struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+}
+
+func newChecksumWriter() *checksumWriter {
+	return &checksumWriter{md5: md5.New(), sha256: sha256.New()}
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	c.md5.Write(p)
+	return c.sha256.Write(p)
+}
+
+func (c *checksumWriter) verify(checksums UploadChecksums) error {
+	if checksums.MD5 != nil && !bytes.Equal(checksums.MD5, c.md5.Sum(nil)) {
+		return fmt.Errorf("%w: Content-MD5", ErrChecksumMismatch)
+	}
+	if checksums.Sha256 != nil && !bytes.Equal(checksums.Sha256, c.sha256.Sum(nil)) {
+		return fmt.Errorf("%w: SHA-256", ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// copyLimited copies at most limit bytes and fails instead of truncating a larger body.
+func copyLimited(dst io.Writer, src io.Reader, limit int64) (int64, error) {
+	written, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err != nil {
+		return written, err
+	}
+	if written > limit {
+		return written, ErrUploadTooLarge
+	}
+	return written, nil
+}
+
+const stagedFileSuffix = ".staged"
+
+// isStagedFile tells the files being written apart from the files of the bucket.
+func isStagedFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, stagedFileSuffix)
+}
+
+// writeFileAtomically stages the content next to its destination and renames it once fully written,
+// so that readers never see a partially written file.
+func writeFileAtomically(filePath string, write func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+	temporary, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.upload")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+	err = write(temporary)
+	if err == nil {
+		err = temporary.Sync()
+	}
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), filePath)
+}
+
+// HandleUploadFile streams a whole file to its destination, verifying its size and checksums before it is kept.
+func HandleUploadFile(filePath string, body io.Reader, checksums UploadChecksums) error {
+	return writeFileAtomically(filePath, func(file io.Writer) error {
+		checksum := newChecksumWriter()
+		if _, err := copyLimited(io.MultiWriter(file, checksum), body, MaxLocalUploadSize()); err != nil {
+			return err
+		}
+		return checksum.verify(checksums)
+	})
+}
+
+// HandleObjectUpload verifies a whole file before writing it to the object storage, for buckets kept in memory.
+func HandleObjectUpload(storage ObjectStorage, key string, body io.Reader, checksums UploadChecksums) error {
+	var content bytes.Buffer
+	checksum := newChecksumWriter()
+	if _, err := copyLimited(io.MultiWriter(&content, checksum), body, MaxLocalUploadSize()); err != nil {
+		return err
+	}
+	if err := checksum.verify(checksums); err != nil {
+		return err
+	}
+	return storage.PutObject(key, &content)
+}
+
+var partialUploadLocks sync.Map
+
+func lockPartialUpload(partialPath string) func() {
+	lock, _ := partialUploadLocks.LoadOrStore(partialPath, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+// partialUploadPath keeps the chunks received so far out of the update folder, on the same volume for the rename.
+func (b *LocalBucket) partialUploadPath(filePath string) string {
+	name := sha256.Sum256([]byte(filePath))
+	return filepath.Join(b.BasePath, filepath.FromSlash(PartialUploadsFolder), hex.EncodeToString(name[:]))
+}
+
+// PartialUploadOffset is the number of bytes of a resumable upload already received.
+func (b *LocalBucket) PartialUploadOffset(filePath string) (int64, error) {
+	info, err := os.Stat(b.partialUploadPath(filePath))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// HandleUploadChunk appends a chunk to a resumable upload, chunks must be sent in order and the checksums cover
+// the chunk only. The file is moved into place once its last byte is received, and the new offset is returned.
+func (b *LocalBucket) HandleUploadChunk(filePath string, body io.Reader, contentRange ContentRange, checksums UploadChecksums) (int64, bool, error) {
+	if contentRange.Total > MaxLocalUploadSize() {
+		return 0, false, ErrUploadTooLarge
+	}
+	partialPath := b.partialUploadPath(filePath)
+	unlock := lockPartialUpload(partialPath)
+	defer unlock()
+	if err := os.MkdirAll(filepath.Dir(partialPath), os.ModePerm); err != nil {
+		return 0, false, err
+	}
+	partial, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, false, err
+	}
+	defer partial.Close()
+	info, err := partial.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	offset := info.Size()
+	if contentRange.Start != offset {
+		return offset, false, fmt.Errorf("%w: expected a chunk starting at %d", ErrUploadOffsetMismatch, offset)
+	}
+	if _, err := partial.Seek(offset, io.SeekStart); err != nil {
+		return offset, false, err
+	}
+	checksum := newChecksumWriter()
+	written, err := copyLimited(io.MultiWriter(partial, checksum), body, contentRange.Length())
+	if err == nil && written != contentRange.Length() {
+		err = fmt.Errorf("%w: received %d bytes for %d", ErrInvalidContentRange, written, contentRange.Length())
+	}
+	if err == nil {
+		err = checksum.verify(checksums)
+	}
+	if err != nil {
+		// Drop the chunk so that the client can send it again
+		if truncateErr := partial.Truncate(offset); truncateErr != nil {
+			return offset, false, errors.Join(err, truncateErr)
+		}
+		return offset, false, err
+	}
+	offset += written
+	if offset < contentRange.Total {
+		return offset, false, nil
+	}
+	if err := partial.Sync(); err != nil {
+		return offset, false, err
+	}
+	if err := partial.Close(); err != nil {
+		return offset, false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return offset, false, err
+	}
+	if err := os.Rename(partialPath, filePath); err != nil {
+		return offset, false, err
+	}
+	partialUploadLocks.Delete(partialPath)
+	return offset, true, nil
+}
+
+// SweepPartialUploads removes the resumable uploads left untouched since before the given time.
+func (b *LocalBucket) SweepPartialUploads(before time.Time) (int, error) {
+	folder := filepath.Join(b.BasePath, filepath.FromSlash(PartialUploadsFolder))
+	entries, err := os.ReadDir(folder)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	swept := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(folder, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return swept, err
+		}
+		swept++
+	}
+	return swept, nil
+}
@@ -0,0 +1,143 @@
+package bucket
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useLocalUploads(t *testing.T) string {
+	t.Helper()
+	basePath := t.TempDir()
+	os.Setenv("LOCAL_BUCKET_BASE_PATH", basePath)
+	t.Cleanup(func() {
+		os.Unsetenv("LOCAL_BUCKET_BASE_PATH")
+		os.Unsetenv("LOCAL_UPLOAD_MAX_BYTES")
+	})
+	return basePath
+}
+
+func TestParseContentRange(t *testing.T) {
+	contentRange, err := ParseContentRange("bytes 0-1023/4096")
+	assert.Nil(t, err)
+	assert.Equal(t, ContentRange{Start: 0, End: 1023, Total: 4096}, contentRange)
+	assert.Equal(t, int64(1024), contentRange.Length())
+	for _, header := range []string{"", "bytes */4096", "bytes 0-1023/*", "bytes 10-5/20", "bytes 0-20/20", "bytes -1-5/20", "items 0-1/2"} {
+		_, err := ParseContentRange(header)
+		assert.ErrorIs(t, err, ErrInvalidContentRange, header)
+	}
+}
+
+func TestHandleUploadFile(t *testing.T) {
+	basePath := useLocalUploads(t)
+	filePath := filepath.Join(basePath, "main", "1", "1700000000000", "bundles", "ios.hbc")
+	md5Sum := md5.Sum([]byte("bundle"))
+	sha256Sum := sha256.Sum256([]byte("bundle"))
+	assert.Nil(t, HandleUploadFile(filePath, strings.NewReader("bundle"), UploadChecksums{MD5: md5Sum[:], Sha256: sha256Sum[:]}))
+	content, err := os.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "bundle", string(content))
+
+	// A failed upload keeps the previous file and leaves no temporary file behind
+	err = HandleUploadFile(filePath, strings.NewReader("tampered"), UploadChecksums{Sha256: sha256Sum[:]})
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	os.Setenv("LOCAL_UPLOAD_MAX_BYTES", "4")
+	assert.ErrorIs(t, HandleUploadFile(filePath, strings.NewReader("too large"), UploadChecksums{}), ErrUploadTooLarge)
+	content, err = os.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "bundle", string(content))
+	entries, err := os.ReadDir(filepath.Dir(filePath))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestHandleUploadChunk(t *testing.T) {
+	basePath := useLocalUploads(t)
+	b := &LocalBucket{BasePath: basePath}
+	filePath := filepath.Join(basePath, "main", "1", "1700000000000", "assets", "abc")
+
+	offset, complete, err := b.HandleUploadChunk(filePath, strings.NewReader("hello "), ContentRange{Start: 0, End: 5, Total: 11}, UploadChecksums{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), offset)
+	assert.False(t, complete)
+	received, err := b.PartialUploadOffset(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), received)
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err))
+
+	// Chunks must be sent in order, and a chunk failing its checksum can be sent again
+	offset, _, err = b.HandleUploadChunk(filePath, strings.NewReader("hello "), ContentRange{Start: 0, End: 5, Total: 11}, UploadChecksums{})
+	assert.ErrorIs(t, err, ErrUploadOffsetMismatch)
+	assert.Equal(t, int64(6), offset)
+	wrongSum := sha256.Sum256([]byte("other"))
+	offset, _, err = b.HandleUploadChunk(filePath, strings.NewReader("world"), ContentRange{Start: 6, End: 10, Total: 11}, UploadChecksums{Sha256: wrongSum[:]})
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Equal(t, int64(6), offset)
+	_, _, err = b.HandleUploadChunk(filePath, strings.NewReader("wor"), ContentRange{Start: 6, End: 10, Total: 11}, UploadChecksums{})
+	assert.ErrorIs(t, err, ErrInvalidContentRange)
+
+	sum := sha256.Sum256([]byte("world"))
+	offset, complete, err = b.HandleUploadChunk(filePath, strings.NewReader("world"), ContentRange{Start: 6, End: 10, Total: 11}, UploadChecksums{Sha256: sum[:]})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), offset)
+	assert.True(t, complete)
+	content, err := os.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(content))
+	received, err = b.PartialUploadOffset(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), received)
+
+	os.Setenv("LOCAL_UPLOAD_MAX_BYTES", "10")
+	_, _, err = b.HandleUploadChunk(filePath, strings.NewReader("a"), ContentRange{Start: 0, End: 0, Total: 11}, UploadChecksums{})
+	assert.ErrorIs(t, err, ErrUploadTooLarge)
+}
+
+func TestSweepPartialUploads(t *testing.T) {
+	basePath := useLocalUploads(t)
+	b := &LocalBucket{BasePath: basePath}
+	filePath := filepath.Join(basePath, "main", "1", "1700000000000", "metadata.json")
+	_, _, err := b.HandleUploadChunk(filePath, strings.NewReader("{"), ContentRange{Start: 0, End: 0, Total: 2}, UploadChecksums{})
+	assert.Nil(t, err)
+
+	swept, err := b.SweepPartialUploads(time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, swept)
+	swept, err = b.SweepPartialUploads(time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, swept)
+	offset, err := b.PartialUploadOffset(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), offset)
+}
+
+func TestWriteFileAtomically(t *testing.T) {
+	basePath := useLocalUploads(t)
+	b := &LocalBucket{BasePath: basePath}
+	assert.Nil(t, b.PutObject("main/1/1700000000000/.check", strings.NewReader("committed")))
+
+	failing := errors.New("connection reset")
+	err := writeFileAtomically(filepath.Join(basePath, "main", "1", "1700000000000", ".check"), func(out io.Writer) error {
+		_, _ = out.Write([]byte("{\"ver"))
+		return failing
+	})
+	assert.ErrorIs(t, err, failing)
+	content, err := os.ReadFile(filepath.Join(basePath, "main", "1", "1700000000000", ".check"))
+	assert.Nil(t, err)
+	assert.Equal(t, "committed", string(content))
+
+	// Files still being written are not listed
+	assert.Nil(t, os.WriteFile(filepath.Join(basePath, "main", "1", "1700000000000", ".metadata.json.123"+stagedFileSuffix), []byte("{"), 0644))
+	keys, err := b.ListObjects("main/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"main/1/1700000000000/.check"}, keys)
+}
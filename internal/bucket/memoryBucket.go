@@ -0,0 +1,233 @@
+package bucket
+
+import (
+	"bytes"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	content []byte
+	modTime time.Time
+}
+
+// MemoryBucket keeps every object in memory, for tests and throwaway servers. Its content is lost with the process.
+type MemoryBucket struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+	// Now dates the objects written, time.Now when nil
+	Now func() time.Time
+	// BaseURL is the URL the upload route is served under, BASE_URL when empty
+	BaseURL string
+}
+
+func NewMemoryBucket() *MemoryBucket {
+	return &MemoryBucket{objects: map[string]memoryObject{}}
+}
+
+func (b *MemoryBucket) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
+}
+
+func (b *MemoryBucket) put(key string, body io.Reader) error {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.objects == nil {
+		b.objects = map[string]memoryObject{}
+	}
+	b.objects[key] = memoryObject{content: content, modTime: b.now()}
+	return nil
+}
+
+// children lists the distinct names found right under a folder, along with the keys below each of them.
+func (b *MemoryBucket) children(folder string) map[string][]string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	children := map[string][]string{}
+	for key := range b.objects {
+		relative, found := strings.CutPrefix(key, folder)
+		if !found {
+			continue
+		}
+		name, rest, isFolder := strings.Cut(relative, "/")
+		if isFolder {
+			children[name] = append(children[name], rest)
+		}
+	}
+	return children
+}
+
+func (b *MemoryBucket) GetBranches() ([]string, error) {
+	branches := []string{}
+	for name := range b.children("") {
+		if !isHiddenFolder(name) {
+			branches = append(branches, name)
+		}
+	}
+	sort.Strings(branches)
+	return branches, nil
+}
+
+func (b *MemoryBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error) {
+	if err := ValidateBranch(branch); err != nil {
+		return nil, err
+	}
+	var runtimeVersions []RuntimeVersionWithStats
+	for runtimeVersion, keys := range b.children(branch + "/") {
+		timestamps := map[int64]struct{}{}
+		for _, key := range keys {
+			updateId, _, _ := strings.Cut(key, "/")
+			if timestamp, err := strconv.ParseInt(updateId, 10, 64); err == nil {
+				timestamps[timestamp] = struct{}{}
+			}
+		}
+		if len(timestamps) == 0 {
+			continue
+		}
+		sorted := make([]int64, 0, len(timestamps))
+		for timestamp := range timestamps {
+			sorted = append(sorted, timestamp)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		runtimeVersions = append(runtimeVersions, RuntimeVersionWithStats{
+			RuntimeVersion:  runtimeVersion,
+			CreatedAt:       time.UnixMilli(sorted[0]).UTC().Format(time.RFC3339),
+			LastUpdatedAt:   time.UnixMilli(sorted[len(sorted)-1]).UTC().Format(time.RFC3339),
+			NumberOfUpdates: len(sorted),
+		})
+	}
+	sort.Slice(runtimeVersions, func(i, j int) bool { return runtimeVersions[i].RuntimeVersion < runtimeVersions[j].RuntimeVersion })
+	return runtimeVersions, nil
+}
+
+func (b *MemoryBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
+	if err := ValidateBranch(branch); err != nil {
+		return nil, err
+	}
+	if err := ValidateRuntimeVersion(runtimeVersion); err != nil {
+		return nil, err
+	}
+	updates := []types.Update{}
+	for name := range b.children(branch + "/" + runtimeVersion + "/") {
+		updateId, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		updates = append(updates, types.Update{
+			Branch:         branch,
+			RuntimeVersion: runtimeVersion,
+			UpdateId:       strconv.FormatInt(updateId, 10),
+			CreatedAt:      time.Duration(updateId) * time.Millisecond,
+		})
+	}
+	return updates, nil
+}
+
+func (b *MemoryBucket) GetFile(update types.Update, assetPath string) (types.BucketFile, error) {
+	key, err := updateFileKey(update.Branch, update.RuntimeVersion, update.UpdateId, assetPath)
+	if err != nil {
+		return types.BucketFile{}, err
+	}
+	b.mu.RLock()
+	object, ok := b.objects[key]
+	b.mu.RUnlock()
+	if !ok {
+		return types.BucketFile{}, fmt.Errorf("%s: %w", key, os.ErrNotExist)
+	}
+	return types.BucketFile{
+		Reader:    io.NopCloser(bytes.NewReader(object.content)),
+		CreatedAt: object.modTime,
+	}, nil
+}
+
+// RequestUploadUrlForFileUpdate returns the same upload URL as the local storage, the token naming the key to write.
+func (b *MemoryBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string, subject string) (string, error) {
+	key, err := updateFileKey(branch, runtimeVersion, updateId, fileName)
+	if err != nil {
+		return "", err
+	}
+	return requestLocalUploadUrl(b.BaseURL, key, subject)
+}
+
+func (b *MemoryBucket) UploadFileIntoUpdate(update types.Update, fileName string, file io.Reader) error {
+	key, err := updateFileKey(update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
+	if err != nil {
+		return err
+	}
+	return b.put(key, file)
+}
+
+func (b *MemoryBucket) DeleteUpdateFolder(branch string, runtimeVersion string, updateId string) error {
+	folder, err := updateFolderKey(branch, runtimeVersion, updateId)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key := range b.objects {
+		if strings.HasPrefix(key, folder+"/") {
+			delete(b.objects, key)
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBucket) PutObject(key string, body io.Reader) error {
+	if err := ValidateObjectKey(key); err != nil {
+		return err
+	}
+	return b.put(key, body)
+}
+
+func (b *MemoryBucket) GetObject(key string) (io.ReadCloser, error) {
+	if err := ValidateObjectKey(key); err != nil {
+		return nil, err
+	}
+	b.mu.RLock()
+	object, ok := b.objects[key]
+	b.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, os.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(object.content)), nil
+}
+
+func (b *MemoryBucket) DeleteObject(key string) error {
+	if err := ValidateObjectKey(key); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.objects, key)
+	return nil
+}
+
+func (b *MemoryBucket) ListObjects(prefix string) ([]string, error) {
+	if err := ValidateObjectPrefix(prefix); err != nil {
+		return nil, err
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	keys := []string{}
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,76 @@
+package bucket
+
+import (
+	"errors"
+	"expo-open-ota/internal/types"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBucket(t *testing.T) {
+	b := NewMemoryBucket()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	b.Now = func() time.Time { return now }
+	first := types.Update{Branch: "main", RuntimeVersion: "1", UpdateId: "1700000000000"}
+	second := types.Update{Branch: "main", RuntimeVersion: "1", UpdateId: "1700000001000"}
+	assert.Nil(t, b.UploadFileIntoUpdate(first, "metadata.json", strings.NewReader("{}")))
+	assert.Nil(t, b.UploadFileIntoUpdate(first, "assets/a", strings.NewReader("asset")))
+	assert.Nil(t, b.UploadFileIntoUpdate(second, "metadata.json", strings.NewReader("{}")))
+	assert.Nil(t, b.PutObject(InternalFolder+"/index.json", strings.NewReader("{}")))
+
+	branches, err := b.GetBranches()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"main"}, branches)
+
+	runtimeVersions, err := b.GetRuntimeVersions("main")
+	assert.Nil(t, err)
+	assert.Equal(t, []RuntimeVersionWithStats{{
+		RuntimeVersion:  "1",
+		CreatedAt:       "2023-11-14T22:13:20Z",
+		LastUpdatedAt:   "2023-11-14T22:13:21Z",
+		NumberOfUpdates: 2,
+	}}, runtimeVersions)
+
+	updates, err := b.GetUpdates("main", "1")
+	assert.Nil(t, err)
+	assert.Len(t, updates, 2)
+
+	file, err := b.GetFile(first, "assets/a")
+	assert.Nil(t, err)
+	content, err := io.ReadAll(file.Reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "asset", string(content))
+	assert.Equal(t, now, file.CreatedAt)
+
+	_, err = b.GetFile(first, "assets/missing")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	_, err = b.GetFile(first, "../../2/1700000000000/metadata.json")
+	assert.ErrorIs(t, err, ErrUnsafePath)
+	assert.ErrorIs(t, b.PutObject("../outside", strings.NewReader("")), ErrUnsafePath)
+
+	keys, err := b.ListObjects("main/1/1700000000000/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"main/1/1700000000000/assets/a", "main/1/1700000000000/metadata.json"}, keys)
+
+	assert.Nil(t, b.DeleteUpdateFolder("main", "1", "1700000000000"))
+	updates, err = b.GetUpdates("main", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Update{{
+		Branch:         "main",
+		RuntimeVersion: "1",
+		UpdateId:       "1700000001000",
+		CreatedAt:      1700000001000 * time.Millisecond,
+	}}, updates)
+
+	reader, err := b.GetObject(InternalFolder + "/index.json")
+	assert.Nil(t, err)
+	reader.Close()
+	assert.Nil(t, b.DeleteObject(InternalFolder+"/index.json"))
+	_, err = b.GetObject(InternalFolder + "/index.json")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
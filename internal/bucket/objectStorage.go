@@ -0,0 +1,25 @@
+package bucket
+
+import (
+	"io"
+	"strings"
+)
+
+// Objects stored by the server itself live under this folder, which can never be a branch.
+const InternalFolder = ".expo-open-ota"
+
+// ObjectStorage is implemented by the buckets able to keep arbitrary objects next to the updates.
+// Keys are slash separated, the objects of the server start with InternalFolder and the files of an
+// update with branch/runtimeVersion/updateId/.
+type ObjectStorage interface {
+	PutObject(key string, body io.Reader) error
+	GetObject(key string) (io.ReadCloser, error)
+	// DeleteObject succeeds when the object does not exist
+	DeleteObject(key string) error
+	// ListObjects returns the keys starting with prefix, in lexical order
+	ListObjects(prefix string) ([]string, error)
+}
+
+func isHiddenFolder(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,164 @@
+package bucket
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrUnsafePath is returned for branch names, runtime versions, update ids and asset paths that could
+// address anything else than their own folder of the bucket.
+var ErrUnsafePath = errors.New("unsafe path")
+
+const maxSegmentLength = 255
+
+func unsafePath(kind string, value string, reason string) error {
+	return fmt.Errorf("%w: %s %q %s", ErrUnsafePath, kind, value, reason)
+}
+
+// validateSegment accepts a single folder name, never hidden so that it cannot collide with InternalFolder.
+func validateSegment(kind string, value string) error {
+	if value == "" {
+		return unsafePath(kind, value, "is empty")
+	}
+	if len(value) > maxSegmentLength {
+		return unsafePath(kind, value, "is too long")
+	}
+	if !utf8.ValidString(value) {
+		return unsafePath(kind, value, "is not valid UTF-8")
+	}
+	if strings.ContainsAny(value, `/\`) {
+		return unsafePath(kind, value, "contains a path separator")
+	}
+	if isHiddenFolder(value) {
+		return unsafePath(kind, value, "starts with a dot")
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return unsafePath(kind, value, "contains a control character")
+		}
+	}
+	return nil
+}
+
+func ValidateBranch(branch string) error {
+	return validateSegment("branch", branch)
+}
+
+func ValidateRuntimeVersion(runtimeVersion string) error {
+	return validateSegment("runtime version", runtimeVersion)
+}
+
+// ValidateUpdateId accepts the millisecond timestamps used as update ids.
+func ValidateUpdateId(updateId string) error {
+	if updateId == "" || len(updateId) > 19 {
+		return unsafePath("update id", updateId, "is not a timestamp")
+	}
+	for _, r := range updateId {
+		if r < '0' || r > '9' {
+			return unsafePath("update id", updateId, "is not a timestamp")
+		}
+	}
+	return nil
+}
+
+// ValidateUpdatePath checks the three folders holding the files of an update.
+func ValidateUpdatePath(branch string, runtimeVersion string, updateId string) error {
+	if err := ValidateBranch(branch); err != nil {
+		return err
+	}
+	if err := ValidateRuntimeVersion(runtimeVersion); err != nil {
+		return err
+	}
+	return ValidateUpdateId(updateId)
+}
+
+// CleanAssetPath canonicalizes a slash separated path relative to an update folder, and rejects the
+// paths leaving it. "/assets//a/./b" becomes "assets/a/b" while "../a", "a/../../b" or "a\b" are refused.
+func CleanAssetPath(assetPath string) (string, error) {
+	if assetPath == "" {
+		return "", unsafePath("asset path", assetPath, "is empty")
+	}
+	if !utf8.ValidString(assetPath) {
+		return "", unsafePath("asset path", assetPath, "is not valid UTF-8")
+	}
+	// Backslashes are separators on Windows, and volume names make a path absolute there
+	if strings.Contains(assetPath, `\`) || filepath.VolumeName(assetPath) != "" {
+		return "", unsafePath("asset path", assetPath, "is not a relative slash separated path")
+	}
+	for _, r := range assetPath {
+		if unicode.IsControl(r) {
+			return "", unsafePath("asset path", assetPath, "contains a control character")
+		}
+	}
+	// Clients address the root of the update folder with a leading slash
+	cleaned := path.Clean(strings.TrimLeft(assetPath, "/"))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", unsafePath("asset path", assetPath, "leaves the update folder")
+	}
+	for _, segment := range strings.Split(cleaned, "/") {
+		if len(segment) > maxSegmentLength {
+			return "", unsafePath("asset path", assetPath, "has a too long segment")
+		}
+	}
+	return cleaned, nil
+}
+
+// updateFolderKey validates the folders of an update and returns the key of the folder holding its files.
+func updateFolderKey(branch string, runtimeVersion string, updateId string) (string, error) {
+	if err := ValidateUpdatePath(branch, runtimeVersion, updateId); err != nil {
+		return "", err
+	}
+	return branch + "/" + runtimeVersion + "/" + updateId, nil
+}
+
+// updateFileKey is the slash separated key of a file of an update, the same for every backend.
+func updateFileKey(branch string, runtimeVersion string, updateId string, assetPath string) (string, error) {
+	folder, err := updateFolderKey(branch, runtimeVersion, updateId)
+	if err != nil {
+		return "", err
+	}
+	cleaned, err := CleanAssetPath(assetPath)
+	if err != nil {
+		return "", err
+	}
+	return folder + "/" + cleaned, nil
+}
+
+// ValidateObjectKey checks the keys given to ObjectStorage, which must stay inside the bucket.
+func ValidateObjectKey(key string) error {
+	cleaned, err := CleanAssetPath(key)
+	if err != nil {
+		return err
+	}
+	if cleaned != key {
+		return unsafePath("object key", key, "is not canonical")
+	}
+	return nil
+}
+
+// ValidateObjectPrefix checks the prefixes listed through ObjectStorage, an empty prefix lists everything.
+func ValidateObjectPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	return ValidateObjectKey(strings.TrimSuffix(prefix, "/"))
+}
+
+func isWithin(basePath string, target string) bool {
+	relative, err := filepath.Rel(basePath, target)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) && !filepath.IsAbs(relative)
+}
+
+// resolveWithin joins a slash separated key to a base folder, making sure the result stays inside it.
+func resolveWithin(basePath string, key string) (string, error) {
+	resolved := filepath.Join(basePath, filepath.FromSlash(key))
+	if !isWithin(basePath, resolved) {
+		return "", unsafePath("key", key, "leaves the bucket")
+	}
+	return resolved, nil
+}
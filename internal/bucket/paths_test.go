@@ -0,0 +1,147 @@
+package bucket
+
+import (
+	"expo-open-ota/internal/types"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateUpdatePath(t *testing.T) {
+	assert.Nil(t, ValidateUpdatePath("main", "1.0.0", "1700000000000"))
+	assert.Nil(t, ValidateUpdatePath("release 2.0", "exposdk:50.0.0", "1"))
+	invalid := [][3]string{
+		{"", "1", "1"},
+		{"..", "1", "1"},
+		{".", "1", "1"},
+		{".expo-open-ota", "1", "1"},
+		{"feature/login", "1", "1"},
+		{`a\b`, "1", "1"},
+		{"main\x00", "1", "1"},
+		{"main\n", "1", "1"},
+		{strings.Repeat("a", 256), "1", "1"},
+		{"main", "../1", "1"},
+		{"main", "..", "1"},
+		{"main", "1", "../1"},
+		{"main", "1", "1a"},
+		{"main", "1", "-1"},
+		{"main", "1", "12345678901234567890"},
+	}
+	for _, parts := range invalid {
+		err := ValidateUpdatePath(parts[0], parts[1], parts[2])
+		assert.ErrorIs(t, err, ErrUnsafePath, "%q", parts)
+	}
+}
+
+func TestCleanAssetPath(t *testing.T) {
+	valid := map[string]string{
+		"metadata.json":         "metadata.json",
+		"/assets/abc":           "assets/abc",
+		"assets//a/./b":         "assets/a/b",
+		"assets/a/../b":         "assets/b",
+		"_expo/static/js/a.hbc": "_expo/static/js/a.hbc",
+		".check":                ".check",
+	}
+	for input, expected := range valid {
+		cleaned, err := CleanAssetPath(input)
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, cleaned, input)
+	}
+	invalid := []string{"", "/", ".", "..", "../a", "/../a", "a/../../b", `a\b`, `..\a`, "a\x00b", "a/\x7f", "\xff"}
+	for _, input := range invalid {
+		_, err := CleanAssetPath(input)
+		assert.ErrorIs(t, err, ErrUnsafePath, "%q", input)
+	}
+}
+
+func TestValidateObjectKey(t *testing.T) {
+	assert.Nil(t, ValidateObjectKey(InternalFolder+"/audit/2024/01/01/1.json"))
+	assert.Nil(t, ValidateObjectPrefix(InternalFolder+"/audit/"))
+	assert.Nil(t, ValidateObjectPrefix(""))
+	assert.NotNil(t, ValidateObjectKey("/"+InternalFolder+"/a"))
+	assert.NotNil(t, ValidateObjectKey(InternalFolder+"/../a"))
+	assert.NotNil(t, ValidateObjectPrefix("../"))
+}
+
+func TestLocalBucketRejectsTraversal(t *testing.T) {
+	basePath := filepath.Join(t.TempDir(), "bucket")
+	assert.Nil(t, os.MkdirAll(filepath.Join(basePath, "main", "1", "1700000000000"), os.ModePerm))
+	assert.Nil(t, os.WriteFile(filepath.Join(filepath.Dir(basePath), "secret"), []byte("secret"), 0644))
+	b := &LocalBucket{BasePath: basePath}
+	update := types.Update{Branch: "main", RuntimeVersion: "1", UpdateId: "1700000000000"}
+
+	_, err := b.GetFile(update, "../../../../secret")
+	assert.ErrorIs(t, err, ErrUnsafePath)
+	_, err = b.GetFile(types.Update{Branch: "..", RuntimeVersion: "..", UpdateId: "1"}, "secret")
+	assert.ErrorIs(t, err, ErrUnsafePath)
+	assert.ErrorIs(t, b.UploadFileIntoUpdate(update, "../../../escaped", strings.NewReader("x")), ErrUnsafePath)
+	assert.ErrorIs(t, b.DeleteUpdateFolder("main", "..", "1"), ErrUnsafePath)
+	_, err = b.RequestUploadUrlForFileUpdate("main", "1", "1700000000000", "../../../../escaped", "apiKey:1")
+	assert.ErrorIs(t, err, ErrUnsafePath)
+	assert.ErrorIs(t, b.PutObject("../escaped", strings.NewReader("x")), ErrUnsafePath)
+	_, err = b.GetObject("../secret")
+	assert.ErrorIs(t, err, ErrUnsafePath)
+	_, err = b.GetUpdates("main", "../..")
+	assert.ErrorIs(t, err, ErrUnsafePath)
+	_, err = b.GetRuntimeVersions("..")
+	assert.ErrorIs(t, err, ErrUnsafePath)
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(basePath), "escaped"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func FuzzCleanAssetPath(f *testing.F) {
+	for _, seed := range []string{"metadata.json", "/assets/a", "../a", "a/../../b", `a\b`, "a//b/./c", ".", "..", "/", "\x00"} {
+		f.Add(seed)
+	}
+	basePath := filepath.FromSlash("/bucket/main/1/1700000000000")
+	f.Fuzz(func(t *testing.T, assetPath string) {
+		cleaned, err := CleanAssetPath(assetPath)
+		if err != nil {
+			return
+		}
+		if cleaned == "" || strings.HasPrefix(cleaned, "/") || strings.Contains(cleaned, `\`) || path.Clean(cleaned) != cleaned {
+			t.Fatalf("%q was canonicalized to %q", assetPath, cleaned)
+		}
+		for _, segment := range strings.Split(cleaned, "/") {
+			if segment == ".." || segment == "." || segment == "" {
+				t.Fatalf("%q was canonicalized to %q", assetPath, cleaned)
+			}
+		}
+		if again, err := CleanAssetPath(cleaned); err != nil || again != cleaned {
+			t.Fatalf("canonicalizing %q is not idempotent: %q, %v", cleaned, again, err)
+		}
+		if _, err := resolveWithin(basePath, cleaned); err != nil {
+			t.Fatalf("%q leaves the update folder: %v", assetPath, err)
+		}
+	})
+}
+
+func FuzzUpdateFileKey(f *testing.F) {
+	f.Add("main", "1.0.0", "1700000000000", "assets/a")
+	f.Add("..", "..", "1", "../../etc/passwd")
+	f.Add("main", "1", "1", "/")
+	f.Add(".expo-open-ota", "audit", "1", "a")
+	f.Fuzz(func(t *testing.T, branch string, runtimeVersion string, updateId string, assetPath string) {
+		key, err := updateFileKey(branch, runtimeVersion, updateId, assetPath)
+		if err != nil {
+			return
+		}
+		folder := branch + "/" + runtimeVersion + "/" + updateId + "/"
+		if !strings.HasPrefix(key, folder) || strings.HasPrefix(key, InternalFolder) {
+			t.Fatalf("key %q is not inside %q", key, folder)
+		}
+		basePath := filepath.FromSlash("/bucket")
+		resolved, err := resolveWithin(basePath, key)
+		if err != nil {
+			t.Fatalf("key %q leaves the bucket: %v", key, err)
+		}
+		if !isWithin(filepath.Join(basePath, branch, runtimeVersion, updateId), resolved) {
+			t.Fatalf("key %q leaves the update folder", key)
+		}
+	})
+}
@@ -0,0 +1,503 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/metrics"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const maxReplicationRetryDelay = time.Minute
+
+// Replica is a bucket the writes of a ReplicatedBucket are copied into, Name labelling its metrics.
+type Replica struct {
+	Name   string
+	Bucket Bucket
+}
+
+type ReplicationOptions struct {
+	// ReadTimeout is how long a read waits for the primary before trying the replicas, forever when 0
+	ReadTimeout time.Duration
+	// MaxAttempts of a write into a replica before it is given up, 5 when 0
+	MaxAttempts int
+	// RetryDelay before the second attempt, doubled on each attempt, one second when 0
+	RetryDelay time.Duration
+}
+
+// replicatedStorage is what the primary and the replicas must implement to be copied file by file.
+type replicatedStorage interface {
+	Bucket
+	ObjectStorage
+}
+
+// ReplicatedBucket writes into a primary bucket, then copies every write into its replicas in the background.
+// Reads fail over to the replicas, in order, when the primary errors or does not answer within ReadTimeout.
+// A file missing from the primary is never looked up in the replicas, which may still hold a deleted one.
+type ReplicatedBucket struct {
+	primary     replicatedStorage
+	replicators []*replicator
+	options     ReplicationOptions
+}
+
+func NewReplicatedBucket(primary Bucket, replicas []Replica, options ReplicationOptions) (*ReplicatedBucket, error) {
+	primaryStorage, ok := primary.(replicatedStorage)
+	if !ok {
+		return nil, fmt.Errorf("bucket %T cannot be replicated", primary)
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 5
+	}
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = time.Second
+	}
+	b := &ReplicatedBucket{primary: primaryStorage, options: options}
+	for _, replica := range replicas {
+		storage, ok := replica.Bucket.(replicatedStorage)
+		if !ok {
+			return nil, fmt.Errorf("bucket %T of replica %s cannot be replicated into", replica.Bucket, replica.Name)
+		}
+		b.replicators = append(b.replicators, newReplicator(replica.Name, storage, primaryStorage, options))
+	}
+	return b, nil
+}
+
+// Primary returns the bucket the writes of b go to, b itself when it is not replicated.
+func Primary(b Bucket) Bucket {
+	if replicated, ok := b.(*ReplicatedBucket); ok {
+		return replicated.primary
+	}
+	return b
+}
+
+// Pending returns the number of writes not yet copied into every replica.
+func (b *ReplicatedBucket) Pending() int {
+	pending := 0
+	for _, r := range b.replicators {
+		pending += r.pending()
+	}
+	return pending
+}
+
+// Flush waits until every write is copied into the replicas, or given up.
+func (b *ReplicatedBucket) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for b.Pending() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d writes left to replicate: %w", b.Pending(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Close stops the replication, the writes left are not copied.
+func (b *ReplicatedBucket) Close() {
+	for _, r := range b.replicators {
+		r.close()
+	}
+}
+
+func (b *ReplicatedBucket) replicate(description string, apply func(primary replicatedStorage, replica replicatedStorage) error) {
+	for _, r := range b.replicators {
+		r.enqueue(replicationJob{description: description, apply: apply, enqueuedAt: time.Now()})
+	}
+}
+
+// isNotFound tells the errors of the files missing from a bucket, for which the primary is trusted.
+func isNotFound(err error) bool {
+	var noSuchKey *s3types.NoSuchKey
+	return errors.Is(err, os.ErrNotExist) || errors.As(err, &noSuchKey)
+}
+
+type readResult[T any] struct {
+	value T
+	err   error
+}
+
+// failover reads from the primary, then from each replica when the primary fails or is too slow. A late
+// answer of the primary is released by discard.
+func failover[T any](b *ReplicatedBucket, operation string, read func(Bucket) (T, error), discard func(T)) (T, error) {
+	results := make(chan readResult[T], 1)
+	go func() {
+		value, err := read(b.primary)
+		results <- readResult[T]{value: value, err: err}
+	}()
+	var timeout <-chan time.Time
+	if b.options.ReadTimeout > 0 {
+		timer := time.NewTimer(b.options.ReadTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var primary readResult[T]
+	timedOut := false
+	select {
+	case primary = <-results:
+		if primary.err == nil || isNotFound(primary.err) || len(b.replicators) == 0 {
+			return primary.value, primary.err
+		}
+	case <-timeout:
+		timedOut = true
+	}
+	for _, r := range b.replicators {
+		value, err := read(r.storage)
+		if err != nil {
+			continue
+		}
+		metrics.TrackReadFailover(operation, r.name)
+		if timedOut && discard != nil {
+			go func() {
+				if late := <-results; late.err == nil {
+					discard(late.value)
+				}
+			}()
+		}
+		return value, nil
+	}
+	// No replica could answer, the primary may still do
+	if timedOut {
+		primary = <-results
+	}
+	return primary.value, primary.err
+}
+
+func (b *ReplicatedBucket) GetBranches() ([]string, error) {
+	return failover(b, "branches", func(from Bucket) ([]string, error) {
+		return from.GetBranches()
+	}, nil)
+}
+
+func (b *ReplicatedBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error) {
+	return failover(b, "runtimeVersions", func(from Bucket) ([]RuntimeVersionWithStats, error) {
+		return from.GetRuntimeVersions(branch)
+	}, nil)
+}
+
+func (b *ReplicatedBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
+	return failover(b, "updates", func(from Bucket) ([]types.Update, error) {
+		return from.GetUpdates(branch, runtimeVersion)
+	}, nil)
+}
+
+func (b *ReplicatedBucket) GetFile(update types.Update, assetPath string) (types.BucketFile, error) {
+	return failover(b, "file", func(from Bucket) (types.BucketFile, error) {
+		return from.GetFile(update, assetPath)
+	}, func(file types.BucketFile) {
+		if file.Reader != nil {
+			file.Reader.Close()
+		}
+	})
+}
+
+func (b *ReplicatedBucket) GetObject(key string) (io.ReadCloser, error) {
+	return failover(b, "object", func(from Bucket) (io.ReadCloser, error) {
+		return from.(ObjectStorage).GetObject(key)
+	}, func(reader io.ReadCloser) {
+		reader.Close()
+	})
+}
+
+func (b *ReplicatedBucket) ListObjects(prefix string) ([]string, error) {
+	return failover(b, "objects", func(from Bucket) ([]string, error) {
+		return from.(ObjectStorage).ListObjects(prefix)
+	}, nil)
+}
+
+// RequestUploadUrlForFileUpdate lets the client upload into the primary, the files are replicated along
+// with the commit of their update.
+func (b *ReplicatedBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string, subject string) (string, error) {
+	return b.primary.RequestUploadUrlForFileUpdate(branch, runtimeVersion, updateId, fileName, subject)
+}
+
+func (b *ReplicatedBucket) UploadFileIntoUpdate(update types.Update, fileName string, file io.Reader) error {
+	if err := b.primary.UploadFileIntoUpdate(update, fileName, file); err != nil {
+		return err
+	}
+	b.replicate(fmt.Sprintf("%s of update %s", fileName, update.UpdateId), func(primary replicatedStorage, replica replicatedStorage) error {
+		return syncUpdateFolder(primary, replica, update, fileName)
+	})
+	return nil
+}
+
+func (b *ReplicatedBucket) DeleteUpdateFolder(branch string, runtimeVersion string, updateId string) error {
+	if err := b.primary.DeleteUpdateFolder(branch, runtimeVersion, updateId); err != nil {
+		return err
+	}
+	b.replicate("deletion of update "+updateId, func(primary replicatedStorage, replica replicatedStorage) error {
+		return replica.DeleteUpdateFolder(branch, runtimeVersion, updateId)
+	})
+	return nil
+}
+
+func (b *ReplicatedBucket) PutObject(key string, body io.Reader) error {
+	if err := b.primary.PutObject(key, body); err != nil {
+		return err
+	}
+	b.replicate(key, func(primary replicatedStorage, replica replicatedStorage) error {
+		return mirrorObject(primary, replica, key)
+	})
+	return nil
+}
+
+func (b *ReplicatedBucket) DeleteObject(key string) error {
+	if err := b.primary.DeleteObject(key); err != nil {
+		return err
+	}
+	b.replicate("deletion of "+key, func(primary replicatedStorage, replica replicatedStorage) error {
+		return mirrorObject(primary, replica, key)
+	})
+	return nil
+}
+
+// mirrorObject copies the current state of an object of the primary, deleting it when it is gone.
+func mirrorObject(primary ObjectStorage, replica ObjectStorage, key string) error {
+	reader, err := primary.GetObject(key)
+	if isNotFound(err) {
+		return replica.DeleteObject(key)
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return replica.PutObject(key, reader)
+}
+
+// syncUpdateFolder copies the file written into an update along with the files uploaded straight into the
+// primary, hidden files such as the commit last so that a replica never serves an update missing files.
+func syncUpdateFolder(primary ObjectStorage, replica ObjectStorage, update types.Update, fileName string) error {
+	folder := update.Branch + "/" + update.RuntimeVersion + "/" + update.UpdateId + "/"
+	primaryKeys, err := primary.ListObjects(folder)
+	if err != nil {
+		return err
+	}
+	replicaKeys, err := replica.ListObjects(folder)
+	if err != nil {
+		return err
+	}
+	replicated := map[string]bool{}
+	for _, key := range replicaKeys {
+		replicated[key] = true
+	}
+	written := folder + fileName
+	var keys []string
+	for _, key := range primaryKeys {
+		if !replicated[key] && key != written {
+			keys = append(keys, key)
+		}
+	}
+	keys = append(keys, written)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return !isHiddenFolder(path.Base(keys[i])) && isHiddenFolder(path.Base(keys[j]))
+	})
+	for _, key := range keys {
+		reader, err := primary.GetObject(key)
+		if isNotFound(err) {
+			// Deleted since, the deletion is replicated next
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = replica.PutObject(key, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type replicationJob struct {
+	description string
+	apply       func(primary replicatedStorage, replica replicatedStorage) error
+	enqueuedAt  time.Time
+}
+
+// replicator copies the writes into a replica one at a time, in the order they were made into the primary.
+type replicator struct {
+	name    string
+	storage replicatedStorage
+	primary replicatedStorage
+	options ReplicationOptions
+	mu      sync.Mutex
+	jobs    []replicationJob
+	wake    chan struct{}
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func newReplicator(name string, storage replicatedStorage, primary replicatedStorage, options ReplicationOptions) *replicator {
+	r := &replicator{
+		name:    name,
+		storage: storage,
+		primary: primary,
+		options: options,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+	go r.run()
+	go r.reportLag()
+	return r
+}
+
+func (r *replicator) enqueue(job replicationJob) {
+	r.mu.Lock()
+	r.jobs = append(r.jobs, job)
+	r.mu.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *replicator) pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.jobs)
+}
+
+func (r *replicator) close() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+}
+
+func (r *replicator) run() {
+	for {
+		r.mu.Lock()
+		if len(r.jobs) == 0 {
+			r.mu.Unlock()
+			select {
+			case <-r.wake:
+				continue
+			case <-r.stop:
+				return
+			}
+		}
+		job := r.jobs[0]
+		r.mu.Unlock()
+		if !r.apply(job) {
+			return
+		}
+		r.mu.Lock()
+		r.jobs = r.jobs[1:]
+		r.updateLagLocked()
+		r.mu.Unlock()
+	}
+}
+
+// apply retries a job until it succeeds or MaxAttempts is reached, returning false once the replicator is closed.
+func (r *replicator) apply(job replicationJob) bool {
+	delay := r.options.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := job.apply(r.primary, r.storage)
+		if err == nil {
+			return true
+		}
+		if attempt >= r.options.MaxAttempts {
+			log.Printf("Giving up replicating %s into %s after %d attempts: %v", job.description, r.name, attempt, err)
+			metrics.TrackReplicationFailure(r.name)
+			return true
+		}
+		log.Printf("Error replicating %s into %s, retrying in %s: %v", job.description, r.name, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-r.stop:
+			return false
+		}
+		delay = min(delay*2, maxReplicationRetryDelay)
+	}
+}
+
+func (r *replicator) updateLag() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateLagLocked()
+}
+
+// updateLagLocked reports the age of the oldest job, so that the lag is already 0 once the queue is seen empty.
+func (r *replicator) updateLagLocked() {
+	var lag time.Duration
+	if len(r.jobs) > 0 {
+		lag = time.Since(r.jobs[0].enqueuedAt)
+	}
+	metrics.SetReplicationLag(r.name, len(r.jobs), lag.Seconds())
+}
+
+// reportLag keeps the lag growing while a write is being copied or retried.
+func (r *replicator) reportLag() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.updateLag()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// newReplicasFromEnv returns the buckets of STORAGE_REPLICAS, holding the folder of app when not empty.
+func newReplicasFromEnv(app string) ([]Replica, error) {
+	var replicas []Replica
+	for _, location := range strings.Split(config.GetEnv("STORAGE_REPLICAS"), ",") {
+		location = strings.TrimSpace(location)
+		if location == "" {
+			continue
+		}
+		replica, err := ParseLocation(location)
+		if err != nil {
+			return nil, err
+		}
+		if app != "" {
+			if replica, err = AppFolder(replica, app); err != nil {
+				return nil, err
+			}
+		}
+		replicas = append(replicas, Replica{Name: location, Bucket: replica})
+	}
+	return replicas, nil
+}
+
+// AppFolder returns the bucket keeping the updates of app in the AppsFolder of b.
+func AppFolder(b Bucket, app string) (Bucket, error) {
+	switch b := b.(type) {
+	case *S3Bucket:
+		return &S3Bucket{BucketName: b.BucketName, Prefix: strings.TrimPrefix(b.Prefix+"/"+AppsFolder+"/"+app, "/"), Region: b.Region}, nil
+	case *LocalBucket:
+		basePath := filepath.Join(b.BasePath, AppsFolder, app)
+		if err := os.MkdirAll(basePath, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("error creating bucket folder of app %s: %w", app, err)
+		}
+		return &LocalBucket{BasePath: basePath, BaseURL: b.BaseURL}, nil
+	default:
+		return nil, fmt.Errorf("bucket %T cannot hold apps", b)
+	}
+}
+
+// replicateFromEnv wraps primary into a ReplicatedBucket when STORAGE_REPLICAS is set.
+func replicateFromEnv(primary Bucket, app string) (Bucket, error) {
+	replicas, err := newReplicasFromEnv(app)
+	if err != nil || len(replicas) == 0 {
+		return primary, err
+	}
+	return NewReplicatedBucket(primary, replicas, ReplicationOptions{
+		ReadTimeout: time.Duration(config.GetIntEnv("STORAGE_READ_TIMEOUT_MS", 0)) * time.Millisecond,
+		MaxAttempts: int(config.GetIntEnv("STORAGE_REPLICATION_RETRIES", 1)),
+	})
+}
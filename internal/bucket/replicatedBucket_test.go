@@ -0,0 +1,251 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"expo-open-ota/internal/metrics"
+	"expo-open-ota/internal/types"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// flakyBucket is a memory bucket whose reads and writes can fail or be slow.
+type flakyBucket struct {
+	*MemoryBucket
+	mu       sync.Mutex
+	failures int
+	delay    time.Duration
+	puts     []string
+}
+
+func newFlakyBucket() *flakyBucket {
+	return &flakyBucket{MemoryBucket: NewMemoryBucket()}
+}
+
+func (b *flakyBucket) fail(failures int, delay time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = failures
+	b.delay = delay
+}
+
+func (b *flakyBucket) call() error {
+	b.mu.Lock()
+	delay := b.delay
+	failing := b.failures != 0
+	if b.failures > 0 {
+		b.failures--
+	}
+	b.mu.Unlock()
+	time.Sleep(delay)
+	if failing {
+		return errUnavailable
+	}
+	return nil
+}
+
+func (b *flakyBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
+	if err := b.call(); err != nil {
+		return nil, err
+	}
+	return b.MemoryBucket.GetUpdates(branch, runtimeVersion)
+}
+
+func (b *flakyBucket) GetFile(update types.Update, assetPath string) (types.BucketFile, error) {
+	if err := b.call(); err != nil {
+		return types.BucketFile{}, err
+	}
+	return b.MemoryBucket.GetFile(update, assetPath)
+}
+
+func (b *flakyBucket) PutObject(key string, body io.Reader) error {
+	if err := b.call(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.puts = append(b.puts, key)
+	b.mu.Unlock()
+	return b.MemoryBucket.PutObject(key, body)
+}
+
+func setupReplicationMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	defaultRegisterer, defaultGatherer := prometheus.DefaultRegisterer, prometheus.DefaultGatherer
+	prometheus.DefaultRegisterer, prometheus.DefaultGatherer = registry, registry
+	metrics.ResetMetricsForTest()
+	metrics.InitMetrics()
+	t.Cleanup(func() {
+		prometheus.DefaultRegisterer, prometheus.DefaultGatherer = defaultRegisterer, defaultGatherer
+	})
+}
+
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.Nil(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.Metric {
+			matched := 0
+			for _, label := range metric.Label {
+				if labels[label.GetName()] == label.GetValue() {
+					matched++
+				}
+			}
+			if matched != len(labels) {
+				continue
+			}
+			if metric.Gauge != nil {
+				return metric.Gauge.GetValue()
+			}
+			return metric.Counter.GetValue()
+		}
+	}
+	return 0
+}
+
+func newTestReplicatedBucket(t *testing.T, primary Bucket, replica Bucket, options ReplicationOptions) *ReplicatedBucket {
+	replicated, err := NewReplicatedBucket(primary, []Replica{{Name: "replica", Bucket: replica}}, options)
+	assert.Nil(t, err)
+	t.Cleanup(replicated.Close)
+	return replicated
+}
+
+func flush(t *testing.T, replicated *ReplicatedBucket) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, replicated.Flush(ctx))
+}
+
+func readFile(t *testing.T, b Bucket, update types.Update, assetPath string) string {
+	file, err := b.GetFile(update, assetPath)
+	if !assert.Nil(t, err) {
+		return ""
+	}
+	defer file.Reader.Close()
+	content, err := io.ReadAll(file.Reader)
+	assert.Nil(t, err)
+	return string(content)
+}
+
+func TestReplicatedBucketReplicatesWrites(t *testing.T) {
+	setupReplicationMetrics(t)
+	primary := NewMemoryBucket()
+	replica := newFlakyBucket()
+	replicated := newTestReplicatedBucket(t, primary, replica, ReplicationOptions{})
+	update := types.Update{Branch: "main", RuntimeVersion: "1", UpdateId: "1700000000000"}
+
+	// Files uploaded through an upload URL only reach the primary, they are copied along with the commit
+	assert.Nil(t, primary.UploadFileIntoUpdate(update, "assets/a", strings.NewReader("asset")))
+	assert.Nil(t, replicated.UploadFileIntoUpdate(update, ".check", strings.NewReader("commit")))
+	flush(t, replicated)
+	assert.Nil(t, replicated.UploadFileIntoUpdate(update, "metadata.json", strings.NewReader("{}")))
+	assert.Nil(t, replicated.PutObject(InternalFolder+"/index.json", strings.NewReader("{}")))
+	flush(t, replicated)
+
+	assert.Equal(t, "asset", readFile(t, replica, update, "assets/a"))
+	assert.Equal(t, "commit", readFile(t, replica, update, ".check"))
+	assert.Equal(t, "{}", readFile(t, replica, update, "metadata.json"))
+	assert.Equal(t, []string{"main/1/1700000000000/assets/a", "main/1/1700000000000/.check", "main/1/1700000000000/metadata.json", InternalFolder + "/index.json"}, replica.puts)
+
+	assert.Nil(t, replicated.DeleteObject(InternalFolder+"/index.json"))
+	assert.Nil(t, replicated.DeleteUpdateFolder(update.Branch, update.RuntimeVersion, update.UpdateId))
+	flush(t, replicated)
+	keys, err := replica.ListObjects("")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+	assert.Equal(t, float64(0), metricValue(t, "storage_replication_pending", map[string]string{"replica": "replica"}))
+}
+
+func TestReplicatedBucketRetriesWrites(t *testing.T) {
+	setupReplicationMetrics(t)
+	primary := NewMemoryBucket()
+	replica := newFlakyBucket()
+	replicated := newTestReplicatedBucket(t, primary, replica, ReplicationOptions{MaxAttempts: 3, RetryDelay: 50 * time.Millisecond})
+
+	replica.fail(2, 0)
+	assert.Nil(t, replicated.PutObject(InternalFolder+"/a", strings.NewReader("a")))
+	flush(t, replicated)
+	content, err := replica.GetObject(InternalFolder + "/a")
+	assert.Nil(t, err)
+	content.Close()
+
+	replica.fail(-1, 0)
+	assert.Nil(t, replicated.PutObject(InternalFolder+"/b", strings.NewReader("b")))
+	assert.Nil(t, replicated.PutObject(InternalFolder+"/c", strings.NewReader("c")))
+	assert.Equal(t, 2, replicated.Pending())
+	flush(t, replicated)
+	_, err = replica.GetObject(InternalFolder + "/b")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.Equal(t, float64(2), metricValue(t, "storage_replication_failures_total", map[string]string{"replica": "replica"}))
+	// The writes given up on are still served by the primary
+	_, err = replicated.GetObject(InternalFolder + "/b")
+	assert.Nil(t, err)
+}
+
+func TestReplicatedBucketReportsLag(t *testing.T) {
+	setupReplicationMetrics(t)
+	replica := newFlakyBucket()
+	replicated := newTestReplicatedBucket(t, NewMemoryBucket(), replica, ReplicationOptions{MaxAttempts: 100, RetryDelay: 100 * time.Millisecond})
+
+	replica.fail(-1, 0)
+	assert.Nil(t, replicated.PutObject(InternalFolder+"/a", strings.NewReader("a")))
+	assert.Eventually(t, func() bool {
+		return metricValue(t, "storage_replication_lag_seconds", map[string]string{"replica": "replica"}) >= 1
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, float64(1), metricValue(t, "storage_replication_pending", map[string]string{"replica": "replica"}))
+
+	replica.fail(0, 0)
+	flush(t, replicated)
+	assert.Equal(t, float64(0), metricValue(t, "storage_replication_lag_seconds", map[string]string{"replica": "replica"}))
+}
+
+func TestReplicatedBucketFailsOverReads(t *testing.T) {
+	setupReplicationMetrics(t)
+	primary := newFlakyBucket()
+	replica := NewMemoryBucket()
+	replicated := newTestReplicatedBucket(t, primary, replica, ReplicationOptions{ReadTimeout: 100 * time.Millisecond})
+	update := types.Update{Branch: "main", RuntimeVersion: "1", UpdateId: "1700000000000"}
+	assert.Nil(t, replicated.UploadFileIntoUpdate(update, "metadata.json", strings.NewReader("{}")))
+	flush(t, replicated)
+
+	primary.fail(1, 0)
+	assert.Equal(t, "{}", readFile(t, replicated, update, "metadata.json"))
+	assert.Equal(t, float64(1), metricValue(t, "storage_read_failovers_total", map[string]string{"operation": "file", "replica": "replica"}))
+
+	primary.fail(0, time.Second)
+	start := time.Now()
+	updates, err := replicated.GetUpdates("main", "1")
+	assert.Nil(t, err)
+	assert.Len(t, updates, 1)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, float64(1), metricValue(t, "storage_read_failovers_total", map[string]string{"operation": "updates", "replica": "replica"}))
+
+	// A file missing from the primary is not looked up in the replicas
+	primary.fail(0, 0)
+	assert.Nil(t, replica.UploadFileIntoUpdate(update, "deleted.json", strings.NewReader("{}")))
+	_, err = replicated.GetFile(update, "deleted.json")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// The error of the primary is returned when no replica can answer either
+	primary.fail(1, 0)
+	_, err = replicated.GetFile(update, "missing.json")
+	assert.ErrorIs(t, err, errUnavailable)
+}
+
+func TestReplicatedBucketUnwrapsPrimary(t *testing.T) {
+	primary := NewMemoryBucket()
+	replicated := newTestReplicatedBucket(t, primary, NewMemoryBucket(), ReplicationOptions{})
+	assert.Same(t, primary, Primary(replicated))
+	assert.Same(t, primary, Primary(primary))
+}
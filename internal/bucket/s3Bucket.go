@@ -18,6 +18,21 @@ import (
 
 type S3Bucket struct {
 	BucketName string
+	// Prefix is the folder the updates are kept under, so that several apps can share a bucket
+	Prefix string
+	// Region of the bucket, AWS_REGION when empty
+	Region string
+}
+
+func (b *S3Bucket) client() (*s3.Client, error) {
+	return services.GetS3ClientForRegion(b.Region)
+}
+
+func (b *S3Bucket) key(key string) string {
+	if b.Prefix == "" {
+		return key
+	}
+	return b.Prefix + "/" + key
 }
 
 func (b *S3Bucket) DeleteUpdateFolder(branch, runtimeVersion, updateId string) error {
@@ -25,12 +40,16 @@ func (b *S3Bucket) DeleteUpdateFolder(branch, runtimeVersion, updateId string) e
 		return errors.New("BucketName not set")
 	}
 
-	s3Client, err := services.GetS3Client()
+	s3Client, err := b.client()
 	if err != nil {
 		return fmt.Errorf("error getting S3 client: %w", err)
 	}
 
-	prefix := fmt.Sprintf("%s/%s/%s/", branch, runtimeVersion, updateId)
+	folder, err := updateFolderKey(branch, runtimeVersion, updateId)
+	if err != nil {
+		return err
+	}
+	prefix := b.key(folder + "/")
 
 	listInput := &s3.ListObjectsV2Input{
 		Bucket: aws.String(b.BucketName),
@@ -85,14 +104,17 @@ func (b *S3Bucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats,
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
-	s3Client, errS3 := services.GetS3Client()
+	if err := ValidateBranch(branch); err != nil {
+		return nil, err
+	}
+	s3Client, errS3 := b.client()
 	if errS3 != nil {
 		return nil, errS3
 	}
 
 	input := &s3.ListObjectsV2Input{
 		Bucket:    aws.String(b.BucketName),
-		Prefix:    aws.String(branch + "/"),
+		Prefix:    aws.String(b.key(branch + "/")),
 		Delimiter: aws.String("/"),
 	}
 	resp, err := s3Client.ListObjectsV2(context.TODO(), input)
@@ -101,7 +123,7 @@ func (b *S3Bucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats,
 	}
 
 	var runtimeVersions []RuntimeVersionWithStats
-	prefixLen := len(branch) + 1
+	prefixLen := len(b.key(branch)) + 1
 
 	for _, commonPrefix := range resp.CommonPrefixes {
 		runtimeVersion := (*commonPrefix.Prefix)[prefixLen : len(*commonPrefix.Prefix)-1]
@@ -147,7 +169,7 @@ func (b *S3Bucket) GetBranches() ([]string, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
-	s3Client, errS3 := services.GetS3Client()
+	s3Client, errS3 := b.client()
 	if errS3 != nil {
 		return nil, errS3
 	}
@@ -155,13 +177,19 @@ func (b *S3Bucket) GetBranches() ([]string, error) {
 		Bucket:    aws.String(b.BucketName),
 		Delimiter: aws.String("/"),
 	}
+	if b.Prefix != "" {
+		input.Prefix = aws.String(b.Prefix + "/")
+	}
 	resp, err := s3Client.ListObjectsV2(context.TODO(), input)
 	if err != nil {
 		return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
 	}
 	var branches []string
 	for _, commonPrefix := range resp.CommonPrefixes {
-		prefix := *commonPrefix.Prefix
+		prefix := strings.TrimPrefix(*commonPrefix.Prefix, b.key(""))
+		if isHiddenFolder(prefix) {
+			continue
+		}
 		branches = append(branches, prefix[:len(prefix)-1])
 	}
 	return branches, nil
@@ -171,11 +199,17 @@ func (b *S3Bucket) GetUpdates(branch string, runtimeVersion string) ([]types.Upd
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
-	s3Client, errS3 := services.GetS3Client()
+	if err := ValidateBranch(branch); err != nil {
+		return nil, err
+	}
+	if err := ValidateRuntimeVersion(runtimeVersion); err != nil {
+		return nil, err
+	}
+	s3Client, errS3 := b.client()
 	if errS3 != nil {
 		return nil, errS3
 	}
-	prefix := branch + "/" + runtimeVersion + "/"
+	prefix := b.key(branch + "/" + runtimeVersion + "/")
 	input := &s3.ListObjectsV2Input{
 		Bucket:    aws.String(b.BucketName),
 		Prefix:    aws.String(prefix),
@@ -204,14 +238,17 @@ func (b *S3Bucket) GetFile(update types.Update, assetPath string) (types.BucketF
 	if b.BucketName == "" {
 		return types.BucketFile{}, errors.New("BucketName not set")
 	}
-	filePath := update.Branch + "/" + update.RuntimeVersion + "/" + update.UpdateId + "/" + assetPath
-	s3Client, errS3 := services.GetS3Client()
+	filePath, err := updateFileKey(update.Branch, update.RuntimeVersion, update.UpdateId, assetPath)
+	if err != nil {
+		return types.BucketFile{}, err
+	}
+	s3Client, errS3 := b.client()
 	if errS3 != nil {
 		return types.BucketFile{}, errS3
 	}
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(b.BucketName),
-		Key:    aws.String(filePath),
+		Key:    aws.String(b.key(filePath)),
 	}
 	resp, err := s3Client.GetObject(context.TODO(), input)
 	if err != nil {
@@ -224,23 +261,26 @@ func (b *S3Bucket) GetFile(update types.Update, assetPath string) (types.BucketF
 	}, nil
 }
 
-func (b *S3Bucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string) (string, error) {
+func (b *S3Bucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string, subject string) (string, error) {
 	if b.BucketName == "" {
 		return "", errors.New("BucketName not set")
 	}
 
-	s3Client, err := services.GetS3Client()
+	s3Client, err := b.client()
 	if err != nil {
 		return "", fmt.Errorf("error getting S3 client: %w", err)
 	}
 
 	presignClient := s3.NewPresignClient(s3Client)
 
-	key := fmt.Sprintf("%s/%s/%s/%s", branch, runtimeVersion, updateId, fileName)
+	key, err := updateFileKey(branch, runtimeVersion, updateId, fileName)
+	if err != nil {
+		return "", err
+	}
 
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(b.BucketName),
-		Key:    aws.String(key),
+		Key:    aws.String(b.key(key)),
 	}
 
 	presignResult, err := presignClient.PresignPutObject(context.TODO(), input, func(opt *s3.PresignOptions) {
@@ -257,14 +297,17 @@ func (b *S3Bucket) UploadFileIntoUpdate(update types.Update, fileName string, fi
 	if b.BucketName == "" {
 		return errors.New("BucketName not set")
 	}
-	s3Client, err := services.GetS3Client()
+	s3Client, err := b.client()
+	if err != nil {
+		return err
+	}
+	key, err := updateFileKey(update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
 	if err != nil {
 		return err
 	}
-	key := fmt.Sprintf("%s/%s/%s/%s", update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(b.BucketName),
-		Key:    aws.String(key),
+		Key:    aws.String(b.key(key)),
 		Body:   file,
 	}
 	_, err = s3Client.PutObject(context.TODO(), input)
@@ -273,3 +316,95 @@ func (b *S3Bucket) UploadFileIntoUpdate(update types.Update, fileName string, fi
 	}
 	return nil
 }
+
+func (b *S3Bucket) PutObject(key string, body io.Reader) error {
+	if b.BucketName == "" {
+		return errors.New("BucketName not set")
+	}
+	if err := ValidateObjectKey(key); err != nil {
+		return err
+	}
+	s3Client, err := b.client()
+	if err != nil {
+		return err
+	}
+	_, err = s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(b.key(key)),
+		Body:   body,
+	})
+	if err != nil {
+		return fmt.Errorf("PutObject error: %w", err)
+	}
+	return nil
+}
+
+func (b *S3Bucket) GetObject(key string) (io.ReadCloser, error) {
+	if b.BucketName == "" {
+		return nil, errors.New("BucketName not set")
+	}
+	if err := ValidateObjectKey(key); err != nil {
+		return nil, err
+	}
+	s3Client, err := b.client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(b.key(key)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetObject error: %w", err)
+	}
+	return resp.Body, nil
+}
+
+func (b *S3Bucket) DeleteObject(key string) error {
+	if b.BucketName == "" {
+		return errors.New("BucketName not set")
+	}
+	if err := ValidateObjectKey(key); err != nil {
+		return err
+	}
+	s3Client, err := b.client()
+	if err != nil {
+		return err
+	}
+	_, err = s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(b.key(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteObject error: %w", err)
+	}
+	return nil
+}
+
+func (b *S3Bucket) ListObjects(prefix string) ([]string, error) {
+	if b.BucketName == "" {
+		return nil, errors.New("BucketName not set")
+	}
+	if err := ValidateObjectPrefix(prefix); err != nil {
+		return nil, err
+	}
+	s3Client, err := b.client()
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.BucketName),
+		Prefix: aws.String(b.key(prefix)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, strings.TrimPrefix(*object.Key, b.key("")))
+		}
+	}
+	return keys, nil
+}
@@ -2,7 +2,9 @@ package cache
 
 import (
 	"expo-open-ota/config"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Cache interface {
@@ -15,14 +17,18 @@ type Cache interface {
 type CacheType string
 
 const (
-	LocalCacheType CacheType = "local"
-	RedisCacheType CacheType = "redis"
+	LocalCacheType   CacheType = "local"
+	RedisCacheType   CacheType = "redis"
+	LayeredCacheType CacheType = "layered"
 )
 
 func ResolveCacheType() CacheType {
 	cacheType := config.GetEnv("CACHE_MODE")
-	if cacheType == "redis" {
+	switch cacheType {
+	case "redis":
 		return RedisCacheType
+	case "layered":
+		return LayeredCacheType
 	}
 	return LocalCacheType
 }
@@ -37,16 +43,55 @@ func GetCache() Cache {
 		cacheType := ResolveCacheType()
 		switch cacheType {
 		case LocalCacheType:
-			cacheInstance = NewLocalCache()
+			cacheInstance = newLocalCacheFromEnv()
 		case RedisCacheType:
-			host := config.GetEnv("REDIS_HOST")
-			password := config.GetEnv("REDIS_PASSWORD")
-			port := config.GetEnv("REDIS_PORT")
-			useTLS := config.GetEnv("REDIS_USE_TLS") == "true"
-			cacheInstance = NewRedisCache(host, password, port, useTLS)
+			cacheInstance = newRedisCacheFromEnv()
+		case LayeredCacheType:
+			l1TTL := config.GetIntEnv("LAYERED_CACHE_L1_TTL", 0)
+			cacheInstance = NewLayeredCache(newLocalCacheFromEnv(), newRedisCacheFromEnv(), int(l1TTL))
 		default:
 			panic("Unknown cache type")
 		}
 	})
 	return cacheInstance
 }
+
+func newLocalCacheFromEnv() *LocalCache {
+	maxEntries := config.GetIntEnv("LOCAL_CACHE_MAX_ENTRIES", 0)
+	maxBytes := config.GetIntEnv("LOCAL_CACHE_MAX_BYTES", 0)
+	sweepInterval := config.GetIntEnv("LOCAL_CACHE_SWEEP_INTERVAL", 0)
+	return NewLocalCache(int(maxEntries), maxBytes, time.Duration(sweepInterval)*time.Second)
+}
+
+func ResolveRedisOptions() RedisOptions {
+	return RedisOptions{
+		Mode:               RedisMode(config.GetEnv("REDIS_MODE")),
+		Host:               config.GetEnv("REDIS_HOST"),
+		Port:               config.GetEnv("REDIS_PORT"),
+		Username:           config.GetEnv("REDIS_USERNAME"),
+		Password:           config.GetEnv("REDIS_PASSWORD"),
+		DB:                 int(config.GetIntEnv("REDIS_DB", 0)),
+		UseTLS:             config.GetEnv("REDIS_USE_TLS") == "true",
+		SentinelMasterName: config.GetEnv("REDIS_SENTINEL_MASTER_NAME"),
+		SentinelAddrs:      splitList(config.GetEnv("REDIS_SENTINEL_ADDRS")),
+		SentinelUsername:   config.GetEnv("REDIS_SENTINEL_USERNAME"),
+		SentinelPassword:   config.GetEnv("REDIS_SENTINEL_PASSWORD"),
+		ClusterAddrs:       splitList(config.GetEnv("REDIS_CLUSTER_ADDRS")),
+		KeyPrefix:          config.GetEnv("REDIS_KEY_PREFIX"),
+	}
+}
+
+func newRedisCacheFromEnv() *RedisCache {
+	return NewRedisCache(ResolveRedisOptions())
+}
+
+func splitList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const invalidationChannel = "invalidation"
+
+// LayeredCache keeps a short-lived in-process copy (L1) of the values stored in Redis (L2).
+// Every write or delete is broadcast on a Redis pub/sub channel so that the L1 of all the
+// other replicas is invalidated. If a message is missed (e.g. during a reconnection), the
+// L1 TTL bounds how long a replica can serve a stale value.
+type LayeredCache struct {
+	l1         *LocalCache
+	l2         *RedisCache
+	l1TTL      int
+	instanceId string
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+type invalidationMessage struct {
+	Origin string `json:"origin"`
+	Key    string `json:"key,omitempty"`
+	Clear  bool   `json:"clear,omitempty"`
+}
+
+func NewLayeredCache(l1 *LocalCache, l2 *RedisCache, l1TTL int) *LayeredCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &LayeredCache{
+		l1:         l1,
+		l2:         l2,
+		l1TTL:      l1TTL,
+		instanceId: uuid.New().String(),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	pubsub := l2.Subscribe(ctx, invalidationChannel)
+	// Wait for the subscription to be confirmed so that no invalidation is missed after startup
+	subscribeCtx, subscribeCancel := context.WithTimeout(ctx, 3*time.Second)
+	defer subscribeCancel()
+	if _, err := pubsub.Receive(subscribeCtx); err != nil {
+		log.Printf("Error subscribing to cache invalidation channel: %v", err)
+	}
+	go c.listen(pubsub)
+	return c
+}
+
+func (c *LayeredCache) Get(key string) string {
+	if value := c.l1.Get(key); value != "" {
+		return value
+	}
+	value := c.l2.Get(key)
+	if value != "" {
+		_ = c.l1.Set(key, value, &c.l1TTL)
+	}
+	return value
+}
+
+func (c *LayeredCache) Set(key string, value string, ttl *int) error {
+	if err := c.l2.Set(key, value, ttl); err != nil {
+		return err
+	}
+	l1TTL := c.l1TTL
+	if ttl != nil && *ttl < l1TTL {
+		l1TTL = *ttl
+	}
+	_ = c.l1.Set(key, value, &l1TTL)
+	c.publish(invalidationMessage{Key: key})
+	return nil
+}
+
+func (c *LayeredCache) Delete(key string) {
+	c.l2.Delete(key)
+	c.l1.Delete(key)
+	c.publish(invalidationMessage{Key: key})
+}
+
+func (c *LayeredCache) Clear() error {
+	err := c.l2.Clear()
+	_ = c.l1.Clear()
+	c.publish(invalidationMessage{Clear: true})
+	return err
+}
+
+// Close stops listening for invalidations and stops the L1 sweeper.
+func (c *LayeredCache) Close() {
+	c.cancel()
+	<-c.done
+	c.l1.Close()
+}
+
+func (c *LayeredCache) publish(message invalidationMessage) {
+	message.Origin = c.instanceId
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	if err := c.l2.Publish(invalidationChannel, string(payload)); err != nil {
+		log.Printf("Error publishing cache invalidation: %v", err)
+	}
+}
+
+func (c *LayeredCache) listen(pubsub *redis.PubSub) {
+	defer close(c.done)
+	defer pubsub.Close()
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var message invalidationMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil {
+				log.Printf("Error decoding cache invalidation: %v", err)
+				continue
+			}
+			if message.Origin == c.instanceId {
+				continue
+			}
+			if message.Clear {
+				_ = c.l1.Clear()
+				continue
+			}
+			c.l1.Delete(message.Key)
+		}
+	}
+}
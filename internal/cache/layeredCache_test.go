@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newTestLayeredCache(t *testing.T, server *miniredis.Miniredis) *LayeredCache {
+	t.Helper()
+	c := NewLayeredCache(NewLocalCache(0, 0, 0), NewRedisCache(RedisOptions{Host: server.Host(), Port: server.Port()}), 60)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestLayeredCacheReadsThroughToRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := newTestLayeredCache(t, server)
+
+	assert.Nil(t, server.Set(c.l2.prefixKey("key"), "from-redis"))
+	assert.Equal(t, "from-redis", c.Get("key"))
+
+	// The value is now served from L1 even if Redis changes behind our back
+	assert.Nil(t, server.Set(c.l2.prefixKey("key"), "changed"))
+	assert.Equal(t, "from-redis", c.Get("key"))
+}
+
+func TestLayeredCacheSetWritesBothLayers(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := newTestLayeredCache(t, server)
+
+	assert.Nil(t, c.Set("key", "value", nil))
+	value, err := server.Get(c.l2.prefixKey("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", value)
+	assert.Equal(t, "value", c.l1.Get("key"))
+}
+
+func TestLayeredCacheDeleteInvalidatesOtherReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+	replicaA := newTestLayeredCache(t, server)
+	replicaB := newTestLayeredCache(t, server)
+
+	assert.Nil(t, replicaA.Set("key", "value", nil))
+	assert.Equal(t, "value", replicaB.Get("key"))
+	assert.Equal(t, "value", replicaB.l1.Get("key"))
+
+	replicaA.Delete("key")
+	assert.Eventually(t, func() bool {
+		return replicaB.l1.Get("key") == ""
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "", replicaB.Get("key"))
+}
+
+func TestLayeredCacheSetInvalidatesOtherReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+	replicaA := newTestLayeredCache(t, server)
+	replicaB := newTestLayeredCache(t, server)
+
+	assert.Nil(t, replicaA.Set("key", "v1", nil))
+	assert.Equal(t, "v1", replicaB.Get("key"))
+
+	assert.Nil(t, replicaA.Set("key", "v2", nil))
+	assert.Eventually(t, func() bool {
+		return replicaB.Get("key") == "v2"
+	}, time.Second, 5*time.Millisecond)
+	// The writer keeps its own fresh L1 copy
+	assert.Equal(t, "v2", replicaA.l1.Get("key"))
+}
+
+func TestLayeredCacheClearInvalidatesOtherReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+	replicaA := newTestLayeredCache(t, server)
+	replicaB := newTestLayeredCache(t, server)
+
+	assert.Nil(t, replicaA.Set("key", "value", nil))
+	assert.Equal(t, "value", replicaB.Get("key"))
+
+	assert.Nil(t, replicaA.Clear())
+	assert.Eventually(t, func() bool {
+		return replicaB.l1.Stats().Entries == 0
+	}, time.Second, 5*time.Millisecond)
+}
@@ -1,40 +1,95 @@
 package cache
 
 import (
+	"container/list"
+	"expo-open-ota/internal/metrics"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const localCacheMetricsLabel = "local"
+
+// LocalCache is an in-memory LRU cache bounded by a number of entries and/or
+// a total size in bytes (keys + values). A value of 0 disables the bound.
+// Expired items are removed lazily on Get and periodically by a background sweeper.
 type LocalCache struct {
-	items map[string]CacheItem
-	mu    sync.RWMutex // RWMutex for safe concurrent access
+	items         map[string]*list.Element
+	lru           *list.List // front = most recently used
+	mu            sync.Mutex
+	maxEntries    int
+	maxBytes      int64
+	currentBytes  int64
+	sweepInterval time.Duration
+	stop          chan struct{}
+	stopOnce      sync.Once
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	evictions     atomic.Uint64
+	expirations   atomic.Uint64
 }
 
 type CacheItem struct {
+	Key        string
 	Value      string
 	Expiration *time.Time // nil if no TTL
 }
 
-func NewLocalCache() *LocalCache {
-	return &LocalCache{
-		items: make(map[string]CacheItem),
+type LocalCacheStats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+}
+
+func (i *CacheItem) size() int64 {
+	return int64(len(i.Key) + len(i.Value))
+}
+
+func (i *CacheItem) isExpired(now time.Time) bool {
+	return i.Expiration != nil && now.After(*i.Expiration)
+}
+
+func NewLocalCache(maxEntries int, maxBytes int64, sweepInterval time.Duration) *LocalCache {
+	c := &LocalCache{
+		items:         make(map[string]*list.Element),
+		lru:           list.New(),
+		maxEntries:    maxEntries,
+		maxBytes:      maxBytes,
+		sweepInterval: sweepInterval,
+		stop:          make(chan struct{}),
+	}
+	if sweepInterval > 0 {
+		go c.sweepLoop()
 	}
+	return c
 }
 
 func (c *LocalCache) Get(key string) string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	item, exists := c.items[key]
+	element, exists := c.items[key]
 	if !exists {
+		c.trackMiss()
 		return ""
 	}
 
-	if item.Expiration != nil && time.Now().After(*item.Expiration) {
-		delete(c.items, key)
+	item := element.Value.(*CacheItem)
+	if item.isExpired(time.Now()) {
+		c.removeElement(element)
+		c.expirations.Add(1)
+		metrics.TrackCacheEviction(localCacheMetricsLabel, "expired")
+		c.trackMiss()
+		c.publishSize()
 		return ""
 	}
 
+	c.lru.MoveToFront(element)
+	c.hits.Add(1)
+	metrics.TrackCacheHit(localCacheMetricsLabel)
 	return item.Value
 }
 
@@ -48,10 +103,33 @@ func (c *LocalCache) Set(key string, value string, ttl *int) error {
 		expiration = &exp
 	}
 
-	c.items[key] = CacheItem{
+	item := &CacheItem{
+		Key:        key,
 		Value:      value,
 		Expiration: expiration,
 	}
+
+	if c.maxBytes > 0 && item.size() > c.maxBytes {
+		// The item alone would not fit, drop any stale value instead of flushing the whole cache
+		if element, exists := c.items[key]; exists {
+			c.removeElement(element)
+			c.publishSize()
+		}
+		return nil
+	}
+
+	if element, exists := c.items[key]; exists {
+		previous := element.Value.(*CacheItem)
+		c.currentBytes += item.size() - previous.size()
+		element.Value = item
+		c.lru.MoveToFront(element)
+	} else {
+		c.items[key] = c.lru.PushFront(item)
+		c.currentBytes += item.size()
+	}
+
+	c.evictOverflow()
+	c.publishSize()
 	return nil
 }
 
@@ -63,13 +141,109 @@ func (c *LocalCache) Delete(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// delete sur une map nil est sans danger en Go, donc pas besoin de vérifier c.items.
-	delete(c.items, key)
+	if element, exists := c.items[key]; exists {
+		c.removeElement(element)
+		c.publishSize()
+	}
 }
 
 func (c *LocalCache) Clear() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.items = make(map[string]CacheItem)
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+	c.currentBytes = 0
+	c.publishSize()
 	return nil
 }
+
+func (c *LocalCache) Stats() LocalCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return LocalCacheStats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+		Entries:     c.lru.Len(),
+		Bytes:       c.currentBytes,
+	}
+}
+
+// Sweep removes every expired item and returns how many were removed.
+func (c *LocalCache) Sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for element := c.lru.Back(); element != nil; {
+		previous := element.Prev()
+		if element.Value.(*CacheItem).isExpired(now) {
+			c.removeElement(element)
+			removed++
+		}
+		element = previous
+	}
+	if removed > 0 {
+		c.expirations.Add(uint64(removed))
+		for i := 0; i < removed; i++ {
+			metrics.TrackCacheEviction(localCacheMetricsLabel, "expired")
+		}
+		c.publishSize()
+	}
+	return removed
+}
+
+// Close stops the background sweeper. The cache remains usable afterwards.
+func (c *LocalCache) Close() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+func (c *LocalCache) sweepLoop() {
+	ticker := time.NewTicker(c.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Sweep()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// evictOverflow must be called with c.mu held.
+func (c *LocalCache) evictOverflow() {
+	for c.lru.Len() > 0 && c.isOverflowing() {
+		c.removeElement(c.lru.Back())
+		c.evictions.Add(1)
+		metrics.TrackCacheEviction(localCacheMetricsLabel, "size")
+	}
+}
+
+func (c *LocalCache) isOverflowing() bool {
+	if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		return true
+	}
+	return c.maxBytes > 0 && c.currentBytes > c.maxBytes
+}
+
+// removeElement must be called with c.mu held.
+func (c *LocalCache) removeElement(element *list.Element) {
+	item := element.Value.(*CacheItem)
+	c.lru.Remove(element)
+	delete(c.items, item.Key)
+	c.currentBytes -= item.size()
+}
+
+func (c *LocalCache) trackMiss() {
+	c.misses.Add(1)
+	metrics.TrackCacheMiss(localCacheMetricsLabel)
+}
+
+func (c *LocalCache) publishSize() {
+	metrics.SetCacheSize(localCacheMetricsLabel, c.lru.Len(), c.currentBytes)
+}
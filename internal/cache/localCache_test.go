@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalCacheGetSetDelete(t *testing.T) {
+	c := NewLocalCache(0, 0, 0)
+	assert.Equal(t, "", c.Get("missing"))
+	assert.Nil(t, c.Set("key", "value", nil))
+	assert.Equal(t, "value", c.Get("key"))
+	c.Delete("key")
+	assert.Equal(t, "", c.Get("key"))
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, 0, stats.Entries)
+	assert.Equal(t, int64(0), stats.Bytes)
+}
+
+func TestLocalCacheEvictsLeastRecentlyUsedEntry(t *testing.T) {
+	c := NewLocalCache(2, 0, 0)
+	_ = c.Set("a", "1", nil)
+	_ = c.Set("b", "2", nil)
+	// Touch a so that b becomes the least recently used entry
+	assert.Equal(t, "1", c.Get("a"))
+	_ = c.Set("c", "3", nil)
+
+	assert.Equal(t, "1", c.Get("a"))
+	assert.Equal(t, "", c.Get("b"))
+	assert.Equal(t, "3", c.Get("c"))
+	assert.Equal(t, uint64(1), c.Stats().Evictions)
+	assert.Equal(t, 2, c.Stats().Entries)
+}
+
+func TestLocalCacheEvictsOnMaxBytes(t *testing.T) {
+	c := NewLocalCache(0, 10, 0)
+	_ = c.Set("a", "1234", nil) // 5 bytes
+	_ = c.Set("b", "1234", nil) // 10 bytes
+	_ = c.Set("c", "1234", nil) // would be 15 bytes, evicts a
+	assert.Equal(t, "", c.Get("a"))
+	assert.Equal(t, "1234", c.Get("b"))
+	assert.Equal(t, "1234", c.Get("c"))
+	assert.Equal(t, int64(10), c.Stats().Bytes)
+
+	// An item bigger than the whole cache is never stored
+	_ = c.Set("big", strings.Repeat("x", 20), nil)
+	assert.Equal(t, "", c.Get("big"))
+	assert.Equal(t, "1234", c.Get("b"))
+}
+
+func TestLocalCacheOverwriteUpdatesSize(t *testing.T) {
+	c := NewLocalCache(0, 0, 0)
+	_ = c.Set("key", "short", nil)
+	_ = c.Set("key", "a much longer value", nil)
+	assert.Equal(t, "a much longer value", c.Get("key"))
+	assert.Equal(t, 1, c.Stats().Entries)
+	assert.Equal(t, int64(len("key")+len("a much longer value")), c.Stats().Bytes)
+}
+
+func TestLocalCacheExpiresOnGet(t *testing.T) {
+	c := NewLocalCache(0, 0, 0)
+	ttl := 0
+	_ = c.Set("key", "value", &ttl)
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, "", c.Get("key"))
+	assert.Equal(t, uint64(1), c.Stats().Expirations)
+	assert.Equal(t, 0, c.Stats().Entries)
+}
+
+func TestLocalCacheSweep(t *testing.T) {
+	c := NewLocalCache(0, 0, 0)
+	ttl := 0
+	_ = c.Set("expired-1", "value", &ttl)
+	_ = c.Set("expired-2", "value", &ttl)
+	_ = c.Set("kept", "value", nil)
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, 2, c.Sweep())
+	assert.Equal(t, 1, c.Stats().Entries)
+	assert.Equal(t, "value", c.Get("kept"))
+}
+
+func TestLocalCacheBackgroundSweeper(t *testing.T) {
+	c := NewLocalCache(0, 0, 10*time.Millisecond)
+	defer c.Close()
+	ttl := 0
+	_ = c.Set("key", "value", &ttl)
+	assert.Eventually(t, func() bool {
+		return c.Stats().Entries == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, uint64(1), c.Stats().Expirations)
+}
+
+func TestLocalCacheClear(t *testing.T) {
+	c := NewLocalCache(0, 0, 0)
+	_ = c.Set("a", "1", nil)
+	_ = c.Set("b", "2", nil)
+	assert.Nil(t, c.Clear())
+	assert.Equal(t, 0, c.Stats().Entries)
+	assert.Equal(t, int64(0), c.Stats().Bytes)
+	assert.Equal(t, "", c.Get("a"))
+}
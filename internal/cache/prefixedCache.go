@@ -0,0 +1,29 @@
+package cache
+
+// PrefixedCache namespaces the keys written to a cache shared by several apps, which compute the same keys
+// for their branches and runtime versions.
+type PrefixedCache struct {
+	inner  Cache
+	prefix string
+}
+
+func NewPrefixedCache(inner Cache, prefix string) *PrefixedCache {
+	return &PrefixedCache{inner: inner, prefix: prefix + ":"}
+}
+
+func (c *PrefixedCache) Get(key string) string {
+	return c.inner.Get(c.prefix + key)
+}
+
+func (c *PrefixedCache) Set(key string, value string, ttl *int) error {
+	return c.inner.Set(c.prefix+key, value, ttl)
+}
+
+func (c *PrefixedCache) Delete(key string) {
+	c.inner.Delete(c.prefix + key)
+}
+
+// Clear clears the whole shared cache, the other namespaces are recomputed on their next reads.
+func (c *PrefixedCache) Clear() error {
+	return c.inner.Clear()
+}
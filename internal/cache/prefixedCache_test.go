@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixedCachesDoNotShareKeys(t *testing.T) {
+	shared := NewLocalCache(0, 0, 0)
+	first := NewPrefixedCache(shared, "first")
+	second := NewPrefixedCache(shared, "second")
+
+	assert.Nil(t, first.Set("branches", "a", nil))
+	assert.Nil(t, second.Set("branches", "b", nil))
+	assert.Equal(t, "a", first.Get("branches"))
+	assert.Equal(t, "b", second.Get("branches"))
+
+	first.Delete("branches")
+	assert.Equal(t, "", first.Get("branches"))
+	assert.Equal(t, "b", second.Get("branches"))
+
+	assert.Nil(t, first.Clear())
+	assert.Equal(t, "", second.Get("branches"))
+}
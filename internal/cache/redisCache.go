@@ -4,33 +4,127 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+type RedisMode string
+
+const (
+	RedisStandaloneMode RedisMode = "standalone"
+	RedisSentinelMode   RedisMode = "sentinel"
+	RedisClusterMode    RedisMode = "cluster"
+)
+
+// DefaultRedisKeyPrefix is the prefix earlier versions hard-coded, keeping it as the default lets an upgraded
+// server find the cached values and the sessions stored before the upgrade.
+const DefaultRedisKeyPrefix = "expo-open-ota"
+
+type RedisOptions struct {
+	Mode     RedisMode
+	Host     string
+	Port     string
+	Username string
+	Password string
+	DB       int
+	UseTLS   bool
+	// Sentinel mode
+	SentinelMasterName string
+	SentinelAddrs      []string
+	SentinelUsername   string
+	SentinelPassword   string
+	// Cluster mode
+	ClusterAddrs []string
+	// Prefix prepended to every key, so that several instances can share one Redis
+	KeyPrefix string
+}
+
 type RedisCache struct {
-	client   *redis.Client
-	host     string
-	password string
-	port     string
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+func (o RedisOptions) Validate() error {
+	switch o.Mode {
+	case "", RedisStandaloneMode:
+		if o.Host == "" || o.Port == "" {
+			return errors.New("REDIS_HOST and REDIS_PORT must be set in standalone mode")
+		}
+	case RedisSentinelMode:
+		if o.SentinelMasterName == "" {
+			return errors.New("REDIS_SENTINEL_MASTER_NAME must be set in sentinel mode")
+		}
+		if len(o.SentinelAddrs) == 0 {
+			return errors.New("REDIS_SENTINEL_ADDRS must be set in sentinel mode")
+		}
+	case RedisClusterMode:
+		if len(o.ClusterAddrs) == 0 {
+			return errors.New("REDIS_CLUSTER_ADDRS must be set in cluster mode")
+		}
+		if o.DB != 0 {
+			return errors.New("REDIS_DB is not supported in cluster mode")
+		}
+	default:
+		return fmt.Errorf("unknown REDIS_MODE: %s", o.Mode)
+	}
+	if o.DB < 0 {
+		return fmt.Errorf("invalid REDIS_DB: %d", o.DB)
+	}
+	return nil
 }
 
-func appendKeyPrefix(key string) string {
-	return "expo-open-ota:" + key
+func newRedisClient(opts RedisOptions) redis.UniversalClient {
+	var tlsConfig *tls.Config
+	if opts.UseTLS {
+		tlsConfig = &tls.Config{}
+	}
+	switch opts.Mode {
+	case RedisSentinelMode:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       opts.SentinelMasterName,
+			SentinelAddrs:    opts.SentinelAddrs,
+			SentinelUsername: opts.SentinelUsername,
+			SentinelPassword: opts.SentinelPassword,
+			Username:         opts.Username,
+			Password:         opts.Password,
+			DB:               opts.DB,
+			TLSConfig:        tlsConfig,
+		})
+	case RedisClusterMode:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     opts.ClusterAddrs,
+			Username:  opts.Username,
+			Password:  opts.Password,
+			TLSConfig: tlsConfig,
+		})
+	default:
+		return redis.NewClient(&redis.Options{
+			Addr:      opts.Host + ":" + opts.Port,
+			Username:  opts.Username,
+			Password:  opts.Password,
+			DB:        opts.DB,
+			TLSConfig: tlsConfig,
+		})
+	}
 }
 
-func NewRedisCache(host, password, port string, useTLS bool) *RedisCache {
-	opts := &redis.Options{
-		Addr:     host + ":" + port,
-		Password: password,
+// Prefix is the prefix of every key written by the server, DefaultRedisKeyPrefix when not configured.
+func (o RedisOptions) Prefix() string {
+	if o.KeyPrefix == "" {
+		return DefaultRedisKeyPrefix
 	}
+	return o.KeyPrefix
+}
 
-	if useTLS {
-		opts.TLSConfig = &tls.Config{}
+// NewRedisClient connects to the Redis configured by opts and panics when it cannot be reached.
+func NewRedisClient(opts RedisOptions) redis.UniversalClient {
+	if err := opts.Validate(); err != nil {
+		panic(err)
 	}
 
-	client := redis.NewClient(opts)
+	client := newRedisClient(opts)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -38,15 +132,22 @@ func NewRedisCache(host, password, port string, useTLS bool) *RedisCache {
 	if _, err := client.Ping(ctx).Result(); err != nil {
 		panic(err)
 	}
+	return client
+}
 
-	return &RedisCache{client: client}
+func NewRedisCache(opts RedisOptions) *RedisCache {
+	return &RedisCache{client: NewRedisClient(opts), keyPrefix: opts.Prefix()}
+}
+
+func (c *RedisCache) prefixKey(key string) string {
+	return c.keyPrefix + ":" + key
 }
 
 func (c *RedisCache) Get(key string) string {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	val, err := c.client.Get(ctx, appendKeyPrefix(key)).Result()
+	val, err := c.client.Get(ctx, c.prefixKey(key)).Result()
 	if errors.Is(err, redis.Nil) {
 		return ""
 	} else if err != nil {
@@ -64,19 +165,61 @@ func (c *RedisCache) Set(key string, value string, ttl *int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	return c.client.Set(ctx, appendKeyPrefix(key), value, expiration).Err()
+	return c.client.Set(ctx, c.prefixKey(key), value, expiration).Err()
 }
 
 func (c *RedisCache) Delete(key string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	c.client.Del(ctx, appendKeyPrefix(key))
+	c.client.Del(ctx, c.prefixKey(key))
 }
 
+// Clear only removes the keys of this instance's namespace, other instances sharing
+// the same Redis are left untouched.
 func (c *RedisCache) Clear() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	return c.client.FlushDB(ctx).Err()
+	if clusterClient, ok := c.client.(*redis.ClusterClient); ok {
+		return clusterClient.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return c.deleteNamespace(ctx, node)
+		})
+	}
+	return c.deleteNamespace(ctx, c.client)
+}
+
+func (c *RedisCache) deleteNamespace(ctx context.Context, client redis.Cmdable) error {
+	var cursor uint64
+	for {
+		keys, nextCursor, err := client.Scan(ctx, cursor, c.prefixKey("*"), 500).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			// Keys are deleted one by one (pipelined) as they may belong to different cluster slots
+			pipe := client.Pipeline()
+			for _, key := range keys {
+				pipe.Del(ctx, key)
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return err
+			}
+		}
+		cursor = nextCursor
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+func (c *RedisCache) Publish(channel string, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return c.client.Publish(ctx, c.prefixKey(channel), message).Err()
+}
+
+func (c *RedisCache) Subscribe(ctx context.Context, channel string) *redis.PubSub {
+	return c.client.Subscribe(ctx, c.prefixKey(channel))
 }
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRedisCacheNamespacesKeys(t *testing.T) {
+	server := miniredis.RunT(t)
+	instanceA := NewRedisCache(RedisOptions{Host: server.Host(), Port: server.Port(), KeyPrefix: "app-a"})
+	instanceB := NewRedisCache(RedisOptions{Host: server.Host(), Port: server.Port(), KeyPrefix: "app-b"})
+
+	assert.Nil(t, instanceA.Set("key", "a", nil))
+	assert.Nil(t, instanceB.Set("key", "b", nil))
+	assert.Equal(t, "a", instanceA.Get("key"))
+	assert.Equal(t, "b", instanceB.Get("key"))
+	assert.True(t, server.Exists("app-a:key"))
+	assert.True(t, server.Exists("app-b:key"))
+}
+
+func TestRedisCacheDefaultKeyPrefix(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := NewRedisCache(RedisOptions{Host: server.Host(), Port: server.Port()})
+	assert.Nil(t, c.Set("key", "value", nil))
+	assert.True(t, server.Exists("expo-open-ota:key"))
+
+	// Keys written before the prefix was configurable are still read
+	assert.Nil(t, server.Set("expo-open-ota:legacy", "value"))
+	assert.Equal(t, "value", c.Get("legacy"))
+}
+
+func TestRedisCacheClearOnlyRemovesOwnNamespace(t *testing.T) {
+	server := miniredis.RunT(t)
+	instanceA := NewRedisCache(RedisOptions{Host: server.Host(), Port: server.Port(), KeyPrefix: "app-a"})
+	instanceB := NewRedisCache(RedisOptions{Host: server.Host(), Port: server.Port(), KeyPrefix: "app-b"})
+	for _, key := range []string{"k1", "k2", "k3"} {
+		assert.Nil(t, instanceA.Set(key, "a", nil))
+		assert.Nil(t, instanceB.Set(key, "b", nil))
+	}
+
+	assert.Nil(t, instanceA.Clear())
+	assert.Equal(t, "", instanceA.Get("k1"))
+	assert.Equal(t, "b", instanceB.Get("k1"))
+	assert.Equal(t, 3, len(server.Keys()))
+}
+
+func TestRedisCacheUsesDBAndACLUser(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("ota", "secret")
+	c := NewRedisCache(RedisOptions{Host: server.Host(), Port: server.Port(), Username: "ota", Password: "secret", DB: 2})
+	assert.Nil(t, c.Set("key", "value", nil))
+
+	server.Select(2)
+	assert.True(t, server.Exists("expo-open-ota:key"))
+	server.Select(0)
+	assert.False(t, server.Exists("expo-open-ota:key"))
+}
+
+func TestRedisOptionsValidation(t *testing.T) {
+	assert.NotNil(t, RedisOptions{}.Validate())
+	assert.Nil(t, RedisOptions{Host: "localhost", Port: "6379"}.Validate())
+	assert.NotNil(t, RedisOptions{Host: "localhost", Port: "6379", DB: -1}.Validate())
+	assert.NotNil(t, RedisOptions{Mode: RedisSentinelMode, SentinelAddrs: []string{"localhost:26379"}}.Validate())
+	assert.NotNil(t, RedisOptions{Mode: RedisSentinelMode, SentinelMasterName: "mymaster"}.Validate())
+	assert.Nil(t, RedisOptions{Mode: RedisSentinelMode, SentinelMasterName: "mymaster", SentinelAddrs: []string{"localhost:26379"}}.Validate())
+	assert.NotNil(t, RedisOptions{Mode: RedisClusterMode}.Validate())
+	assert.NotNil(t, RedisOptions{Mode: RedisClusterMode, ClusterAddrs: []string{"localhost:7000"}, DB: 1}.Validate())
+	assert.Nil(t, RedisOptions{Mode: RedisClusterMode, ClusterAddrs: []string{"localhost:7000"}}.Validate())
+	assert.NotNil(t, RedisOptions{Mode: "unknown"}.Validate())
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"a:1", "b:2"}, splitList(" a:1, b:2 ,,"))
+	assert.Nil(t, splitList(""))
+}
@@ -3,7 +3,6 @@ package cdn
 import "sync"
 
 type CDN interface {
-	isCDNAvailable() bool
 	ComputeRedirectionURLForAsset(branch, runtimeVersion, updateId, asset string) (string, error)
 }
 
@@ -117,3 +117,26 @@ func SignRSASHA1(data, privateKeyPEM string) (string, error) {
 
 	return base64.StdEncoding.EncodeToString(signature), nil
 }
+
+// VerifyRSASHA256 checks a base64 signature made by SignRSASHA256 against the PEM encoded public key.
+func VerifyRSASHA256(data, signature, publicKeyPEM string) error {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return errors.New("invalid public key PEM format")
+	}
+	var publicKey *rsa.PublicKey
+	if parsedKey, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		var ok bool
+		if publicKey, ok = parsedKey.(*rsa.PublicKey); !ok {
+			return errors.New("key is not an RSA public key")
+		}
+	} else if publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+		return fmt.Errorf("failed to parse public key: %w", err)
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	hashed := sha256.Sum256([]byte(data))
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signatureBytes)
+}
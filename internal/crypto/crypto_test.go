@@ -101,3 +101,39 @@ func TestSignRSASHA256(t *testing.T) {
 		t.Errorf("expected error for invalid private key, got none")
 	}
 }
+
+func TestVerifyRSASHA256(t *testing.T) {
+	data := "test data"
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %v", err)
+	}
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	publicKeyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes}))
+	pkcs1PublicKeyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)}))
+
+	signature, err := SignRSASHA256(data, string(privateKeyPEM))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := VerifyRSASHA256(data, signature, publicKeyPEM); err != nil {
+		t.Errorf("signature verification failed: %v", err)
+	}
+	if err := VerifyRSASHA256(data, signature, pkcs1PublicKeyPEM); err != nil {
+		t.Errorf("signature verification with a PKCS1 key failed: %v", err)
+	}
+	if err := VerifyRSASHA256("other data", signature, publicKeyPEM); err == nil {
+		t.Errorf("expected error for tampered data, got none")
+	}
+	if err := VerifyRSASHA256(data, signature, "invalid"); err == nil {
+		t.Errorf("expected error for invalid public key, got none")
+	}
+}
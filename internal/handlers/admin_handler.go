@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/apiKeys"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"expo-open-ota/internal/uploadSessions"
+	"expo-open-ota/internal/webhooks"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type reindexEvent struct {
+	Progress *update.ReindexProgress `json:"progress,omitempty"`
+	Report   *update.ReindexReport   `json:"report,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+// ReindexHandler rebuilds caches and the metadata store from the bucket. With ?stream=true the
+// progress is streamed as newline-delimited JSON events, the last one holding the report.
+func (h *Handlers) ReindexHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	stream := r.URL.Query().Get("stream") == "true"
+	flusher, canFlush := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	log.Printf("[RequestID: %s] Rebuilding index from bucket", requestID)
+	if stream {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+	report, err := h.updates.RebuildIndex(func(progress update.ReindexProgress) {
+		if progress.Updates%100 == 0 {
+			log.Printf("[RequestID: %s] Reindex progress: %d branches, %d runtime versions, %d updates", requestID, progress.Branches, progress.RuntimeVersions, progress.Updates)
+		}
+		if !stream {
+			return
+		}
+		_ = encoder.Encode(reindexEvent{Progress: &progress})
+		if canFlush {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		log.Printf("[RequestID: %s] Error rebuilding index: %v", requestID, err)
+		if stream {
+			_ = encoder.Encode(reindexEvent{Error: err.Error()})
+			return
+		}
+		http.Error(w, "Error rebuilding index", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[RequestID: %s] Index rebuilt: %d updates, %d issues in %s", requestID, report.Updates, len(report.Issues), report.Duration)
+	if stream {
+		_ = encoder.Encode(reindexEvent{Report: &report})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = encoder.Encode(report)
+}
+
+// RevokeAllSessionsHandler logs out everyone signed in to the app, including the caller.
+func (h *Handlers) RevokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	if err := h.auth.RevokeAllSessions(); err != nil {
+		log.Printf("[RequestID: %s] Error revoking sessions: %v", requestID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[RequestID: %s] All sessions revoked by %s", requestID, auth.PrincipalFromContext(r.Context()).Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type PromoteUpdateRequest struct {
+	Branch string `json:"branch"`
+}
+
+type RollbackRequest struct {
+	// Update of the branch to publish again, the clients roll back to their embedded update when empty
+	UpdateId string `json:"updateId"`
+	Platform string `json:"platform"`
+}
+
+type ImportUpdateResponse struct {
+	Update types.Update `json:"update"`
+	// Source describes the update the archive was exported from
+	Source update.ArchiveManifest `json:"source"`
+}
+
+type GarbageCollectionResponse struct {
+	update.GCReport
+	SweptUploadSessions int `json:"sweptUploadSessions"`
+}
+
+func writeUpdateOperationError(w http.ResponseWriter, requestID string, message string, err error) {
+	log.Printf("[RequestID: %s] %s: %v", requestID, message, err)
+	switch {
+	case errors.Is(err, update.ErrUpdateNotFound):
+		http.Error(w, "Update not found", http.StatusNotFound)
+	case errors.As(err, new(*http.MaxBytesError)):
+		http.Error(w, "Archive too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, bucket.ErrUnsafePath), errors.Is(err, update.ErrInvalidArchive), errors.Is(err, update.ErrArchiveSignature):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
+
+func updateFromVars(r *http.Request) types.Update {
+	vars := mux.Vars(r)
+	return types.Update{Branch: vars["BRANCH"], RuntimeVersion: vars["RUNTIME_VERSION"], UpdateId: vars["UPDATE_ID"]}
+}
+
+// PromoteUpdateHandler publishes a copy of an update as the latest update of another branch.
+func (h *Handlers) PromoteUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	source := updateFromVars(r)
+	var request PromoteUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Branch == "" {
+		http.Error(w, "A target branch is required", http.StatusBadRequest)
+		return
+	}
+	h.promoteUpdate(w, requestID, source, request.Branch)
+}
+
+// PublisherPromoteUpdateHandler promotes an update on behalf of eoas or a CI, authenticated like the upload
+// endpoints. API keys need the promote scope on the target branch.
+func (h *Handlers) PublisherPromoteUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	source := types.Update{
+		Branch:         mux.Vars(r)["BRANCH"],
+		RuntimeVersion: r.URL.Query().Get("runtimeVersion"),
+		UpdateId:       r.URL.Query().Get("updateId"),
+	}
+	if err := bucket.ValidateUpdatePath(source.Branch, source.RuntimeVersion, source.UpdateId); err != nil {
+		log.Printf("[RequestID: %s] Invalid update: %v", requestID, err)
+		http.Error(w, "Invalid branch, runtime version or update id", http.StatusBadRequest)
+		return
+	}
+	publisher, ok := h.authenticatePublisher(w, r, requestID, http.StatusUnauthorized)
+	if !ok {
+		return
+	}
+	var request PromoteUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Branch == "" {
+		http.Error(w, "A target branch is required", http.StatusBadRequest)
+		return
+	}
+	if !authorizeApiKey(w, requestID, publisher.apiKey, apiKeys.PromoteAction, request.Branch) {
+		return
+	}
+	h.promoteUpdate(w, requestID, source, request.Branch)
+}
+
+func (h *Handlers) promoteUpdate(w http.ResponseWriter, requestID string, source types.Update, targetBranch string) {
+	promoted, err := h.updates.PromoteUpdate(source, targetBranch)
+	if err != nil {
+		writeUpdateOperationError(w, requestID, "Error promoting update", err)
+		return
+	}
+	log.Printf("[RequestID: %s] Update %s/%s/%s promoted to %s as %s", requestID, source.Branch, source.RuntimeVersion, source.UpdateId, promoted.Branch, promoted.UpdateId)
+	eventType := webhooks.UpdatePublishedEvent
+	if h.updates.GetUpdateType(promoted) == types.Rollback {
+		eventType = webhooks.UpdateRolledBackEvent
+	}
+	_, platform, _ := h.updates.RetrieveUpdateCommitHashAndPlatform(promoted)
+	h.dispatchUpdateEvent(eventType, promoted, platform, "promoted from "+source.Branch+" update "+source.UpdateId)
+	writeJSON(w, http.StatusCreated, promoted)
+}
+
+// RollbackHandler publishes an older update of a branch again, or a rollback to the embedded update.
+func (h *Handlers) RollbackHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	target := updateFromVars(r)
+	var request RollbackRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+	var published types.Update
+	var err error
+	reason := "rolled back to embedded update"
+	if request.UpdateId != "" {
+		target.UpdateId = request.UpdateId
+		audit.EventFromContext(r.Context()).Target.UpdateId = request.UpdateId
+		published, err = h.updates.PromoteUpdate(target, target.Branch)
+		reason = "rolled back to update " + request.UpdateId
+	} else {
+		published, err = h.updates.RollbackToEmbedded(target.Branch, target.RuntimeVersion, request.Platform)
+	}
+	if err != nil {
+		writeUpdateOperationError(w, requestID, "Error rolling back", err)
+		return
+	}
+	log.Printf("[RequestID: %s] Branch %s (runtime version %s) %s, published as %s", requestID, target.Branch, target.RuntimeVersion, reason, published.UpdateId)
+	_, platform, _ := h.updates.RetrieveUpdateCommitHashAndPlatform(published)
+	h.dispatchUpdateEvent(webhooks.UpdateRolledBackEvent, published, platform, reason)
+	writeJSON(w, http.StatusCreated, published)
+}
+
+// exportWriter tells whether the archive started to be written, after which errors can no longer be answered.
+type exportWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(p)
+}
+
+// ExportUpdateHandler streams a committed update as an archive signed with the key of the server.
+func (h *Handlers) ExportUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	exported := updateFromVars(r)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s-%s.tar.gz"`, exported.Branch, exported.RuntimeVersion, exported.UpdateId))
+	writer := &exportWriter{ResponseWriter: w}
+	manifest, err := h.updates.ExportUpdate(exported, writer, h.keys.GetPrivateExpoKey())
+	if err != nil {
+		if writer.started {
+			log.Printf("[RequestID: %s] Error exporting update, archive truncated: %v", requestID, err)
+			return
+		}
+		w.Header().Del("Content-Disposition")
+		writeUpdateOperationError(w, requestID, "Error exporting update", err)
+		return
+	}
+	log.Printf("[RequestID: %s] Update %s/%s/%s exported with %d files", requestID, exported.Branch, exported.RuntimeVersion, exported.UpdateId, len(manifest.Files))
+}
+
+// ImportUpdateHandler publishes the update of an archive as the latest update of its runtime version on
+// the branch, once its signature and the hashes of its files are verified.
+func (h *Handlers) ImportUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	branch := mux.Vars(r)["BRANCH"]
+	publicKeys, err := update.ArchivePublicKeys(h.keys.GetPublicExpoKey())
+	if err != nil {
+		writeUpdateOperationError(w, requestID, "Error reading archive public keys", err)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, update.MaxArchiveSize())
+	imported, source, err := h.updates.ImportUpdate(body, branch, publicKeys)
+	if err != nil {
+		writeUpdateOperationError(w, requestID, "Error importing update", err)
+		return
+	}
+	audit.EventFromContext(r.Context()).Target.UpdateId = imported.UpdateId
+	log.Printf("[RequestID: %s] Update %s/%s/%s imported into %s as %s", requestID, source.Branch, source.RuntimeVersion, source.UpdateId, branch, imported.UpdateId)
+	eventType := webhooks.UpdatePublishedEvent
+	if h.updates.GetUpdateType(imported) == types.Rollback {
+		eventType = webhooks.UpdateRolledBackEvent
+	}
+	_, platform, _ := h.updates.RetrieveUpdateCommitHashAndPlatform(imported)
+	h.dispatchUpdateEvent(eventType, imported, platform, "imported from "+source.Branch+" update "+source.UpdateId)
+	writeJSON(w, http.StatusCreated, ImportUpdateResponse{Update: imported, Source: source})
+}
+
+func (h *Handlers) DeleteUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	deleted := updateFromVars(r)
+	if err := h.updates.DeleteUpdate(deleted); err != nil {
+		writeUpdateOperationError(w, requestID, "Error deleting update", err)
+		return
+	}
+	log.Printf("[RequestID: %s] Update %s/%s/%s deleted", requestID, deleted.Branch, deleted.RuntimeVersion, deleted.UpdateId)
+	webhooks.Dispatch(webhooks.NewEvent(h.app, webhooks.UpdateDeletedEvent, deleted.Branch, deleted.RuntimeVersion, deleted.UpdateId))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CollectGarbageHandler deletes the abandoned uploads and, with ?keep=N, the committed updates older than
+// the N latest ones of each runtime version. Only updates older than ?minAge (24h by default) are deleted.
+func (h *Handlers) CollectGarbageHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	query := r.URL.Query()
+	options := update.GCOptions{MinAge: 24 * time.Hour, DryRun: query.Get("dryRun") == "true"}
+	if keep := query.Get("keep"); keep != "" {
+		keepUpdates, err := strconv.Atoi(keep)
+		if err != nil || keepUpdates < 0 {
+			http.Error(w, "keep must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		options.KeepUpdates = keepUpdates
+	}
+	if minAge := query.Get("minAge"); minAge != "" {
+		duration, err := time.ParseDuration(minAge)
+		if err != nil || duration < 0 {
+			http.Error(w, "minAge must be a positive duration such as 24h", http.StatusBadRequest)
+			return
+		}
+		options.MinAge = duration
+	}
+	report, err := h.updates.CollectGarbage(options)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error collecting garbage: %v", requestID, err)
+		http.Error(w, "Error collecting garbage", http.StatusInternalServerError)
+		return
+	}
+	response := GarbageCollectionResponse{GCReport: report}
+	if !options.DryRun {
+		for _, deletion := range report.Deleted {
+			webhooks.Dispatch(webhooks.NewEvent(h.app, webhooks.UpdateDeletedEvent, deletion.Branch, deletion.RuntimeVersion, deletion.UpdateId))
+		}
+		swept, err := uploadSessions.SweepExpired(h.updates, time.Now())
+		if err != nil {
+			log.Printf("[RequestID: %s] Error sweeping upload sessions: %v", requestID, err)
+		}
+		response.SweptUploadSessions = swept
+	}
+	log.Printf("[RequestID: %s] Garbage collected: %d of %d updates deleted (dry run: %t) in %s", requestID, len(report.Deleted), report.Scanned, options.DryRun, report.Duration)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// VerifyStorageHandler reports the consistency errors of the bucket without changing anything.
+func (h *Handlers) VerifyStorageHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := h.updates.VerifyStorage()
+	if err != nil {
+		log.Printf("Error verifying storage: %v", err)
+		http.Error(w, "Error verifying storage", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/apiKeys"
+	"expo-open-ota/internal/audit"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type CreateApiKeyRequest struct {
+	Name      string           `json:"name"`
+	Branches  []string         `json:"branches"`
+	Actions   []apiKeys.Action `json:"actions"`
+	ExpiresAt *time.Time       `json:"expiresAt,omitempty"`
+}
+
+type CreateApiKeyResponse struct {
+	apiKeys.ApiKey
+	// Only returned once, the server only keeps its hash
+	Key string `json:"key"`
+}
+
+func (h *Handlers) ListApiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := apiKeys.ListApiKeys(h.app)
+	if err != nil {
+		log.Printf("Error listing api keys: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response := make([]apiKeys.ApiKey, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, key.Redacted())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handlers) CreateApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	var request CreateApiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("[RequestID: %s] Error decoding JSON body: %v", requestID, err)
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	key, rawKey, err := apiKeys.CreateApiKey(h.app, request.Name, request.Branches, request.Actions, request.ExpiresAt)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error creating api key: %v", requestID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[RequestID: %s] Api key %s (%s) created", requestID, key.Id, key.Name)
+	w.Header().Set("Content-Type", "application/json")
+	audit.EventFromContext(r.Context()).Target.Resource = key.Id
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateApiKeyResponse{ApiKey: key.Redacted(), Key: rawKey})
+}
+
+func (h *Handlers) RevokeApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	id := mux.Vars(r)["ID"]
+	err := apiKeys.RevokeApiKey(h.app, id, time.Now().UTC())
+	if errors.Is(err, apiKeys.ErrApiKeyNotFound) {
+		http.Error(w, "Api key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[RequestID: %s] Error revoking api key: %v", requestID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[RequestID: %s] Api key %s revoked", requestID, id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,19 +2,17 @@ package handlers
 
 import (
     "expo-open-ota/internal/assets"
-    cdn2 "expo-open-ota/internal/cdn"
     "expo-open-ota/internal/compression"
     "expo-open-ota/internal/metrics"
-    "expo-open-ota/internal/services"
     "github.com/google/uuid"
     "log"
     "net/http"
 )
 
-func AssetsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) AssetsHandler(w http.ResponseWriter, r *http.Request) {
 	channelName := r.Header.Get("expo-channel-name")
 	preventCDNRedirection := r.Header.Get("prevent-cdn-redirection") == "true"
-	branchMap, err := services.FetchExpoChannelMapping(channelName)
+	branchMap, err := h.channels.ResolveChannel(channelName)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error fetching channel mapping: %v", uuid.New().String(), err)
         clientId := r.Header.Get("EAS-Client-ID")
@@ -25,7 +23,7 @@ func AssetsHandler(w http.ResponseWriter, r *http.Request) {
         if branchMap != nil {
             branch = branchMap.BranchName
         }
-        metrics.TrackUpdateErrorUser(clientId, platform, runtimeVersion, branch, updateId)
+        metrics.TrackUpdateErrorUser(h.app, clientId, platform, runtimeVersion, branch, updateId)
 		http.Error(w, "Error fetching channel mapping", http.StatusInternalServerError)
 		return
 	}
@@ -35,7 +33,7 @@ func AssetsHandler(w http.ResponseWriter, r *http.Request) {
         platform := r.URL.Query().Get("platform")
         runtimeVersion := r.URL.Query().Get("runtimeVersion")
         updateId := r.Header.Get("expo-current-update-id")
-        metrics.TrackUpdateErrorUser(clientId, platform, runtimeVersion, "", updateId)
+        metrics.TrackUpdateErrorUser(h.app, clientId, platform, runtimeVersion, "", updateId)
 		http.Error(w, "No branch mapping found", http.StatusNotFound)
 		return
 	}
@@ -48,12 +46,12 @@ func AssetsHandler(w http.ResponseWriter, r *http.Request) {
 		RequestID:      uuid.New().String(),
 	}
 
-	cdn := cdn2.GetCDN()
+	cdn := h.cdn
 	if cdn == nil || preventCDNRedirection {
-		resp, err := assets.HandleAssetsWithFile(req)
+		resp, err := assets.HandleAssetsWithFile(h.updates, req)
 		if err != nil {
             clientId := r.Header.Get("EAS-Client-ID")
-            metrics.TrackUpdateErrorUser(clientId, req.Platform, req.RuntimeVersion, req.Branch, r.Header.Get("expo-current-update-id"))
+            metrics.TrackUpdateErrorUser(h.app, clientId, req.Platform, req.RuntimeVersion, req.Branch, r.Header.Get("expo-current-update-id"))
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -63,17 +61,17 @@ func AssetsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		if resp.StatusCode != 200 {
             clientId := r.Header.Get("EAS-Client-ID")
-            metrics.TrackUpdateErrorUser(clientId, req.Platform, req.RuntimeVersion, req.Branch, r.Header.Get("expo-current-update-id"))
+            metrics.TrackUpdateErrorUser(h.app, clientId, req.Platform, req.RuntimeVersion, req.Branch, r.Header.Get("expo-current-update-id"))
 			http.Error(w, string(resp.Body), resp.StatusCode)
 			return
 		}
 		compression.ServeCompressedAsset(w, r, resp.Body, resp.ContentType, req.RequestID)
 		return
 	}
-	resp, err := assets.HandleAssetsWithURL(req, cdn)
+	resp, err := assets.HandleAssetsWithURL(h.updates, req, cdn)
 	if err != nil {
         clientId := r.Header.Get("EAS-Client-ID")
-        metrics.TrackUpdateErrorUser(clientId, req.Platform, req.RuntimeVersion, req.Branch, r.Header.Get("expo-current-update-id"))
+        metrics.TrackUpdateErrorUser(h.app, clientId, req.Platform, req.RuntimeVersion, req.Branch, r.Header.Get("expo-current-update-id"))
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
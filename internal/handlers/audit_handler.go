@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/audit"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Action:         audit.Action(query.Get("action")),
+		Actor:          query.Get("actor"),
+		Branch:         query.Get("branch"),
+		RuntimeVersion: query.Get("runtimeVersion"),
+		UpdateId:       query.Get("updateId"),
+		Outcome:        audit.Outcome(query.Get("outcome")),
+	}
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, errors.New("Invalid " + name + " date, expected RFC 3339")
+			}
+			*target = parsed
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return filter, errors.New("Invalid limit")
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+func (h *Handlers) GetAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	sink := h.auditSink
+	if sink == nil {
+		http.Error(w, "Audit log is disabled", http.StatusNotImplemented)
+		return
+	}
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := sink.Query(filter)
+	if errors.Is(err, audit.ErrQueryNotSupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		log.Printf("[RequestID: %s] Error querying audit log: %v", requestID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(events)
+}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"expo-open-ota/internal/audit"
 	"expo-open-ota/internal/auth"
 	"expo-open-ota/internal/dashboard"
 	"net/http"
+	"strings"
 )
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	dashboardEnabled := dashboard.IsDashboardEnabled()
 	if !dashboardEnabled {
 		w.WriteHeader(http.StatusNotFound)
@@ -17,19 +19,32 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	authService := auth.NewAuth()
-	authResponse, err := authService.LoginWithPassword(password)
+	authService := h.auth
+	var authResponse *auth.AuthResponse
+	var err error
+	event := audit.EventFromContext(r.Context())
+	// Without a username, the password is checked against the shared ADMIN_PASSWORD
+	if username := r.FormValue("username"); username != "" {
+		event.Actor = audit.Actor{Type: audit.UserActor, Name: username}
+		authResponse, err = authService.LoginWithCredentials(username, password)
+	} else {
+		event.Actor = audit.Actor{Type: audit.UserActor, Id: auth.AdminDashboardSubject, Name: "admin"}
+		authResponse, err = authService.LoginWithPassword(password)
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	if principal, err := authService.ValidateToken(authResponse.Token); err == nil {
+		event.Actor.Id = principal.Subject
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_, _ = w.Write([]byte(`{"token":"` + authResponse.Token + `","refreshToken":"` + authResponse.RefreshToken + `"}`))
 	w.WriteHeader(http.StatusOK)
 }
 
-func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	dashboardEnabled := dashboard.IsDashboardEnabled()
 	if !dashboardEnabled {
 		w.WriteHeader(http.StatusNotFound)
@@ -40,10 +55,9 @@ func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	authService := auth.NewAuth()
-	authResponse, err := authService.RefreshToken(refreshToken)
+	authResponse, err := h.auth.RefreshToken(refreshToken)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
@@ -51,3 +65,28 @@ func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(`{"token":"` + authResponse.Token + `","refreshToken":"` + authResponse.RefreshToken + `"}`))
 	w.WriteHeader(http.StatusOK)
 }
+
+// LogoutHandler ends the session of the refresh token posted, or of the bearer access token.
+func (h *Handlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	dashboardEnabled := dashboard.IsDashboardEnabled()
+	if !dashboardEnabled {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	token := r.FormValue("refreshToken")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if principal, err := h.auth.ValidateToken(token); err == nil {
+		audit.EventFromContext(r.Context()).Actor = audit.Actor{Type: audit.UserActor, Id: principal.Subject, Name: principal.Username}
+	}
+	if err := h.auth.Logout(token); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
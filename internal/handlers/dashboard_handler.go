@@ -4,11 +4,11 @@ import (
 	"encoding/json"
 	"expo-open-ota/config"
 	"expo-open-ota/internal/bucket"
-	cache2 "expo-open-ota/internal/cache"
 	"expo-open-ota/internal/crypto"
 	"expo-open-ota/internal/dashboard"
-	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/metadataStore"
 	update2 "expo-open-ota/internal/update"
+	"expo-open-ota/internal/webhooks"
 	"net/http"
 	"sort"
 	"strconv"
@@ -30,6 +30,13 @@ type UpdateItem struct {
 	Platform   string `json:"platform"`
 }
 
+type UpdateSearchItem struct {
+	UpdateItem
+	Branch         string `json:"branch"`
+	RuntimeVersion string `json:"runtimeVersion"`
+	Status         string `json:"status"`
+}
+
 type SettingsEnv struct {
 	BASE_URL                               string `json:"BASE_URL"`
 	EXPO_APP_ID                            string `json:"EXPO_APP_ID"`
@@ -37,6 +44,9 @@ type SettingsEnv struct {
 	CACHE_MODE                             string `json:"CACHE_MODE"`
 	REDIS_HOST                             string `json:"REDIS_HOST"`
 	REDIS_PORT                             string `json:"REDIS_PORT"`
+	REDIS_MODE                             string `json:"REDIS_MODE"`
+	REDIS_DB                               string `json:"REDIS_DB"`
+	REDIS_KEY_PREFIX                       string `json:"REDIS_KEY_PREFIX"`
 	STORAGE_MODE                           string `json:"STORAGE_MODE"`
 	S3_BUCKET_NAME                         string `json:"S3_BUCKET_NAME"`
 	LOCAL_BUCKET_BASE_PATH                 string `json:"LOCAL_BUCKET_BASE_PATH"`
@@ -69,6 +79,9 @@ func GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		CACHE_MODE:                             config.GetEnv("CACHE_MODE"),
 		REDIS_HOST:                             config.GetEnv("REDIS_HOST"),
 		REDIS_PORT:                             config.GetEnv("REDIS_PORT"),
+		REDIS_MODE:                             config.GetEnv("REDIS_MODE"),
+		REDIS_DB:                               config.GetEnv("REDIS_DB"),
+		REDIS_KEY_PREFIX:                       config.GetEnv("REDIS_KEY_PREFIX"),
 		STORAGE_MODE:                           config.GetEnv("STORAGE_MODE"),
 		S3_BUCKET_NAME:                         config.GetEnv("S3_BUCKET_NAME"),
 		LOCAL_BUCKET_BASE_PATH:                 config.GetEnv("LOCAL_BUCKET_BASE_PATH"),
@@ -89,15 +102,14 @@ func GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func GetBranchesHandler(w http.ResponseWriter, r *http.Request) {
-	resolvedBucket := bucket.GetBucket()
-	branches, err := resolvedBucket.GetBranches()
+func (h *Handlers) GetBranchesHandler(w http.ResponseWriter, r *http.Request) {
+	branches, err := h.updates.GetBranches()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	cacheKey := dashboard.ComputeGetBranchesCacheKey()
-	cache := cache2.GetCache()
+	cache := h.cache
 	if cacheValue := cache.Get(cacheKey); cacheValue != "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -106,7 +118,7 @@ func GetBranchesHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(branches)
 		return
 	}
-	branchesMapping, err := services.FetchExpoBranchesMapping()
+	branchesMapping, err := h.expoProject().FetchBranchesMapping()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -132,11 +144,11 @@ func GetBranchesHandler(w http.ResponseWriter, r *http.Request) {
 	cache.Set(cacheKey, string(marshaledResponse), nil)
 }
 
-func GetRuntimeVersionsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) GetRuntimeVersionsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	branchName := vars["BRANCH"]
 	cacheKey := dashboard.ComputeGetRuntimeVersionsCacheKey(branchName)
-	cache := cache2.GetCache()
+	cache := h.cache
 	if cacheValue := cache.Get(cacheKey); cacheValue != "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -145,8 +157,7 @@ func GetRuntimeVersionsHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(runtimeVersions)
 		return
 	}
-	resolvedBucket := bucket.GetBucket()
-	runtimeVersions, err := resolvedBucket.GetRuntimeVersions(branchName)
+	runtimeVersions, err := h.updates.GetRuntimeVersions(branchName)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -164,12 +175,12 @@ func GetRuntimeVersionsHandler(w http.ResponseWriter, r *http.Request) {
 	cache.Set(cacheKey, string(marshaledResponse), nil)
 }
 
-func GetUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) GetUpdatesHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	branchName := vars["BRANCH"]
 	runtimeVersion := vars["RUNTIME_VERSION"]
 	cacheKey := dashboard.ComputeGetUpdatesCacheKey(branchName, runtimeVersion)
-	cache := cache2.GetCache()
+	cache := h.cache
 	if cacheValue := cache.Get(cacheKey); cacheValue != "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -178,7 +189,21 @@ func GetUpdatesHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(updatesResponse)
 		return
 	}
-	resolvedBucket := bucket.GetBucket()
+	if store := h.updates.MetadataStore(); store != nil {
+		records, err := store.GetUpdates(branchName, runtimeVersion)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		updatesResponse := h.buildUpdateItemsFromRecords(records)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(updatesResponse)
+		marshaledResponse, _ := json.Marshal(updatesResponse)
+		cache.Set(cacheKey, string(marshaledResponse), nil)
+		return
+	}
+	resolvedBucket := h.bucket
 	updates, err := resolvedBucket.GetUpdates(branchName, runtimeVersion)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -187,16 +212,16 @@ func GetUpdatesHandler(w http.ResponseWriter, r *http.Request) {
 
 	var updatesResponse []UpdateItem
 	for _, update := range updates {
-		isValid := update2.IsUpdateValid(update)
+		isValid := h.updates.IsUpdateValid(update)
 		if !isValid {
 			continue
 		}
-		metadata, err := update2.GetMetadata(update)
+		metadata, err := h.updates.GetMetadata(update)
 		if err != nil {
 			continue
 		}
 		numberUpdate, _ := strconv.ParseInt(update.UpdateId, 10, 64)
-		commitHash, platform, _ := update2.RetrieveUpdateCommitHashAndPlatform(update)
+		commitHash, platform, _ := h.updates.RetrieveUpdateCommitHashAndPlatform(update)
 		updatesResponse = append(updatesResponse, UpdateItem{
 			UpdateUUID: crypto.ConvertSHA256HashToUUID(metadata.ID),
 			UpdateId:   update.UpdateId,
@@ -217,12 +242,12 @@ func GetUpdatesHandler(w http.ResponseWriter, r *http.Request) {
 	cache.Set(cacheKey, string(marshaledResponse), nil)
 }
 
-func DeleteRuntimeVersionHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) DeleteRuntimeVersionHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	branchName := vars["BRANCH"]
 	runtimeVersion := vars["RUNTIME_VERSION"]
 
-	resolvedBucket := bucket.GetBucket()
+	resolvedBucket := h.bucket
 	updates, err := resolvedBucket.GetUpdates(branchName, runtimeVersion)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -237,11 +262,13 @@ func DeleteRuntimeVersionHandler(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			continue
 		}
+		_ = h.updates.ForgetUpdate(branchName, runtimeVersion, update.UpdateId)
+		webhooks.Dispatch(webhooks.NewEvent(h.app, webhooks.UpdateDeletedEvent, branchName, runtimeVersion, update.UpdateId))
 		deletedCount++
 	}
 
 	// Invalidate related caches
-	cache := cache2.GetCache()
+	cache := h.cache
 	branchesCacheKey := dashboard.ComputeGetBranchesCacheKey()
 	runtimeVersionsCacheKey := dashboard.ComputeGetRuntimeVersionsCacheKey(branchName)
 	updatesCacheKey := dashboard.ComputeGetUpdatesCacheKey(branchName, runtimeVersion)
@@ -258,3 +285,63 @@ func DeleteRuntimeVersionHandler(w http.ResponseWriter, r *http.Request) {
 		"totalCount":   len(updates),
 	})
 }
+
+func (h *Handlers) buildUpdateItemsFromRecords(records []metadataStore.UpdateRecord) []UpdateItem {
+	var updatesResponse []UpdateItem
+	for _, record := range records {
+		if record.Status != metadataStore.CheckedStatus {
+			continue
+		}
+		metadata, err := h.updates.GetMetadata(update2.RecordToUpdate(record))
+		if err != nil {
+			continue
+		}
+		updatesResponse = append(updatesResponse, UpdateItem{
+			UpdateUUID: crypto.ConvertSHA256HashToUUID(metadata.ID),
+			UpdateId:   record.UpdateId,
+			CreatedAt:  record.CreatedAt.UTC().Format(time.RFC3339),
+			CommitHash: record.CommitHash,
+			Platform:   record.Platform,
+		})
+	}
+	return updatesResponse
+}
+
+func (h *Handlers) SearchUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+	store := h.updates.MetadataStore()
+	if store == nil {
+		http.Error(w, "Searching updates requires a metadata store", http.StatusNotImplemented)
+		return
+	}
+	commitHash := r.URL.Query().Get("commitHash")
+	if commitHash == "" {
+		http.Error(w, "No commit hash provided", http.StatusBadRequest)
+		return
+	}
+	records, err := store.GetUpdatesByCommitHash(commitHash)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response := make([]UpdateSearchItem, 0, len(records))
+	for _, record := range records {
+		item := UpdateSearchItem{
+			UpdateItem: UpdateItem{
+				UpdateId:   record.UpdateId,
+				CreatedAt:  record.CreatedAt.UTC().Format(time.RFC3339),
+				CommitHash: record.CommitHash,
+				Platform:   record.Platform,
+			},
+			Branch:         record.Branch,
+			RuntimeVersion: record.RuntimeVersion,
+			Status:         string(record.Status),
+		}
+		if metadata, err := h.updates.GetMetadata(update2.RecordToUpdate(record)); err == nil {
+			item.UpdateUUID = crypto.ConvertSHA256HashToUUID(metadata.ID)
+		}
+		response = append(response, item)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/cdn"
+	"expo-open-ota/internal/keyStore"
+	"expo-open-ota/internal/metadataStore"
+	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/update"
+)
+
+// Handlers serves the routes reading or writing updates with the dependencies it was built with, so that
+// servers with different storages can run in the same process.
+type Handlers struct {
+	app       string
+	bucket    bucket.Bucket
+	cache     cache2.Cache
+	cdn       cdn.CDN
+	keys      keyStore.KeysStorage
+	channels  services.ChannelResolver
+	expo      services.ExpoProject
+	updates   *update.Manager
+	auditSink audit.Sink
+	auth      *auth.Auth
+}
+
+type Dependencies struct {
+	// App is the id of the app in a multi-app deployment, empty for the default app
+	App string
+	// BaseURL is the URL the routes of the app are served under, BASE_URL when empty
+	BaseURL  string
+	Bucket   bucket.Bucket
+	Cache    cache2.Cache
+	CDN      cdn.CDN
+	KeyStore keyStore.KeysStorage
+	Channels services.ChannelResolver
+	Expo     services.ExpoProject
+	// AuditSink records the audited requests, nil when the audit log is disabled
+	AuditSink audit.Sink
+	// Sessions keeps the dashboard sessions of the app, the sessions of the app configured by the
+	// environment when nil
+	Sessions auth.SessionStore
+	// MetadataStore indexes the updates of the default app, the store configured by the environment when nil.
+	// It is not used by the other apps.
+	MetadataStore metadataStore.MetadataStore
+}
+
+// New builds the handlers, the CDN may be nil to serve the assets directly.
+func New(deps Dependencies) *Handlers {
+	store := deps.MetadataStore
+	if store == nil {
+		store = metadataStore.GetMetadataStore()
+	}
+	updates := update.NewManager(deps.Bucket, deps.Cache, store)
+	if deps.App != "" {
+		updates = update.NewAppManager(deps.Bucket, deps.Cache, deps.BaseURL)
+	}
+	sessions := deps.Sessions
+	if sessions == nil {
+		sessions = auth.GetAppSessionStore(deps.App)
+	}
+	return &Handlers{
+		app:       deps.App,
+		bucket:    deps.Bucket,
+		cache:     deps.Cache,
+		cdn:       deps.CDN,
+		keys:      deps.KeyStore,
+		channels:  deps.Channels,
+		expo:      deps.Expo,
+		updates:   updates,
+		auditSink: deps.AuditSink,
+		auth:      auth.NewAppAuth(deps.App, sessions),
+	}
+}
+
+func (h *Handlers) Updates() *update.Manager {
+	return h.updates
+}
+
+func (h *Handlers) AuditSink() audit.Sink {
+	return h.auditSink
+}
+
+// Auth signs in the dashboard users of the app.
+func (h *Handlers) Auth() *auth.Auth {
+	return h.auth
+}
+
+// expoProject is the project of the app, the default app follows EXPO_APP_ID and EXPO_ACCESS_TOKEN.
+func (h *Handlers) expoProject() services.ExpoProject {
+	if h.expo.AppId == "" {
+		return services.DefaultExpoProject()
+	}
+	return h.expo
+}
@@ -4,9 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"expo-open-ota/internal/crypto"
-	"expo-open-ota/internal/keyStore"
 	"expo-open-ota/internal/metrics"
-	"expo-open-ota/internal/services"
 	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/update"
 	"fmt"
@@ -34,11 +32,11 @@ func createMultipartResponse(headers map[string][]string, jsonContent interface{
 	return writer, &buf, nil
 }
 
-func signDirectiveOrManifest(content interface{}, expectSignatureHeader string) (string, error) {
+func (h *Handlers) signDirectiveOrManifest(content interface{}, expectSignatureHeader string) (string, error) {
 	if expectSignatureHeader == "" {
 		return "", nil
 	}
-	privateKey := keyStore.GetPrivateExpoKey()
+	privateKey := h.keys.GetPrivateExpoKey()
 	contentJSON, err := json.Marshal(content)
 	if err != nil {
 		return "", fmt.Errorf("error stringifying content: %w", err)
@@ -65,8 +63,8 @@ func writeResponse(w http.ResponseWriter, writer *multipart.Writer, buf *bytes.B
 	}
 }
 
-func putResponse(w http.ResponseWriter, r *http.Request, content interface{}, fieldName string, runtimeVersion string, protocolVersion int64, requestID string) {
-	signedHash, err := signDirectiveOrManifest(content, r.Header.Get("expo-expect-signature"))
+func (h *Handlers) putResponse(w http.ResponseWriter, r *http.Request, content interface{}, fieldName string, runtimeVersion string, protocolVersion int64, requestID string) {
+	signedHash, err := h.signDirectiveOrManifest(content, r.Header.Get("expo-expect-signature"))
 	if err != nil {
 		log.Printf("[RequestID: %s] Error signing content: %v", requestID, err)
 		http.Error(w, "Error signing content", http.StatusInternalServerError)
@@ -89,33 +87,33 @@ func putResponse(w http.ResponseWriter, r *http.Request, content interface{}, fi
 	writeResponse(w, writer, buf, protocolVersion, runtimeVersion, requestID)
 }
 
-func putUpdateInResponse(w http.ResponseWriter, r *http.Request, lastUpdate types.Update, platform string, protocolVersion int64, requestID string) {
+func (h *Handlers) putUpdateInResponse(w http.ResponseWriter, r *http.Request, lastUpdate types.Update, platform string, protocolVersion int64, requestID string) {
 	currentUpdateId := r.Header.Get("expo-current-update-id")
-	metadata, err := update.GetMetadata(lastUpdate)
+	metadata, err := h.updates.GetMetadata(lastUpdate)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error getting metadata: %v", requestID, err)
         clientId := r.Header.Get("EAS-Client-ID")
-        metrics.TrackUpdateErrorUser(clientId, platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, lastUpdate.UpdateId)
+        metrics.TrackUpdateErrorUser(h.app, clientId, platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, lastUpdate.UpdateId)
 		http.Error(w, "Error getting metadata", http.StatusInternalServerError)
 		return
 	}
 	if currentUpdateId != "" && currentUpdateId == crypto.ConvertSHA256HashToUUID(metadata.ID) && protocolVersion == 1 {
-		putNoUpdateAvailableInResponse(w, r, lastUpdate.RuntimeVersion, protocolVersion, requestID)
+		h.putNoUpdateAvailableInResponse(w, r, lastUpdate.RuntimeVersion, protocolVersion, requestID)
 		return
 	}
-	manifest, err := update.ComposeUpdateManifest(&metadata, lastUpdate, platform)
+	manifest, err := h.updates.ComposeUpdateManifest(&metadata, lastUpdate, platform)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error composing manifest: %v", requestID, err)
         clientId := r.Header.Get("EAS-Client-ID")
-        metrics.TrackUpdateErrorUser(clientId, platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, lastUpdate.UpdateId)
+        metrics.TrackUpdateErrorUser(h.app, clientId, platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, lastUpdate.UpdateId)
 		http.Error(w, "Error composing manifest", http.StatusInternalServerError)
 		return
 	}
-	metrics.TrackUpdateDownload(platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, metadata.ID, "update")
-	putResponse(w, r, manifest, "manifest", lastUpdate.RuntimeVersion, protocolVersion, requestID)
+	metrics.TrackUpdateDownload(h.app, platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, metadata.ID, "update")
+	h.putResponse(w, r, manifest, "manifest", lastUpdate.RuntimeVersion, protocolVersion, requestID)
 }
 
-func putRollbackInResponse(w http.ResponseWriter, r *http.Request, lastUpdate types.Update, platform string, protocolVersion int64, requestID string) {
+func (h *Handlers) putRollbackInResponse(w http.ResponseWriter, r *http.Request, lastUpdate types.Update, platform string, protocolVersion int64, requestID string) {
 	if protocolVersion == 0 {
 		http.Error(w, "Rollback not supported in protocol version 0", http.StatusBadRequest)
 		return
@@ -127,31 +125,31 @@ func putRollbackInResponse(w http.ResponseWriter, r *http.Request, lastUpdate ty
 	}
 	currentUpdateId := r.Header.Get("expo-current-update-id")
 	if currentUpdateId != "" && currentUpdateId == embeddedUpdateId {
-		putNoUpdateAvailableInResponse(w, r, lastUpdate.RuntimeVersion, protocolVersion, requestID)
+		h.putNoUpdateAvailableInResponse(w, r, lastUpdate.RuntimeVersion, protocolVersion, requestID)
 		return
 	}
-	directive, err := update.CreateRollbackDirective(lastUpdate)
+	directive, err := h.updates.CreateRollbackDirective(lastUpdate)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error creating rollback directive: %v", requestID, err)
         clientId := r.Header.Get("EAS-Client-ID")
-        metrics.TrackUpdateErrorUser(clientId, platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, lastUpdate.UpdateId)
+        metrics.TrackUpdateErrorUser(h.app, clientId, platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, lastUpdate.UpdateId)
 		http.Error(w, "Error creating rollback directive", http.StatusInternalServerError)
 		return
 	}
-	metrics.TrackUpdateDownload(platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, lastUpdate.UpdateId, "rollback")
-	putResponse(w, r, directive, "directive", lastUpdate.RuntimeVersion, protocolVersion, requestID)
+	metrics.TrackUpdateDownload(h.app, platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, lastUpdate.UpdateId, "rollback")
+	h.putResponse(w, r, directive, "directive", lastUpdate.RuntimeVersion, protocolVersion, requestID)
 }
 
-func putNoUpdateAvailableInResponse(w http.ResponseWriter, r *http.Request, runtimeVersion string, protocolVersion int64, requestID string) {
+func (h *Handlers) putNoUpdateAvailableInResponse(w http.ResponseWriter, r *http.Request, runtimeVersion string, protocolVersion int64, requestID string) {
 	if protocolVersion == 0 {
 		http.Error(w, "NoUpdateAvailable directive not available in protocol version 0", http.StatusNoContent)
 		return
 	}
 	directive := update.CreateNoUpdateAvailableDirective()
-	putResponse(w, r, directive, "directive", runtimeVersion, protocolVersion, requestID)
+	h.putResponse(w, r, directive, "directive", runtimeVersion, protocolVersion, requestID)
 }
 
-func ManifestHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) ManifestHandler(w http.ResponseWriter, r *http.Request) {
 	requestID := uuid.New().String()
 
 	channelName := r.Header.Get("expo-channel-name")
@@ -160,14 +158,14 @@ func ManifestHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No channel name provided", http.StatusBadRequest)
 		return
 	}
-	branchMap, err := services.FetchExpoChannelMapping(channelName)
+	branchMap, err := h.channels.ResolveChannel(channelName)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error fetching channel mapping: %v", requestID, err)
 		clientId := r.Header.Get("EAS-Client-ID")
 		platform := r.Header.Get("expo-platform")
 		runtimeVersion := r.Header.Get("expo-runtime-version")
 		currentUpdateId := r.Header.Get("expo-current-update-id")
-		metrics.TrackUpdateErrorUser(clientId, platform, runtimeVersion, "", currentUpdateId)
+		metrics.TrackUpdateErrorUser(h.app, clientId, platform, runtimeVersion, "", currentUpdateId)
 		http.Error(w, "Error fetching channel mapping", http.StatusInternalServerError)
 		return
 	}
@@ -177,7 +175,7 @@ func ManifestHandler(w http.ResponseWriter, r *http.Request) {
 		platform := r.Header.Get("expo-platform")
 		runtimeVersion := r.Header.Get("expo-runtime-version")
 		currentUpdateId := r.Header.Get("expo-current-update-id")
-		metrics.TrackUpdateErrorUser(clientId, platform, runtimeVersion, "", currentUpdateId)
+		metrics.TrackUpdateErrorUser(h.app, clientId, platform, runtimeVersion, "", currentUpdateId)
 		http.Error(w, "No branch mapping found", http.StatusNotFound)
 		return
 	}
@@ -189,7 +187,7 @@ func ManifestHandler(w http.ResponseWriter, r *http.Request) {
 		platform := r.Header.Get("expo-platform")
 		runtimeVersion := r.Header.Get("expo-runtime-version")
 		currentUpdateId := r.Header.Get("expo-current-update-id")
-		metrics.TrackUpdateErrorUser(clientId, platform, runtimeVersion, branch, currentUpdateId)
+		metrics.TrackUpdateErrorUser(h.app, clientId, platform, runtimeVersion, branch, currentUpdateId)
 		http.Error(w, "Invalid protocol version", http.StatusBadRequest)
 		return
 	}
@@ -202,7 +200,7 @@ func ManifestHandler(w http.ResponseWriter, r *http.Request) {
 		clientId := r.Header.Get("EAS-Client-ID")
 		runtimeVersion := r.Header.Get("expo-runtime-version")
 		currentUpdateId := r.Header.Get("expo-current-update-id")
-		metrics.TrackUpdateErrorUser(clientId, platform, runtimeVersion, branch, currentUpdateId)
+		metrics.TrackUpdateErrorUser(h.app, clientId, platform, runtimeVersion, branch, currentUpdateId)
 		http.Error(w, "Invalid platform", http.StatusBadRequest)
 		return
 	}
@@ -212,30 +210,30 @@ func ManifestHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	clientId := r.Header.Get("EAS-Client-ID")
 	currentUpdateId := r.Header.Get("expo-current-update-id")
-	metrics.TrackActiveUser(clientId, platform, runtimeVersion, branch, currentUpdateId)
+	metrics.TrackActiveUser(h.app, clientId, platform, runtimeVersion, branch, currentUpdateId)
 	if runtimeVersion == "" {
 		log.Printf("[RequestID: %s] No runtime version provided", requestID)
-		metrics.TrackUpdateErrorUser(clientId, platform, runtimeVersion, branch, currentUpdateId)
+		metrics.TrackUpdateErrorUser(h.app, clientId, platform, runtimeVersion, branch, currentUpdateId)
 		http.Error(w, "No runtime version provided", http.StatusBadRequest)
 		return
 	}
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(branch, runtimeVersion)
+	lastUpdate, err := h.updates.GetLatestUpdateBundlePathForRuntimeVersion(branch, runtimeVersion)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error getting latest update: %v", requestID, err)
-		metrics.TrackUpdateErrorUser(clientId, platform, runtimeVersion, branch, currentUpdateId)
+		metrics.TrackUpdateErrorUser(h.app, clientId, platform, runtimeVersion, branch, currentUpdateId)
 		http.Error(w, "Error getting latest update", http.StatusInternalServerError)
 		return
 	}
 	if lastUpdate == nil {
 		log.Printf("[RequestID: %s] No update found for runtimeVersion: %s in branch: %s", requestID, runtimeVersion, branch)
-		putNoUpdateAvailableInResponse(w, r, runtimeVersion, protocolVersion, requestID)
+		h.putNoUpdateAvailableInResponse(w, r, runtimeVersion, protocolVersion, requestID)
 		return
 	}
 
-	updateType := update.GetUpdateType(*lastUpdate)
+	updateType := h.updates.GetUpdateType(*lastUpdate)
 	if updateType == types.NormalUpdate {
-		putUpdateInResponse(w, r, *lastUpdate, platform, protocolVersion, requestID)
+		h.putUpdateInResponse(w, r, *lastUpdate, platform, protocolVersion, requestID)
 	} else {
-		putRollbackInResponse(w, r, *lastUpdate, platform, protocolVersion, requestID)
+		h.putRollbackInResponse(w, r, *lastUpdate, platform, protocolVersion, requestID)
 	}
 }
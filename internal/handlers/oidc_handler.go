@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/dashboard"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	dashboardLoginPath = "/dashboard/login"
+	// oidcStateCookie ties the OIDC login to the browser that started it
+	oidcStateCookie = "ota_oidc_state"
+)
+
+type AuthMethodsResponse struct {
+	Password bool `json:"password"`
+	OIDC     bool `json:"oidc"`
+}
+
+func redirectToDashboardLogin(w http.ResponseWriter, r *http.Request, params url.Values) {
+	http.Redirect(w, r, dashboardLoginPath+"?"+params.Encode(), http.StatusFound)
+}
+
+// isOIDCEnabled tells whether the users of the app can sign in with OIDC. The identity provider redirects
+// to the callback of the default app, the apps hosted next to it only offer the password logins.
+func (h *Handlers) isOIDCEnabled() bool {
+	return h.app == "" && auth.IsOIDCEnabled()
+}
+
+// setOIDCStateCookie is only sent back to the callback, a negative maxAge deletes it.
+func setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	path := "/auth/oidc/callback"
+	if redirectUrl, err := url.Parse(auth.OIDCRedirectURL()); err == nil && redirectUrl.Path != "" {
+		path = redirectUrl.Path
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(auth.OIDCRedirectURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *Handlers) GetAuthMethodsHandler(w http.ResponseWriter, r *http.Request) {
+	if !dashboard.IsDashboardEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(AuthMethodsResponse{Password: true, OIDC: h.isOIDCEnabled()})
+}
+
+func (h *Handlers) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	if !dashboard.IsDashboardEnabled() || !h.isOIDCEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	authorizationUrl, binding, err := auth.StartOIDCLogin()
+	if err != nil {
+		log.Printf("[RequestID: %s] Error starting OIDC login: %v", requestID, err)
+		http.Error(w, "Error starting OIDC login", http.StatusBadGateway)
+		return
+	}
+	setOIDCStateCookie(w, binding, auth.OIDCStateTTL)
+	http.Redirect(w, r, authorizationUrl, http.StatusFound)
+}
+
+// OIDCCallbackHandler is the redirect URL registered on the identity provider. It sends the
+// browser back to the dashboard login page with a one-time code to exchange for tokens.
+func (h *Handlers) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	if !dashboard.IsDashboardEnabled() || !h.isOIDCEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	event := audit.EventFromContext(r.Context())
+	event.RequestId = requestID
+	var binding string
+	if cookie, err := r.Cookie(oidcStateCookie); err == nil {
+		binding = cookie.Value
+	}
+	setOIDCStateCookie(w, "", -1)
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("[RequestID: %s] OIDC provider returned an error: %s %s", requestID, providerError, query.Get("error_description"))
+		event.Fail(audit.DeniedOutcome, "identity provider error: "+providerError)
+		redirectToDashboardLogin(w, r, url.Values{"error": {"sso"}})
+		return
+	}
+	authService := h.auth
+	authResponse, err := authService.LoginWithOIDC(r.Context(), query.Get("state"), query.Get("code"), binding)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error completing OIDC login: %v", requestID, err)
+		event.Fail(audit.DeniedOutcome, err.Error())
+		redirectToDashboardLogin(w, r, url.Values{"error": {"sso"}})
+		return
+	}
+	if principal, err := authService.ValidateToken(authResponse.Token); err == nil {
+		event.Actor = audit.Actor{Type: audit.UserActor, Id: principal.Subject, Name: principal.Username}
+	}
+	code, err := auth.CreateLoginCode(authResponse)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error creating login code: %v", requestID, err)
+		event.Fail(audit.FailureOutcome, err.Error())
+		redirectToDashboardLogin(w, r, url.Values{"error": {"sso"}})
+		return
+	}
+	redirectToDashboardLogin(w, r, url.Values{"code": {code}})
+}
+
+func (h *Handlers) OIDCTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if !dashboard.IsDashboardEnabled() || !h.isOIDCEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	code := r.FormValue("code")
+	if code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	authResponse, err := auth.ExchangeLoginCode(code)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(authResponse)
+}
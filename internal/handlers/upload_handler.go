@@ -2,29 +2,140 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/apiKeys"
+	"expo-open-ota/internal/audit"
 	"expo-open-ota/internal/branch"
 	"expo-open-ota/internal/bucket"
-	cache2 "expo-open-ota/internal/cache"
 	"expo-open-ota/internal/helpers"
 	"expo-open-ota/internal/services"
 	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/update"
+	"expo-open-ota/internal/uploadSessions"
+	"expo-open-ota/internal/webhooks"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"io"
 	"log"
+	"mime"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"time"
 )
 
 type FileNamesRequest struct {
 	FileNames []string `json:"fileNames"`
+	// Files declares the size and hash of every file, clients only sending fileNames skip the content checks
+	Files []uploadSessions.File `json:"files,omitempty"`
 }
 
-func MarkUpdateAsUploadedHandler(w http.ResponseWriter, r *http.Request) {
+// declaredFiles merges both ways of listing the files, which must agree when both are sent
+func (request FileNamesRequest) declaredFiles() ([]uploadSessions.File, error) {
+	if len(request.Files) == 0 {
+		return uploadSessions.FilesFromNames(request.FileNames), nil
+	}
+	if len(request.FileNames) > 0 {
+		declared := make(map[string]struct{}, len(request.Files))
+		for _, file := range request.Files {
+			declared[file.Path] = struct{}{}
+		}
+		for _, fileName := range request.FileNames {
+			if _, ok := declared[fileName]; !ok {
+				return nil, fmt.Errorf("file %q is listed in fileNames but not in files", fileName)
+			}
+		}
+		if len(declared) != len(uploadSessions.FilesFromNames(request.FileNames)) {
+			return nil, fmt.Errorf("fileNames and files do not list the same files")
+		}
+	}
+	return request.Files, nil
+}
+
+// A publisher is the principal of a publishing request. Its subject, the Expo username or the id of the
+// API key, names it in the upload tokens so that they are only accepted from whoever requested them.
+type publisher struct {
+	// apiKey is nil when the request was authenticated through Expo
+	apiKey  *apiKeys.ApiKey
+	subject string
+}
+
+// authenticatePublisher accepts either a server-issued API key or the token of the Expo account owning
+// the app. Requests authenticated by an API key never reach Expo.
+func (h *Handlers) authenticatePublisher(w http.ResponseWriter, r *http.Request, requestID string, expoErrorStatus int) (*publisher, bool) {
+	event := audit.EventFromContext(r.Context())
+	if bearerToken, _ := helpers.GetBearerToken(r); apiKeys.IsApiKey(bearerToken) {
+		event.Actor = audit.Actor{Type: audit.ApiKeyActor}
+		apiKey, err := apiKeys.Authenticate(h.app, bearerToken)
+		if err != nil {
+			log.Printf("[RequestID: %s] Invalid api key: %v", requestID, err)
+			http.Error(w, "Invalid api key", http.StatusUnauthorized)
+			return nil, false
+		}
+		event.Actor = audit.Actor{Type: audit.ApiKeyActor, Id: apiKey.Id, Name: apiKey.Name}
+		return &publisher{apiKey: apiKey, subject: "apiKey:" + apiKey.Id}, true
+	}
+	expoAuth := helpers.GetExpoAuth(r)
+	expoAccount, err := services.FetchExpoUserAccountInformations(expoAuth)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error fetching expo account informations: %v", requestID, err)
+		http.Error(w, "Error fetching expo account informations", expoErrorStatus)
+		return nil, false
+	}
+	if expoAccount == nil {
+		log.Printf("[RequestID: %s] No expo account found", requestID)
+		http.Error(w, "No expo account found", http.StatusUnauthorized)
+		return nil, false
+	}
+	event.Actor = audit.Actor{Type: audit.ExpoActor, Id: expoAccount.Id, Name: expoAccount.Username}
+	currentExpoUsername := h.expoProject().FetchSelfUsername()
+	if expoAccount.Username != currentExpoUsername {
+		log.Printf("[RequestID: %s] Invalid expo account", requestID)
+		http.Error(w, "Invalid expo account", http.StatusUnauthorized)
+		return nil, false
+	}
+	return &publisher{subject: expoAccount.Username}, true
+}
+
+// upsertBranch creates the branch on Expo when it does not exist yet. API keys exist to publish without
+// Expo, the branch is only created on a best-effort basis for them.
+func (h *Handlers) upsertBranch(requestID string, publisher *publisher, branchName string) error {
+	err := branch.UpsertProjectBranch(h.expoProject(), branchName)
+	if err != nil && publisher.apiKey != nil {
+		log.Printf("[RequestID: %s] Error upserting branch %s on Expo, publishing anyway: %v", requestID, branchName, err)
+		return nil
+	}
+	return err
+}
+
+// authorizeApiKey checks the scopes of the API key, requests authenticated through Expo are always allowed.
+func authorizeApiKey(w http.ResponseWriter, requestID string, apiKey *apiKeys.ApiKey, action apiKeys.Action, branchName string) bool {
+	if apiKey == nil || apiKey.Allows(action, branchName) {
+		return true
+	}
+	log.Printf("[RequestID: %s] Api key %s is not allowed to %s on branch %s", requestID, apiKey.Id, action, branchName)
+	http.Error(w, fmt.Sprintf("Api key is not allowed to %s on branch %s", action, branchName), http.StatusForbidden)
+	return false
+}
+
+func requiredUploadAction(files []uploadSessions.File) apiKeys.Action {
+	for _, file := range files {
+		if file.Path == "rollback" {
+			return apiKeys.RollbackAction
+		}
+	}
+	return apiKeys.PublishAction
+}
+
+func (h *Handlers) MarkUpdateAsUploadedHandler(w http.ResponseWriter, r *http.Request) {
 	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
 	vars := mux.Vars(r)
 	branchName := vars["BRANCH"]
 	platform := r.URL.Query().Get("platform")
@@ -38,28 +149,13 @@ func MarkUpdateAsUploadedHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No branch provided", http.StatusBadRequest)
 		return
 	}
-	err := branch.UpsertBranch(branchName)
-	if err != nil {
-		log.Printf("[RequestID: %s] Error upserting branch: %v", requestID, err)
-		http.Error(w, "Error upserting branch", http.StatusInternalServerError)
-		return
-	}
-	expoAuth := helpers.GetExpoAuth(r)
-	expoAccount, err := services.FetchExpoUserAccountInformations(expoAuth)
-	if err != nil {
-		log.Printf("[RequestID: %s] Error fetching expo account informations: %v", requestID, err)
-		http.Error(w, "Error fetching expo account informations", http.StatusUnauthorized)
-		return
-	}
-	if expoAccount == nil {
-		log.Printf("[RequestID: %s] No expo account found", requestID)
-		http.Error(w, "No expo account found", http.StatusUnauthorized)
+	if err := bucket.ValidateBranch(branchName); err != nil {
+		log.Printf("[RequestID: %s] Invalid branch: %v", requestID, err)
+		http.Error(w, "Invalid branch", http.StatusBadRequest)
 		return
 	}
-	currentExpoUsername := services.FetchSelfExpoUsername()
-	if expoAccount.Username != currentExpoUsername {
-		log.Printf("[RequestID: %s] Invalid expo account", requestID)
-		http.Error(w, "Invalid expo account", http.StatusUnauthorized)
+	publisher, ok := h.authenticatePublisher(w, r, requestID, http.StatusUnauthorized)
+	if !ok {
 		return
 	}
 	runtimeVersion := r.URL.Query().Get("runtimeVersion")
@@ -74,14 +170,36 @@ func MarkUpdateAsUploadedHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No update id provided", http.StatusBadRequest)
 		return
 	}
+	if err := bucket.ValidateUpdatePath(branchName, runtimeVersion, updateId); err != nil {
+		log.Printf("[RequestID: %s] Invalid update: %v", requestID, err)
+		http.Error(w, "Invalid runtime version or update id", http.StatusBadRequest)
+		return
+	}
 	currentUpdate, err := update.GetUpdate(branchName, runtimeVersion, updateId)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error getting update: %v", requestID, err)
 		http.Error(w, "Error getting update", http.StatusInternalServerError)
 		return
 	}
-	resolvedBucket := bucket.GetBucket()
-	errorVerify := update.VerifyUploadedUpdate(*currentUpdate)
+	action := apiKeys.PublishAction
+	eventType := webhooks.UpdatePublishedEvent
+	if h.updates.GetUpdateType(*currentUpdate) == types.Rollback {
+		action = apiKeys.RollbackAction
+		eventType = webhooks.UpdateRolledBackEvent
+	}
+	if !authorizeApiKey(w, requestID, publisher.apiKey, action, branchName) {
+		return
+	}
+	if err := h.upsertBranch(requestID, publisher, branchName); err != nil {
+		log.Printf("[RequestID: %s] Error upserting branch: %v", requestID, err)
+		http.Error(w, "Error upserting branch", http.StatusInternalServerError)
+		return
+	}
+	resolvedBucket := h.bucket
+	errorVerify := h.verifyUploadSession(*currentUpdate, platform)
+	if errorVerify == nil {
+		errorVerify = h.updates.VerifyUploadedUpdate(*currentUpdate)
+	}
 	if errorVerify != nil {
 		// Delete folder and throw error
 		log.Printf("[RequestID: %s] Invalid update, deleting folder...", requestID)
@@ -91,31 +209,39 @@ func MarkUpdateAsUploadedHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Error deleting update folder", http.StatusInternalServerError)
 			return
 		}
+		if err := h.updates.ForgetUpdate(branchName, runtimeVersion, updateId); err != nil {
+			log.Printf("[RequestID: %s] Error removing update from metadata store: %v", requestID, err)
+		}
+		if err := uploadSessions.Delete(h.bucket, branchName, runtimeVersion, updateId); err != nil {
+			log.Printf("[RequestID: %s] Error deleting upload session: %v", requestID, err)
+		}
 		log.Printf("[RequestID: %s] Invalid update, folder deleted", requestID)
+		h.dispatchUpdateEvent(webhooks.UpdateVerificationFailedEvent, *currentUpdate, platform, errorVerify.Error())
 		http.Error(w, fmt.Sprintf("Invalid update %s", errorVerify), http.StatusBadRequest)
 		return
 	}
 	// Now we have to retrieve the latest update and compare hash changes
-	latestUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(branchName, runtimeVersion)
+	latestUpdate, err := h.updates.GetLatestUpdateBundlePathForRuntimeVersion(branchName, runtimeVersion)
 	if err != nil || latestUpdate == nil {
-		err = update.MarkUpdateAsChecked(*currentUpdate)
+		err = h.updates.MarkUpdateAsChecked(*currentUpdate)
 		if err != nil {
 			log.Printf("[RequestID: %s] Error marking update as checked: %v", requestID, err)
 			http.Error(w, "Error marking update as checked", http.StatusInternalServerError)
 			return
 		}
 		log.Printf("[RequestID: %s] No latest update found, update marked as checked", requestID)
+		h.dispatchUpdateEvent(eventType, *currentUpdate, platform, "")
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	areUpdatesIdentical, err := update.AreUpdatesIdentical(*currentUpdate, *latestUpdate, platform)
+	areUpdatesIdentical, err := h.updates.AreUpdatesIdentical(*currentUpdate, *latestUpdate, platform)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error comparing updates: %v", requestID, err)
 		http.Error(w, "Error comparing updates", http.StatusInternalServerError)
 		return
 	}
 	// Always mark update as checked and deploy, even if identical to previous update
-	err = update.MarkUpdateAsChecked(*currentUpdate)
+	err = h.updates.MarkUpdateAsChecked(*currentUpdate)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error marking update as checked: %v", requestID, err)
 		http.Error(w, "Error marking update as checked", http.StatusInternalServerError)
@@ -126,45 +252,128 @@ func MarkUpdateAsUploadedHandler(w http.ResponseWriter, r *http.Request) {
 	} else {
 		log.Printf("[RequestID: %s] Updates are not identical, update marked as checked", requestID)
 	}
+	h.dispatchUpdateEvent(eventType, *currentUpdate, platform, "")
 	w.WriteHeader(http.StatusOK)
 }
 
-func RequestUploadLocalFileHandler(w http.ResponseWriter, r *http.Request) {
-	bucketType := bucket.ResolveBucketType()
-	if bucketType != bucket.LocalBucketType {
-		log.Printf("Invalid bucket type: %s", bucketType)
-		http.Error(w, "Invalid bucket type", http.StatusInternalServerError)
-		return
+// verifyUploadSession checks the uploaded files against the session opened when the upload URLs were
+// requested. Updates already marked as uploaded were checked back then, their session may be gone.
+func (h *Handlers) verifyUploadSession(currentUpdate types.Update, platform string) error {
+	if h.updates.IsUpdateValid(currentUpdate) {
+		return nil
 	}
-	requestID := uuid.New().String()
-	expoAuth := helpers.GetExpoAuth(r)
-	expoAccount, err := services.FetchExpoUserAccountInformations(expoAuth)
+	session, err := uploadSessions.Get(h.bucket, currentUpdate.Branch, currentUpdate.RuntimeVersion, currentUpdate.UpdateId)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error fetching expo account informations: %v", requestID, err)
-		http.Error(w, "Error fetching expo account informations", http.StatusInternalServerError)
-		return
+		return err
 	}
-	if expoAccount == nil {
-		log.Printf("[RequestID: %s] No expo account found", requestID)
-		http.Error(w, "No expo account found", http.StatusUnauthorized)
-		return
+	if session.Platform != "" && session.Platform != platform {
+		return fmt.Errorf("upload session was opened for platform %s", session.Platform)
 	}
-	currentExpoUsername := services.FetchSelfExpoUsername()
-	if expoAccount.Username != currentExpoUsername {
-		log.Printf("[RequestID: %s] Invalid expo account", requestID)
-		http.Error(w, "Invalid expo account", http.StatusUnauthorized)
-		return
+	return session.Verify(h.bucket)
+}
+
+func (h *Handlers) dispatchUpdateEvent(eventType webhooks.EventType, currentUpdate types.Update, platform string, reason string) {
+	event := webhooks.NewEvent(h.app, eventType, currentUpdate.Branch, currentUpdate.RuntimeVersion, currentUpdate.UpdateId)
+	event.Platform = platform
+	event.Reason = reason
+	webhooks.Dispatch(event)
+}
+
+// authorizeLocalUpload resolves the file targeted by the upload token of a local storage upload.
+func (h *Handlers) authorizeLocalUpload(w http.ResponseWriter, r *http.Request, requestID string) (string, bool) {
+	switch bucket.Primary(h.bucket).(type) {
+	case *bucket.LocalBucket, *bucket.MemoryBucket:
+	default:
+		log.Printf("Invalid bucket type: %T", h.bucket)
+		http.Error(w, "Invalid bucket type", http.StatusInternalServerError)
+		return "", false
+	}
+	publisher, ok := h.authenticatePublisher(w, r, requestID, http.StatusInternalServerError)
+	if !ok {
+		return "", false
+	}
+	// The upload token already scopes the request to a single file of an update requested by an allowed key
+	if apiKey := publisher.apiKey; apiKey != nil && !apiKey.HasAction(apiKeys.PublishAction) && !apiKey.HasAction(apiKeys.RollbackAction) {
+		log.Printf("[RequestID: %s] Api key %s is not allowed to upload files", requestID, apiKey.Id)
+		http.Error(w, "Api key is not allowed to upload files", http.StatusForbidden)
+		return "", false
 	}
 	token := r.URL.Query().Get("token")
 	if token == "" {
 		log.Printf("[RequestID: %s] No token provided", requestID)
 		http.Error(w, "No token provided", http.StatusBadRequest)
-		return
+		return "", false
 	}
-	filePath, err := bucket.ValidateUploadTokenAndResolveFilePath(token)
+	filePath, err := bucket.ValidateUploadTokenAndResolveFilePath(h.bucket, token, publisher.subject)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error validating upload token: %v", requestID, err)
 		http.Error(w, "Error validating upload token", http.StatusBadRequest)
+		return "", false
+	}
+	return filePath, true
+}
+
+func parseUploadChecksums(header http.Header) (bucket.UploadChecksums, error) {
+	var checksums bucket.UploadChecksums
+	if contentMD5 := header.Get("Content-MD5"); contentMD5 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(decoded) != md5.Size {
+			return checksums, fmt.Errorf("invalid Content-MD5 header")
+		}
+		checksums.MD5 = decoded
+	}
+	if contentSha256 := header.Get("X-Content-Sha256"); contentSha256 != "" {
+		decoded, err := hex.DecodeString(contentSha256)
+		if err != nil || len(decoded) != sha256.Size {
+			return checksums, fmt.Errorf("invalid X-Content-Sha256 header")
+		}
+		checksums.Sha256 = decoded
+	}
+	return checksums, nil
+}
+
+// localUploadBody returns the file being uploaded, streamed from a raw body or from the part named after
+// the file for the clients still sending multipart forms.
+func localUploadBody(r *http.Request, fileName string) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, fmt.Errorf("no %s part in the form: %w", fileName, err)
+		}
+		if part.FormName() == fileName {
+			return part, nil
+		}
+	}
+}
+
+func localUploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, bucket.ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, bucket.ErrUploadOffsetMismatch):
+		return http.StatusConflict
+	case errors.Is(err, bucket.ErrChecksumMismatch), errors.Is(err, bucket.ErrInvalidContentRange):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RequestUploadLocalFileHandler streams the body of a PUT to the file of the upload token. A Content-Range
+// header makes it a chunk of a resumable upload, acknowledged with 202 until the last one.
+func (h *Handlers) RequestUploadLocalFileHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	filePath, ok := h.authorizeLocalUpload(w, r, requestID)
+	if !ok {
 		return
 	}
 	if r.Body == nil {
@@ -175,30 +384,96 @@ func RequestUploadLocalFileHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	fileName := filepath.Base(filePath)
+	audit.EventFromContext(r.Context()).Target.Resource = fileName
 
-	file, _, err := r.FormFile(fileName)
+	if r.ContentLength > bucket.MaxLocalUploadSize() {
+		log.Printf("[RequestID: %s] Upload of %d bytes exceeds the maximum size", requestID, r.ContentLength)
+		http.Error(w, "Upload exceeds the maximum size", http.StatusRequestEntityTooLarge)
+		return
+	}
+	checksums, err := parseUploadChecksums(r.Header)
+	if err != nil {
+		log.Printf("[RequestID: %s] %v", requestID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := localUploadBody(r, fileName)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error retrieving file from form: %v", requestID, err)
 		http.Error(w, "Error retrieving file from form", http.StatusBadRequest)
 		return
 	}
 
-	success, err := bucket.HandleUploadFile(filePath, file)
-	if err != nil {
+	localBucket, ok := bucket.Primary(h.bucket).(*bucket.LocalBucket)
+	if !ok {
+		if r.Header.Get("Content-Range") != "" {
+			log.Printf("[RequestID: %s] Chunked uploads are not supported by the memory storage", requestID)
+			http.Error(w, "Chunked uploads are not supported by the memory storage", http.StatusBadRequest)
+			return
+		}
+		if err := bucket.HandleObjectUpload(bucket.Primary(h.bucket).(bucket.ObjectStorage), filePath, body, checksums); err != nil {
+			log.Printf("[RequestID: %s] Error handling upload file: %v", requestID, err)
+			http.Error(w, "Error handling upload file", localUploadErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if header := r.Header.Get("Content-Range"); header != "" {
+		contentRange, err := bucket.ParseContentRange(header)
+		if err != nil {
+			log.Printf("[RequestID: %s] %v", requestID, err)
+			http.Error(w, "Invalid Content-Range header", http.StatusBadRequest)
+			return
+		}
+		offset, complete, err := localBucket.HandleUploadChunk(filePath, body, contentRange, checksums)
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		if err != nil {
+			log.Printf("[RequestID: %s] Error handling upload chunk: %v", requestID, err)
+			http.Error(w, "Error handling upload chunk", localUploadErrorStatus(err))
+			return
+		}
+		if !complete {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := bucket.HandleUploadFile(filePath, body, checksums); err != nil {
 		log.Printf("[RequestID: %s] Error handling upload file: %v", requestID, err)
-		http.Error(w, "Error handling upload file", http.StatusInternalServerError)
+		http.Error(w, "Error handling upload file", localUploadErrorStatus(err))
 		return
 	}
-	if !success {
-		log.Printf("[RequestID: %s] Error handling upload file", requestID)
-		http.Error(w, "Error handling upload file", http.StatusInternalServerError)
+	w.WriteHeader(http.StatusOK)
+}
+
+// LocalUploadOffsetHandler tells a client resuming a chunked upload how many bytes were already received.
+func (h *Handlers) LocalUploadOffsetHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	filePath, ok := h.authorizeLocalUpload(w, r, requestID)
+	if !ok {
 		return
 	}
+	var offset int64
+	var err error
+	if localBucket, ok := bucket.Primary(h.bucket).(*bucket.LocalBucket); ok {
+		offset, err = localBucket.PartialUploadOffset(filePath)
+	}
+	if err != nil {
+		log.Printf("[RequestID: %s] Error reading upload offset: %v", requestID, err)
+		http.Error(w, "Error reading upload offset", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
 	w.WriteHeader(http.StatusOK)
 }
 
-func RequestUploadUrlHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) RequestUploadUrlHandler(w http.ResponseWriter, r *http.Request) {
 	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
 	vars := mux.Vars(r)
 	branchName := vars["BRANCH"]
 	if branchName == "" {
@@ -206,34 +481,17 @@ func RequestUploadUrlHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No branch provided", http.StatusBadRequest)
 		return
 	}
-
-	expoAuth := helpers.GetExpoAuth(r)
-	expoAccount, err := services.FetchExpoUserAccountInformations(expoAuth)
-	if err != nil {
-		log.Printf("[RequestID: %s] Error fetching expo account informations: %v", requestID, err)
-		http.Error(w, "Error fetching expo account informations", http.StatusUnauthorized)
+	if err := bucket.ValidateBranch(branchName); err != nil {
+		log.Printf("[RequestID: %s] Invalid branch: %v", requestID, err)
+		http.Error(w, "Invalid branch", http.StatusBadRequest)
 		return
 	}
 
-	err = branch.UpsertBranch(branchName)
-	if err != nil {
-		log.Printf("[RequestID: %s] Error upserting branch: %v", requestID, err)
-		http.Error(w, "Error upserting branch", http.StatusInternalServerError)
+	publisher, ok := h.authenticatePublisher(w, r, requestID, http.StatusUnauthorized)
+	if !ok {
 		return
 	}
 
-	if expoAccount == nil {
-		log.Printf("[RequestID: %s] No expo account found", requestID)
-		http.Error(w, "No expo account found", http.StatusUnauthorized)
-		return
-	}
-
-	currentExpoUsername := services.FetchSelfExpoUsername()
-	if expoAccount.Username != currentExpoUsername {
-		log.Printf("[RequestID: %s] Invalid expo account", requestID)
-		http.Error(w, "Invalid expo account", http.StatusUnauthorized)
-		return
-	}
 	platform := r.URL.Query().Get("platform")
 	if platform != "" && (platform != "ios" && platform != "android") {
 		log.Printf("[RequestID: %s] Invalid platform: %s", requestID, platform)
@@ -246,22 +504,55 @@ func RequestUploadUrlHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No runtime version provided", http.StatusBadRequest)
 		return
 	}
+	if err := bucket.ValidateRuntimeVersion(runtimeVersion); err != nil {
+		log.Printf("[RequestID: %s] Invalid runtime version: %v", requestID, err)
+		http.Error(w, "Invalid runtime version", http.StatusBadRequest)
+		return
+	}
 
 	var request FileNamesRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		log.Printf("[RequestID: %s] Error decoding JSON body: %v", requestID, err)
+		if errors.As(err, new(*http.MaxBytesError)) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
 		return
 	}
 
-	if len(request.FileNames) == 0 {
+	if len(request.FileNames) == 0 && len(request.Files) == 0 {
 		log.Printf("[RequestID: %s] No file names provided", requestID)
 		http.Error(w, "No file names provided", http.StatusBadRequest)
 		return
 	}
+	files, err := request.declaredFiles()
+	if err == nil {
+		err = uploadSessions.ValidateFiles(files)
+	}
+	if err != nil {
+		log.Printf("[RequestID: %s] Invalid files: %v", requestID, err)
+		http.Error(w, fmt.Sprintf("Invalid files: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !authorizeApiKey(w, requestID, publisher.apiKey, requiredUploadAction(files), branchName) {
+		return
+	}
+	if err := h.upsertBranch(requestID, publisher, branchName); err != nil {
+		log.Printf("[RequestID: %s] Error upserting branch: %v", requestID, err)
+		http.Error(w, "Error upserting branch", http.StatusInternalServerError)
+		return
+	}
 
 	updateId := time.Now().UnixNano() / int64(time.Millisecond)
-	updateRequests, err := bucket.RequestUploadUrlsForFileUpdates(branchName, runtimeVersion, fmt.Sprintf("%d", updateId), request.FileNames)
+	audit.EventFromContext(r.Context()).Target.UpdateId = fmt.Sprintf("%d", updateId)
+	uploadSession, err := uploadSessions.Create(h.bucket, branchName, runtimeVersion, fmt.Sprintf("%d", updateId), platform, files)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error creating upload session: %v", requestID, err)
+		http.Error(w, "Error creating upload session", http.StatusInternalServerError)
+		return
+	}
+	updateRequests, err := bucket.RequestUploadUrlsForFileUpdates(h.bucket, branchName, runtimeVersion, fmt.Sprintf("%d", updateId), uploadSession.Paths(), publisher.subject)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error requesting upload urls: %v", requestID, err)
 		http.Error(w, "Error requesting upload urls", http.StatusInternalServerError)
@@ -278,21 +569,36 @@ func RequestUploadUrlHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	metadataReader := bytes.NewReader(marshalledMetadata)
-	resolvedBucket := bucket.GetBucket()
-	err = resolvedBucket.UploadFileIntoUpdate(types.Update{
+	resolvedBucket := h.bucket
+	newUpdate := types.Update{
 		Branch:         branchName,
 		RuntimeVersion: runtimeVersion,
 		UpdateId:       fmt.Sprintf("%d", updateId),
 		CreatedAt:      time.Duration(updateId) * time.Millisecond,
-	}, "update-metadata.json", metadataReader)
+	}
+	err = resolvedBucket.UploadFileIntoUpdate(newUpdate, "update-metadata.json", metadataReader)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error uploading update metadata: %v", requestID, err)
+		http.Error(w, "Error uploading update metadata", http.StatusInternalServerError)
+		return
+	}
+	if err := h.updates.RecordUpdate(newUpdate, platform, commitHash); err != nil {
+		log.Printf("[RequestID: %s] Error recording update in metadata store: %v", requestID, err)
+		http.Error(w, "Error recording update in metadata store", http.StatusInternalServerError)
+		return
+	}
 
-	cache := cache2.GetCache()
+	cache := h.cache
 	cacheKey := update.ComputeLastUpdateCacheKey(branchName, runtimeVersion)
 	cache.Delete(cacheKey)
 
 	response := map[string]interface{}{
 		"updateId":       updateId,
 		"uploadRequests": updateRequests,
+		"uploadSession": map[string]interface{}{
+			"id":        uploadSession.Id,
+			"expiresAt": uploadSession.ExpiresAt,
+		},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/users"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type CreateUserRequest struct {
+	Username string     `json:"username"`
+	Password string     `json:"password"`
+	Role     users.Role `json:"role"`
+}
+
+type UpdateUserRequest struct {
+	Password string     `json:"password,omitempty"`
+	Role     users.Role `json:"role,omitempty"`
+}
+
+func GetMeHandler(w http.ResponseWriter, r *http.Request) {
+	principal := auth.PrincipalFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(principal)
+}
+
+func (h *Handlers) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := users.ListUsers(h.app)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response := make([]users.User, 0, len(list))
+	for _, user := range list {
+		response = append(response, user.Redacted())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handlers) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	var request CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("[RequestID: %s] Error decoding JSON body: %v", requestID, err)
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	user, err := users.CreateUser(h.app, request.Username, request.Password, request.Role)
+	if errors.Is(err, users.ErrUserAlreadyExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[RequestID: %s] Error creating user: %v", requestID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[RequestID: %s] User %s created with role %s", requestID, user.Username, user.Role)
+	w.Header().Set("Content-Type", "application/json")
+	audit.EventFromContext(r.Context()).Target.Resource = user.Id
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user.Redacted())
+}
+
+// isCurrentUser prevents admins from locking themselves out by demoting or deleting their own account
+func isCurrentUser(r *http.Request, id string) bool {
+	principal := auth.PrincipalFromContext(r.Context())
+	return principal != nil && principal.Subject == auth.UserSubject(id)
+}
+
+func (h *Handlers) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	id := mux.Vars(r)["ID"]
+	var request UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("[RequestID: %s] Error decoding JSON body: %v", requestID, err)
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if request.Role != "" && request.Role != users.AdminRole && isCurrentUser(r, id) {
+		http.Error(w, "You cannot change your own role", http.StatusBadRequest)
+		return
+	}
+	user, err := users.UpdateUser(h.app, id, request.Role, request.Password)
+	if errors.Is(err, users.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[RequestID: %s] Error updating user: %v", requestID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[RequestID: %s] User %s updated", requestID, user.Username)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user.Redacted())
+}
+
+func (h *Handlers) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	id := mux.Vars(r)["ID"]
+	if isCurrentUser(r, id) {
+		http.Error(w, "You cannot delete your own account", http.StatusBadRequest)
+		return
+	}
+	err := users.DeleteUser(h.app, id)
+	if errors.Is(err, users.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[RequestID: %s] Error deleting user: %v", requestID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[RequestID: %s] User %s deleted", requestID, id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/webhooks"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 100
+)
+
+type CreateWebhookRequest struct {
+	Name     string               `json:"name"`
+	Url      string               `json:"url"`
+	Events   []webhooks.EventType `json:"events"`
+	Branches []string             `json:"branches"`
+}
+
+func (h *Handlers) ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := webhooks.ListWebhooks(h.app)
+	if err != nil {
+		log.Printf("Error listing webhooks: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response := make([]webhooks.Webhook, 0, len(list))
+	for _, webhook := range list {
+		response = append(response, webhook.Redacted())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handlers) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	var request CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("[RequestID: %s] Error decoding JSON body: %v", requestID, err)
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	webhook, err := webhooks.CreateWebhook(h.app, request.Name, request.Url, request.Events, request.Branches)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error creating webhook: %v", requestID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[RequestID: %s] Webhook %s (%s) created", requestID, webhook.Id, webhook.Name)
+	audit.EventFromContext(r.Context()).Target.Resource = webhook.Id
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	// The secret is only returned once, to be configured on the receiver
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (h *Handlers) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	id := mux.Vars(r)["ID"]
+	err := webhooks.DeleteWebhook(h.app, id)
+	if errors.Is(err, webhooks.ErrWebhookNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[RequestID: %s] Error deleting webhook: %v", requestID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[RequestID: %s] Webhook %s deleted", requestID, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) PingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	audit.EventFromContext(r.Context()).RequestId = requestID
+	webhook, err := webhooks.GetWebhook(h.app, mux.Vars(r)["ID"])
+	if errors.Is(err, webhooks.ErrWebhookNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[RequestID: %s] Error getting webhook: %v", requestID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	delivery := webhooks.Ping(*webhook)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+func (h *Handlers) GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["ID"]
+	limit := defaultDeliveriesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxDeliveriesLimit)
+	}
+	if _, err := webhooks.GetWebhook(h.app, id); errors.Is(err, webhooks.ErrWebhookNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	deliveries, err := webhooks.GetWebhookStore().ListDeliveries(id, limit)
+	if err != nil {
+		log.Printf("Error listing deliveries of webhook %s: %v", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deliveries)
+}
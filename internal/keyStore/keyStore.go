@@ -19,7 +19,8 @@ type KeysStorage interface {
 	GetPrivateCloudfrontKey() string
 }
 
-func getStorage() (KeysStorage, error) {
+// GetKeysStorage resolves the storage of the signing keys from KEYS_STORAGE_TYPE.
+func GetKeysStorage() (KeysStorage, error) {
 	var storageType KeysStorageType
 	if config.GetEnv("KEYS_STORAGE_TYPE") == "aws-secrets-manager" {
 		storageType = AWSSecretsManager
@@ -66,7 +67,7 @@ func getStorage() (KeysStorage, error) {
 }
 
 func GetPublicExpoKey() string {
-	storage, err := getStorage()
+	storage, err := GetKeysStorage()
 	if err != nil {
 		return ""
 	}
@@ -74,7 +75,7 @@ func GetPublicExpoKey() string {
 }
 
 func GetPrivateExpoKey() string {
-	storage, err := getStorage()
+	storage, err := GetKeysStorage()
 	if err != nil {
 		return ""
 	}
@@ -82,7 +83,7 @@ func GetPrivateExpoKey() string {
 }
 
 func GetPrivateCloudfrontKey() string {
-	storage, err := getStorage()
+	storage, err := GetKeysStorage()
 	if err != nil {
 		return ""
 	}
@@ -0,0 +1,20 @@
+package keyStore
+
+// StaticKeysStorage holds PEM encoded keys given by the program embedding the server.
+type StaticKeysStorage struct {
+	PublicExpoKey        string
+	PrivateExpoKey       string
+	PrivateCloudfrontKey string
+}
+
+func (c *StaticKeysStorage) GetPublicExpoKey() string {
+	return c.PublicExpoKey
+}
+
+func (c *StaticKeysStorage) GetPrivateExpoKey() string {
+	return c.PrivateExpoKey
+}
+
+func (c *StaticKeysStorage) GetPrivateCloudfrontKey() string {
+	return c.PrivateCloudfrontKey
+}
@@ -0,0 +1,126 @@
+package metadataStore
+
+import (
+	"expo-open-ota/config"
+	"expo-open-ota/internal/bucket"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type UpdateStatus string
+
+const (
+	// The update folder has been created but the upload has not been verified yet
+	PendingStatus UpdateStatus = "pending"
+	// The update has been verified and can be served (equivalent of the .check marker file)
+	CheckedStatus UpdateStatus = "checked"
+)
+
+type UpdateRecordType string
+
+const (
+	NormalUpdateRecord   UpdateRecordType = "normal"
+	RollbackUpdateRecord UpdateRecordType = "rollback"
+)
+
+type UpdateRecord struct {
+	Branch            string           `json:"branch"`
+	RuntimeVersion    string           `json:"runtimeVersion"`
+	UpdateId          string           `json:"updateId"`
+	Platform          string           `json:"platform"`
+	CommitHash        string           `json:"commitHash"`
+	Status            UpdateStatus     `json:"status"`
+	Type              UpdateRecordType `json:"type"`
+	RolloutPercentage int              `json:"rolloutPercentage"`
+	CreatedAt         time.Time        `json:"createdAt"`
+}
+
+type MetadataStore interface {
+	UpsertUpdate(record UpdateRecord) error
+	SetUpdateStatus(branch string, runtimeVersion string, updateId string, status UpdateStatus) error
+	DeleteUpdate(branch string, runtimeVersion string, updateId string) error
+	GetBranches() ([]string, error)
+	GetRuntimeVersions(branch string) ([]bucket.RuntimeVersionWithStats, error)
+	GetUpdates(branch string, runtimeVersion string) ([]UpdateRecord, error)
+	GetUpdate(branch string, runtimeVersion string, updateId string) (*UpdateRecord, error)
+	GetLatestCheckedUpdate(branch string, runtimeVersion string) (*UpdateRecord, error)
+	GetUpdatesByCommitHash(commitHash string) ([]UpdateRecord, error)
+	CountUpdates() (int, error)
+	Close() error
+}
+
+type MetadataStoreType string
+
+const (
+	NoMetadataStoreType       MetadataStoreType = ""
+	SQLiteMetadataStoreType   MetadataStoreType = "sqlite"
+	PostgresMetadataStoreType MetadataStoreType = "postgres"
+)
+
+func ResolveMetadataStoreType() MetadataStoreType {
+	switch config.GetEnv("METADATA_STORE_TYPE") {
+	case "sqlite":
+		return SQLiteMetadataStoreType
+	case "postgres":
+		return PostgresMetadataStoreType
+	}
+	return NoMetadataStoreType
+}
+
+func IsMetadataStoreEnabled() bool {
+	return ResolveMetadataStoreType() != NoMetadataStoreType
+}
+
+var (
+	metadataStoreInstance MetadataStore
+	once                  sync.Once
+)
+
+// GetMetadataStore returns nil when no metadata store is configured, in which case
+// every listing is derived from the bucket.
+func GetMetadataStore() MetadataStore {
+	once.Do(func() {
+		storeType := ResolveMetadataStoreType()
+		if storeType == NoMetadataStoreType {
+			return
+		}
+		store, err := NewSQLMetadataStore(storeType, config.GetEnv("METADATA_STORE_DSN"))
+		if err != nil {
+			log.Fatalf("Error initializing metadata store: %v", err)
+		}
+		metadataStoreInstance = store
+	})
+	return metadataStoreInstance
+}
+
+func ResetMetadataStoreInstance() {
+	if metadataStoreInstance != nil {
+		_ = metadataStoreInstance.Close()
+	}
+	metadataStoreInstance = nil
+	once = sync.Once{}
+}
+
+func NewUpdateRecord(branch string, runtimeVersion string, updateId string, createdAt time.Time) UpdateRecord {
+	return UpdateRecord{
+		Branch:            branch,
+		RuntimeVersion:    runtimeVersion,
+		UpdateId:          updateId,
+		Status:            PendingStatus,
+		Type:              NormalUpdateRecord,
+		RolloutPercentage: 100,
+		CreatedAt:         createdAt,
+	}
+}
+
+func validateRecord(record UpdateRecord) error {
+	if record.Branch == "" || record.RuntimeVersion == "" || record.UpdateId == "" {
+		return fmt.Errorf("branch, runtimeVersion and updateId are required")
+	}
+	if record.RolloutPercentage < 0 || record.RolloutPercentage > 100 {
+		return fmt.Errorf("invalid rollout percentage: %d", record.RolloutPercentage)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package metadataStore
+
+import (
+	"database/sql"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+type SQLMetadataStore struct {
+	db        *sql.DB
+	storeType MetadataStoreType
+}
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS updates (
+		branch TEXT NOT NULL,
+		runtime_version TEXT NOT NULL,
+		update_id TEXT NOT NULL,
+		platform TEXT NOT NULL DEFAULT '',
+		commit_hash TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		update_type TEXT NOT NULL DEFAULT 'normal',
+		rollout_percentage INTEGER NOT NULL DEFAULT 100,
+		created_at BIGINT NOT NULL,
+		PRIMARY KEY (branch, runtime_version, update_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS updates_commit_hash_idx ON updates (commit_hash)`,
+	`CREATE INDEX IF NOT EXISTS updates_latest_idx ON updates (branch, runtime_version, status, created_at)`,
+}
+
+const updateColumns = "branch, runtime_version, update_id, platform, commit_hash, status, update_type, rollout_percentage, created_at"
+
+func NewSQLMetadataStore(storeType MetadataStoreType, dsn string) (*SQLMetadataStore, error) {
+	var driverName string
+	switch storeType {
+	case SQLiteMetadataStoreType:
+		driverName = "sqlite"
+		if dsn == "" {
+			return nil, errors.New("METADATA_STORE_DSN must be set to the path of the SQLite database")
+		}
+	case PostgresMetadataStoreType:
+		driverName = "postgres"
+		if dsn == "" {
+			return nil, errors.New("METADATA_STORE_DSN must be set to the Postgres connection string")
+		}
+	default:
+		return nil, fmt.Errorf("unknown metadata store type: %s", storeType)
+	}
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening metadata store: %w", err)
+	}
+	if storeType == SQLiteMetadataStoreType {
+		// SQLite only supports one writer at a time
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to metadata store: %w", err)
+	}
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error migrating metadata store: %w", err)
+		}
+	}
+	return &SQLMetadataStore{db: db, storeType: storeType}, nil
+}
+
+// DB gives access to the underlying connection so that other tables can live in the same database.
+func (s *SQLMetadataStore) DB() *sql.DB {
+	return s.db
+}
+
+// Rebind converts the "?" placeholders into the "$n" placeholders expected by Postgres.
+func (s *SQLMetadataStore) Rebind(query string) string {
+	if s.storeType != PostgresMetadataStoreType {
+		return query
+	}
+	var builder strings.Builder
+	index := 1
+	for _, char := range query {
+		if char == '?' {
+			builder.WriteString("$" + strconv.Itoa(index))
+			index++
+			continue
+		}
+		builder.WriteRune(char)
+	}
+	return builder.String()
+}
+
+func (s *SQLMetadataStore) UpsertUpdate(record UpdateRecord) error {
+	if err := validateRecord(record); err != nil {
+		return err
+	}
+	query := s.Rebind(`INSERT INTO updates (` + updateColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (branch, runtime_version, update_id) DO UPDATE SET
+			platform = excluded.platform,
+			commit_hash = excluded.commit_hash,
+			status = excluded.status,
+			update_type = excluded.update_type,
+			rollout_percentage = excluded.rollout_percentage,
+			created_at = excluded.created_at`)
+	_, err := s.db.Exec(query,
+		record.Branch,
+		record.RuntimeVersion,
+		record.UpdateId,
+		record.Platform,
+		record.CommitHash,
+		string(record.Status),
+		string(record.Type),
+		record.RolloutPercentage,
+		record.CreatedAt.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("error upserting update: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLMetadataStore) SetUpdateStatus(branch string, runtimeVersion string, updateId string, status UpdateStatus) error {
+	query := s.Rebind(`UPDATE updates SET status = ? WHERE branch = ? AND runtime_version = ? AND update_id = ?`)
+	result, err := s.db.Exec(query, string(status), branch, runtimeVersion, updateId)
+	if err != nil {
+		return fmt.Errorf("error updating update status: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return fmt.Errorf("update %s/%s/%s not found", branch, runtimeVersion, updateId)
+	}
+	return nil
+}
+
+func (s *SQLMetadataStore) DeleteUpdate(branch string, runtimeVersion string, updateId string) error {
+	query := s.Rebind(`DELETE FROM updates WHERE branch = ? AND runtime_version = ? AND update_id = ?`)
+	if _, err := s.db.Exec(query, branch, runtimeVersion, updateId); err != nil {
+		return fmt.Errorf("error deleting update: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLMetadataStore) GetBranches() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT branch FROM updates ORDER BY branch`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing branches: %w", err)
+	}
+	defer rows.Close()
+	var branches []string
+	for rows.Next() {
+		var branch string
+		if err := rows.Scan(&branch); err != nil {
+			return nil, err
+		}
+		branches = append(branches, branch)
+	}
+	return branches, rows.Err()
+}
+
+func (s *SQLMetadataStore) GetRuntimeVersions(branch string) ([]bucket.RuntimeVersionWithStats, error) {
+	query := s.Rebind(`SELECT runtime_version, MIN(created_at), MAX(created_at), COUNT(*)
+		FROM updates WHERE branch = ? GROUP BY runtime_version`)
+	rows, err := s.db.Query(query, branch)
+	if err != nil {
+		return nil, fmt.Errorf("error listing runtime versions: %w", err)
+	}
+	defer rows.Close()
+	var runtimeVersions []bucket.RuntimeVersionWithStats
+	for rows.Next() {
+		var runtimeVersion string
+		var firstCreatedAt, lastCreatedAt int64
+		var numberOfUpdates int
+		if err := rows.Scan(&runtimeVersion, &firstCreatedAt, &lastCreatedAt, &numberOfUpdates); err != nil {
+			return nil, err
+		}
+		runtimeVersions = append(runtimeVersions, bucket.RuntimeVersionWithStats{
+			RuntimeVersion:  runtimeVersion,
+			CreatedAt:       time.UnixMilli(firstCreatedAt).UTC().Format(time.RFC3339),
+			LastUpdatedAt:   time.UnixMilli(lastCreatedAt).UTC().Format(time.RFC3339),
+			NumberOfUpdates: numberOfUpdates,
+		})
+	}
+	return runtimeVersions, rows.Err()
+}
+
+func (s *SQLMetadataStore) GetUpdates(branch string, runtimeVersion string) ([]UpdateRecord, error) {
+	query := s.Rebind(`SELECT ` + updateColumns + ` FROM updates
+		WHERE branch = ? AND runtime_version = ? ORDER BY created_at DESC`)
+	return s.queryUpdates(query, branch, runtimeVersion)
+}
+
+func (s *SQLMetadataStore) GetUpdate(branch string, runtimeVersion string, updateId string) (*UpdateRecord, error) {
+	query := s.Rebind(`SELECT ` + updateColumns + ` FROM updates
+		WHERE branch = ? AND runtime_version = ? AND update_id = ?`)
+	records, err := s.queryUpdates(query, branch, runtimeVersion, updateId)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[0], nil
+}
+
+func (s *SQLMetadataStore) GetLatestCheckedUpdate(branch string, runtimeVersion string) (*UpdateRecord, error) {
+	query := s.Rebind(`SELECT ` + updateColumns + ` FROM updates
+		WHERE branch = ? AND runtime_version = ? AND status = ? ORDER BY created_at DESC LIMIT 1`)
+	records, err := s.queryUpdates(query, branch, runtimeVersion, string(CheckedStatus))
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[0], nil
+}
+
+func (s *SQLMetadataStore) GetUpdatesByCommitHash(commitHash string) ([]UpdateRecord, error) {
+	query := s.Rebind(`SELECT ` + updateColumns + ` FROM updates
+		WHERE commit_hash = ? ORDER BY created_at DESC`)
+	return s.queryUpdates(query, commitHash)
+}
+
+func (s *SQLMetadataStore) CountUpdates() (int, error) {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM updates`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting updates: %w", err)
+	}
+	return count, nil
+}
+
+func (s *SQLMetadataStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLMetadataStore) queryUpdates(query string, args ...interface{}) ([]UpdateRecord, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying updates: %w", err)
+	}
+	defer rows.Close()
+	var records []UpdateRecord
+	for rows.Next() {
+		var record UpdateRecord
+		var status, updateType string
+		var createdAt int64
+		if err := rows.Scan(
+			&record.Branch,
+			&record.RuntimeVersion,
+			&record.UpdateId,
+			&record.Platform,
+			&record.CommitHash,
+			&status,
+			&updateType,
+			&record.RolloutPercentage,
+			&createdAt,
+		); err != nil {
+			return nil, err
+		}
+		record.Status = UpdateStatus(status)
+		record.Type = UpdateRecordType(updateType)
+		record.CreatedAt = time.UnixMilli(createdAt).UTC()
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,113 @@
+package metadataStore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLMetadataStore {
+	t.Helper()
+	store, err := NewSQLMetadataStore(SQLiteMetadataStoreType, filepath.Join(t.TempDir(), "metadata.db"))
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestSQLMetadataStoreRequiresDSN(t *testing.T) {
+	_, err := NewSQLMetadataStore(SQLiteMetadataStoreType, "")
+	assert.NotNil(t, err)
+	_, err = NewSQLMetadataStore("mysql", "dsn")
+	assert.NotNil(t, err)
+}
+
+func TestSQLMetadataStoreUpsertAndList(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	first := NewUpdateRecord("main", "1", "1000", time.UnixMilli(1000))
+	first.CommitHash = "abc"
+	first.Platform = "ios"
+	second := NewUpdateRecord("main", "1", "2000", time.UnixMilli(2000))
+	second.CommitHash = "abc"
+	second.Platform = "android"
+	other := NewUpdateRecord("staging", "2", "3000", time.UnixMilli(3000))
+	for _, record := range []UpdateRecord{first, second, other} {
+		assert.Nil(t, store.UpsertUpdate(record))
+	}
+	// Upserting twice must not duplicate the record
+	assert.Nil(t, store.UpsertUpdate(first))
+
+	count, err := store.CountUpdates()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+
+	branches, err := store.GetBranches()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"main", "staging"}, branches)
+
+	runtimeVersions, err := store.GetRuntimeVersions("main")
+	assert.Nil(t, err)
+	assert.Len(t, runtimeVersions, 1)
+	assert.Equal(t, "1", runtimeVersions[0].RuntimeVersion)
+	assert.Equal(t, 2, runtimeVersions[0].NumberOfUpdates)
+	assert.Equal(t, "1970-01-01T00:00:01Z", runtimeVersions[0].CreatedAt)
+	assert.Equal(t, "1970-01-01T00:00:02Z", runtimeVersions[0].LastUpdatedAt)
+
+	updates, err := store.GetUpdates("main", "1")
+	assert.Nil(t, err)
+	assert.Len(t, updates, 2)
+	assert.Equal(t, "2000", updates[0].UpdateId)
+	assert.Equal(t, "android", updates[0].Platform)
+	assert.Equal(t, PendingStatus, updates[0].Status)
+
+	byCommitHash, err := store.GetUpdatesByCommitHash("abc")
+	assert.Nil(t, err)
+	assert.Len(t, byCommitHash, 2)
+}
+
+func TestSQLMetadataStoreLatestCheckedUpdate(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	assert.Nil(t, store.UpsertUpdate(NewUpdateRecord("main", "1", "1000", time.UnixMilli(1000))))
+	assert.Nil(t, store.UpsertUpdate(NewUpdateRecord("main", "1", "2000", time.UnixMilli(2000))))
+
+	latest, err := store.GetLatestCheckedUpdate("main", "1")
+	assert.Nil(t, err)
+	assert.Nil(t, latest)
+
+	assert.Nil(t, store.SetUpdateStatus("main", "1", "1000", CheckedStatus))
+	latest, err = store.GetLatestCheckedUpdate("main", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "1000", latest.UpdateId)
+
+	assert.Nil(t, store.SetUpdateStatus("main", "1", "2000", CheckedStatus))
+	latest, err = store.GetLatestCheckedUpdate("main", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "2000", latest.UpdateId)
+
+	assert.NotNil(t, store.SetUpdateStatus("main", "1", "3000", CheckedStatus))
+}
+
+func TestSQLMetadataStoreDeleteUpdate(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	assert.Nil(t, store.UpsertUpdate(NewUpdateRecord("main", "1", "1000", time.UnixMilli(1000))))
+	assert.Nil(t, store.DeleteUpdate("main", "1", "1000"))
+	record, err := store.GetUpdate("main", "1", "1000")
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+}
+
+func TestSQLMetadataStoreRejectsInvalidRecord(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	assert.NotNil(t, store.UpsertUpdate(NewUpdateRecord("", "1", "1000", time.UnixMilli(1000))))
+	record := NewUpdateRecord("main", "1", "1000", time.UnixMilli(1000))
+	record.RolloutPercentage = 150
+	assert.NotNil(t, store.UpsertUpdate(record))
+}
+
+func TestRebindForPostgres(t *testing.T) {
+	store := &SQLMetadataStore{storeType: PostgresMetadataStoreType}
+	assert.Equal(t, "a = $1 AND b = $2", store.Rebind("a = ? AND b = ?"))
+	store = &SQLMetadataStore{storeType: SQLiteMetadataStoreType}
+	assert.Equal(t, "a = ? AND b = ?", store.Rebind("a = ? AND b = ?"))
+}
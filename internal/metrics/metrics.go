@@ -11,57 +11,205 @@ var (
 	activeUsersVec = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "active_users_total",
-			Help: "Total number of unique active users per clientId, platform, runtime version, branch and update",
+			Help: "Total number of unique active users per app, clientId, platform, runtime version, branch and update",
 		},
-		[]string{"clientId", "platform", "runtime", "branch", "update"},
+		[]string{"app", "clientId", "platform", "runtime", "branch", "update"},
 	)
 	updateDownloadsVec = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "update_downloads_total",
-			Help: "Total number of update downloads per platform, runtime version, branch and update",
+			Help: "Total number of update downloads per app, platform, runtime version, branch and update",
 		},
-		[]string{"platform", "runtime", "branch", "update", "updateType"},
+		[]string{"app", "platform", "runtime", "branch", "update", "updateType"},
 	)
 	updateErrorUsersVec = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "update_error_users_total",
 			Help: "Total number of users who encountered errors during update process",
 		},
-		[]string{"clientId", "platform", "runtime", "branch", "update"},
+		[]string{"app", "clientId", "platform", "runtime", "branch", "update"},
 	)
+	cacheHitsVec      = newCacheHitsVec()
+	cacheMissesVec    = newCacheMissesVec()
+	cacheEvictionsVec = newCacheEvictionsVec()
+	cacheEntriesVec   = newCacheEntriesVec()
+	cacheBytesVec     = newCacheBytesVec()
+
+	replicationLagVec      = newReplicationLagVec()
+	replicationPendingVec  = newReplicationPendingVec()
+	replicationFailuresVec = newReplicationFailuresVec()
+	readFailoversVec       = newReadFailoversVec()
 )
 
+func newCacheHitsVec() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_hits_total",
+			Help: "Total number of cache hits per cache",
+		},
+		[]string{"cache"},
+	)
+}
+
+func newCacheMissesVec() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_misses_total",
+			Help: "Total number of cache misses per cache",
+		},
+		[]string{"cache"},
+	)
+}
+
+func newCacheEvictionsVec() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_evictions_total",
+			Help: "Total number of cache evictions per cache and reason (size or expired)",
+		},
+		[]string{"cache", "reason"},
+	)
+}
+
+func newCacheEntriesVec() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cache_entries",
+			Help: "Current number of entries per cache",
+		},
+		[]string{"cache"},
+	)
+}
+
+func newCacheBytesVec() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cache_bytes",
+			Help: "Current size in bytes of keys and values per cache",
+		},
+		[]string{"cache"},
+	)
+}
+
+func newReplicationLagVec() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "storage_replication_lag_seconds",
+			Help: "Age in seconds of the oldest write not yet replicated per storage replica",
+		},
+		[]string{"replica"},
+	)
+}
+
+func newReplicationPendingVec() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "storage_replication_pending",
+			Help: "Current number of writes waiting to be replicated per storage replica",
+		},
+		[]string{"replica"},
+	)
+}
+
+func newReplicationFailuresVec() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_replication_failures_total",
+			Help: "Total number of writes given up replicating per storage replica",
+		},
+		[]string{"replica"},
+	)
+}
+
+func newReadFailoversVec() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_read_failovers_total",
+			Help: "Total number of reads served by a storage replica per operation and replica",
+		},
+		[]string{"operation", "replica"},
+	)
+}
+
 func InitMetrics() {
 	prometheus.MustRegister(activeUsersVec)
 	prometheus.MustRegister(updateDownloadsVec)
 	prometheus.MustRegister(updateErrorUsersVec)
+	prometheus.MustRegister(cacheHitsVec)
+	prometheus.MustRegister(cacheMissesVec)
+	prometheus.MustRegister(cacheEvictionsVec)
+	prometheus.MustRegister(cacheEntriesVec)
+	prometheus.MustRegister(cacheBytesVec)
+	prometheus.MustRegister(replicationLagVec)
+	prometheus.MustRegister(replicationPendingVec)
+	prometheus.MustRegister(replicationFailuresVec)
+	prometheus.MustRegister(readFailoversVec)
 }
 
 func CleanupMetrics() {
 	prometheus.Unregister(activeUsersVec)
 	prometheus.Unregister(updateDownloadsVec)
 	prometheus.Unregister(updateErrorUsersVec)
+	prometheus.Unregister(cacheHitsVec)
+	prometheus.Unregister(cacheMissesVec)
+	prometheus.Unregister(cacheEvictionsVec)
+	prometheus.Unregister(cacheEntriesVec)
+	prometheus.Unregister(cacheBytesVec)
+	prometheus.Unregister(replicationLagVec)
+	prometheus.Unregister(replicationPendingVec)
+	prometheus.Unregister(replicationFailuresVec)
+	prometheus.Unregister(readFailoversVec)
 }
 
-func TrackActiveUser(clientId, platform, runtime, branch, update string) {
+func TrackActiveUser(app, clientId, platform, runtime, branch, update string) {
 	if clientId == "" || update == "" || platform == "" || branch == "" {
 		return
 	}
-	activeUsersVec.WithLabelValues(clientId, platform, runtime, branch, update).Set(1)
+	activeUsersVec.WithLabelValues(app, clientId, platform, runtime, branch, update).Set(1)
 }
 
-func TrackUpdateDownload(platform, runtime, branch, update, updateType string) {
+func TrackUpdateDownload(app, platform, runtime, branch, update, updateType string) {
 	if update == "" || platform == "" || branch == "" {
 		return
 	}
-	updateDownloadsVec.WithLabelValues(platform, runtime, branch, update, updateType).Inc()
+	updateDownloadsVec.WithLabelValues(app, platform, runtime, branch, update, updateType).Inc()
 }
 
-func TrackUpdateErrorUser(clientId, platform, runtime, branch, update string) {
+func TrackUpdateErrorUser(app, clientId, platform, runtime, branch, update string) {
     if clientId == "" || update == "" || platform == "" || branch == "" {
         return
     }
-    updateErrorUsersVec.WithLabelValues(clientId, platform, runtime, branch, update).Inc()
+    updateErrorUsersVec.WithLabelValues(app, clientId, platform, runtime, branch, update).Inc()
+}
+
+func TrackCacheHit(cache string) {
+	cacheHitsVec.WithLabelValues(cache).Inc()
+}
+
+func TrackCacheMiss(cache string) {
+	cacheMissesVec.WithLabelValues(cache).Inc()
+}
+
+func TrackCacheEviction(cache, reason string) {
+	cacheEvictionsVec.WithLabelValues(cache, reason).Inc()
+}
+
+func SetCacheSize(cache string, entries int, bytes int64) {
+	cacheEntriesVec.WithLabelValues(cache).Set(float64(entries))
+	cacheBytesVec.WithLabelValues(cache).Set(float64(bytes))
+}
+
+func SetReplicationLag(replica string, pending int, lagSeconds float64) {
+	replicationPendingVec.WithLabelValues(replica).Set(float64(pending))
+	replicationLagVec.WithLabelValues(replica).Set(lagSeconds)
+}
+
+func TrackReplicationFailure(replica string) {
+	replicationFailuresVec.WithLabelValues(replica).Inc()
+}
+
+func TrackReadFailover(operation, replica string) {
+	readFailoversVec.WithLabelValues(operation, replica).Inc()
 }
 
 func PrometheusHandler() http.Handler {
@@ -72,22 +220,31 @@ func ResetMetricsForTest() {
 	activeUsersVec = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "active_users_total",
-			Help: "Total number of unique active users per clientId, platform, runtime version, branch and update",
+			Help: "Total number of unique active users per app, clientId, platform, runtime version, branch and update",
 		},
-		[]string{"clientId", "platform", "runtime", "branch", "update"},
+		[]string{"app", "clientId", "platform", "runtime", "branch", "update"},
 	)
 	updateDownloadsVec = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "update_downloads_total",
-			Help: "Total number of update downloads per platform, runtime version, branch and update",
+			Help: "Total number of update downloads per app, platform, runtime version, branch and update",
 		},
-		[]string{"platform", "runtime", "branch", "update", "updateType"},
+		[]string{"app", "platform", "runtime", "branch", "update", "updateType"},
 	)
 	updateErrorUsersVec = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "update_error_users_total",
 			Help: "Total number of users who encountered errors during update process",
 		},
-		[]string{"clientId", "platform", "runtime", "branch", "update"},
+		[]string{"app", "clientId", "platform", "runtime", "branch", "update"},
 	)
+	cacheHitsVec = newCacheHitsVec()
+	cacheMissesVec = newCacheMissesVec()
+	cacheEvictionsVec = newCacheEvictionsVec()
+	cacheEntriesVec = newCacheEntriesVec()
+	cacheBytesVec = newCacheBytesVec()
+	replicationLagVec = newReplicationLagVec()
+	replicationPendingVec = newReplicationPendingVec()
+	replicationFailuresVec = newReplicationFailuresVec()
+	readFailoversVec = newReadFailoversVec()
 }
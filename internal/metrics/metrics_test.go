@@ -99,7 +99,7 @@ func TestTrackUpdateDownload(t *testing.T) {
 	branch := "stable"
 	update := "update42"
 	updateType := "normal"
-	metrics.TrackUpdateDownload(platform, runtime, branch, update, updateType)
+	metrics.TrackUpdateDownload("", platform, runtime, branch, update, updateType)
 	val := getTotalUpdateDownloads(platform, runtime, branch, update, updateType)
 	if val != 1 {
 		t.Errorf("Expected update_downloads_total to be 1, got %v", val)
@@ -114,7 +114,7 @@ func TestTrackActiveUser(t *testing.T) {
 	runtime := "1.0.0"
 	branch := "stable"
 	update := "update42"
-	metrics.TrackActiveUser(clientId, platform, runtime, branch, update)
+	metrics.TrackActiveUser("", clientId, platform, runtime, branch, update)
 	val := getActiveUsers(platform, runtime, branch, update)
 	if val != 1 {
 		t.Errorf("Expected active_users_total to be 1, got %v", val)
@@ -132,11 +132,11 @@ func TestGetActiveUsers(t *testing.T) {
 	if got := getActiveUsers(platform, runtime, branch, update); got != 0 {
 		t.Errorf("Expected getActiveUsers to return 0, got %v", got)
 	}
-	metrics.TrackActiveUser(clientId, platform, runtime, branch, update)
+	metrics.TrackActiveUser("", clientId, platform, runtime, branch, update)
 	if got := getActiveUsers(platform, runtime, branch, update); got != 1 {
 		t.Errorf("Expected getActiveUsers to return 1, got %v", got)
 	}
-	metrics.TrackActiveUser("client2", platform, runtime, branch, update)
+	metrics.TrackActiveUser("", "client2", platform, runtime, branch, update)
 	if got := getActiveUsers(platform, runtime, branch, update); got != 1 {
 		t.Errorf("Expected getActiveUsers to still be 1 (Gauge should not increment), got %v", got)
 	}
@@ -153,11 +153,11 @@ func TestGetTotalUpdateDownloadsByUpdate(t *testing.T) {
 	if got := getTotalUpdateDownloads(platform, runtime, branch, update, updateType); got != 0 {
 		t.Errorf("Expected total update downloads to be 0, got %v", got)
 	}
-	metrics.TrackUpdateDownload(platform, runtime, branch, update, updateType)
+	metrics.TrackUpdateDownload("", platform, runtime, branch, update, updateType)
 	if got := getTotalUpdateDownloads(platform, runtime, branch, update, updateType); got != 1 {
 		t.Errorf("Expected total update downloads to be 1, got %v", got)
 	}
-	metrics.TrackUpdateDownload(platform, runtime, branch, update, updateType)
+	metrics.TrackUpdateDownload("", platform, runtime, branch, update, updateType)
 	if got := getTotalUpdateDownloads(platform, runtime, branch, update, updateType); got != 2 {
 		t.Errorf("Expected total update downloads to be 2, got %v", got)
 	}
@@ -171,7 +171,7 @@ func TestPrometheusHandler(t *testing.T) {
 	branch := "stable"
 	update := "update42"
 	updateType := "normal"
-	metrics.TrackUpdateDownload(platform, runtime, branch, update, updateType)
+	metrics.TrackUpdateDownload("", platform, runtime, branch, update, updateType)
 	req := httptest.NewRequest("GET", "/metrics", nil)
 	rr := httptest.NewRecorder()
 	handler := promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{})
@@ -193,7 +193,7 @@ func TestTrackUpdateErrorUser(t *testing.T) {
     if got := getUpdateErrorUsers(clientId, platform, runtime, branch, update); got != 0 {
         t.Errorf("Expected update_error_users_total to be 0, got %v", got)
     }
-    metrics.TrackUpdateErrorUser(clientId, platform, runtime, branch, update)
+    metrics.TrackUpdateErrorUser("", clientId, platform, runtime, branch, update)
     if got := getUpdateErrorUsers(clientId, platform, runtime, branch, update); got != 1 {
         t.Errorf("Expected update_error_users_total to be 1, got %v", got)
     }
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/auth"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func remoteIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Audit records an audit event for every request of the route in sink. The target is read from the route
+// variables and the query, the actor from the dashboard principal; handlers complete the event
+// through audit.EventFromContext. The outcome is derived from the response status code unless
+// the handler sets it.
+func Audit(sink audit.Sink, action audit.Action, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := audit.NewEvent(action)
+		event.RequestId = r.Header.Get("X-Request-Id")
+		event.Ip = remoteIp(r)
+		event.ForwardedFor = r.Header.Get("X-Forwarded-For")
+		if principal := auth.PrincipalFromContext(r.Context()); principal != nil {
+			event.Actor = audit.Actor{Type: audit.UserActor, Id: principal.Subject, Name: principal.Username}
+		}
+		vars := mux.Vars(r)
+		query := r.URL.Query()
+		event.Target = audit.Target{
+			Branch:         vars["BRANCH"],
+			RuntimeVersion: firstNonEmpty(vars["RUNTIME_VERSION"], query.Get("runtimeVersion")),
+			UpdateId:       firstNonEmpty(vars["UPDATE_ID"], query.Get("updateId")),
+			Resource:       vars["ID"],
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(audit.WithEvent(r.Context(), event)))
+
+		event.StatusCode = recorder.statusCode
+		if event.Outcome == "" {
+			switch {
+			case recorder.statusCode < 400:
+				event.Outcome = audit.SuccessOutcome
+			case recorder.statusCode == http.StatusUnauthorized || recorder.statusCode == http.StatusForbidden:
+				event.Outcome = audit.DeniedOutcome
+			default:
+				event.Outcome = audit.FailureOutcome
+			}
+		}
+		if event.Reason == "" && event.Outcome != audit.SuccessOutcome {
+			event.Reason = http.StatusText(recorder.statusCode)
+		}
+		audit.Record(sink, *event)
+	})
+}
@@ -2,10 +2,18 @@ package middleware
 
 import (
 	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/users"
 	"net/http"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
+// AuthMiddleware only lets through the requests bearing an access token of a session of authService.
+func AuthMiddleware(authService *auth.Auth) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return authenticated(authService, next)
+	}
+}
+
+func authenticated(authService *auth.Auth, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -13,12 +21,27 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		bearerToken := authHeader[len("Bearer "):]
-		authService := auth.NewAuth()
-		_, err := authService.ValidateToken(bearerToken)
+		principal, err := authService.ValidateToken(bearerToken)
 		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// RequireRole must be used behind AuthMiddleware, it rejects the principals whose role is lower than role.
+func RequireRole(role users.Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.PrincipalFromContext(r.Context())
+		if principal == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !users.HasRole(principal.Role, role) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
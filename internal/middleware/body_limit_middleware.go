@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"expo-open-ota/config"
+	"net/http"
+)
+
+// MaxRequestBodySize is the largest body accepted by the routes taking JSON or form bodies, MAX_REQUEST_BODY_BYTES.
+func MaxRequestBodySize() int64 {
+	return config.GetIntEnv("MAX_REQUEST_BODY_BYTES", 1)
+}
+
+// LimitBody refuses with a 413 the requests announcing a body larger than limit, and stops reading the
+// others past it. The limit is read on every request so that it follows the reloaded configuration.
+func LimitBody(limit func() int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxBytes := limit()
+		if r.ContentLength > maxBytes {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,41 @@
+package infrastructure
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// appRouter serves the routes of an app hosted next to the default one, once its /apps/{id} prefix is stripped.
+func (s *Server) appRouter() *mux.Router {
+	r := mux.NewRouter()
+	s.registerUpdateRoutes(r)
+	s.registerUploadRoutes(r)
+	s.registerDashboardApiRoutes(r)
+	return r
+}
+
+// NewAppsRouter serves the routes of the default server along with the ones of the other apps, the requests
+// being routed to an app by their /apps/{id} prefix or by their expo-project-id header.
+func (s *Server) NewAppsRouter(appServers []*Server) *mux.Router {
+	r := s.NewRouter()
+	byProjectId := map[string]http.Handler{}
+	for _, appServer := range appServers {
+		prefix := "/apps/" + appServer.app
+		appRouter := appServer.appRouter()
+		r.PathPrefix(prefix + "/").Handler(http.StripPrefix(prefix, appRouter))
+		byProjectId[appServer.expo.AppId] = appRouter
+	}
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			appRouter, found := byProjectId[r.Header.Get("expo-project-id")]
+			if found && !strings.HasPrefix(r.URL.Path, "/apps/") {
+				appRouter.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	return r
+}
@@ -2,10 +2,13 @@ package infrastructure
 
 import (
 	"expo-open-ota/config"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/bucket"
 	"expo-open-ota/internal/dashboard"
 	"expo-open-ota/internal/handlers"
 	"expo-open-ota/internal/metrics"
 	"expo-open-ota/internal/middleware"
+	"expo-open-ota/internal/users"
 	"fmt"
 	"log"
 	"net/http"
@@ -20,6 +23,24 @@ func HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func withRole(role users.Role, handler http.HandlerFunc) http.Handler {
+	return middleware.RequireRole(role, handler)
+}
+
+// audited records the requests in the audit log of the server.
+func (s *Server) audited(action audit.Action, handler http.Handler) http.Handler {
+	return middleware.Audit(s.handlers.AuditSink(), action, handler)
+}
+
+func limited(limit func() int64, handler http.HandlerFunc) http.Handler {
+	return middleware.LimitBody(limit, handler)
+}
+
+// maxLocalUploadBodySize leaves room for the multipart envelope of the clients still sending forms.
+func maxLocalUploadBodySize() int64 {
+	return bucket.MaxLocalUploadSize() + middleware.MaxRequestBodySize()
+}
+
 func getDashboardPath() string {
 	exePath, err := os.Executable()
 	if err != nil {
@@ -34,7 +55,79 @@ func getDashboardPath() string {
 	return filepath.Join(exeDir, "dashboard", "dist")
 }
 
-func NewRouter() *mux.Router {
+func (s *Server) registerUpdateRoutes(r *mux.Router) {
+	r.HandleFunc("/manifest", s.handlers.ManifestHandler).Methods(http.MethodGet)
+	r.HandleFunc("/assets", s.handlers.AssetsHandler).Methods(http.MethodGet)
+}
+
+func (s *Server) registerUploadRoutes(r *mux.Router) {
+	h := s.handlers
+	r.Handle("/requestUploadUrl/{BRANCH}", s.audited(audit.RequestUploadUrlAction, limited(middleware.MaxRequestBodySize, h.RequestUploadUrlHandler))).Methods(http.MethodPost)
+	r.Handle("/uploadLocalFile", s.audited(audit.UploadLocalFileAction, limited(maxLocalUploadBodySize, h.RequestUploadLocalFileHandler))).Methods(http.MethodPut)
+	r.HandleFunc("/uploadLocalFile", h.LocalUploadOffsetHandler).Methods(http.MethodHead)
+	r.Handle("/markUpdateAsUploaded/{BRANCH}", s.audited(audit.MarkUpdateAsUploadedAction, limited(middleware.MaxRequestBodySize, h.MarkUpdateAsUploadedHandler))).Methods(http.MethodPost)
+	r.Handle("/promoteUpdate/{BRANCH}", s.audited(audit.PromoteUpdateAction, limited(middleware.MaxRequestBodySize, h.PublisherPromoteUpdateHandler))).Methods(http.MethodPost)
+}
+
+func (s *Server) registerDashboardApiRoutes(r *mux.Router) {
+	h := s.handlers
+	corsSubrouter := r.PathPrefix("/auth").Subrouter()
+	corsSubrouter.Handle("/login", s.audited(audit.LoginAction, http.HandlerFunc(h.LoginHandler))).Methods(http.MethodPost)
+	corsSubrouter.HandleFunc("/refreshToken", h.RefreshTokenHandler).Methods(http.MethodPost)
+	corsSubrouter.Handle("/logout", s.audited(audit.LogoutAction, http.HandlerFunc(h.LogoutHandler))).Methods(http.MethodPost)
+	corsSubrouter.HandleFunc("/methods", h.GetAuthMethodsHandler).Methods(http.MethodGet)
+	corsSubrouter.HandleFunc("/oidc/login", h.OIDCLoginHandler).Methods(http.MethodGet)
+	corsSubrouter.Handle("/oidc/callback", s.audited(audit.OIDCLoginAction, http.HandlerFunc(h.OIDCCallbackHandler))).Methods(http.MethodGet)
+	corsSubrouter.HandleFunc("/oidc/token", h.OIDCTokenHandler).Methods(http.MethodPost)
+
+	authSubrouter := r.PathPrefix("/api").Subrouter()
+	authSubrouter.Use(middleware.AuthMiddleware(h.Auth()))
+	authSubrouter.Handle("/me", withRole(users.ViewerRole, handlers.GetMeHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/settings", s.audited(audit.ReadSettingsAction, withRole(users.ViewerRole, handlers.GetSettingsHandler))).Methods(http.MethodGet)
+	authSubrouter.Handle("/branches", withRole(users.ViewerRole, h.GetBranchesHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/updates", withRole(users.ViewerRole, h.SearchUpdatesHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/reindex", s.audited(audit.ReindexAction, withRole(users.AdminRole, h.ReindexHandler))).Methods(http.MethodPost)
+	authSubrouter.Handle("/gc", s.audited(audit.CollectGarbageAction, withRole(users.AdminRole, h.CollectGarbageHandler))).Methods(http.MethodPost)
+	authSubrouter.Handle("/verify", withRole(users.AdminRole, h.VerifyStorageHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/audit", withRole(users.AdminRole, h.GetAuditEventsHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/sessions", s.audited(audit.RevokeSessionsAction, withRole(users.AdminRole, h.RevokeAllSessionsHandler))).Methods(http.MethodDelete)
+	authSubrouter.Handle("/apiKeys", withRole(users.PublisherRole, h.ListApiKeysHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/apiKeys", s.audited(audit.CreateApiKeyAction, withRole(users.PublisherRole, h.CreateApiKeyHandler))).Methods(http.MethodPost)
+	authSubrouter.Handle("/apiKeys/{ID}", s.audited(audit.RevokeApiKeyAction, withRole(users.PublisherRole, h.RevokeApiKeyHandler))).Methods(http.MethodDelete)
+	authSubrouter.Handle("/webhooks", withRole(users.AdminRole, h.ListWebhooksHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/webhooks", s.audited(audit.CreateWebhookAction, withRole(users.AdminRole, h.CreateWebhookHandler))).Methods(http.MethodPost)
+	authSubrouter.Handle("/webhooks/{ID}", s.audited(audit.DeleteWebhookAction, withRole(users.AdminRole, h.DeleteWebhookHandler))).Methods(http.MethodDelete)
+	authSubrouter.Handle("/webhooks/{ID}/ping", s.audited(audit.PingWebhookAction, withRole(users.AdminRole, h.PingWebhookHandler))).Methods(http.MethodPost)
+	authSubrouter.Handle("/webhooks/{ID}/deliveries", withRole(users.AdminRole, h.GetWebhookDeliveriesHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/users", withRole(users.AdminRole, h.ListUsersHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/users", s.audited(audit.CreateUserAction, withRole(users.AdminRole, h.CreateUserHandler))).Methods(http.MethodPost)
+	authSubrouter.Handle("/users/{ID}", s.audited(audit.UpdateUserAction, withRole(users.AdminRole, h.UpdateUserHandler))).Methods(http.MethodPatch)
+	authSubrouter.Handle("/users/{ID}", s.audited(audit.DeleteUserAction, withRole(users.AdminRole, h.DeleteUserHandler))).Methods(http.MethodDelete)
+	authSubrouter.Handle("/branch/{BRANCH}/import", s.audited(audit.ImportUpdateAction, withRole(users.PublisherRole, h.ImportUpdateHandler))).Methods(http.MethodPost)
+	authSubrouter.Handle("/branch/{BRANCH}/runtimeVersions", withRole(users.ViewerRole, h.GetRuntimeVersionsHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates", withRole(users.ViewerRole, h.GetUpdatesHandler)).Methods(http.MethodGet)
+	authSubrouter.Handle("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}", s.audited(audit.DeleteRuntimeVersionAction, withRole(users.AdminRole, h.DeleteRuntimeVersionHandler))).Methods(http.MethodDelete)
+	authSubrouter.Handle("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/rollback", s.audited(audit.RollbackAction, withRole(users.PublisherRole, h.RollbackHandler))).Methods(http.MethodPost)
+	authSubrouter.Handle("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates/{UPDATE_ID}", s.audited(audit.DeleteUpdateAction, withRole(users.AdminRole, h.DeleteUpdateHandler))).Methods(http.MethodDelete)
+	authSubrouter.Handle("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates/{UPDATE_ID}/promote", s.audited(audit.PromoteUpdateAction, withRole(users.PublisherRole, h.PromoteUpdateHandler))).Methods(http.MethodPost)
+	authSubrouter.Handle("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates/{UPDATE_ID}/export", s.audited(audit.ExportUpdateAction, withRole(users.PublisherRole, h.ExportUpdateHandler))).Methods(http.MethodGet)
+}
+
+// UploadRouter serves the routes used by eoas to publish updates.
+func (s *Server) UploadRouter() *mux.Router {
+	r := mux.NewRouter()
+	s.registerUploadRoutes(r)
+	return r
+}
+
+// DashboardApiRouter serves the /auth and /api routes used by the dashboard.
+func (s *Server) DashboardApiRouter() *mux.Router {
+	r := mux.NewRouter()
+	s.registerDashboardApiRoutes(r)
+	return r
+}
+
+func (s *Server) NewRouter() *mux.Router {
 	r := mux.NewRouter()
 	r.Use(middleware.LoggingMiddleware)
 
@@ -43,15 +136,10 @@ func NewRouter() *mux.Router {
 	}).Methods(http.MethodGet)
 
 	r.HandleFunc("/hc", HealthCheck).Methods(http.MethodGet)
-	r.HandleFunc("/manifest", handlers.ManifestHandler).Methods(http.MethodGet)
-	r.HandleFunc("/assets", handlers.AssetsHandler).Methods(http.MethodGet)
-	r.HandleFunc("/requestUploadUrl/{BRANCH}", handlers.RequestUploadUrlHandler).Methods(http.MethodPost)
-	r.HandleFunc("/uploadLocalFile", handlers.RequestUploadLocalFileHandler).Methods(http.MethodPut)
-	r.HandleFunc("/markUpdateAsUploaded/{BRANCH}", handlers.MarkUpdateAsUploadedHandler).Methods(http.MethodPost)
-
-	corsSubrouter := r.PathPrefix("/auth").Subrouter()
-	corsSubrouter.HandleFunc("/login", handlers.LoginHandler).Methods(http.MethodPost)
-	corsSubrouter.HandleFunc("/refreshToken", handlers.RefreshTokenHandler).Methods(http.MethodPost)
+	r.HandleFunc("/ready", s.ReadinessCheck).Methods(http.MethodGet)
+	s.registerUpdateRoutes(r)
+	s.registerUploadRoutes(r)
+	s.registerDashboardApiRoutes(r)
 
 	dashboardPath := getDashboardPath()
 
@@ -89,13 +177,5 @@ func NewRouter() *mux.Router {
 			http.ServeFile(w, r, filePath)
 		}))
 	}
-
-	authSubrouter := r.PathPrefix("/api").Subrouter()
-	authSubrouter.Use(middleware.AuthMiddleware)
-	authSubrouter.HandleFunc("/settings", handlers.GetSettingsHandler).Methods(http.MethodGet)
-	authSubrouter.HandleFunc("/branches", handlers.GetBranchesHandler).Methods(http.MethodGet)
-	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersions", handlers.GetRuntimeVersionsHandler).Methods(http.MethodGet)
-	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates", handlers.GetUpdatesHandler).Methods(http.MethodGet)
-	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}", handlers.DeleteRuntimeVersionHandler).Methods(http.MethodDelete)
 	return r
 }
@@ -0,0 +1,99 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"expo-open-ota/config"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPServerOptions are the timeouts of the standalone server, zero durations disabling them.
+type HTTPServerOptions struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownDelay is how long /ready reports the server as draining before new connections are refused
+	ShutdownDelay time.Duration
+	// ShutdownTimeout bounds the wait for the requests in flight once new connections are refused
+	ShutdownTimeout time.Duration
+}
+
+func secondsEnv(key string) time.Duration {
+	return time.Duration(config.GetIntEnv(key, 0)) * time.Second
+}
+
+// HTTPServerOptionsFromEnv reads the SERVER_* timeouts, in seconds.
+func HTTPServerOptionsFromEnv() HTTPServerOptions {
+	return HTTPServerOptions{
+		ReadHeaderTimeout: secondsEnv("SERVER_READ_HEADER_TIMEOUT"),
+		ReadTimeout:       secondsEnv("SERVER_READ_TIMEOUT"),
+		WriteTimeout:      secondsEnv("SERVER_WRITE_TIMEOUT"),
+		IdleTimeout:       secondsEnv("SERVER_IDLE_TIMEOUT"),
+		ShutdownDelay:     secondsEnv("SERVER_SHUTDOWN_DELAY"),
+		ShutdownTimeout:   secondsEnv("SERVER_SHUTDOWN_TIMEOUT"),
+	}
+}
+
+// ReadinessCheck answers 503 once the server is draining, so that the load balancers stop routing to it
+// while the requests in flight complete. /hc keeps answering 200 until the process exits.
+func (s *Server) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Drain reports the server as not ready.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+// Serve serves handler on listener until ctx is done, then shuts down gracefully: the server is reported as
+// not ready for ShutdownDelay, then new connections are refused and the requests in flight are given
+// ShutdownTimeout to complete.
+func (s *Server) Serve(ctx context.Context, listener net.Listener, handler http.Handler, options HTTPServerOptions) error {
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: options.ReadHeaderTimeout,
+		ReadTimeout:       options.ReadTimeout,
+		WriteTimeout:      options.WriteTimeout,
+		IdleTimeout:       options.IdleTimeout,
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.Serve(listener)
+	}()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, refusing new connections in %s", options.ShutdownDelay)
+	s.Drain()
+	// The clients reconnect, to another instance, after their request in flight
+	httpServer.SetKeepAlivesEnabled(false)
+	time.Sleep(options.ShutdownDelay)
+
+	shutdownCtx := context.Background()
+	if options.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, options.ShutdownTimeout)
+		defer cancel()
+	}
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		httpServer.Close()
+		return fmt.Errorf("error draining connections: %w", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Printf("Server stopped")
+	return nil
+}
@@ -0,0 +1,136 @@
+package infrastructure
+
+import (
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/apps"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/cdn"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/keyStore"
+	"expo-open-ota/internal/metadataStore"
+	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Dependencies are the storages and services the update routes are served with. The users, API keys and
+// webhooks are only seen by the Server of the app they were created for.
+type Dependencies struct {
+	// App is the id of the app in a multi-app deployment, empty for the default app
+	App string
+	// BaseURL is the URL the routes of the app are served under, BASE_URL when empty
+	BaseURL  string
+	Bucket   bucket.Bucket
+	Cache    cache2.Cache
+	CDN      cdn.CDN // optional, the assets are served directly when nil
+	KeyStore keyStore.KeysStorage
+	Channels services.ChannelResolver
+	// Expo is the project of the app, EXPO_APP_ID and EXPO_ACCESS_TOKEN when empty
+	Expo services.ExpoProject
+	// Sessions keeps the dashboard sessions of the app, the sessions of the app configured by the
+	// environment when nil
+	Sessions auth.SessionStore
+	// MetadataStore indexes the updates of the default app, the store configured by the environment when nil
+	MetadataStore metadataStore.MetadataStore
+}
+
+type Server struct {
+	app      string
+	expo     services.ExpoProject
+	handlers *handlers.Handlers
+	draining atomic.Bool
+}
+
+func NewServer(deps Dependencies) (*Server, error) {
+	if deps.Bucket == nil {
+		return nil, errors.New("a bucket is required")
+	}
+	if deps.Cache == nil {
+		return nil, errors.New("a cache is required")
+	}
+	if deps.KeyStore == nil {
+		return nil, errors.New("a key store is required")
+	}
+	if deps.Channels == nil {
+		return nil, errors.New("a channel resolver is required")
+	}
+	auditSink, err := audit.SinkForBucket(deps.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		app:  deps.App,
+		expo: deps.Expo,
+		handlers: handlers.New(handlers.Dependencies{
+			App:           deps.App,
+			BaseURL:       deps.BaseURL,
+			Bucket:        deps.Bucket,
+			Cache:         deps.Cache,
+			CDN:           deps.CDN,
+			KeyStore:      deps.KeyStore,
+			Channels:      deps.Channels,
+			Expo:          deps.Expo,
+			AuditSink:     auditSink,
+			Sessions:      deps.Sessions,
+			MetadataStore: deps.MetadataStore,
+		}),
+	}, nil
+}
+
+// NewServerFromEnv builds the server from the storages and services configured by the environment.
+func NewServerFromEnv() (*Server, error) {
+	keys, err := keyStore.GetKeysStorage()
+	if err != nil {
+		return nil, fmt.Errorf("error resolving key store: %w", err)
+	}
+	return NewServer(Dependencies{
+		Bucket:   bucket.GetBucket(),
+		Cache:    cache2.GetCache(),
+		CDN:      cdn.GetCDN(),
+		KeyStore: keys,
+		Channels: services.ExpoChannelResolver{},
+	})
+}
+
+// NewAppServerFromEnv builds the server of an app hosted next to the default one, under /apps/{id}. Its
+// updates are kept in the apps folder of the configured storage and the assets are served without CDN.
+func NewAppServerFromEnv(app apps.App) (*Server, error) {
+	baseURL := strings.TrimSuffix(config.GetEnv("BASE_URL"), "/") + "/apps/" + app.Id
+	appBucket, err := bucket.NewAppBucket(app.Id, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, privateKey, err := app.ReadKeys()
+	if err != nil {
+		return nil, err
+	}
+	project := services.ExpoProject{AppId: app.ExpoAppId, AccessToken: app.ExpoAccessToken}
+	return NewServer(Dependencies{
+		App:      app.Id,
+		BaseURL:  baseURL,
+		Bucket:   appBucket,
+		Cache:    cache2.NewPrefixedCache(cache2.GetCache(), "apps:"+app.Id),
+		KeyStore: &keyStore.StaticKeysStorage{PublicExpoKey: publicKey, PrivateExpoKey: privateKey},
+		Channels: project,
+		Expo:     project,
+	})
+}
+
+func (s *Server) Updates() *update.Manager {
+	return s.handlers.Updates()
+}
+
+func (s *Server) ManifestHandler() http.Handler {
+	return http.HandlerFunc(s.handlers.ManifestHandler)
+}
+
+func (s *Server) AssetsHandler() http.Handler {
+	return http.HandlerFunc(s.handlers.AssetsHandler)
+}
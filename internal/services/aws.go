@@ -13,43 +13,68 @@ import (
 )
 
 var (
-	s3Client     *s3.Client
-	initS3Client sync.Once
+	s3Client         *s3.Client
+	initS3Client     sync.Once
+	regionalClients  = map[string]*s3.Client{}
+	regionalClientMu sync.Mutex
 )
 
+func loadS3Client(region string) (*s3.Client, error) {
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(region),
+	}
+	accessKey := config.GetEnv("AWS_ACCESS_KEY_ID")
+	secretKey := config.GetEnv("AWS_SECRET_ACCESS_KEY")
+	if accessKey != "" && secretKey != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+				return aws.Credentials{
+					AccessKeyID:     accessKey,
+					SecretAccessKey: secretKey,
+				}, nil
+			}),
+		))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(context.TODO(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS configuration: %w", err)
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
 func GetS3Client() (*s3.Client, error) {
 	var err error
 
 	initS3Client.Do(func() {
-		var cfg aws.Config
-		opts := []func(*awsconfig.LoadOptions) error{
-			awsconfig.WithRegion(config.GetEnv("AWS_REGION")),
-		}
-		accessKey := config.GetEnv("AWS_ACCESS_KEY_ID")
-		secretKey := config.GetEnv("AWS_SECRET_ACCESS_KEY")
-		if accessKey != "" && secretKey != "" {
-			opts = append(opts, awsconfig.WithCredentialsProvider(
-				aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
-					return aws.Credentials{
-						AccessKeyID:     accessKey,
-						SecretAccessKey: secretKey,
-					}, nil
-				}),
-			))
-		}
-
-		cfg, err = awsconfig.LoadDefaultConfig(context.TODO(), opts...)
-		if err == nil {
-			s3Client = s3.NewFromConfig(cfg)
-		}
+		s3Client, err = loadS3Client(config.GetEnv("AWS_REGION"))
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("error loading AWS configuration: %w", err)
+		return nil, err
 	}
 	return s3Client, nil
 }
 
+// GetS3ClientForRegion returns a client of the buckets of another region than AWS_REGION, such as the
+// replicas of the storage.
+func GetS3ClientForRegion(region string) (*s3.Client, error) {
+	if region == "" || region == config.GetEnv("AWS_REGION") {
+		return GetS3Client()
+	}
+	regionalClientMu.Lock()
+	defer regionalClientMu.Unlock()
+	if client, ok := regionalClients[region]; ok {
+		return client, nil
+	}
+	client, err := loadS3Client(region)
+	if err != nil {
+		return nil, err
+	}
+	regionalClients[region] = client
+	return client, nil
+}
+
 func FetchSecret(secretName string) string {
 	cfg, err := awsconfig.LoadDefaultConfig(context.TODO())
 	if err != nil {
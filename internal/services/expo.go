@@ -42,6 +42,17 @@ func GetExpoAppId() string {
 	return config.GetEnv("EXPO_APP_ID")
 }
 
+// ExpoProject is an Expo app updates are served for, along with the access token used to query it.
+type ExpoProject struct {
+	AppId       string
+	AccessToken string
+}
+
+// DefaultExpoProject is the project configured by EXPO_APP_ID and EXPO_ACCESS_TOKEN.
+func DefaultExpoProject() ExpoProject {
+	return ExpoProject{AppId: GetExpoAppId(), AccessToken: GetExpoAccessToken()}
+}
+
 func SetAuthHeaders(expoAuth types.ExpoAuth, req *http.Request) {
 	if expoAuth.Token != nil {
 		req.Header.Set("Authorization", "Bearer "+*expoAuth.Token)
@@ -62,7 +73,7 @@ func makeGraphQLRequest(ctx context.Context, query string, variables map[string]
 		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.expo.dev/graphql", bytes.NewBuffer(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.GetEnv("EXPO_GRAPHQL_URL"), bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return err
 	}
@@ -88,6 +99,10 @@ func makeGraphQLRequest(ctx context.Context, query string, variables map[string]
 }
 
 func FetchExpoBranches() ([]string, error) {
+	return DefaultExpoProject().FetchBranches()
+}
+
+func (p ExpoProject) FetchBranches() ([]string, error) {
 	query := `
 		query FetchAppChannel($appId: String!) {
 			app {
@@ -101,8 +116,8 @@ func FetchExpoBranches() ([]string, error) {
 			}
 		}
 	`
-	appId := GetExpoAppId()
-	expoToken := GetExpoAccessToken()
+	appId := p.AppId
+	expoToken := p.AccessToken
 	variables := map[string]interface{}{
 		"appId": appId,
 	}
@@ -166,7 +181,11 @@ func FetchExpoUserAccountInformations(expoAuth types.ExpoAuth) (*ExpoUserAccount
 }
 
 func FetchSelfExpoUsername() string {
-	token := GetExpoAccessToken()
+	return DefaultExpoProject().FetchSelfUsername()
+}
+
+func (p ExpoProject) FetchSelfUsername() string {
+	token := p.AccessToken
 	expoAccount, err := FetchExpoUserAccountInformations(types.ExpoAuth{
 		Token: &token,
 	})
@@ -176,7 +195,27 @@ func FetchSelfExpoUsername() string {
 	return expoAccount.Username
 }
 
+// ChannelResolver finds the branch serving the channel requested by a client.
+type ChannelResolver interface {
+	ResolveChannel(channelName string) (*ExpoChannelMapping, error)
+}
+
+// ExpoChannelResolver reads the channel mappings of the Expo project.
+type ExpoChannelResolver struct{}
+
+func (ExpoChannelResolver) ResolveChannel(channelName string) (*ExpoChannelMapping, error) {
+	return FetchExpoChannelMapping(channelName)
+}
+
+func (p ExpoProject) ResolveChannel(channelName string) (*ExpoChannelMapping, error) {
+	return p.FetchChannelMapping(channelName)
+}
+
 func FetchExpoChannelMapping(channelName string) (*ExpoChannelMapping, error) {
+	return DefaultExpoProject().FetchChannelMapping(channelName)
+}
+
+func (p ExpoProject) FetchChannelMapping(channelName string) (*ExpoChannelMapping, error) {
 	query := `
 		query FetchAppChannel($appId: String!, $channelName: String!) {
 			app {
@@ -196,8 +235,8 @@ func FetchExpoChannelMapping(channelName string) (*ExpoChannelMapping, error) {
 		}
 	`
 
-	appId := GetExpoAppId()
-	expoToken := GetExpoAccessToken()
+	appId := p.AppId
+	expoToken := p.AccessToken
 	variables := map[string]interface{}{
 		"appId":       appId,
 		"channelName": channelName,
@@ -264,6 +303,10 @@ func FetchExpoChannelMapping(channelName string) (*ExpoChannelMapping, error) {
 }
 
 func FetchExpoBranchesMapping() ([]ExpoBranchMapping, error) {
+	return DefaultExpoProject().FetchBranchesMapping()
+}
+
+func (p ExpoProject) FetchBranchesMapping() ([]ExpoBranchMapping, error) {
 	query := `
 		query FetchAppChannel($appId: String!) {
 			app {
@@ -282,8 +325,8 @@ func FetchExpoBranchesMapping() ([]ExpoBranchMapping, error) {
 			}
 		}
 	`
-	appId := GetExpoAppId()
-	expoToken := GetExpoAccessToken()
+	appId := p.AppId
+	expoToken := p.AccessToken
 	variables := map[string]interface{}{
 		"appId": appId,
 	}
@@ -350,6 +393,10 @@ func FetchExpoBranchesMapping() ([]ExpoBranchMapping, error) {
 }
 
 func CreateBranch(branch string) error {
+	return DefaultExpoProject().CreateBranch(branch)
+}
+
+func (p ExpoProject) CreateBranch(branch string) error {
 	query := `
 		mutation CreateUpdateBranchForAppMutation($appId: ID!, $name: String!) {
 		  updateBranch {
@@ -359,12 +406,12 @@ func CreateBranch(branch string) error {
 		  }
 		}
 	`
-	appId := GetExpoAppId()
+	appId := p.AppId
 	variables := map[string]interface{}{
 		"appId": appId,
 		"name":  branch,
 	}
-	token := GetExpoAccessToken()
+	token := p.AccessToken
 	headers := map[string]string{}
 	if config.IsTestMode() {
 		headers["operationName"] = "CreateBranch"
@@ -0,0 +1,397 @@
+package storageMigration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultConcurrency = 4
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+type Options struct {
+	// Concurrency is the number of folders copied at once, 4 when 0
+	Concurrency int
+	DryRun      bool
+	// Verify compares the content of the updates already committed in the target, which are otherwise
+	// considered identical when they hold the same files as in the source
+	Verify bool
+	// Internal also copies the objects of the server, such as the audit log and the upload sessions
+	Internal bool
+}
+
+type Status string
+
+const (
+	// MissingStatus is reported by a dry run for the folders absent from the target
+	MissingStatus Status = "missing"
+	// IncompleteStatus is reported by a dry run for the folders whose files are partly absent or different in the target
+	IncompleteStatus Status = "incomplete"
+	IdenticalStatus  Status = "identical"
+	CopiedStatus     Status = "copied"
+	// ExtraStatus is reported for the updates only found in the target, which are never deleted
+	ExtraStatus  Status = "extra"
+	FailedStatus Status = "failed"
+)
+
+type Result struct {
+	// App is the id of the app the update belongs to, empty for the default app
+	App            string `json:"app,omitempty"`
+	Branch         string `json:"branch,omitempty"`
+	RuntimeVersion string `json:"runtimeVersion,omitempty"`
+	UpdateId       string `json:"updateId,omitempty"`
+	Folder         string `json:"folder"`
+	Status         Status `json:"status"`
+	Files          int    `json:"files"`
+	MissingFiles   int    `json:"missingFiles"`
+	ChangedFiles   int    `json:"changedFiles"`
+	CopiedBytes    int64  `json:"copiedBytes"`
+	Error          string `json:"error,omitempty"`
+}
+
+// Report lists every folder that is not identical in both buckets.
+type Report struct {
+	DryRun      bool     `json:"dryRun"`
+	Folders     int      `json:"folders"`
+	Identical   int      `json:"identical"`
+	Copied      int      `json:"copied"`
+	Failed      int      `json:"failed"`
+	Extra       int      `json:"extra"`
+	CopiedBytes int64    `json:"copiedBytes"`
+	Results     []Result `json:"results"`
+	Duration    string   `json:"duration"`
+}
+
+type Progress struct {
+	Folders int
+	Done    int
+	Copied  int
+	Failed  int
+}
+
+type folder struct {
+	prefix string
+	// root is the folder of the app in the bucket, empty for the default app
+	root string
+	app  string
+	// update is nil for the objects of the server
+	update *types.Update
+}
+
+func objectStorage(b bucket.Bucket, role string) (bucket.ObjectStorage, error) {
+	storage, ok := b.(bucket.ObjectStorage)
+	if !ok {
+		return nil, fmt.Errorf("%s bucket %T does not support listing its objects", role, b)
+	}
+	return storage, nil
+}
+
+func updateFolder(u types.Update) string {
+	return u.Branch + "/" + u.RuntimeVersion + "/" + u.UpdateId + "/"
+}
+
+func listUpdates(b bucket.Bucket) ([]types.Update, error) {
+	var updates []types.Update
+	branches, err := b.GetBranches()
+	if err != nil {
+		return nil, fmt.Errorf("error listing branches: %w", err)
+	}
+	for _, branch := range branches {
+		runtimeVersions, err := b.GetRuntimeVersions(branch)
+		if err != nil {
+			return nil, fmt.Errorf("error listing runtime versions of branch %s: %w", branch, err)
+		}
+		for _, runtimeVersion := range runtimeVersions {
+			rvUpdates, err := b.GetUpdates(branch, runtimeVersion.RuntimeVersion)
+			if err != nil {
+				return nil, fmt.Errorf("error listing updates of %s/%s: %w", branch, runtimeVersion.RuntimeVersion, err)
+			}
+			updates = append(updates, rvUpdates...)
+		}
+	}
+	return updates, nil
+}
+
+// listApps returns the ids of the apps hosted next to the default one, whose updates are kept in the AppsFolder.
+func listApps(storage bucket.ObjectStorage) ([]string, error) {
+	keys, err := storage.ListObjects(bucket.AppsFolder + "/")
+	if err != nil {
+		return nil, fmt.Errorf("error listing apps: %w", err)
+	}
+	var apps []string
+	for _, key := range keys {
+		app := strings.SplitN(strings.TrimPrefix(key, bucket.AppsFolder+"/"), "/", 2)[0]
+		if len(apps) == 0 || apps[len(apps)-1] != app {
+			apps = append(apps, app)
+		}
+	}
+	return apps, nil
+}
+
+// listFolders lists the update folders of b, the ones of its apps included, along with the folders of the
+// server when internal is set.
+func listFolders(b bucket.Bucket, storage bucket.ObjectStorage, internal bool) ([]folder, error) {
+	var folders []folder
+	updates, err := listUpdates(b)
+	if err != nil {
+		return nil, err
+	}
+	for i := range updates {
+		folders = append(folders, folder{prefix: updateFolder(updates[i]), update: &updates[i]})
+	}
+	if internal {
+		folders = append(folders, folder{prefix: bucket.InternalFolder + "/"})
+	}
+	apps, err := listApps(storage)
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range apps {
+		appBucket, err := bucket.AppFolder(b, app)
+		if err != nil {
+			return nil, fmt.Errorf("error opening the folder of app %s: %w", app, err)
+		}
+		updates, err := listUpdates(appBucket)
+		if err != nil {
+			return nil, fmt.Errorf("error listing updates of app %s: %w", app, err)
+		}
+		root := bucket.AppsFolder + "/" + app + "/"
+		for i := range updates {
+			folders = append(folders, folder{prefix: root + updateFolder(updates[i]), root: root, app: app, update: &updates[i]})
+		}
+		if internal {
+			folders = append(folders, folder{prefix: root + bucket.InternalFolder + "/", root: root, app: app})
+		}
+	}
+	return folders, nil
+}
+
+// Migrate copies every update of source, the ones of the apps kept in its AppsFolder included, with its
+// marker files, into target. The commit marker of an update is copied last so that the target never serves
+// a partial copy, and the files already identical in the target are skipped, so an interrupted migration
+// resumes where it stopped when run again.
+// Every copied file is read back from the target and compared to the source.
+func Migrate(source bucket.Bucket, target bucket.Bucket, options Options, onProgress func(Progress)) (Report, error) {
+	start := time.Now()
+	report := Report{DryRun: options.DryRun, Results: []Result{}}
+	sourceStorage, err := objectStorage(source, "source")
+	if err != nil {
+		return report, err
+	}
+	targetStorage, err := objectStorage(target, "target")
+	if err != nil {
+		return report, err
+	}
+	folders, err := listFolders(source, sourceStorage, options.Internal)
+	if err != nil {
+		return report, fmt.Errorf("error listing source updates: %w", err)
+	}
+	targetFolders, err := listFolders(target, targetStorage, false)
+	if err != nil {
+		return report, fmt.Errorf("error listing target updates: %w", err)
+	}
+
+	inSource := map[string]bool{}
+	for _, f := range folders {
+		inSource[f.prefix] = true
+	}
+	for _, f := range targetFolders {
+		if !inSource[f.prefix] {
+			u := f.update
+			report.Results = append(report.Results, Result{App: f.app, Branch: u.Branch, RuntimeVersion: u.RuntimeVersion, UpdateId: u.UpdateId, Folder: f.prefix, Status: ExtraStatus})
+			report.Extra++
+		}
+	}
+	report.Folders = len(folders)
+
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	m := &migration{source: sourceStorage, target: targetStorage, options: options}
+	jobs := make(chan folder)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	progress := Progress{Folders: len(folders)}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				result := m.copyFolder(f)
+				mu.Lock()
+				progress.Done++
+				switch result.Status {
+				case IdenticalStatus:
+					report.Identical++
+				case FailedStatus:
+					report.Failed++
+					progress.Failed++
+				case CopiedStatus:
+					report.Copied++
+					progress.Copied++
+				}
+				report.CopiedBytes += result.CopiedBytes
+				if result.Status != IdenticalStatus {
+					report.Results = append(report.Results, result)
+				}
+				if onProgress != nil {
+					onProgress(progress)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, f := range folders {
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(report.Results, func(i, j int) bool {
+		return report.Results[i].Folder < report.Results[j].Folder
+	})
+	report.Duration = time.Since(start).String()
+	return report, nil
+}
+
+type migration struct {
+	source  bucket.ObjectStorage
+	target  bucket.ObjectStorage
+	options Options
+}
+
+func readObject(storage bucket.ObjectStorage, key string) ([]byte, error) {
+	reader, err := storage.GetObject(key)
+	if err != nil {
+		return nil, err
+	}
+	return bucket.ConvertReadCloserToBytes(reader)
+}
+
+func (m *migration) listKeys(storage bucket.ObjectStorage, f folder) ([]string, error) {
+	keys, err := storage.ListObjects(f.prefix)
+	if err != nil {
+		return nil, err
+	}
+	if f.update != nil {
+		return keys, nil
+	}
+	// The chunks of the uploads in progress only make sense to the server that received them
+	var kept []string
+	for _, key := range keys {
+		if !strings.HasPrefix(key, f.root+bucket.PartialUploadsFolder+"/") {
+			kept = append(kept, key)
+		}
+	}
+	return kept, nil
+}
+
+func (m *migration) copyFolder(f folder) Result {
+	result := Result{App: f.app, Folder: f.prefix}
+	if f.update != nil {
+		result.Branch, result.RuntimeVersion, result.UpdateId = f.update.Branch, f.update.RuntimeVersion, f.update.UpdateId
+	}
+	if err := m.copyFiles(f, &result); err != nil {
+		result.Status = FailedStatus
+		result.Error = err.Error()
+		return result
+	}
+	switch {
+	case result.MissingFiles+result.ChangedFiles == 0:
+		result.Status = IdenticalStatus
+	case !m.options.DryRun:
+		result.Status = CopiedStatus
+	case result.MissingFiles == result.Files:
+		result.Status = MissingStatus
+	default:
+		result.Status = IncompleteStatus
+	}
+	return result
+}
+
+func (m *migration) copyFiles(f folder, result *Result) error {
+	sourceKeys, err := m.listKeys(m.source, f)
+	if err != nil {
+		return fmt.Errorf("error listing source files: %w", err)
+	}
+	targetKeys, err := m.listKeys(m.target, f)
+	if err != nil {
+		return fmt.Errorf("error listing target files: %w", err)
+	}
+	inTarget := map[string]bool{}
+	for _, key := range targetKeys {
+		inTarget[key] = true
+	}
+	result.Files = len(sourceKeys)
+
+	commitKey := f.prefix + update.CommitFile
+	if f.update != nil && !m.options.Verify && inTarget[commitKey] {
+		complete := true
+		for _, key := range sourceKeys {
+			complete = complete && inTarget[key]
+		}
+		if complete {
+			return nil
+		}
+	}
+
+	// The commit marker goes last, once every other file is in place
+	sort.SliceStable(sourceKeys, func(i, j int) bool {
+		return sourceKeys[i] != commitKey && sourceKeys[j] == commitKey
+	})
+	for _, key := range sourceKeys {
+		if !inTarget[key] {
+			result.MissingFiles++
+			if m.options.DryRun {
+				continue
+			}
+		}
+		content, err := readObject(m.source, key)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", key, err)
+		}
+		checksum := sha256.Sum256(content)
+		if inTarget[key] {
+			existing, err := readObject(m.target, key)
+			if err != nil {
+				return fmt.Errorf("error reading %s from target: %w", key, err)
+			}
+			if sha256.Sum256(existing) == checksum {
+				continue
+			}
+			result.ChangedFiles++
+		}
+		if m.options.DryRun {
+			continue
+		}
+		if err := m.copyObject(key, content, checksum); err != nil {
+			return err
+		}
+		result.CopiedBytes += int64(len(content))
+	}
+	return nil
+}
+
+func (m *migration) copyObject(key string, content []byte, checksum [sha256.Size]byte) error {
+	if err := m.target.PutObject(key, bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	copied, err := readObject(m.target, key)
+	if err != nil {
+		return fmt.Errorf("error reading back %s: %w", key, err)
+	}
+	if sha256.Sum256(copied) != checksum {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, key)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package storageMigration
+
+import (
+	"bytes"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"expo-open-ota/testkit"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var createdAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func sourceBucket(t *testing.T) (*bucket.MemoryBucket, []types.Update) {
+	source := bucket.NewMemoryBucket()
+	var updates []types.Update
+	for i, builder := range []*testkit.UpdateBuilder{
+		testkit.NewUpdate("main", "1", createdAt).WithBundle("ios", "first").WithAsset("ios", "png", "image"),
+		testkit.NewUpdate("main", "2", createdAt.Add(time.Hour)).WithBundle("android", "second"),
+		testkit.NewUpdate("staging", "1", createdAt.Add(2*time.Hour)).WithBundle("ios", "uploading").Uncommitted(),
+	} {
+		u, err := builder.Build(source)
+		assert.Nil(t, err, i)
+		updates = append(updates, u)
+	}
+	return source, updates
+}
+
+func objects(t *testing.T, storage bucket.ObjectStorage) map[string]string {
+	keys, err := storage.ListObjects("")
+	assert.Nil(t, err)
+	contents := map[string]string{}
+	for _, key := range keys {
+		content, err := readObject(storage, key)
+		assert.Nil(t, err)
+		contents[key] = string(content)
+	}
+	return contents
+}
+
+func TestMigrateCopiesEveryUpdate(t *testing.T) {
+	source, updates := sourceBucket(t)
+	target := bucket.NewMemoryBucket()
+
+	report, err := Migrate(source, target, Options{}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Folders)
+	assert.Equal(t, 3, report.Copied)
+	assert.Equal(t, 0, report.Failed)
+	assert.Greater(t, report.CopiedBytes, int64(0))
+	assert.Equal(t, objects(t, source), objects(t, target))
+	_, err = target.GetFile(updates[2], update.CommitFile)
+	assert.Error(t, err)
+
+	report, err = Migrate(source, target, Options{Verify: true}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Identical)
+	assert.Equal(t, 0, report.Copied)
+	assert.Empty(t, report.Results)
+}
+
+func TestDryRunReportsTheDifferences(t *testing.T) {
+	source, updates := sourceBucket(t)
+	target := bucket.NewMemoryBucket()
+	_, err := Migrate(source, target, Options{}, nil)
+	assert.Nil(t, err)
+	// An interrupted copy, the commit marker and a file missing
+	assert.Nil(t, target.DeleteObject(updateFolder(updates[0])+update.CommitFile))
+	assert.Nil(t, target.DeleteObject(updateFolder(updates[0])+"metadata.json"))
+	assert.Nil(t, target.DeleteUpdateFolder(updates[1].Branch, updates[1].RuntimeVersion, updates[1].UpdateId))
+	extra, err := testkit.NewUpdate("main", "1", createdAt.Add(time.Minute)).WithBundle("ios", "extra").Build(target)
+	assert.Nil(t, err)
+	before := objects(t, target)
+
+	report, err := Migrate(source, target, Options{DryRun: true}, nil)
+	assert.Nil(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Identical)
+	assert.Equal(t, 1, report.Extra)
+	assert.Equal(t, 0, report.Copied)
+	assert.Equal(t, before, objects(t, target))
+	statuses := map[string]Status{}
+	for _, result := range report.Results {
+		statuses[result.UpdateId] = result.Status
+	}
+	assert.Equal(t, map[string]Status{updates[0].UpdateId: IncompleteStatus, updates[1].UpdateId: MissingStatus, extra.UpdateId: ExtraStatus}, statuses)
+	assert.Equal(t, 2, report.Results[0].MissingFiles)
+
+	report, err = Migrate(source, target, Options{}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Copied)
+	after := objects(t, target)
+	for key, content := range objects(t, source) {
+		assert.Equal(t, content, after[key], key)
+	}
+	assert.Contains(t, after, updateFolder(extra)+update.CommitFile)
+}
+
+func TestVerifyComparesCommittedUpdates(t *testing.T) {
+	source, updates := sourceBucket(t)
+	target := bucket.NewMemoryBucket()
+	_, err := Migrate(source, target, Options{}, nil)
+	assert.Nil(t, err)
+	key := updateFolder(updates[1]) + "update-metadata.json"
+	assert.Nil(t, target.PutObject(key, strings.NewReader("corrupted")))
+
+	report, err := Migrate(source, target, Options{}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, report.Copied)
+
+	report, err = Migrate(source, target, Options{Verify: true, Concurrency: 1}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Copied)
+	assert.Equal(t, 1, report.Results[0].ChangedFiles)
+	assert.Equal(t, objects(t, source), objects(t, target))
+}
+
+// corruptingBucket alters the objects written, as a faulty storage would
+type corruptingBucket struct {
+	*bucket.MemoryBucket
+}
+
+func (b corruptingBucket) PutObject(key string, body io.Reader) error {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return b.MemoryBucket.PutObject(key, bytes.NewReader(append(content, '!')))
+}
+
+func TestChecksumMismatchFailsTheUpdate(t *testing.T) {
+	source, updates := sourceBucket(t)
+	target := corruptingBucket{bucket.NewMemoryBucket()}
+
+	var last Progress
+	report, err := Migrate(source, target, Options{}, func(progress Progress) {
+		last = progress
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Failed)
+	assert.Equal(t, Progress{Folders: 3, Done: 3, Failed: 3}, last)
+	assert.Contains(t, report.Results[0].Error, ErrChecksumMismatch.Error())
+	// The copy stops at the first corrupted file, the update is never committed in the target
+	_, err = target.GetFile(updates[0], update.CommitFile)
+	assert.Error(t, err)
+}
+
+func TestInternalObjects(t *testing.T) {
+	source, _ := sourceBucket(t)
+	target := bucket.NewMemoryBucket()
+	audit := bucket.InternalFolder + "/audit/2024/05/01/event.json"
+	assert.Nil(t, source.PutObject(audit, strings.NewReader("{}")))
+	assert.Nil(t, source.PutObject(bucket.PartialUploadsFolder+"/chunk", strings.NewReader("partial")))
+
+	_, err := Migrate(source, target, Options{}, nil)
+	assert.Nil(t, err)
+	assert.NotContains(t, objects(t, target), audit)
+
+	report, err := Migrate(source, target, Options{Internal: true}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Copied)
+	assert.Equal(t, bucket.InternalFolder+"/", report.Results[0].Folder)
+	copied := objects(t, target)
+	assert.Equal(t, "{}", copied[audit])
+	assert.NotContains(t, copied, bucket.PartialUploadsFolder+"/chunk")
+}
+
+func TestMigrateCopiesTheUpdatesOfEveryApp(t *testing.T) {
+	source := &bucket.LocalBucket{BasePath: t.TempDir()}
+	target := &bucket.LocalBucket{BasePath: t.TempDir()}
+	_, err := testkit.NewUpdate("main", "1", createdAt).WithBundle("ios", "default").Build(source)
+	assert.Nil(t, err)
+	sourceApp, err := bucket.AppFolder(source, "second")
+	assert.Nil(t, err)
+	appUpdate, err := testkit.NewUpdate("main", "1", createdAt).WithBundle("ios", "second").Build(sourceApp)
+	assert.Nil(t, err)
+	root := bucket.AppsFolder + "/second/"
+	audit := root + bucket.InternalFolder + "/audit/2024/05/01/event.json"
+	assert.Nil(t, source.PutObject(audit, strings.NewReader("{}")))
+	assert.Nil(t, source.PutObject(root+bucket.PartialUploadsFolder+"/chunk", strings.NewReader("partial")))
+
+	report, err := Migrate(source, target, Options{Internal: true}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, report.Folders)
+	assert.Equal(t, 3, report.Copied)
+	appFolder := root + updateFolder(appUpdate)
+	results := map[string]Result{}
+	for _, result := range report.Results {
+		results[result.Folder] = result
+	}
+	assert.Equal(t, "second", results[appFolder].App)
+	assert.Equal(t, appUpdate.UpdateId, results[appFolder].UpdateId)
+	assert.Equal(t, CopiedStatus, results[appFolder].Status)
+	assert.Equal(t, CopiedStatus, results[root+bucket.InternalFolder+"/"].Status)
+	copied := objects(t, target)
+	assert.Contains(t, copied, appFolder+update.CommitFile)
+	assert.Equal(t, "{}", copied[audit])
+	assert.NotContains(t, copied, root+bucket.PartialUploadsFolder+"/chunk")
+
+	// The updates of an app only found in the target are reported, never deleted
+	targetApp, err := bucket.AppFolder(target, "third")
+	assert.Nil(t, err)
+	extra, err := testkit.NewUpdate("main", "1", createdAt).WithBundle("ios", "third").Build(targetApp)
+	assert.Nil(t, err)
+	report, err = Migrate(source, target, Options{}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Identical)
+	assert.Equal(t, 1, report.Extra)
+	assert.Equal(t, "third", report.Results[0].App)
+	assert.Equal(t, bucket.AppsFolder+"/third/"+updateFolder(extra), report.Results[0].Folder)
+}
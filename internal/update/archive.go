@@ -0,0 +1,313 @@
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/crypto"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// An archive is a tar.gz holding manifest.json first, then its signature and the files of the update under files/.
+const (
+	archiveVersion       = 1
+	archiveManifestName  = "manifest.json"
+	archiveSignatureName = "manifest.json.sig"
+	archiveFilesFolder   = "files/"
+	maxArchiveManifest   = 1 << 20
+)
+
+var (
+	ErrInvalidArchive   = errors.New("invalid archive")
+	ErrArchiveSignature = errors.New("archive signature does not match any trusted key")
+)
+
+type ArchiveFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+type ArchiveManifest struct {
+	Version        int           `json:"version"`
+	Branch         string        `json:"branch"`
+	RuntimeVersion string        `json:"runtimeVersion"`
+	UpdateId       string        `json:"updateId"`
+	ExportedAt     time.Time     `json:"exportedAt"`
+	Files          []ArchiveFile `json:"files"`
+}
+
+// MaxArchiveSize is the largest archive accepted by the import route, ARCHIVE_MAX_BYTES.
+func MaxArchiveSize() int64 {
+	return config.GetIntEnv("ARCHIVE_MAX_BYTES", 1)
+}
+
+func invalidArchive(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidArchive, fmt.Sprintf(format, args...))
+}
+
+// ArchivePublicKeys returns the keys the imported archives are verified with: the public key of the
+// server and the one found at ARCHIVE_PUBLIC_KEY_PATH, if set.
+func ArchivePublicKeys(serverPublicKey string) ([]string, error) {
+	keys := []string{serverPublicKey}
+	if path := config.GetEnv("ARCHIVE_PUBLIC_KEY_PATH"); path != "" {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive public key: %w", err)
+		}
+		keys = append(keys, string(key))
+	}
+	return keys, nil
+}
+
+func (m *Manager) archivedFiles(update types.Update) ([]string, error) {
+	storage, err := m.objectStorage()
+	if err != nil {
+		return nil, err
+	}
+	folder := update.Branch + "/" + update.RuntimeVersion + "/" + update.UpdateId + "/"
+	keys, err := storage.ListObjects(folder)
+	if err != nil {
+		return nil, fmt.Errorf("error listing files of update %s: %w", update.UpdateId, err)
+	}
+	var paths []string
+	for _, key := range keys {
+		// The commit names the update it was written for, the import commits the copy again
+		if path := strings.TrimPrefix(key, folder); path != CommitFile {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+func (m *Manager) hashFile(update types.Update, path string) (ArchiveFile, error) {
+	file, err := m.bucket.GetFile(update, path)
+	if err != nil || file.Reader == nil {
+		return ArchiveFile{}, fmt.Errorf("error reading %s of update %s: %w", path, update.UpdateId, err)
+	}
+	defer file.Reader.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file.Reader)
+	if err != nil {
+		return ArchiveFile{}, fmt.Errorf("error reading %s of update %s: %w", path, update.UpdateId, err)
+	}
+	return ArchiveFile{Path: path, Size: size, Sha256: hex.EncodeToString(hasher.Sum(nil))}, nil
+}
+
+// ExportUpdate writes a committed update as an archive signed with privateKey, which ImportUpdate
+// publishes again on any server trusting the matching public key.
+func (m *Manager) ExportUpdate(update types.Update, w io.Writer, privateKey string) (ArchiveManifest, error) {
+	manifest := ArchiveManifest{
+		Version:        archiveVersion,
+		Branch:         update.Branch,
+		RuntimeVersion: update.RuntimeVersion,
+		UpdateId:       update.UpdateId,
+		ExportedAt:     time.Now().UTC(),
+	}
+	if !m.IsUpdateValid(update) {
+		return manifest, fmt.Errorf("%w: %s/%s/%s", ErrUpdateNotFound, update.Branch, update.RuntimeVersion, update.UpdateId)
+	}
+	paths, err := m.archivedFiles(update)
+	if err != nil {
+		return manifest, err
+	}
+	for _, path := range paths {
+		file, err := m.hashFile(update, path)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Files = append(manifest.Files, file)
+	}
+	encodedManifest, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	signature, err := crypto.SignRSASHA256(string(encodedManifest), privateKey)
+	if err != nil {
+		return manifest, fmt.Errorf("error signing archive: %w", err)
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	writeEntry := func(name string, size int64, content io.Reader) error {
+		header := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: manifest.ExportedAt, Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := io.Copy(tarWriter, content)
+		return err
+	}
+	if err := writeEntry(archiveManifestName, int64(len(encodedManifest)), bytes.NewReader(encodedManifest)); err != nil {
+		return manifest, fmt.Errorf("error writing archive: %w", err)
+	}
+	if err := writeEntry(archiveSignatureName, int64(len(signature)), strings.NewReader(signature)); err != nil {
+		return manifest, fmt.Errorf("error writing archive: %w", err)
+	}
+	for _, archived := range manifest.Files {
+		file, err := m.bucket.GetFile(update, archived.Path)
+		if err != nil || file.Reader == nil {
+			return manifest, fmt.Errorf("error reading %s of update %s: %w", archived.Path, update.UpdateId, err)
+		}
+		err = writeEntry(archiveFilesFolder+archived.Path, archived.Size, file.Reader)
+		file.Reader.Close()
+		if err != nil {
+			return manifest, fmt.Errorf("error writing %s into archive: %w", archived.Path, err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return manifest, fmt.Errorf("error writing archive: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return manifest, fmt.Errorf("error writing archive: %w", err)
+	}
+	return manifest, nil
+}
+
+func readArchiveEntry(tarReader *tar.Reader, name string) ([]byte, error) {
+	header, err := tarReader.Next()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing %s: %w", ErrInvalidArchive, name, err)
+	}
+	if header.Name != name || header.Size > maxArchiveManifest {
+		return nil, invalidArchive("expected %s, found %s", name, header.Name)
+	}
+	content, err := io.ReadAll(tarReader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	return content, nil
+}
+
+func verifyArchiveManifest(encodedManifest []byte, signature []byte, publicKeys []string) (ArchiveManifest, error) {
+	var manifest ArchiveManifest
+	verified := false
+	for _, publicKey := range publicKeys {
+		if publicKey != "" && crypto.VerifyRSASHA256(string(encodedManifest), string(signature), publicKey) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return manifest, ErrArchiveSignature
+	}
+	if err := json.Unmarshal(encodedManifest, &manifest); err != nil {
+		return manifest, invalidArchive("unparsable manifest: %v", err)
+	}
+	if manifest.Version != archiveVersion {
+		return manifest, invalidArchive("unsupported version %d", manifest.Version)
+	}
+	if err := bucket.ValidateRuntimeVersion(manifest.RuntimeVersion); err != nil {
+		return manifest, invalidArchive("%v", err)
+	}
+	if len(manifest.Files) == 0 {
+		return manifest, invalidArchive("no files")
+	}
+	seen := map[string]bool{}
+	for _, file := range manifest.Files {
+		cleaned, err := bucket.CleanAssetPath(file.Path)
+		if err != nil || cleaned != file.Path || file.Path == CommitFile || seen[file.Path] {
+			return manifest, invalidArchive("unexpected file %q", file.Path)
+		}
+		seen[file.Path] = true
+	}
+	return manifest, nil
+}
+
+// hashingReader hashes an archive entry while it is written into the bucket.
+type hashingReader struct {
+	reader io.Reader
+	hasher hash.Hash
+}
+
+func (r hashingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hasher.Write(p[:n])
+	return n, err
+}
+
+// ImportUpdate checks the signature of an archive against publicKeys and the hash of every file, then
+// publishes its update as the latest one of its runtime version on branch. Nothing is served until every
+// file is verified: the copy is only committed last, and removed when the archive turns out invalid.
+func (m *Manager) ImportUpdate(r io.Reader, branch string, publicKeys []string) (types.Update, ArchiveManifest, error) {
+	var manifest ArchiveManifest
+	if err := bucket.ValidateBranch(branch); err != nil {
+		return types.Update{}, manifest, err
+	}
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return types.Update{}, manifest, fmt.Errorf("%w: not a gzip file: %w", ErrInvalidArchive, err)
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	encodedManifest, err := readArchiveEntry(tarReader, archiveManifestName)
+	if err != nil {
+		return types.Update{}, manifest, err
+	}
+	signature, err := readArchiveEntry(tarReader, archiveSignatureName)
+	if err != nil {
+		return types.Update{}, manifest, err
+	}
+	manifest, err = verifyArchiveManifest(encodedManifest, signature, publicKeys)
+	if err != nil {
+		return types.Update{}, manifest, err
+	}
+
+	imported := newUpdate(branch, manifest.RuntimeVersion)
+	if err := m.importFiles(tarReader, imported, manifest); err != nil {
+		if deleteErr := m.bucket.DeleteUpdateFolder(imported.Branch, imported.RuntimeVersion, imported.UpdateId); deleteErr != nil {
+			return imported, manifest, errors.Join(err, deleteErr)
+		}
+		return imported, manifest, err
+	}
+	if err := m.MarkUpdateAsChecked(imported); err != nil {
+		return imported, manifest, err
+	}
+	return imported, manifest, nil
+}
+
+func (m *Manager) importFiles(tarReader *tar.Reader, imported types.Update, manifest ArchiveManifest) error {
+	expected := map[string]ArchiveFile{}
+	for _, file := range manifest.Files {
+		expected[file.Path] = file
+	}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+		file, ok := expected[strings.TrimPrefix(header.Name, archiveFilesFolder)]
+		if !ok || !strings.HasPrefix(header.Name, archiveFilesFolder) || header.Typeflag != tar.TypeReg {
+			return invalidArchive("unexpected entry %s", header.Name)
+		}
+		if header.Size != file.Size {
+			return invalidArchive("size of %s does not match the manifest", file.Path)
+		}
+		delete(expected, file.Path)
+		reader := hashingReader{reader: tarReader, hasher: sha256.New()}
+		if err := m.bucket.UploadFileIntoUpdate(imported, file.Path, reader); err != nil {
+			return fmt.Errorf("error writing %s into update %s: %w", file.Path, imported.UpdateId, err)
+		}
+		if hex.EncodeToString(reader.hasher.Sum(nil)) != file.Sha256 {
+			return invalidArchive("checksum of %s does not match the manifest", file.Path)
+		}
+	}
+	for path := range expected {
+		return invalidArchive("missing %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"time"
+)
+
+// CommitFile is written last when an update is marked as uploaded, in a single write, so that a folder
+// holding a partial upload is never served.
+const CommitFile = ".check"
+
+const commitVersion = 1
+
+var ErrUpdateNotCommitted = errors.New("update is not committed")
+
+type Commit struct {
+	Version        int       `json:"version"`
+	Branch         string    `json:"branch"`
+	RuntimeVersion string    `json:"runtimeVersion"`
+	UpdateId       string    `json:"updateId"`
+	CommittedAt    time.Time `json:"committedAt"`
+}
+
+func NewCommit(update types.Update) Commit {
+	return Commit{
+		Version:        commitVersion,
+		Branch:         update.Branch,
+		RuntimeVersion: update.RuntimeVersion,
+		UpdateId:       update.UpdateId,
+		CommittedAt:    time.Now().UTC(),
+	}
+}
+
+func (m *Manager) commitUpdate(update types.Update) error {
+	commit, err := json.Marshal(NewCommit(update))
+	if err != nil {
+		return err
+	}
+	if err := m.bucket.UploadFileIntoUpdate(update, CommitFile, bytes.NewReader(commit)); err != nil {
+		return fmt.Errorf("error writing commit of update %s: %w", update.UpdateId, err)
+	}
+	return nil
+}
+
+// ReadCommit returns the commit of an update, truncated commits or commits copied from another update are refused.
+func (m *Manager) ReadCommit(update types.Update) (*Commit, error) {
+	file, err := m.bucket.GetFile(update, CommitFile)
+	if err != nil || file.Reader == nil {
+		return nil, ErrUpdateNotCommitted
+	}
+	defer file.Reader.Close()
+	content, err := io.ReadAll(file.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading commit: %w", err)
+	}
+	if len(content) == 0 {
+		return nil, fmt.Errorf("%w: empty commit", ErrUpdateNotCommitted)
+	}
+	// Markers written before commits named their update only had to exist, whatever their content
+	if content[0] != '{' {
+		return &Commit{Branch: update.Branch, RuntimeVersion: update.RuntimeVersion, UpdateId: update.UpdateId}, nil
+	}
+	var commit Commit
+	if err := json.Unmarshal(content, &commit); err != nil {
+		return nil, fmt.Errorf("%w: unreadable commit: %v", ErrUpdateNotCommitted, err)
+	}
+	if commit.Version != commitVersion {
+		return nil, fmt.Errorf("%w: unsupported commit version %d", ErrUpdateNotCommitted, commit.Version)
+	}
+	if commit.Branch != update.Branch || commit.RuntimeVersion != update.RuntimeVersion || commit.UpdateId != update.UpdateId {
+		return nil, fmt.Errorf("%w: commit belongs to another update", ErrUpdateNotCommitted)
+	}
+	return &commit, nil
+}
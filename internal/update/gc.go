@@ -0,0 +1,100 @@
+package update
+
+import (
+	"expo-open-ota/internal/types"
+	"fmt"
+	"time"
+)
+
+type GCOptions struct {
+	// Committed updates of a runtime version beyond the KeepUpdates latest ones are deleted, 0 keeps them all.
+	// The latest committed update of a runtime version is never deleted.
+	KeepUpdates int
+	// Updates younger than MinAge are never deleted, so that uploads in progress are left alone
+	MinAge time.Duration
+	DryRun bool
+}
+
+type GCReason string
+
+const (
+	UncommittedReason GCReason = "uncommitted"
+	SupersededReason  GCReason = "superseded"
+)
+
+type GCDeletion struct {
+	Branch         string   `json:"branch"`
+	RuntimeVersion string   `json:"runtimeVersion"`
+	UpdateId       string   `json:"updateId"`
+	Reason         GCReason `json:"reason"`
+}
+
+type GCReport struct {
+	DryRun   bool         `json:"dryRun"`
+	Scanned  int          `json:"scanned"`
+	Deleted  []GCDeletion `json:"deleted"`
+	Duration string       `json:"duration"`
+}
+
+// CollectGarbage deletes the update folders that were never committed and, with KeepUpdates, the old
+// committed updates of every runtime version. With DryRun, the report lists what would be deleted.
+func (m *Manager) CollectGarbage(options GCOptions) (GCReport, error) {
+	start := time.Now()
+	report := GCReport{DryRun: options.DryRun, Deleted: []GCDeletion{}}
+	branches, err := m.bucket.GetBranches()
+	if err != nil {
+		return report, fmt.Errorf("error listing branches: %w", err)
+	}
+	for _, branch := range branches {
+		runtimeVersions, err := m.bucket.GetRuntimeVersions(branch)
+		if err != nil {
+			return report, fmt.Errorf("error listing runtime versions of branch %s: %w", branch, err)
+		}
+		for _, runtimeVersion := range runtimeVersions {
+			updates, err := m.bucket.GetUpdates(branch, runtimeVersion.RuntimeVersion)
+			if err != nil {
+				return report, fmt.Errorf("error listing updates of %s/%s: %w", branch, runtimeVersion.RuntimeVersion, err)
+			}
+			for _, deletion := range m.garbageOf(sortUpdates(updates), options, start) {
+				if !options.DryRun {
+					if err := m.DeleteUpdate(types.Update{Branch: deletion.Branch, RuntimeVersion: deletion.RuntimeVersion, UpdateId: deletion.UpdateId}); err != nil {
+						return report, err
+					}
+				}
+				report.Deleted = append(report.Deleted, deletion)
+			}
+			report.Scanned += len(updates)
+		}
+	}
+	report.Duration = time.Since(start).String()
+	return report, nil
+}
+
+// garbageOf picks the updates to delete among the updates of a runtime version, sorted from the latest.
+func (m *Manager) garbageOf(updates []types.Update, options GCOptions, now time.Time) []GCDeletion {
+	var garbage []GCDeletion
+	committed := 0
+	for _, update := range updates {
+		isCommitted := m.isUpdateCheckedInBucket(update)
+		if isCommitted {
+			committed++
+		}
+		if now.Sub(updateCreatedAt(update)) < options.MinAge {
+			continue
+		}
+		reason := UncommittedReason
+		if isCommitted {
+			if options.KeepUpdates <= 0 || committed <= max(options.KeepUpdates, 1) {
+				continue
+			}
+			reason = SupersededReason
+		}
+		garbage = append(garbage, GCDeletion{
+			Branch:         update.Branch,
+			RuntimeVersion: update.RuntimeVersion,
+			UpdateId:       update.UpdateId,
+			Reason:         reason,
+		})
+	}
+	return garbage
+}
@@ -0,0 +1,53 @@
+package update
+
+import (
+	"expo-open-ota/config"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/metadataStore"
+)
+
+// Manager reads the updates of a bucket, caching the metadata and manifests it computes.
+type Manager struct {
+	bucket  bucket.Bucket
+	cache   cache2.Cache
+	store   metadataStore.MetadataStore
+	baseURL string
+}
+
+// NewManager indexes the updates in store, which may be nil to derive every listing from the bucket.
+func NewManager(resolvedBucket bucket.Bucket, cache cache2.Cache, store metadataStore.MetadataStore) *Manager {
+	return &Manager{bucket: resolvedBucket, cache: cache, store: store}
+}
+
+// NewAppManager reads the updates of one of the apps hosted by the deployment, whose routes are served
+// under baseURL. Its updates are read from the bucket only, the metadata store has no app dimension.
+func NewAppManager(resolvedBucket bucket.Bucket, cache cache2.Cache, baseURL string) *Manager {
+	return &Manager{bucket: resolvedBucket, cache: cache, baseURL: baseURL}
+}
+
+// DefaultManager uses the bucket, cache and metadata store configured by the environment.
+func DefaultManager() *Manager {
+	return NewManager(bucket.GetBucket(), cache2.GetCache(), metadataStore.GetMetadataStore())
+}
+
+func (m *Manager) Bucket() bucket.Bucket {
+	return m.bucket
+}
+
+func (m *Manager) Cache() cache2.Cache {
+	return m.cache
+}
+
+// BaseURL is the URL the routes reading the updates of the manager are served under.
+func (m *Manager) BaseURL() string {
+	if m.baseURL != "" {
+		return m.baseURL
+	}
+	return config.GetEnv("BASE_URL")
+}
+
+// MetadataStore is the store indexing the updates of the manager, nil when disabled or for apps other than the default one.
+func (m *Manager) MetadataStore() metadataStore.MetadataStore {
+	return m.store
+}
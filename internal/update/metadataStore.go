@@ -0,0 +1,115 @@
+package update
+
+import (
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/metadataStore"
+	"expo-open-ota/internal/types"
+	"log"
+	"strconv"
+	"time"
+)
+
+func RecordToUpdate(record metadataStore.UpdateRecord) types.Update {
+	return types.Update{
+		Branch:         record.Branch,
+		RuntimeVersion: record.RuntimeVersion,
+		UpdateId:       record.UpdateId,
+		CreatedAt:      time.Duration(record.CreatedAt.UnixMilli()) * time.Millisecond,
+	}
+}
+
+func updateCreatedAt(update types.Update) time.Time {
+	updateId, err := strconv.ParseInt(update.UpdateId, 10, 64)
+	if err != nil {
+		return time.UnixMilli(int64(update.CreatedAt / time.Millisecond)).UTC()
+	}
+	return time.UnixMilli(updateId).UTC()
+}
+
+// RecordUpdate registers a newly created (not yet verified) update in the metadata store, if enabled.
+func (m *Manager) RecordUpdate(update types.Update, platform string, commitHash string) error {
+	store := m.MetadataStore()
+	if store == nil {
+		return nil
+	}
+	record := metadataStore.NewUpdateRecord(update.Branch, update.RuntimeVersion, update.UpdateId, updateCreatedAt(update))
+	record.Platform = platform
+	record.CommitHash = commitHash
+	return store.UpsertUpdate(record)
+}
+
+// ForgetUpdate removes a deleted update from the metadata store, if enabled.
+func (m *Manager) ForgetUpdate(branch string, runtimeVersion string, updateId string) error {
+	store := m.MetadataStore()
+	if store == nil {
+		return nil
+	}
+	return store.DeleteUpdate(branch, runtimeVersion, updateId)
+}
+
+func (m *Manager) GetBranches() ([]string, error) {
+	if store := m.MetadataStore(); store != nil {
+		return store.GetBranches()
+	}
+	return m.bucket.GetBranches()
+}
+
+func (m *Manager) GetRuntimeVersions(branch string) ([]bucket.RuntimeVersionWithStats, error) {
+	if store := m.MetadataStore(); store != nil {
+		return store.GetRuntimeVersions(branch)
+	}
+	return m.bucket.GetRuntimeVersions(branch)
+}
+
+// buildRecordFromBucket reads the marker files of an update folder to build its metadata store record.
+func (m *Manager) buildRecordFromBucket(update types.Update) metadataStore.UpdateRecord {
+	record := metadataStore.NewUpdateRecord(update.Branch, update.RuntimeVersion, update.UpdateId, updateCreatedAt(update))
+	if m.isUpdateCheckedInBucket(update) {
+		record.Status = metadataStore.CheckedStatus
+	}
+	if m.getUpdateTypeFromBucket(update) == types.Rollback {
+		record.Type = metadataStore.RollbackUpdateRecord
+	}
+	commitHash, platform, err := m.RetrieveUpdateCommitHashAndPlatform(update)
+	if err == nil {
+		record.CommitHash = commitHash
+		record.Platform = platform
+	}
+	return record
+}
+
+// SyncMetadataStoreFromBucket walks every update of the bucket and upserts it in the metadata store.
+// It returns the number of synchronized updates.
+func (m *Manager) SyncMetadataStoreFromBucket() (int, error) {
+	store := m.MetadataStore()
+	if store == nil {
+		return 0, nil
+	}
+	resolvedBucket := m.bucket
+	branches, err := resolvedBucket.GetBranches()
+	if err != nil {
+		return 0, err
+	}
+	synchronized := 0
+	for _, branch := range branches {
+		runtimeVersions, err := resolvedBucket.GetRuntimeVersions(branch)
+		if err != nil {
+			log.Printf("Error listing runtime versions of branch %s: %v", branch, err)
+			continue
+		}
+		for _, runtimeVersion := range runtimeVersions {
+			updates, err := resolvedBucket.GetUpdates(branch, runtimeVersion.RuntimeVersion)
+			if err != nil {
+				log.Printf("Error listing updates of %s/%s: %v", branch, runtimeVersion.RuntimeVersion, err)
+				continue
+			}
+			for _, update := range updates {
+				if err := store.UpsertUpdate(m.buildRecordFromBucket(update)); err != nil {
+					return synchronized, err
+				}
+				synchronized++
+			}
+		}
+	}
+	return synchronized, nil
+}
@@ -0,0 +1,136 @@
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/dashboard"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUpdateNotFound = errors.New("update not found")
+
+func newUpdate(branch string, runtimeVersion string) types.Update {
+	createdAt := time.Now().UnixMilli()
+	return types.Update{
+		Branch:         branch,
+		RuntimeVersion: runtimeVersion,
+		UpdateId:       strconv.FormatInt(createdAt, 10),
+		CreatedAt:      time.Duration(createdAt) * time.Millisecond,
+	}
+}
+
+func (m *Manager) objectStorage() (bucket.ObjectStorage, error) {
+	storage, ok := m.bucket.(bucket.ObjectStorage)
+	if !ok {
+		return nil, errors.New("bucket does not support listing the files of an update")
+	}
+	return storage, nil
+}
+
+// PromoteUpdate republishes a committed update as the latest update of the same runtime version of
+// targetBranch. Promoting an older update to its own branch rolls the branch back to it.
+func (m *Manager) PromoteUpdate(source types.Update, targetBranch string) (types.Update, error) {
+	if err := bucket.ValidateBranch(targetBranch); err != nil {
+		return types.Update{}, err
+	}
+	if !m.IsUpdateValid(source) {
+		return types.Update{}, fmt.Errorf("%w: %s/%s/%s", ErrUpdateNotFound, source.Branch, source.RuntimeVersion, source.UpdateId)
+	}
+	storage, err := m.objectStorage()
+	if err != nil {
+		return types.Update{}, err
+	}
+	folder := source.Branch + "/" + source.RuntimeVersion + "/" + source.UpdateId + "/"
+	keys, err := storage.ListObjects(folder)
+	if err != nil {
+		return types.Update{}, fmt.Errorf("error listing files of update %s: %w", source.UpdateId, err)
+	}
+	target := newUpdate(targetBranch, source.RuntimeVersion)
+	for _, key := range keys {
+		path := strings.TrimPrefix(key, folder)
+		if path == CommitFile {
+			continue
+		}
+		file, err := m.bucket.GetFile(source, path)
+		if err != nil || file.Reader == nil {
+			return target, fmt.Errorf("error reading %s of update %s: %w", path, source.UpdateId, err)
+		}
+		err = m.bucket.UploadFileIntoUpdate(target, path, file.Reader)
+		file.Reader.Close()
+		if err != nil {
+			return target, fmt.Errorf("error copying %s into update %s: %w", path, target.UpdateId, err)
+		}
+	}
+	if err := m.MarkUpdateAsChecked(target); err != nil {
+		return target, err
+	}
+	return target, nil
+}
+
+// RollbackToEmbedded publishes a rollback directive, making the clients of the runtime version go back to
+// the update embedded in their build.
+func (m *Manager) RollbackToEmbedded(branch string, runtimeVersion string, platform string) (types.Update, error) {
+	if err := bucket.ValidateUpdatePath(branch, runtimeVersion, "0"); err != nil {
+		return types.Update{}, err
+	}
+	rollback := newUpdate(branch, runtimeVersion)
+	updateMetadata, err := json.Marshal(map[string]string{"platform": platform, "commitHash": ""})
+	if err != nil {
+		return rollback, err
+	}
+	if err := m.bucket.UploadFileIntoUpdate(rollback, "update-metadata.json", bytes.NewReader(updateMetadata)); err != nil {
+		return rollback, fmt.Errorf("error writing metadata of rollback %s: %w", rollback.UpdateId, err)
+	}
+	if err := m.bucket.UploadFileIntoUpdate(rollback, "rollback", strings.NewReader("rollback")); err != nil {
+		return rollback, fmt.Errorf("error writing rollback %s: %w", rollback.UpdateId, err)
+	}
+	if err := m.MarkUpdateAsChecked(rollback); err != nil {
+		return rollback, err
+	}
+	return rollback, nil
+}
+
+// DeleteUpdate removes the folder of an update, along with its record and the listings it appears in.
+func (m *Manager) DeleteUpdate(update types.Update) error {
+	exists, err := m.updateExists(update)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s/%s/%s", ErrUpdateNotFound, update.Branch, update.RuntimeVersion, update.UpdateId)
+	}
+	if err := m.bucket.DeleteUpdateFolder(update.Branch, update.RuntimeVersion, update.UpdateId); err != nil {
+		return fmt.Errorf("error deleting update %s: %w", update.UpdateId, err)
+	}
+	if err := m.ForgetUpdate(update.Branch, update.RuntimeVersion, update.UpdateId); err != nil {
+		return fmt.Errorf("error removing update %s from metadata store: %w", update.UpdateId, err)
+	}
+	m.invalidateListings(update.Branch, update.RuntimeVersion)
+	return nil
+}
+
+func (m *Manager) updateExists(update types.Update) (bool, error) {
+	updates, err := m.bucket.GetUpdates(update.Branch, update.RuntimeVersion)
+	if err != nil {
+		return false, fmt.Errorf("error listing updates of %s/%s: %w", update.Branch, update.RuntimeVersion, err)
+	}
+	for _, existing := range updates {
+		if existing.UpdateId == update.UpdateId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Manager) invalidateListings(branch string, runtimeVersion string) {
+	m.cache.Delete(dashboard.ComputeGetBranchesCacheKey())
+	m.cache.Delete(dashboard.ComputeGetRuntimeVersionsCacheKey(branch))
+	m.cache.Delete(dashboard.ComputeGetUpdatesCacheKey(branch, runtimeVersion))
+	m.cache.Delete(ComputeLastUpdateCacheKey(branch, runtimeVersion))
+}
@@ -0,0 +1,319 @@
+package update
+
+import (
+	"expo-open-ota/internal/dashboard"
+	"expo-open-ota/internal/metadataStore"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"time"
+)
+
+type ReindexIssueType string
+
+const (
+	MissingFileIssue        ReindexIssueType = "missingFile"
+	UnparsableMetadataIssue ReindexIssueType = "unparsableMetadata"
+	// A folder without any verified or verifiable update in it, usually an abandoned upload
+	OrphanFolderIssue ReindexIssueType = "orphanFolder"
+	// An update that has been uploaded but never marked as uploaded, it is never served
+	UncheckedUpdateIssue ReindexIssueType = "uncheckedUpdate"
+	// A metadata store record whose update folder no longer exists in the bucket
+	StaleRecordIssue ReindexIssueType = "staleRecord"
+)
+
+type ReindexIssue struct {
+	Type           ReindexIssueType `json:"type"`
+	Branch         string           `json:"branch"`
+	RuntimeVersion string           `json:"runtimeVersion,omitempty"`
+	UpdateId       string           `json:"updateId,omitempty"`
+	File           string           `json:"file,omitempty"`
+	Message        string           `json:"message"`
+}
+
+type ReindexProgress struct {
+	Branches        int `json:"branches"`
+	RuntimeVersions int `json:"runtimeVersions"`
+	Updates         int `json:"updates"`
+	CheckedUpdates  int `json:"checkedUpdates"`
+	WarmedManifests int `json:"warmedManifests"`
+}
+
+type ReindexReport struct {
+	ReindexProgress
+	Issues   []ReindexIssue `json:"issues"`
+	Duration string         `json:"duration"`
+}
+
+type reindexer struct {
+	m          *Manager
+	report     ReindexReport
+	onProgress func(ReindexProgress)
+	store      metadataStore.MetadataStore
+	indexed    map[string]bool
+	// verifyOnly reports the issues without touching the caches or the metadata store
+	verifyOnly bool
+}
+
+var manifestPlatforms = []string{"ios", "android"}
+
+// RebuildIndex walks the whole bucket, reports consistency errors and rebuilds every cached
+// listing, metadata and manifest (and the metadata store, if enabled) from what is actually stored.
+// onProgress, if not nil, is called after each scanned update.
+func (m *Manager) RebuildIndex(onProgress func(ReindexProgress)) (ReindexReport, error) {
+	return m.newReindexer(onProgress, false).run()
+}
+
+// VerifyStorage walks the whole bucket and reports the same consistency errors as RebuildIndex, without
+// changing the caches or the metadata store. Stale records of the metadata store are reported, not removed.
+func (m *Manager) VerifyStorage() (ReindexReport, error) {
+	return m.newReindexer(nil, true).run()
+}
+
+func (m *Manager) newReindexer(onProgress func(ReindexProgress), verifyOnly bool) *reindexer {
+	return &reindexer{
+		m:          m,
+		report:     ReindexReport{Issues: []ReindexIssue{}},
+		onProgress: onProgress,
+		store:      m.MetadataStore(),
+		indexed:    map[string]bool{},
+		verifyOnly: verifyOnly,
+	}
+}
+
+func (r *reindexer) run() (ReindexReport, error) {
+	start := time.Now()
+	branches, err := r.m.bucket.GetBranches()
+	if err != nil {
+		return r.report, fmt.Errorf("error listing branches: %w", err)
+	}
+	r.invalidate(dashboard.ComputeGetBranchesCacheKey())
+	for _, branch := range branches {
+		r.report.Branches++
+		r.invalidate(dashboard.ComputeGetRuntimeVersionsCacheKey(branch))
+		runtimeVersions, err := r.m.bucket.GetRuntimeVersions(branch)
+		if err != nil {
+			return r.report, fmt.Errorf("error listing runtime versions of branch %s: %w", branch, err)
+		}
+		if len(runtimeVersions) == 0 {
+			r.addIssue(ReindexIssue{Type: OrphanFolderIssue, Branch: branch, Message: "branch folder has no runtime version"})
+		}
+		for _, runtimeVersion := range runtimeVersions {
+			r.report.RuntimeVersions++
+			if err := r.reindexRuntimeVersion(branch, runtimeVersion.RuntimeVersion); err != nil {
+				return r.report, err
+			}
+		}
+	}
+	if err := r.removeStaleRecords(); err != nil {
+		return r.report, err
+	}
+	r.report.Duration = time.Since(start).String()
+	r.notify()
+	return r.report, nil
+}
+
+func (r *reindexer) invalidate(cacheKey string) {
+	if !r.verifyOnly {
+		r.m.cache.Delete(cacheKey)
+	}
+}
+
+func (r *reindexer) addIssue(issue ReindexIssue) {
+	r.report.Issues = append(r.report.Issues, issue)
+}
+
+func (r *reindexer) notify() {
+	if r.onProgress != nil {
+		r.onProgress(r.report.ReindexProgress)
+	}
+}
+
+func (r *reindexer) reindexRuntimeVersion(branch string, runtimeVersion string) error {
+	updates, err := r.m.bucket.GetUpdates(branch, runtimeVersion)
+	if err != nil {
+		return fmt.Errorf("error listing updates of %s/%s: %w", branch, runtimeVersion, err)
+	}
+	if len(updates) == 0 {
+		r.addIssue(ReindexIssue{Type: OrphanFolderIssue, Branch: branch, RuntimeVersion: runtimeVersion, Message: "runtime version folder has no update"})
+	}
+	for _, update := range updates {
+		if err := r.reindexUpdate(update); err != nil {
+			return err
+		}
+		r.report.Updates++
+		r.notify()
+	}
+	if r.verifyOnly {
+		return nil
+	}
+	// The latest update can only be resolved once every update of the runtime version is indexed
+	cache := r.m.cache
+	cache.Delete(dashboard.ComputeGetUpdatesCacheKey(branch, runtimeVersion))
+	cache.Delete(ComputeLastUpdateCacheKey(branch, runtimeVersion))
+	if _, err := r.m.GetLatestUpdateBundlePathForRuntimeVersion(branch, runtimeVersion); err != nil {
+		return fmt.Errorf("error resolving latest update of %s/%s: %w", branch, runtimeVersion, err)
+	}
+	return nil
+}
+
+func (r *reindexer) reindexUpdate(update types.Update) error {
+	issue := func(issueType ReindexIssueType, file string, message string) {
+		r.addIssue(ReindexIssue{
+			Type:           issueType,
+			Branch:         update.Branch,
+			RuntimeVersion: update.RuntimeVersion,
+			UpdateId:       update.UpdateId,
+			File:           file,
+			Message:        message,
+		})
+	}
+	_, commitErr := r.m.ReadCommit(update)
+	isChecked := commitErr == nil
+	isRollback := r.m.fileExists(update, "rollback")
+	hasMetadata := r.m.fileExists(update, "metadata.json")
+
+	record := metadataStore.NewUpdateRecord(update.Branch, update.RuntimeVersion, update.UpdateId, updateCreatedAt(update))
+	if isRollback {
+		record.Type = metadataStore.RollbackUpdateRecord
+	}
+	if r.m.fileExists(update, "update-metadata.json") {
+		commitHash, platform, err := r.m.RetrieveUpdateCommitHashAndPlatform(update)
+		if err != nil {
+			issue(UnparsableMetadataIssue, "update-metadata.json", err.Error())
+		}
+		record.CommitHash = commitHash
+		record.Platform = platform
+	} else {
+		issue(MissingFileIssue, "update-metadata.json", "update was not created through requestUploadUrl")
+	}
+
+	switch {
+	case !isChecked && !isRollback && !hasMetadata:
+		issue(OrphanFolderIssue, "", "update folder contains neither metadata.json nor rollback")
+	case !isChecked && r.m.fileExists(update, CommitFile):
+		issue(UncheckedUpdateIssue, CommitFile, commitErr.Error())
+	case !isChecked:
+		issue(UncheckedUpdateIssue, CommitFile, "update has never been marked as uploaded")
+	default:
+		record.Status = metadataStore.CheckedStatus
+		r.report.CheckedUpdates++
+		if !isRollback {
+			if !hasMetadata {
+				issue(MissingFileIssue, "metadata.json", "checked update has no metadata.json")
+			} else {
+				r.warmManifests(update, issue)
+			}
+		}
+	}
+
+	if r.store == nil {
+		return nil
+	}
+	if r.verifyOnly {
+		r.indexed[recordKey(update.Branch, update.RuntimeVersion, update.UpdateId)] = true
+		return nil
+	}
+	if err := r.store.UpsertUpdate(record); err != nil {
+		return fmt.Errorf("error indexing update %s/%s/%s: %w", update.Branch, update.RuntimeVersion, update.UpdateId, err)
+	}
+	r.indexed[recordKey(update.Branch, update.RuntimeVersion, update.UpdateId)] = true
+	return nil
+}
+
+func (r *reindexer) warmManifests(update types.Update, issue func(ReindexIssueType, string, string)) {
+	r.invalidate(ComputeMetadataCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId))
+	metadata, err := r.m.GetMetadata(update)
+	if err != nil {
+		issue(UnparsableMetadataIssue, "metadata.json", err.Error())
+		return
+	}
+	hasExpoConfig := r.m.fileExists(update, "expoConfig.json")
+	if !hasExpoConfig {
+		issue(MissingFileIssue, "expoConfig.json", "checked update has no expoConfig.json")
+	}
+	for _, platform := range manifestPlatforms {
+		r.invalidate(ComputeUpdataManifestCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId, platform))
+		platformMetadata := metadata.MetadataJSON.FileMetadata.IOS
+		if platform == "android" {
+			platformMetadata = metadata.MetadataJSON.FileMetadata.Android
+		}
+		if platformMetadata.Bundle == "" {
+			continue
+		}
+		complete := true
+		files := []string{platformMetadata.Bundle}
+		for _, asset := range platformMetadata.Assets {
+			files = append(files, asset.Path)
+		}
+		for _, file := range files {
+			r.invalidate(ComputeManifestAssetCacheKey(update, file, platform))
+			if !r.m.fileExists(update, file) {
+				issue(MissingFileIssue, file, fmt.Sprintf("file referenced by the %s metadata is missing", platform))
+				complete = false
+			}
+		}
+		if !complete || !hasExpoConfig || r.verifyOnly {
+			continue
+		}
+		if _, err := r.m.ComposeUpdateManifest(&metadata, update, platform); err != nil {
+			issue(UnparsableMetadataIssue, "", fmt.Sprintf("error composing %s manifest: %v", platform, err))
+			continue
+		}
+		r.report.WarmedManifests++
+	}
+}
+
+func (r *reindexer) removeStaleRecords() error {
+	if r.store == nil {
+		return nil
+	}
+	branches, err := r.store.GetBranches()
+	if err != nil {
+		return err
+	}
+	for _, branch := range branches {
+		runtimeVersions, err := r.store.GetRuntimeVersions(branch)
+		if err != nil {
+			return err
+		}
+		for _, runtimeVersion := range runtimeVersions {
+			records, err := r.store.GetUpdates(branch, runtimeVersion.RuntimeVersion)
+			if err != nil {
+				return err
+			}
+			for _, record := range records {
+				if r.indexed[recordKey(record.Branch, record.RuntimeVersion, record.UpdateId)] {
+					continue
+				}
+				message := "update no longer exists in the bucket"
+				if !r.verifyOnly {
+					if err := r.store.DeleteUpdate(record.Branch, record.RuntimeVersion, record.UpdateId); err != nil {
+						return err
+					}
+					message += ", record removed"
+				}
+				r.addIssue(ReindexIssue{
+					Type:           StaleRecordIssue,
+					Branch:         record.Branch,
+					RuntimeVersion: record.RuntimeVersion,
+					UpdateId:       record.UpdateId,
+					Message:        message,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+func recordKey(branch string, runtimeVersion string, updateId string) string {
+	return branch + "/" + runtimeVersion + "/" + updateId
+}
+
+func (m *Manager) fileExists(update types.Update, path string) bool {
+	file, err := m.bucket.GetFile(update, path)
+	if err != nil || file.Reader == nil {
+		return false
+	}
+	file.Reader.Close()
+	return true
+}
@@ -2,18 +2,16 @@ package update
 
 import (
 	"encoding/json"
-	"expo-open-ota/config"
 	"expo-open-ota/internal/bucket"
-	cache2 "expo-open-ota/internal/cache"
 	"expo-open-ota/internal/crypto"
 	"expo-open-ota/internal/dashboard"
+	"expo-open-ota/internal/metadataStore"
 	"expo-open-ota/internal/types"
 	"fmt"
 	"mime"
 	"net/url"
 	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 )
@@ -25,8 +23,19 @@ func sortUpdates(updates []types.Update) []types.Update {
 	return updates
 }
 
-func GetAllUpdatesForRuntimeVersion(branch string, runtimeVersion string) ([]types.Update, error) {
-	resolvedBucket := bucket.GetBucket()
+func (m *Manager) GetAllUpdatesForRuntimeVersion(branch string, runtimeVersion string) ([]types.Update, error) {
+	if store := m.MetadataStore(); store != nil {
+		records, err := store.GetUpdates(branch, runtimeVersion)
+		if err != nil {
+			return nil, err
+		}
+		updates := make([]types.Update, 0, len(records))
+		for _, record := range records {
+			updates = append(updates, RecordToUpdate(record))
+		}
+		return sortUpdates(updates), nil
+	}
+	resolvedBucket := m.bucket
 	updates, errGetUpdates := resolvedBucket.GetUpdates(branch, runtimeVersion)
 	if errGetUpdates != nil {
 		return nil, errGetUpdates
@@ -35,8 +44,8 @@ func GetAllUpdatesForRuntimeVersion(branch string, runtimeVersion string) ([]typ
 	return updates, nil
 }
 
-func MarkUpdateAsChecked(update types.Update) error {
-	cache := cache2.GetCache()
+func (m *Manager) MarkUpdateAsChecked(update types.Update) error {
+	cache := m.cache
 	branchesCacheKey := dashboard.ComputeGetBranchesCacheKey()
 	runTimeVersionsCacheKey := dashboard.ComputeGetRuntimeVersionsCacheKey(update.Branch)
 	updatesCacheKey := dashboard.ComputeGetUpdatesCacheKey(update.Branch, update.RuntimeVersion)
@@ -44,21 +53,29 @@ func MarkUpdateAsChecked(update types.Update) error {
 	for _, cacheKey := range cacheKeys {
 		cache.Delete(cacheKey)
 	}
-	resolvedBucket := bucket.GetBucket()
-	reader := strings.NewReader(".check")
-	_ = resolvedBucket.UploadFileIntoUpdate(update, ".check", reader)
+	if err := m.commitUpdate(update); err != nil {
+		return err
+	}
+	if store := m.MetadataStore(); store != nil {
+		// Rebuild the record from the bucket, the uploaded files tell whether it is a rollback
+		record := m.buildRecordFromBucket(update)
+		record.Status = metadataStore.CheckedStatus
+		return store.UpsertUpdate(record)
+	}
 	return nil
 }
 
-func IsUpdateValid(Update types.Update) bool {
-	resolvedBucket := bucket.GetBucket()
-	// Search for .check file in the update
-	file, _ := resolvedBucket.GetFile(Update, ".check")
-	if file.Reader != nil {
-		defer file.Reader.Close()
-		return true
+func (m *Manager) IsUpdateValid(Update types.Update) bool {
+	if store := m.MetadataStore(); store != nil {
+		record, err := store.GetUpdate(Update.Branch, Update.RuntimeVersion, Update.UpdateId)
+		return err == nil && record != nil && record.Status == metadataStore.CheckedStatus
 	}
-	return false
+	return m.isUpdateCheckedInBucket(Update)
+}
+
+func (m *Manager) isUpdateCheckedInBucket(Update types.Update) bool {
+	_, err := m.ReadCommit(Update)
+	return err == nil
 }
 
 func ComputeLastUpdateCacheKey(branch string, runtimeVersion string) string {
@@ -77,8 +94,8 @@ func ComputeManifestAssetCacheKey(update types.Update, assetPath string, platfor
 	return fmt.Sprintf("asset:%s:%s:%s:%s:%s", update.Branch, update.RuntimeVersion, update.UpdateId, platform, assetPath)
 }
 
-func VerifyUploadedUpdate(update types.Update) error {
-	metadata, errMetadata := GetMetadata(update)
+func (m *Manager) VerifyUploadedUpdate(update types.Update) error {
+	metadata, errMetadata := m.GetMetadata(update)
 	if errMetadata != nil {
 		return errMetadata
 	}
@@ -99,7 +116,7 @@ func VerifyUploadedUpdate(update types.Update) error {
 		}
 	}
 
-	resolvedBucket := bucket.GetBucket()
+	resolvedBucket := m.bucket
 	for _, file := range files {
 		_, err := resolvedBucket.GetFile(update, file)
 		if err != nil {
@@ -122,20 +139,20 @@ func GetUpdate(branch string, runtimeVersion string, updateId string) (*types.Up
 	}, nil
 }
 
-func AreUpdatesIdentical(update1, update2 types.Update, platform string) (bool, error) {
-	metadata1, errMetadata1 := GetMetadata(update1)
+func (m *Manager) AreUpdatesIdentical(update1, update2 types.Update, platform string) (bool, error) {
+	metadata1, errMetadata1 := m.GetMetadata(update1)
 	if errMetadata1 != nil {
 		return false, errMetadata1
 	}
-	metadata2, errMetadata2 := GetMetadata(update2)
+	metadata2, errMetadata2 := m.GetMetadata(update2)
 	if errMetadata2 != nil {
 		return false, errMetadata2
 	}
-	update1Manifest, errManifest1 := ComposeUpdateManifest(&metadata1, update1, platform)
+	update1Manifest, errManifest1 := m.ComposeUpdateManifest(&metadata1, update1, platform)
 	if errManifest1 != nil {
 		return false, errManifest1
 	}
-	update2Manifest, errManifest2 := ComposeUpdateManifest(&metadata2, update2, platform)
+	update2Manifest, errManifest2 := m.ComposeUpdateManifest(&metadata2, update2, platform)
 	if errManifest2 != nil {
 		return false, errManifest2
 	}
@@ -153,8 +170,8 @@ func AreUpdatesIdentical(update1, update2 types.Update, platform string) (bool,
 	return true, nil
 }
 
-func GetLatestUpdateBundlePathForRuntimeVersion(branch string, runtimeVersion string) (*types.Update, error) {
-	cache := cache2.GetCache()
+func (m *Manager) GetLatestUpdateBundlePathForRuntimeVersion(branch string, runtimeVersion string) (*types.Update, error) {
+	cache := m.cache
 	cacheKey := fmt.Sprintf(ComputeLastUpdateCacheKey(branch, runtimeVersion))
 	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
 		var update types.Update
@@ -164,13 +181,25 @@ func GetLatestUpdateBundlePathForRuntimeVersion(branch string, runtimeVersion st
 		}
 		return &update, nil
 	}
-	updates, err := GetAllUpdatesForRuntimeVersion(branch, runtimeVersion)
+	if store := m.MetadataStore(); store != nil {
+		record, err := store.GetLatestCheckedUpdate(branch, runtimeVersion)
+		if err != nil || record == nil {
+			return nil, err
+		}
+		latestUpdate := RecordToUpdate(*record)
+		if cacheValue, err := json.Marshal(latestUpdate); err == nil {
+			ttl := 1800
+			_ = cache.Set(cacheKey, string(cacheValue), &ttl)
+		}
+		return &latestUpdate, nil
+	}
+	updates, err := m.GetAllUpdatesForRuntimeVersion(branch, runtimeVersion)
 	if err != nil {
 		return nil, err
 	}
 	filteredUpdates := make([]types.Update, 0)
 	for _, update := range updates {
-		if IsUpdateValid(update) {
+		if m.IsUpdateValid(update) {
 			filteredUpdates = append(filteredUpdates, update)
 		}
 	}
@@ -186,8 +215,23 @@ func GetLatestUpdateBundlePathForRuntimeVersion(branch string, runtimeVersion st
 	return nil, nil
 }
 
-func GetUpdateType(update types.Update) types.UpdateType {
-	resolvedBucket := bucket.GetBucket()
+func (m *Manager) GetUpdateType(update types.Update) types.UpdateType {
+	if store := m.MetadataStore(); store != nil {
+		record, err := store.GetUpdate(update.Branch, update.RuntimeVersion, update.UpdateId)
+		// The record of an update still being uploaded is created before its files, its type is only known
+		// once the update is marked as checked
+		if err == nil && record != nil && record.Status == metadataStore.CheckedStatus {
+			if record.Type == metadataStore.RollbackUpdateRecord {
+				return types.Rollback
+			}
+			return types.NormalUpdate
+		}
+	}
+	return m.getUpdateTypeFromBucket(update)
+}
+
+func (m *Manager) getUpdateTypeFromBucket(update types.Update) types.UpdateType {
+	resolvedBucket := m.bucket
 	file, err := resolvedBucket.GetFile(update, "rollback")
 	if err == nil && file.Reader != nil {
 		defer file.Reader.Close()
@@ -196,8 +240,8 @@ func GetUpdateType(update types.Update) types.UpdateType {
 	return types.NormalUpdate
 }
 
-func GetExpoConfig(update types.Update) (json.RawMessage, error) {
-	resolvedBucket := bucket.GetBucket()
+func (m *Manager) GetExpoConfig(update types.Update) (json.RawMessage, error) {
+	resolvedBucket := m.bucket
 	resp, err := resolvedBucket.GetFile(update, "expoConfig.json")
 	if err != nil {
 		return nil, err
@@ -211,9 +255,9 @@ func GetExpoConfig(update types.Update) (json.RawMessage, error) {
 	return expoConfig, nil
 }
 
-func GetMetadata(update types.Update) (types.UpdateMetadata, error) {
+func (m *Manager) GetMetadata(update types.Update) (types.UpdateMetadata, error) {
 	metadataCacheKey := ComputeMetadataCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId)
-	cache := cache2.GetCache()
+	cache := m.cache
 	if cachedValue := cache.Get(metadataCacheKey); cachedValue != "" {
 		var metadata types.UpdateMetadata
 		err := json.Unmarshal([]byte(cachedValue), &metadata)
@@ -222,7 +266,7 @@ func GetMetadata(update types.Update) (types.UpdateMetadata, error) {
 		}
 		return metadata, nil
 	}
-	resolvedBucket := bucket.GetBucket()
+	resolvedBucket := m.bucket
 	file, errFile := resolvedBucket.GetFile(update, "metadata.json")
 	if errFile != nil {
 		return types.UpdateMetadata{}, errFile
@@ -274,13 +318,13 @@ func BuildFinalManifestAssetUrlURL(baseURL, assetFilePath, runtimeVersion, platf
 	return parsedURL.String(), nil
 }
 
-func GetAssetEndpoint() string {
-	return config.GetEnv("BASE_URL") + "/assets"
+func (m *Manager) GetAssetEndpoint() string {
+	return m.BaseURL() + "/assets"
 }
 
-func shapeManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset bool, platform string) (types.ManifestAsset, error) {
+func (m *Manager) shapeManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset bool, platform string) (types.ManifestAsset, error) {
 	cacheKey := ComputeManifestAssetCacheKey(update, asset.Path, platform)
-	cache := cache2.GetCache()
+	cache := m.cache
 	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
 		var manifestAsset types.ManifestAsset
 		err := json.Unmarshal([]byte(cachedValue), &manifestAsset)
@@ -289,7 +333,7 @@ func shapeManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset b
 		}
 		return manifestAsset, nil
 	}
-	resolvedBucket := bucket.GetBucket()
+	resolvedBucket := m.bucket
 	assetFilePath := asset.Path
 	assetFile, errAssetFile := resolvedBucket.GetFile(update, asset.Path)
 	if errAssetFile != nil {
@@ -320,7 +364,7 @@ func shapeManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset b
 	if isLaunchAsset {
 		contentType = mime.TypeByExtension(asset.Ext)
 	}
-	finalUrl, errUrl := BuildFinalManifestAssetUrlURL(GetAssetEndpoint(), assetFilePath, update.RuntimeVersion, platform)
+	finalUrl, errUrl := BuildFinalManifestAssetUrlURL(m.GetAssetEndpoint(), assetFilePath, update.RuntimeVersion, platform)
 	if errUrl != nil {
 		return types.ManifestAsset{}, errUrl
 	}
@@ -339,12 +383,12 @@ func shapeManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset b
 	return manifestAsset, nil
 }
 
-func ComposeUpdateManifest(
+func (m *Manager) ComposeUpdateManifest(
 	metadata *types.UpdateMetadata,
 	update types.Update,
 	platform string,
 ) (types.UpdateManifest, error) {
-	cache := cache2.GetCache()
+	cache := m.cache
 	cacheKey := ComputeUpdataManifestCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId, platform)
 	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
 		var manifest types.UpdateManifest
@@ -354,7 +398,7 @@ func ComposeUpdateManifest(
 		}
 		return manifest, nil
 	}
-	expoConfig, errConfig := GetExpoConfig(update)
+	expoConfig, errConfig := m.GetExpoConfig(update)
 	if errConfig != nil {
 		return types.UpdateManifest{}, errConfig
 	}
@@ -376,7 +420,7 @@ func ComposeUpdateManifest(
 		wg.Add(1)
 		go func(index int, asset types.Asset) {
 			defer wg.Done()
-			shapedAsset, errShape := shapeManifestAsset(update, &asset, false, platform)
+			shapedAsset, errShape := m.shapeManifestAsset(update, &asset, false, platform)
 			if errShape != nil {
 				errs <- errShape
 				return
@@ -392,7 +436,7 @@ func ComposeUpdateManifest(
 		return types.UpdateManifest{}, <-errs
 	}
 
-	launchAsset, errShape := shapeManifestAsset(update, &types.Asset{
+	launchAsset, errShape := m.shapeManifestAsset(update, &types.Asset{
 		Path: platformSpecificMetadata.Bundle,
 		Ext:  "",
 	}, true, platform)
@@ -421,8 +465,8 @@ func ComposeUpdateManifest(
 	return manifest, nil
 }
 
-func CreateRollbackDirective(update types.Update) (types.RollbackDirective, error) {
-	resolvedBucket := bucket.GetBucket()
+func (m *Manager) CreateRollbackDirective(update types.Update) (types.RollbackDirective, error) {
+	resolvedBucket := m.bucket
 	object, err := resolvedBucket.GetFile(update, "rollback")
 	if err != nil {
 		return types.RollbackDirective{}, err
@@ -443,8 +487,8 @@ func CreateNoUpdateAvailableDirective() types.NoUpdateAvailableDirective {
 	}
 }
 
-func RetrieveUpdateCommitHashAndPlatform(update types.Update) (string, string, error) {
-	resolvedBucket := bucket.GetBucket()
+func (m *Manager) RetrieveUpdateCommitHashAndPlatform(update types.Update) (string, string, error) {
+	resolvedBucket := m.bucket
 	file, err := resolvedBucket.GetFile(update, "update-metadata.json")
 	if err != nil {
 		return "", "", err
@@ -0,0 +1,79 @@
+package uploadSessions
+
+import (
+	"expo-open-ota/config"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"log"
+	"time"
+)
+
+// SweepExpired removes the expired sessions along with the updates they were opened for, unless these
+// were marked as uploaded in time, so that abandoned uploads do not linger in the bucket.
+func SweepExpired(updates *update.Manager, now time.Time) (int, error) {
+	storage, err := objectStorage(updates.Bucket())
+	if err != nil {
+		return 0, err
+	}
+	keys, err := storage.ListObjects(sessionsFolder)
+	if err != nil {
+		return 0, fmt.Errorf("error listing upload sessions: %w", err)
+	}
+	swept := 0
+	for _, key := range keys {
+		session, err := readSession(storage, key)
+		if err != nil {
+			log.Printf("Skipping upload session %s: %v", key, err)
+			continue
+		}
+		if !now.After(session.ExpiresAt) {
+			continue
+		}
+		abandoned := types.Update{Branch: session.Branch, RuntimeVersion: session.RuntimeVersion, UpdateId: session.UpdateId}
+		if !updates.IsUpdateValid(abandoned) {
+			if err := updates.Bucket().DeleteUpdateFolder(session.Branch, session.RuntimeVersion, session.UpdateId); err != nil {
+				log.Printf("Error deleting abandoned update %s: %v", session.UpdateId, err)
+				continue
+			}
+			if err := updates.ForgetUpdate(session.Branch, session.RuntimeVersion, session.UpdateId); err != nil {
+				log.Printf("Error removing abandoned update %s from metadata store: %v", session.UpdateId, err)
+			}
+		}
+		if err := storage.DeleteObject(key); err != nil {
+			log.Printf("Error deleting upload session %s: %v", key, err)
+			continue
+		}
+		swept++
+	}
+	return swept, nil
+}
+
+// StartSweeper sweeps the expired sessions of the bucket of updates every UPLOAD_SWEEP_INTERVAL seconds.
+func StartSweeper(updates *update.Manager) {
+	interval := time.Duration(config.GetIntEnv("UPLOAD_SWEEP_INTERVAL", 1)) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			swept, err := SweepExpired(updates, now)
+			if err != nil {
+				log.Printf("Error sweeping upload sessions: %v", err)
+				continue
+			}
+			if swept > 0 {
+				log.Printf("Swept %d expired upload sessions", swept)
+			}
+			localBucket, ok := bucket.Primary(updates.Bucket()).(*bucket.LocalBucket)
+			if !ok {
+				continue
+			}
+			// Chunked uploads cannot be resumed once their session expired
+			ttl := time.Duration(config.GetIntEnv("UPLOAD_SESSIONS_TTL_MINUTES", 1)) * time.Minute
+			if _, err := localBucket.SweepPartialUploads(now.Add(-ttl)); err != nil {
+				log.Printf("Error sweeping partial uploads: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,222 @@
+package uploadSessions
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/bucket"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Version of the session format, sessions written with another version are refused
+const Version = 1
+
+const sessionsFolder = bucket.InternalFolder + "/uploadSessions/"
+
+// Files written into the update folder by the server itself, never declared by the client
+var serverFiles = []string{"update-metadata.json", ".check"}
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+var (
+	ErrSessionNotFound = errors.New("upload session not found")
+	ErrSessionExpired  = errors.New("upload session expired")
+)
+
+// File is an expected file of the update, size and hash are checked when declared.
+type File struct {
+	Path   string `json:"path"`
+	Size   *int64 `json:"size,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+}
+
+// Session records what the client announced when requesting the upload URLs of an update, so that
+// the files found in the bucket can be checked against it once the update is marked as uploaded.
+type Session struct {
+	Version        int       `json:"version"`
+	Id             string    `json:"id"`
+	Branch         string    `json:"branch"`
+	RuntimeVersion string    `json:"runtimeVersion"`
+	UpdateId       string    `json:"updateId"`
+	Platform       string    `json:"platform,omitempty"`
+	Files          []File    `json:"files"`
+	CreatedAt      time.Time `json:"createdAt"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+	Signature      string    `json:"signature"`
+}
+
+func objectStorage(resolvedBucket bucket.Bucket) (bucket.ObjectStorage, error) {
+	storage, ok := resolvedBucket.(bucket.ObjectStorage)
+	if !ok {
+		return nil, fmt.Errorf("the bucket cannot store upload sessions")
+	}
+	return storage, nil
+}
+
+func sessionKey(branch string, runtimeVersion string, updateId string) string {
+	return sessionsFolder + url.PathEscape(branch) + "/" + url.PathEscape(runtimeVersion) + "/" + url.PathEscape(updateId) + ".json"
+}
+
+// ValidateFiles checks the declaration of the client before any upload URL is handed out.
+func ValidateFiles(files []File) error {
+	if len(files) == 0 {
+		return errors.New("no files declared")
+	}
+	seen := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		// Upload URLs and the listing of the update folder both rely on canonical paths
+		if cleaned, err := bucket.CleanAssetPath(file.Path); err != nil || cleaned != file.Path {
+			return fmt.Errorf("invalid file path: %q", file.Path)
+		}
+		for _, serverFile := range serverFiles {
+			if file.Path == serverFile {
+				return fmt.Errorf("reserved file path: %q", file.Path)
+			}
+		}
+		if _, ok := seen[file.Path]; ok {
+			return fmt.Errorf("file declared twice: %q", file.Path)
+		}
+		seen[file.Path] = struct{}{}
+		if file.Size != nil && *file.Size < 0 {
+			return fmt.Errorf("invalid size for %q", file.Path)
+		}
+		if file.Sha256 != "" && !sha256Pattern.MatchString(file.Sha256) {
+			return fmt.Errorf("invalid sha256 for %q, expected 64 lowercase hexadecimal characters", file.Path)
+		}
+	}
+	return nil
+}
+
+// FilesFromNames builds the declaration of clients only sending file names, whose content cannot be checked.
+func FilesFromNames(fileNames []string) []File {
+	files := make([]File, 0, len(fileNames))
+	seen := make(map[string]struct{}, len(fileNames))
+	for _, fileName := range fileNames {
+		if _, ok := seen[fileName]; ok {
+			continue
+		}
+		seen[fileName] = struct{}{}
+		files = append(files, File{Path: fileName})
+	}
+	return files
+}
+
+// Paths returns the declared file paths, in the declaration order.
+func (s Session) Paths() []string {
+	paths := make([]string, 0, len(s.Files))
+	for _, file := range s.Files {
+		paths = append(paths, file.Path)
+	}
+	return paths
+}
+
+func (s Session) sign() (string, error) {
+	s.Signature = ""
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, []byte(config.GetEnv("JWT_SECRET")))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Create signs and stores a new session pinned to the given update.
+func Create(resolvedBucket bucket.Bucket, branch string, runtimeVersion string, updateId string, platform string, files []File) (*Session, error) {
+	if err := ValidateFiles(files); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	session := Session{
+		Version:        Version,
+		Id:             uuid.New().String(),
+		Branch:         branch,
+		RuntimeVersion: runtimeVersion,
+		UpdateId:       updateId,
+		Platform:       platform,
+		Files:          files,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(time.Duration(config.GetIntEnv("UPLOAD_SESSIONS_TTL_MINUTES", 1)) * time.Minute),
+	}
+	signature, err := session.sign()
+	if err != nil {
+		return nil, err
+	}
+	session.Signature = signature
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := objectStorage(resolvedBucket)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.PutObject(sessionKey(branch, runtimeVersion, updateId), bytes.NewReader(payload)); err != nil {
+		return nil, fmt.Errorf("error storing upload session: %w", err)
+	}
+	return &session, nil
+}
+
+func readSession(storage bucket.ObjectStorage, key string) (*Session, error) {
+	reader, err := storage.GetObject(key)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	defer reader.Close()
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading upload session: %w", err)
+	}
+	var session Session
+	if err := json.Unmarshal(payload, &session); err != nil {
+		return nil, fmt.Errorf("error decoding upload session: %w", err)
+	}
+	if session.Version != Version {
+		return nil, fmt.Errorf("unsupported upload session version %d", session.Version)
+	}
+	expected, err := session.sign()
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(session.Signature)) {
+		return nil, errors.New("invalid upload session signature")
+	}
+	return &session, nil
+}
+
+// Get returns the session of the update after checking its signature, pinning and expiry.
+func Get(resolvedBucket bucket.Bucket, branch string, runtimeVersion string, updateId string) (*Session, error) {
+	storage, err := objectStorage(resolvedBucket)
+	if err != nil {
+		return nil, err
+	}
+	session, err := readSession(storage, sessionKey(branch, runtimeVersion, updateId))
+	if err != nil {
+		return nil, err
+	}
+	if session.Branch != branch || session.RuntimeVersion != runtimeVersion || session.UpdateId != updateId {
+		return nil, errors.New("upload session does not belong to this update")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+	return session, nil
+}
+
+func Delete(resolvedBucket bucket.Bucket, branch string, runtimeVersion string, updateId string) error {
+	storage, err := objectStorage(resolvedBucket)
+	if err != nil {
+		return err
+	}
+	return storage.DeleteObject(sessionKey(branch, runtimeVersion, updateId))
+}
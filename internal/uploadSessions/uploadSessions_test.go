@@ -0,0 +1,178 @@
+package uploadSessions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/update"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useLocalBucket(t *testing.T) *bucket.LocalBucket {
+	t.Helper()
+	basePath := t.TempDir()
+	os.Setenv("LOCAL_BUCKET_BASE_PATH", basePath)
+	os.Setenv("JWT_SECRET", "test_jwt_secret")
+	bucket.ResetBucketInstance()
+	t.Cleanup(func() {
+		os.Unsetenv("LOCAL_BUCKET_BASE_PATH")
+		os.Unsetenv("JWT_SECRET")
+		os.Unsetenv("UPLOAD_SESSIONS_TTL_MINUTES")
+		bucket.ResetBucketInstance()
+	})
+	return &bucket.LocalBucket{BasePath: basePath}
+}
+
+func declare(path string, content string) File {
+	size := int64(len(content))
+	hash := sha256.Sum256([]byte(content))
+	return File{Path: path, Size: &size, Sha256: hex.EncodeToString(hash[:])}
+}
+
+func upload(t *testing.T, storage *bucket.LocalBucket, path string, content string) {
+	t.Helper()
+	assert.Nil(t, storage.PutObject("main/1/1700000000000/"+path, strings.NewReader(content)))
+}
+
+func TestValidateFiles(t *testing.T) {
+	negative := int64(-1)
+	assert.Nil(t, ValidateFiles([]File{{Path: "metadata.json"}, declare("assets/abc", "abc")}))
+	assert.NotNil(t, ValidateFiles(nil))
+	assert.NotNil(t, ValidateFiles([]File{{Path: ""}}))
+	assert.NotNil(t, ValidateFiles([]File{{Path: "/etc/passwd"}}))
+	assert.NotNil(t, ValidateFiles([]File{{Path: "../metadata.json"}}))
+	assert.NotNil(t, ValidateFiles([]File{{Path: "assets/../../metadata.json"}}))
+	assert.NotNil(t, ValidateFiles([]File{{Path: "./metadata.json"}}))
+	assert.NotNil(t, ValidateFiles([]File{{Path: "update-metadata.json"}}))
+	assert.NotNil(t, ValidateFiles([]File{{Path: ".check"}}))
+	assert.NotNil(t, ValidateFiles([]File{{Path: "a"}, {Path: "a"}}))
+	assert.NotNil(t, ValidateFiles([]File{{Path: "a", Size: &negative}}))
+	assert.NotNil(t, ValidateFiles([]File{{Path: "a", Sha256: "ABC"}}))
+}
+
+func TestFilesFromNames(t *testing.T) {
+	assert.Equal(t, []File{{Path: "a"}, {Path: "b"}}, FilesFromNames([]string{"a", "b", "a"}))
+}
+
+func TestCreateAndGet(t *testing.T) {
+	storage := useLocalBucket(t)
+	created, err := Create(storage, "feature/login", "1.0.0", "1700000000000", "ios", []File{declare("metadata.json", "{}")})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, created.Signature)
+	assert.True(t, created.ExpiresAt.After(time.Now().Add(59*time.Minute)))
+
+	session, err := Get(storage, "feature/login", "1.0.0", "1700000000000")
+	assert.Nil(t, err)
+	assert.Equal(t, created.Id, session.Id)
+	assert.Equal(t, []string{"metadata.json"}, session.Paths())
+
+	_, err = Get(storage, "feature/login", "1.0.0", "1700000000001")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	// Sessions cannot be edited, nor moved to another update
+	key := sessionKey("feature/login", "1.0.0", "1700000000000")
+	content, err := os.ReadFile(filepath.Join(storage.BasePath, filepath.FromSlash(key)))
+	assert.Nil(t, err)
+	tampered := strings.Replace(string(content), `"path":"metadata.json"`, `"path":"other.json"`, 1)
+	assert.Nil(t, storage.PutObject(key, strings.NewReader(tampered)))
+	_, err = Get(storage, "feature/login", "1.0.0", "1700000000000")
+	assert.ErrorContains(t, err, "signature")
+	assert.Nil(t, storage.PutObject(sessionKey("main", "1.0.0", "1700000000000"), strings.NewReader(string(content))))
+	_, err = Get(storage, "main", "1.0.0", "1700000000000")
+	assert.ErrorContains(t, err, "does not belong")
+
+	assert.Nil(t, Delete(storage, "feature/login", "1.0.0", "1700000000000"))
+	_, err = Get(storage, "feature/login", "1.0.0", "1700000000000")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestGetRefusesOtherVersionsAndExpiredSessions(t *testing.T) {
+	storage := useLocalBucket(t)
+	created, err := Create(storage, "main", "1", "1700000000000", "", []File{{Path: "metadata.json"}})
+	assert.Nil(t, err)
+
+	outdated := *created
+	outdated.Version = Version + 1
+	outdated.Signature, _ = outdated.sign()
+	_, err = readSession(storage, writeSession(t, storage, outdated))
+	assert.ErrorContains(t, err, "version")
+
+	expired := *created
+	expired.ExpiresAt = time.Now().Add(-time.Minute).UTC()
+	expired.Signature, _ = expired.sign()
+	writeSession(t, storage, expired)
+	_, err = Get(storage, "main", "1", "1700000000000")
+	assert.ErrorIs(t, err, ErrSessionExpired)
+}
+
+func writeSession(t *testing.T, storage *bucket.LocalBucket, session Session) string {
+	t.Helper()
+	payload, err := json.Marshal(session)
+	assert.Nil(t, err)
+	key := sessionKey(session.Branch, session.RuntimeVersion, session.UpdateId)
+	assert.Nil(t, storage.PutObject(key, bytes.NewReader(payload)))
+	return key
+}
+
+func TestVerify(t *testing.T) {
+	storage := useLocalBucket(t)
+	session, err := Create(storage, "main", "1", "1700000000000", "android", []File{
+		declare("metadata.json", `{"version":0}`),
+		declare("bundles/android.hbc", "bundle"),
+		{Path: "expoConfig.json"},
+	})
+	assert.Nil(t, err)
+	assert.ErrorContains(t, session.Verify(storage), "missing file: metadata.json")
+
+	upload(t, storage, "metadata.json", `{"version":0}`)
+	upload(t, storage, "bundles/android.hbc", "bundle")
+	upload(t, storage, "expoConfig.json", "anything")
+	upload(t, storage, "update-metadata.json", "{}")
+	assert.Nil(t, session.Verify(storage))
+
+	upload(t, storage, "assets/unexpected", "extra")
+	upload(t, storage, "bundles/android.hbc", "bundle!")
+	err = session.Verify(storage)
+	assert.ErrorContains(t, err, "unexpected file: assets/unexpected")
+	assert.ErrorContains(t, err, "size mismatch for bundles/android.hbc")
+
+	assert.Nil(t, storage.DeleteObject("main/1/1700000000000/assets/unexpected"))
+	upload(t, storage, "bundles/android.hbc", "BUNDLE")
+	assert.EqualError(t, session.Verify(storage), "sha256 mismatch for bundles/android.hbc")
+}
+
+func TestSweepExpired(t *testing.T) {
+	storage := useLocalBucket(t)
+	os.Setenv("UPLOAD_SESSIONS_TTL_MINUTES", "1")
+	for _, updateId := range []string{"1700000000000", "1700000000001"} {
+		_, err := Create(storage, "main", "1", updateId, "", []File{{Path: "metadata.json"}})
+		assert.Nil(t, err)
+		assert.Nil(t, storage.PutObject("main/1/"+updateId+"/metadata.json", strings.NewReader("{}")))
+	}
+	// The second update was marked as uploaded before its session expired
+	assert.Nil(t, storage.PutObject("main/1/1700000000001/.check", strings.NewReader(".check")))
+
+	swept, err := SweepExpired(update.NewManager(storage, cache2.GetCache(), nil), time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, swept)
+
+	swept, err = SweepExpired(update.NewManager(storage, cache2.GetCache(), nil), time.Now().Add(2*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, swept)
+	_, err = os.Stat(filepath.Join(storage.BasePath, "main", "1", "1700000000000"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(storage.BasePath, "main", "1", "1700000000001", "metadata.json"))
+	assert.Nil(t, err)
+	keys, err := storage.ListObjects(sessionsFolder)
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
@@ -0,0 +1,81 @@
+package uploadSessions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Verify compares the files of the update folder with the declaration of the session: every declared
+// file must be there with the declared size and hash, and nothing else may have been uploaded.
+func (s Session) Verify(resolvedBucket bucket.Bucket) error {
+	storage, err := objectStorage(resolvedBucket)
+	if err != nil {
+		return err
+	}
+	prefix := fmt.Sprintf("%s/%s/%s/", s.Branch, s.RuntimeVersion, s.UpdateId)
+	keys, err := storage.ListObjects(prefix)
+	if err != nil {
+		return fmt.Errorf("error listing uploaded files: %w", err)
+	}
+	uploaded := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		uploaded[strings.TrimPrefix(key, prefix)] = struct{}{}
+	}
+	for _, serverFile := range serverFiles {
+		delete(uploaded, serverFile)
+	}
+
+	var problems []string
+	for _, file := range s.Files {
+		if _, ok := uploaded[file.Path]; !ok {
+			problems = append(problems, fmt.Sprintf("missing file: %s", file.Path))
+			continue
+		}
+		delete(uploaded, file.Path)
+		if file.Size == nil && file.Sha256 == "" {
+			continue
+		}
+		if problem := verifyContent(storage, prefix+file.Path, file); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	for _, key := range keys {
+		if name := strings.TrimPrefix(key, prefix); hasKey(uploaded, name) {
+			problems = append(problems, fmt.Sprintf("unexpected file: %s", name))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+func hasKey(set map[string]struct{}, key string) bool {
+	_, ok := set[key]
+	return ok
+}
+
+func verifyContent(storage bucket.ObjectStorage, key string, file File) string {
+	reader, err := storage.GetObject(key)
+	if err != nil {
+		return fmt.Sprintf("unreadable file: %s", file.Path)
+	}
+	defer reader.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return fmt.Sprintf("unreadable file: %s", file.Path)
+	}
+	if file.Size != nil && size != *file.Size {
+		return fmt.Sprintf("size mismatch for %s: declared %d bytes, uploaded %d", file.Path, *file.Size, size)
+	}
+	if file.Sha256 != "" && hex.EncodeToString(hash.Sum(nil)) != file.Sha256 {
+		return fmt.Sprintf("sha256 mismatch for %s", file.Path)
+	}
+	return ""
+}
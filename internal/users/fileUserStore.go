@@ -0,0 +1,136 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type FileUserStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileUserStore(path string) *FileUserStore {
+	return &FileUserStore{path: path}
+}
+
+func (s *FileUserStore) load() ([]User, error) {
+	content, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []User{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading users: %w", err)
+	}
+	var users []User
+	if err := json.Unmarshal(content, &users); err != nil {
+		return nil, fmt.Errorf("error parsing users: %w", err)
+	}
+	return users, nil
+}
+
+// save writes into a temporary file first so that a crash never leaves a truncated users file
+func (s *FileUserStore) save(users []User) error {
+	content, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.path), ".users-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), s.path)
+}
+
+func (s *FileUserStore) Create(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	for _, existing := range users {
+		if existing.Username == user.Username {
+			return ErrUserAlreadyExists
+		}
+	}
+	return s.save(append(users, user))
+}
+
+func (s *FileUserStore) Update(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		if users[i].Id == user.Id {
+			users[i] = user
+			return s.save(users)
+		}
+	}
+	return ErrUserNotFound
+}
+
+func (s *FileUserStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		if users[i].Id == id {
+			return s.save(append(users[:i], users[i+1:]...))
+		}
+	}
+	return ErrUserNotFound
+}
+
+func (s *FileUserStore) List() ([]User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *FileUserStore) find(match func(User) bool) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if match(user) {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *FileUserStore) GetById(id string) (*User, error) {
+	return s.find(func(user User) bool { return user.Id == id })
+}
+
+func (s *FileUserStore) GetByUsername(username string) (*User, error) {
+	return s.find(func(user User) bool { return user.Username == username })
+}
@@ -0,0 +1,117 @@
+package users
+
+import (
+	"expo-open-ota/internal/metadataStore"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type SQLUserStore struct {
+	store *metadataStore.SQLMetadataStore
+}
+
+const usersSchema = `CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	app TEXT NOT NULL DEFAULT '',
+	username TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	role TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL
+)`
+
+// Tables created before users were bound to an app only hold users of the default app
+const addUserAppColumn = `ALTER TABLE users ADD COLUMN app TEXT NOT NULL DEFAULT ''`
+
+const userColumns = "id, app, username, password_hash, role, created_at, updated_at"
+
+func NewSQLUserStore(store *metadataStore.SQLMetadataStore) (*SQLUserStore, error) {
+	if _, err := store.DB().Exec(usersSchema); err != nil {
+		return nil, fmt.Errorf("error migrating users table: %w", err)
+	}
+	if _, err := store.DB().Exec(`SELECT app FROM users LIMIT 1`); err != nil {
+		if _, err := store.DB().Exec(addUserAppColumn); err != nil {
+			return nil, fmt.Errorf("error migrating users table: %w", err)
+		}
+	}
+	return &SQLUserStore{store: store}, nil
+}
+
+func (s *SQLUserStore) Create(user User) error {
+	query := s.store.Rebind(`INSERT INTO users (` + userColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	_, err := s.store.DB().Exec(query, user.Id, user.App, user.Username, user.PasswordHash, string(user.Role), user.CreatedAt.UnixMilli(), user.UpdatedAt.UnixMilli())
+	if err != nil {
+		// Both SQLite and Postgres mention the violated constraint in the error
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			return ErrUserAlreadyExists
+		}
+		return fmt.Errorf("error creating user: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLUserStore) Update(user User) error {
+	query := s.store.Rebind(`UPDATE users SET password_hash = ?, role = ?, updated_at = ? WHERE id = ?`)
+	result, err := s.store.DB().Exec(query, user.PasswordHash, string(user.Role), user.UpdatedAt.UnixMilli(), user.Id)
+	if err != nil {
+		return fmt.Errorf("error updating user: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *SQLUserStore) Delete(id string) error {
+	result, err := s.store.DB().Exec(s.store.Rebind(`DELETE FROM users WHERE id = ?`), id)
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *SQLUserStore) List() ([]User, error) {
+	return s.query(`SELECT ` + userColumns + ` FROM users ORDER BY username`)
+}
+
+func (s *SQLUserStore) GetById(id string) (*User, error) {
+	return s.queryOne(s.store.Rebind(`SELECT `+userColumns+` FROM users WHERE id = ?`), id)
+}
+
+func (s *SQLUserStore) GetByUsername(username string) (*User, error) {
+	return s.queryOne(s.store.Rebind(`SELECT `+userColumns+` FROM users WHERE username = ?`), username)
+}
+
+func (s *SQLUserStore) queryOne(query string, args ...interface{}) (*User, error) {
+	users, err := s.query(query, args...)
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+func (s *SQLUserStore) query(query string, args ...interface{}) ([]User, error) {
+	rows, err := s.store.DB().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %w", err)
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var user User
+		var role string
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&user.Id, &user.App, &user.Username, &user.PasswordHash, &role, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		user.Role = Role(role)
+		user.CreatedAt = time.UnixMilli(createdAt).UTC()
+		user.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,246 @@
+package users
+
+import (
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/metadataStore"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Role string
+
+const (
+	ViewerRole    Role = "viewer"
+	PublisherRole Role = "publisher"
+	AdminRole     Role = "admin"
+)
+
+// Each role includes the permissions of the lower ones
+var roleLevels = map[Role]int{
+	ViewerRole:    1,
+	PublisherRole: 2,
+	AdminRole:     3,
+}
+
+const minPasswordLength = 8
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._@-]{3,64}$`)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrInvalidPassword   = errors.New("invalid password")
+)
+
+type User struct {
+	Id string `json:"id"`
+	// App is the id of the app the user signs in to, empty for the default app. Usernames are unique
+	// across the apps.
+	App          string    `json:"app,omitempty"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"passwordHash,omitempty"`
+	Role         Role      `json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+type UserStore interface {
+	Create(user User) error
+	Update(user User) error
+	Delete(id string) error
+	List() ([]User, error)
+	GetById(id string) (*User, error)
+	GetByUsername(username string) (*User, error)
+}
+
+var (
+	userStoreInstance UserStore
+	once              sync.Once
+)
+
+// GetUserStore stores the users in the metadata store when it is enabled, and in a local JSON file otherwise.
+func GetUserStore() UserStore {
+	once.Do(func() {
+		if store, ok := metadataStore.GetMetadataStore().(*metadataStore.SQLMetadataStore); ok {
+			sqlStore, err := NewSQLUserStore(store)
+			if err != nil {
+				log.Fatalf("Error initializing user store: %v", err)
+			}
+			userStoreInstance = sqlStore
+			return
+		}
+		userStoreInstance = NewFileUserStore(config.GetEnv("USERS_FILE_PATH"))
+	})
+	return userStoreInstance
+}
+
+func ResetUserStoreInstance() {
+	userStoreInstance = nil
+	once = sync.Once{}
+}
+
+func IsValidRole(role Role) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// HasRole tells whether role grants at least the permissions of required.
+func HasRole(role Role, required Role) bool {
+	return roleLevels[role] >= roleLevels[required]
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CreateUser creates a user of app.
+func CreateUser(app string, username string, password string, role Role) (User, error) {
+	username = strings.TrimSpace(username)
+	if !usernamePattern.MatchString(username) {
+		return User{}, errors.New("username must be 3 to 64 letters, digits or . _ @ -")
+	}
+	if !IsValidRole(role) {
+		return User{}, fmt.Errorf("invalid role: %s", role)
+	}
+	existing, err := GetUserStore().GetByUsername(username)
+	if err != nil {
+		return User{}, err
+	}
+	if existing != nil {
+		return User{}, ErrUserAlreadyExists
+	}
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	now := time.Now().UTC()
+	user := User{
+		Id:           uuid.New().String(),
+		App:          app,
+		Username:     username,
+		PasswordHash: passwordHash,
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := GetUserStore().Create(user); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// ListUsers returns the users of app.
+func ListUsers(app string) ([]User, error) {
+	users, err := GetUserStore().List()
+	if err != nil {
+		return nil, err
+	}
+	appUsers := []User{}
+	for _, user := range users {
+		if user.App == app {
+			appUsers = append(appUsers, user)
+		}
+	}
+	return appUsers, nil
+}
+
+// GetUser returns a user of app, nil when there is none with this id in app.
+func GetUser(app string, id string) (*User, error) {
+	user, err := GetUserStore().GetById(id)
+	if err != nil || user == nil || user.App != app {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateUser changes the role and/or the password of a user of app, empty values are left untouched.
+func UpdateUser(app string, id string, role Role, password string) (User, error) {
+	user, err := GetUser(app, id)
+	if err != nil {
+		return User{}, err
+	}
+	if user == nil {
+		return User{}, ErrUserNotFound
+	}
+	if role != "" {
+		if !IsValidRole(role) {
+			return User{}, fmt.Errorf("invalid role: %s", role)
+		}
+		user.Role = role
+	}
+	if password != "" {
+		passwordHash, err := hashPassword(password)
+		if err != nil {
+			return User{}, err
+		}
+		user.PasswordHash = passwordHash
+	}
+	user.UpdatedAt = time.Now().UTC()
+	if err := GetUserStore().Update(*user); err != nil {
+		return User{}, err
+	}
+	return *user, nil
+}
+
+// DeleteUser deletes a user of app, the users of other apps are reported as not found.
+func DeleteUser(app string, id string) error {
+	user, err := GetUser(app, id)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return GetUserStore().Delete(id)
+}
+
+// Authenticate checks the credentials of a user of app. The same error is returned for an unknown user,
+// a user of another app and a wrong password so that usernames cannot be enumerated.
+func Authenticate(app string, username string, password string) (*User, error) {
+	user, err := GetUserStore().GetByUsername(strings.TrimSpace(username))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.App != app {
+		// Compare anyway so that unknown users take as long as known ones
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, ErrInvalidPassword
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidPassword
+	}
+	return user, nil
+}
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("expo-open-ota-dummy-password"), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
+// Redacted strips the password hash before the user is sent to a client.
+func (u User) Redacted() User {
+	u.PasswordHash = ""
+	return u
+}
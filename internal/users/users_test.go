@@ -0,0 +1,127 @@
+package users
+
+import (
+	"expo-open-ota/internal/metadataStore"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useFileStore(t *testing.T) {
+	t.Helper()
+	os.Setenv("USERS_FILE_PATH", filepath.Join(t.TempDir(), "users.json"))
+	ResetUserStoreInstance()
+	t.Cleanup(func() {
+		os.Unsetenv("USERS_FILE_PATH")
+		ResetUserStoreInstance()
+	})
+}
+
+func TestHasRole(t *testing.T) {
+	assert.True(t, HasRole(AdminRole, PublisherRole))
+	assert.True(t, HasRole(PublisherRole, PublisherRole))
+	assert.True(t, HasRole(PublisherRole, ViewerRole))
+	assert.False(t, HasRole(ViewerRole, PublisherRole))
+	assert.False(t, HasRole("unknown", ViewerRole))
+}
+
+func TestCreateUserValidation(t *testing.T) {
+	useFileStore(t)
+	_, err := CreateUser("", "a", "password123", ViewerRole)
+	assert.NotNil(t, err)
+	_, err = CreateUser("", "alice", "short", ViewerRole)
+	assert.NotNil(t, err)
+	_, err = CreateUser("", "alice", "password123", "owner")
+	assert.NotNil(t, err)
+	_, err = CreateUser("", "alice", "password123", ViewerRole)
+	assert.Nil(t, err)
+	_, err = CreateUser("", "alice", "password123", AdminRole)
+	assert.ErrorIs(t, err, ErrUserAlreadyExists)
+}
+
+func TestPasswordIsHashed(t *testing.T) {
+	useFileStore(t)
+	user, err := CreateUser("", "alice", "password123", ViewerRole)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "password123", user.PasswordHash)
+	content, err := os.ReadFile(os.Getenv("USERS_FILE_PATH"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(content), "password123")
+	assert.Empty(t, user.Redacted().PasswordHash)
+}
+
+func TestAuthenticate(t *testing.T) {
+	useFileStore(t)
+	created, err := CreateUser("", "alice", "password123", PublisherRole)
+	assert.Nil(t, err)
+	user, err := Authenticate("", "alice", "password123")
+	assert.Nil(t, err)
+	assert.Equal(t, created.Id, user.Id)
+	_, err = Authenticate("", "alice", "wrong-password")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+	_, err = Authenticate("", "bob", "password123")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+}
+
+func TestUpdateUser(t *testing.T) {
+	useFileStore(t)
+	created, err := CreateUser("", "alice", "password123", ViewerRole)
+	assert.Nil(t, err)
+	updated, err := UpdateUser("", created.Id, AdminRole, "new-password")
+	assert.Nil(t, err)
+	assert.Equal(t, AdminRole, updated.Role)
+	_, err = Authenticate("", "alice", "password123")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+	_, err = Authenticate("", "alice", "new-password")
+	assert.Nil(t, err)
+	_, err = UpdateUser("", "unknown", AdminRole, "")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestUsersOfOtherApps(t *testing.T) {
+	useFileStore(t)
+	created, err := CreateUser("second", "alice", "password123", PublisherRole)
+	assert.Nil(t, err)
+	_, err = CreateUser("", "alice", "password123", ViewerRole)
+	assert.ErrorIs(t, err, ErrUserAlreadyExists)
+	_, err = Authenticate("", "alice", "password123")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+	user, err := Authenticate("second", "alice", "password123")
+	assert.Nil(t, err)
+	assert.Equal(t, created.Id, user.Id)
+
+	list, err := ListUsers("")
+	assert.Nil(t, err)
+	assert.Empty(t, list)
+	_, err = UpdateUser("", created.Id, AdminRole, "")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.ErrorIs(t, DeleteUser("", created.Id), ErrUserNotFound)
+	assert.Nil(t, DeleteUser("second", created.Id))
+}
+
+func TestSQLUserStore(t *testing.T) {
+	metadata, err := metadataStore.NewSQLMetadataStore(metadataStore.SQLiteMetadataStoreType, filepath.Join(t.TempDir(), "metadata.db"))
+	assert.Nil(t, err)
+	defer metadata.Close()
+	store, err := NewSQLUserStore(metadata)
+	assert.Nil(t, err)
+
+	user := User{Id: "id", App: "second", Username: "alice", PasswordHash: "hash", Role: ViewerRole}
+	assert.Nil(t, store.Create(user))
+	assert.ErrorIs(t, store.Create(User{Id: "other", Username: "alice", PasswordHash: "hash", Role: ViewerRole}), ErrUserAlreadyExists)
+
+	user.Role = AdminRole
+	assert.Nil(t, store.Update(user))
+	found, err := store.GetByUsername("alice")
+	assert.Nil(t, err)
+	assert.Equal(t, AdminRole, found.Role)
+	assert.Equal(t, "second", found.App)
+
+	assert.Nil(t, store.Delete("id"))
+	assert.ErrorIs(t, store.Delete("id"), ErrUserNotFound)
+	found, err = store.GetById("id")
+	assert.Nil(t, err)
+	assert.Nil(t, found)
+}
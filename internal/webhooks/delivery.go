@@ -0,0 +1,144 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"expo-open-ota/config"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	deliveryTimeout = 10 * time.Second
+	maxRetryDelay   = 10 * time.Minute
+)
+
+var (
+	httpClient = &http.Client{Timeout: deliveryTimeout}
+	inFlight   sync.WaitGroup
+)
+
+// retryDelay doubles the base delay after every failed attempt.
+func retryDelay(attempt int) time.Duration {
+	delay := time.Duration(config.GetIntEnv("WEBHOOKS_RETRY_DELAY_MS", 1)) * time.Millisecond
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// Client errors other than timeouts and rate limiting will not get better by retrying
+func isRetryable(statusCode int) bool {
+	return statusCode == 0 ||
+		statusCode >= 500 ||
+		statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests
+}
+
+// Dispatch sends the event to every subscribed webhook of its app in the background, so that slow or
+// failing endpoints never delay the request that triggered the event.
+func Dispatch(event Event) {
+	store := GetWebhookStore()
+	webhooks, err := ListWebhooks(event.App)
+	if err != nil {
+		log.Printf("Error listing webhooks for event %s: %v", event.Id, err)
+		return
+	}
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+		inFlight.Add(1)
+		go func(webhook Webhook) {
+			defer inFlight.Done()
+			deliverWithRetries(store, webhook, event)
+		}(webhook)
+	}
+}
+
+// Wait blocks until the deliveries in progress, retries included, are over.
+func Wait() {
+	inFlight.Wait()
+}
+
+// Ping sends a single ping event to the webhook and returns the outcome of the attempt.
+func Ping(webhook Webhook) Delivery {
+	store := GetWebhookStore()
+	delivery := deliver(webhook, NewEvent(webhook.App, PingEvent, "", "", ""), 1)
+	if err := store.AddDelivery(delivery); err != nil {
+		log.Printf("Error recording delivery of webhook %s: %v", webhook.Id, err)
+	}
+	return delivery
+}
+
+func deliverWithRetries(store WebhookStore, webhook Webhook, event Event) {
+	maxAttempts := int(config.GetIntEnv("WEBHOOKS_MAX_ATTEMPTS", 1))
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		delivery := deliver(webhook, event, attempt)
+		if err := store.AddDelivery(delivery); err != nil {
+			log.Printf("Error recording delivery of webhook %s: %v", webhook.Id, err)
+		}
+		if delivery.Success {
+			return
+		}
+		if !isRetryable(delivery.StatusCode) || attempt == maxAttempts {
+			log.Printf("Giving up delivering event %s to webhook %s after %d attempts: %s", event.Id, webhook.Id, attempt, delivery.Error)
+			return
+		}
+		time.Sleep(retryDelay(attempt))
+	}
+}
+
+func deliver(webhook Webhook, event Event, attempt int) Delivery {
+	delivery := Delivery{
+		Id:        uuid.New().String(),
+		WebhookId: webhook.Id,
+		EventId:   event.Id,
+		EventType: event.Type,
+		Attempt:   attempt,
+		Time:      time.Now().UTC(),
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "expo-open-ota-webhooks")
+	req.Header.Set("X-Expo-Open-Ota-Event", string(event.Type))
+	req.Header.Set("X-Expo-Open-Ota-Delivery", event.Id)
+	req.Header.Set("X-Expo-Open-Ota-Timestamp", timestamp)
+	req.Header.Set("X-Expo-Open-Ota-Signature", Sign(webhook.Secret, timestamp, body))
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	delivery.StatusCode = resp.StatusCode
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("unexpected status code %d", resp.StatusCode)
+	}
+	return delivery
+}
@@ -0,0 +1,168 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type fileWebhookStoreContent struct {
+	Webhooks   []Webhook  `json:"webhooks"`
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+type FileWebhookStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileWebhookStore(path string) *FileWebhookStore {
+	return &FileWebhookStore{path: path}
+}
+
+func (s *FileWebhookStore) load() (*fileWebhookStoreContent, error) {
+	content := &fileWebhookStoreContent{Webhooks: []Webhook{}, Deliveries: []Delivery{}}
+	raw, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return content, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading webhooks: %w", err)
+	}
+	if err := json.Unmarshal(raw, content); err != nil {
+		return nil, fmt.Errorf("error parsing webhooks: %w", err)
+	}
+	return content, nil
+}
+
+// save writes into a temporary file first so that a crash never leaves a truncated webhook file
+func (s *FileWebhookStore) save(content *fileWebhookStoreContent) error {
+	raw, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.path), ".webhooks-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(raw); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), s.path)
+}
+
+func (s *FileWebhookStore) Create(webhook Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, err := s.load()
+	if err != nil {
+		return err
+	}
+	content.Webhooks = append(content.Webhooks, webhook)
+	return s.save(content)
+}
+
+func (s *FileWebhookStore) List() ([]Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return content.Webhooks, nil
+}
+
+func (s *FileWebhookStore) Get(id string) (*Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range content.Webhooks {
+		if webhook.Id == id {
+			return &webhook, nil
+		}
+	}
+	return nil, ErrWebhookNotFound
+}
+
+func (s *FileWebhookStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i, webhook := range content.Webhooks {
+		if webhook.Id != id {
+			continue
+		}
+		content.Webhooks = append(content.Webhooks[:i], content.Webhooks[i+1:]...)
+		deliveries := content.Deliveries[:0]
+		for _, delivery := range content.Deliveries {
+			if delivery.WebhookId != id {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		content.Deliveries = deliveries
+		return s.save(content)
+	}
+	return ErrWebhookNotFound
+}
+
+// Deliveries are kept oldest first, so that the oldest ones of a webhook are dropped first
+func (s *FileWebhookStore) AddDelivery(delivery Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, err := s.load()
+	if err != nil {
+		return err
+	}
+	content.Deliveries = append(content.Deliveries, delivery)
+	count := 0
+	for _, existing := range content.Deliveries {
+		if existing.WebhookId == delivery.WebhookId {
+			count++
+		}
+	}
+	if count > maxDeliveriesPerWebhook {
+		for i, existing := range content.Deliveries {
+			if existing.WebhookId == delivery.WebhookId {
+				content.Deliveries = append(content.Deliveries[:i], content.Deliveries[i+1:]...)
+				break
+			}
+		}
+	}
+	return s.save(content)
+}
+
+func (s *FileWebhookStore) ListDeliveries(webhookId string, limit int) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []Delivery{}
+	for i := len(content.Deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if content.Deliveries[i].WebhookId == webhookId {
+			deliveries = append(deliveries, content.Deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,189 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/metadataStore"
+	"fmt"
+	"time"
+)
+
+type SQLWebhookStore struct {
+	store *metadataStore.SQLMetadataStore
+}
+
+var webhooksSchema = []string{
+	`CREATE TABLE IF NOT EXISTS webhooks (
+		id TEXT PRIMARY KEY,
+		app TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL,
+		branches TEXT NOT NULL,
+		created_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id TEXT PRIMARY KEY,
+		webhook_id TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		time BIGINT NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		duration_ms BIGINT NOT NULL DEFAULT 0,
+		success BOOLEAN NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, time)`,
+}
+
+// Tables created before webhooks were bound to an app only hold webhooks of the default app
+const addWebhookAppColumn = `ALTER TABLE webhooks ADD COLUMN app TEXT NOT NULL DEFAULT ''`
+
+const webhookColumns = "id, app, name, url, secret, events, branches, created_at"
+
+const deliveryColumns = "id, webhook_id, event_id, event_type, attempt, time, status_code, error, duration_ms, success"
+
+func NewSQLWebhookStore(store *metadataStore.SQLMetadataStore) (*SQLWebhookStore, error) {
+	for _, statement := range webhooksSchema {
+		if _, err := store.DB().Exec(statement); err != nil {
+			return nil, fmt.Errorf("error migrating webhooks tables: %w", err)
+		}
+	}
+	if _, err := store.DB().Exec(`SELECT app FROM webhooks LIMIT 1`); err != nil {
+		if _, err := store.DB().Exec(addWebhookAppColumn); err != nil {
+			return nil, fmt.Errorf("error migrating webhooks tables: %w", err)
+		}
+	}
+	return &SQLWebhookStore{store: store}, nil
+}
+
+func (s *SQLWebhookStore) Create(webhook Webhook) error {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return err
+	}
+	branches, err := json.Marshal(webhook.Branches)
+	if err != nil {
+		return err
+	}
+	query := s.store.Rebind(`INSERT INTO webhooks (` + webhookColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	_, err = s.store.DB().Exec(query,
+		webhook.Id,
+		webhook.App,
+		webhook.Name,
+		webhook.Url,
+		webhook.Secret,
+		string(events),
+		string(branches),
+		webhook.CreatedAt.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating webhook: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLWebhookStore) List() ([]Webhook, error) {
+	return s.queryWebhooks(`SELECT ` + webhookColumns + ` FROM webhooks ORDER BY created_at`)
+}
+
+func (s *SQLWebhookStore) Get(id string) (*Webhook, error) {
+	webhooks, err := s.queryWebhooks(s.store.Rebind(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`), id)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	return &webhooks[0], nil
+}
+
+func (s *SQLWebhookStore) Delete(id string) error {
+	result, err := s.store.DB().Exec(s.store.Rebind(`DELETE FROM webhooks WHERE id = ?`), id)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrWebhookNotFound
+	}
+	if _, err := s.store.DB().Exec(s.store.Rebind(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`), id); err != nil {
+		return fmt.Errorf("error deleting webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLWebhookStore) AddDelivery(delivery Delivery) error {
+	query := s.store.Rebind(`INSERT INTO webhook_deliveries (` + deliveryColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	_, err := s.store.DB().Exec(query,
+		delivery.Id,
+		delivery.WebhookId,
+		delivery.EventId,
+		string(delivery.EventType),
+		delivery.Attempt,
+		delivery.Time.UnixNano(),
+		delivery.StatusCode,
+		delivery.Error,
+		delivery.DurationMs,
+		delivery.Success,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording webhook delivery: %w", err)
+	}
+	prune := s.store.Rebind(`DELETE FROM webhook_deliveries WHERE webhook_id = ? AND id NOT IN (
+		SELECT id FROM webhook_deliveries WHERE webhook_id = ? ORDER BY time DESC LIMIT ?
+	)`)
+	if _, err := s.store.DB().Exec(prune, delivery.WebhookId, delivery.WebhookId, maxDeliveriesPerWebhook); err != nil {
+		return fmt.Errorf("error pruning webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLWebhookStore) ListDeliveries(webhookId string, limit int) ([]Delivery, error) {
+	query := s.store.Rebind(`SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE webhook_id = ? ORDER BY time DESC LIMIT ?`)
+	rows, err := s.store.DB().Query(query, webhookId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var delivery Delivery
+		var eventType string
+		var deliveredAt int64
+		if err := rows.Scan(&delivery.Id, &delivery.WebhookId, &delivery.EventId, &eventType, &delivery.Attempt, &deliveredAt, &delivery.StatusCode, &delivery.Error, &delivery.DurationMs, &delivery.Success); err != nil {
+			return nil, err
+		}
+		delivery.EventType = EventType(eventType)
+		delivery.Time = time.Unix(0, deliveredAt).UTC()
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *SQLWebhookStore) queryWebhooks(query string, args ...interface{}) ([]Webhook, error) {
+	rows, err := s.store.DB().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhooks: %w", err)
+	}
+	defer rows.Close()
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		var events, branches string
+		var createdAt int64
+		if err := rows.Scan(&webhook.Id, &webhook.App, &webhook.Name, &webhook.Url, &webhook.Secret, &events, &branches, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(events), &webhook.Events); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(branches), &webhook.Branches); err != nil {
+			return nil, err
+		}
+		webhook.CreatedAt = time.UnixMilli(createdAt).UTC()
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
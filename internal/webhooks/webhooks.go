@@ -0,0 +1,276 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/metadataStore"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	UpdatePublishedEvent          EventType = "update.published"
+	UpdateRolledBackEvent         EventType = "update.rolledBack"
+	UpdateDeletedEvent            EventType = "update.deleted"
+	UpdateVerificationFailedEvent EventType = "update.verificationFailed"
+	// Sent on demand to check an endpoint, whatever the events it subscribed to
+	PingEvent EventType = "ping"
+)
+
+var ValidEventTypes = []EventType{UpdatePublishedEvent, UpdateRolledBackEvent, UpdateDeletedEvent, UpdateVerificationFailedEvent}
+
+// Every generated secret starts with this prefix
+const SecretPrefix = "whsec_"
+
+// Subscribes to every branch, including branch names containing a "/"
+const AllBranches = "*"
+
+// Only the most recent deliveries of each webhook are kept
+const maxDeliveriesPerWebhook = 100
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+type Webhook struct {
+	Id string `json:"id"`
+	// App is the id of the app whose events the webhook receives, empty for the default app
+	App  string `json:"app,omitempty"`
+	Name string `json:"name"`
+	Url  string `json:"url"`
+	// Key of the HMAC signature of the payloads, only returned once at creation
+	Secret    string      `json:"secret,omitempty"`
+	Events    []EventType `json:"events"`
+	Branches  []string    `json:"branches"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+type Event struct {
+	// Identical on every attempt, so that receivers can ignore the deliveries they already processed
+	Id             string    `json:"id"`
+	App            string    `json:"app,omitempty"`
+	Type           EventType `json:"type"`
+	Time           time.Time `json:"time"`
+	Branch         string    `json:"branch,omitempty"`
+	RuntimeVersion string    `json:"runtimeVersion,omitempty"`
+	UpdateId       string    `json:"updateId,omitempty"`
+	Platform       string    `json:"platform,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+}
+
+// Delivery is one attempt to send an event to a webhook.
+type Delivery struct {
+	Id         string    `json:"id"`
+	WebhookId  string    `json:"webhookId"`
+	EventId    string    `json:"eventId"`
+	EventType  EventType `json:"eventType"`
+	Attempt    int       `json:"attempt"`
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	Success    bool      `json:"success"`
+}
+
+type WebhookStore interface {
+	Create(webhook Webhook) error
+	List() ([]Webhook, error)
+	Get(id string) (*Webhook, error)
+	Delete(id string) error
+	AddDelivery(delivery Delivery) error
+	// ListDeliveries returns the deliveries of the webhook, most recent first
+	ListDeliveries(webhookId string, limit int) ([]Delivery, error)
+}
+
+var (
+	webhookStoreInstance WebhookStore
+	once                 sync.Once
+)
+
+// GetWebhookStore stores the webhooks in the metadata store when it is enabled, and in a local JSON file otherwise.
+func GetWebhookStore() WebhookStore {
+	once.Do(func() {
+		if store, ok := metadataStore.GetMetadataStore().(*metadataStore.SQLMetadataStore); ok {
+			sqlStore, err := NewSQLWebhookStore(store)
+			if err != nil {
+				log.Fatalf("Error initializing webhook store: %v", err)
+			}
+			webhookStoreInstance = sqlStore
+			return
+		}
+		webhookStoreInstance = NewFileWebhookStore(config.GetEnv("WEBHOOKS_FILE_PATH"))
+	})
+	return webhookStoreInstance
+}
+
+func ResetWebhookStoreInstance() {
+	webhookStoreInstance = nil
+	once = sync.Once{}
+}
+
+func NewEvent(app string, eventType EventType, branch string, runtimeVersion string, updateId string) Event {
+	return Event{
+		Id:             uuid.New().String(),
+		App:            app,
+		Type:           eventType,
+		Time:           time.Now().UTC(),
+		Branch:         branch,
+		RuntimeVersion: runtimeVersion,
+		UpdateId:       updateId,
+	}
+}
+
+func IsValidEventType(eventType EventType) bool {
+	for _, validEventType := range ValidEventTypes {
+		if eventType == validEventType {
+			return true
+		}
+	}
+	return false
+}
+
+func validateWebhook(name string, rawUrl string, events []EventType, branches []string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("name is required")
+	}
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if len(events) == 0 {
+		return errors.New("at least one event is required")
+	}
+	for _, eventType := range events {
+		if !IsValidEventType(eventType) {
+			return fmt.Errorf("invalid event: %s", eventType)
+		}
+	}
+	if len(branches) == 0 {
+		return errors.New("at least one branch is required")
+	}
+	for _, branch := range branches {
+		if branch == "" {
+			return errors.New("branch pattern cannot be empty")
+		}
+		if _, err := path.Match(branch, ""); err != nil {
+			return fmt.Errorf("invalid branch pattern %q: %w", branch, err)
+		}
+	}
+	return nil
+}
+
+// CreateWebhook generates the signing secret of a webhook of app and stores it.
+func CreateWebhook(app string, name string, rawUrl string, events []EventType, branches []string) (Webhook, error) {
+	if err := validateWebhook(name, rawUrl, events, branches); err != nil {
+		return Webhook{}, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	webhook := Webhook{
+		Id:        uuid.New().String(),
+		App:       app,
+		Name:      strings.TrimSpace(name),
+		Url:       rawUrl,
+		Secret:    SecretPrefix + base64.RawURLEncoding.EncodeToString(secret),
+		Events:    events,
+		Branches:  branches,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := GetWebhookStore().Create(webhook); err != nil {
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// ListWebhooks returns the webhooks of app.
+func ListWebhooks(app string) ([]Webhook, error) {
+	webhooks, err := GetWebhookStore().List()
+	if err != nil {
+		return nil, err
+	}
+	appWebhooks := []Webhook{}
+	for _, webhook := range webhooks {
+		if webhook.App == app {
+			appWebhooks = append(appWebhooks, webhook)
+		}
+	}
+	return appWebhooks, nil
+}
+
+// GetWebhook returns a webhook of app, the webhooks of other apps are reported as not found.
+func GetWebhook(app string, id string) (*Webhook, error) {
+	webhook, err := GetWebhookStore().Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.App != app {
+		return nil, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook deletes a webhook of app and its deliveries.
+func DeleteWebhook(app string, id string) error {
+	if _, err := GetWebhook(app, id); err != nil {
+		return err
+	}
+	return GetWebhookStore().Delete(id)
+}
+
+// Subscribes checks that the webhook wants the event, which must come from its app. Branch filters are glob patterns (e.g. "release-*").
+func (w Webhook) Subscribes(event Event) bool {
+	if event.App != w.App {
+		return false
+	}
+	if event.Type == PingEvent {
+		return true
+	}
+	subscribed := false
+	for _, eventType := range w.Events {
+		if eventType == event.Type {
+			subscribed = true
+		}
+	}
+	if !subscribed {
+		return false
+	}
+	for _, pattern := range w.Branches {
+		if pattern == AllBranches {
+			return true
+		}
+		if matched, _ := path.Match(pattern, event.Branch); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted strips the secret before the webhook is sent to a client.
+func (w Webhook) Redacted() Webhook {
+	w.Secret = ""
+	return w
+}
+
+// Sign computes the signature sent in the X-Expo-Open-Ota-Signature header. The timestamp is part of
+// the signed content so that receivers can reject replayed deliveries.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,255 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expo-open-ota/internal/metadataStore"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useFileStore(t *testing.T) {
+	t.Helper()
+	os.Setenv("WEBHOOKS_FILE_PATH", filepath.Join(t.TempDir(), "webhooks.json"))
+	os.Setenv("WEBHOOKS_RETRY_DELAY_MS", "1")
+	ResetWebhookStoreInstance()
+	t.Cleanup(func() {
+		Wait()
+		os.Unsetenv("WEBHOOKS_FILE_PATH")
+		os.Unsetenv("WEBHOOKS_RETRY_DELAY_MS")
+		os.Unsetenv("WEBHOOKS_MAX_ATTEMPTS")
+		ResetWebhookStoreInstance()
+	})
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newReceiver answers with the given status codes in turn, then with 200
+func newReceiver(t *testing.T, statusCodes ...int) (*httptest.Server, func() []receivedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []receivedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, receivedRequest{header: r.Header.Clone(), body: body})
+		if len(received) <= len(statusCodes) {
+			w.WriteHeader(statusCodes[len(received)-1])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedRequest{}, received...)
+	}
+}
+
+func TestSubscribes(t *testing.T) {
+	webhook := Webhook{Events: []EventType{UpdatePublishedEvent}, Branches: []string{"main", "release-*"}}
+	assert.True(t, webhook.Subscribes(NewEvent("", UpdatePublishedEvent, "main", "1", "1")))
+	assert.True(t, webhook.Subscribes(NewEvent("", UpdatePublishedEvent, "release-2.0", "1", "1")))
+	assert.False(t, webhook.Subscribes(NewEvent("", UpdatePublishedEvent, "staging", "1", "1")))
+	assert.False(t, webhook.Subscribes(NewEvent("", UpdateDeletedEvent, "main", "1", "1")))
+	assert.True(t, webhook.Subscribes(NewEvent("", PingEvent, "", "", "")))
+
+	everyBranch := Webhook{Events: []EventType{UpdateDeletedEvent}, Branches: []string{AllBranches}}
+	assert.True(t, everyBranch.Subscribes(NewEvent("", UpdateDeletedEvent, "feature/with-slash", "1", "1")))
+}
+
+func TestCreateWebhookValidates(t *testing.T) {
+	useFileStore(t)
+	events := []EventType{UpdatePublishedEvent}
+	_, err := CreateWebhook("", "", "https://example.com", events, []string{"*"})
+	assert.NotNil(t, err)
+	_, err = CreateWebhook("", "slack", "ftp://example.com", events, []string{"*"})
+	assert.NotNil(t, err)
+	_, err = CreateWebhook("", "slack", "/relative", events, []string{"*"})
+	assert.NotNil(t, err)
+	_, err = CreateWebhook("", "slack", "https://example.com", nil, []string{"*"})
+	assert.NotNil(t, err)
+	_, err = CreateWebhook("", "slack", "https://example.com", []EventType{PingEvent}, []string{"*"})
+	assert.NotNil(t, err)
+	_, err = CreateWebhook("", "slack", "https://example.com", events, nil)
+	assert.NotNil(t, err)
+	_, err = CreateWebhook("", "slack", "https://example.com", events, []string{"[invalid"})
+	assert.NotNil(t, err)
+
+	webhook, err := CreateWebhook("", "slack", "https://example.com", events, []string{"*"})
+	assert.Nil(t, err)
+	assert.Contains(t, webhook.Secret, SecretPrefix)
+	assert.Empty(t, webhook.Redacted().Secret)
+}
+
+func TestSign(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`1700000000.{"id":"1"}`))
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), Sign("secret", "1700000000", []byte(`{"id":"1"}`)))
+	assert.NotEqual(t, Sign("secret", "1700000000", []byte(`{}`)), Sign("secret", "1700000001", []byte(`{}`)))
+}
+
+func TestRetryDelay(t *testing.T) {
+	os.Setenv("WEBHOOKS_RETRY_DELAY_MS", "1000")
+	defer os.Unsetenv("WEBHOOKS_RETRY_DELAY_MS")
+	assert.Equal(t, time.Second, retryDelay(1))
+	assert.Equal(t, 4*time.Second, retryDelay(3))
+	assert.Equal(t, maxRetryDelay, retryDelay(30))
+}
+
+func TestDispatchSignsAndRetries(t *testing.T) {
+	useFileStore(t)
+	server, received := newReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	webhook, err := CreateWebhook("", "qa", server.URL, []EventType{UpdatePublishedEvent}, []string{"main"})
+	assert.Nil(t, err)
+	event := NewEvent("", UpdatePublishedEvent, "main", "1", "1700000000000")
+	event.Platform = "ios"
+	Dispatch(event)
+	Dispatch(NewEvent("", UpdatePublishedEvent, "staging", "1", "1700000000001"))
+	Wait()
+
+	requests := received()
+	assert.Len(t, requests, 3)
+	last := requests[2]
+	assert.Equal(t, string(UpdatePublishedEvent), last.header.Get("X-Expo-Open-Ota-Event"))
+	assert.Equal(t, event.Id, last.header.Get("X-Expo-Open-Ota-Delivery"))
+	assert.Equal(t, Sign(webhook.Secret, last.header.Get("X-Expo-Open-Ota-Timestamp"), last.body), last.header.Get("X-Expo-Open-Ota-Signature"))
+	var payload Event
+	assert.Nil(t, json.Unmarshal(last.body, &payload))
+	assert.Equal(t, event.Id, payload.Id)
+	assert.Equal(t, "ios", payload.Platform)
+
+	deliveries, err := GetWebhookStore().ListDeliveries(webhook.Id, 10)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 3)
+	assert.True(t, deliveries[0].Success)
+	assert.Equal(t, 3, deliveries[0].Attempt)
+	assert.Equal(t, http.StatusTooManyRequests, deliveries[1].StatusCode)
+	assert.False(t, deliveries[2].Success)
+}
+
+func TestDispatchDoesNotRetryClientErrors(t *testing.T) {
+	useFileStore(t)
+	server, received := newReceiver(t, http.StatusBadRequest)
+	webhook, err := CreateWebhook("", "qa", server.URL, []EventType{UpdateDeletedEvent}, []string{"*"})
+	assert.Nil(t, err)
+	Dispatch(NewEvent("", UpdateDeletedEvent, "main", "1", "1"))
+	Wait()
+	assert.Len(t, received(), 1)
+	deliveries, err := GetWebhookStore().ListDeliveries(webhook.Id, 10)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, http.StatusBadRequest, deliveries[0].StatusCode)
+}
+
+func TestDispatchGivesUpAfterMaxAttempts(t *testing.T) {
+	useFileStore(t)
+	os.Setenv("WEBHOOKS_MAX_ATTEMPTS", "2")
+	server, received := newReceiver(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	_, err := CreateWebhook("", "qa", server.URL, []EventType{UpdateVerificationFailedEvent}, []string{"*"})
+	assert.Nil(t, err)
+	Dispatch(NewEvent("", UpdateVerificationFailedEvent, "main", "1", "1"))
+	Wait()
+	assert.Len(t, received(), 2)
+}
+
+func TestDispatchOnlyReachesTheWebhooksOfTheApp(t *testing.T) {
+	useFileStore(t)
+	defaultServer, defaultReceived := newReceiver(t)
+	appServer, appReceived := newReceiver(t)
+	_, err := CreateWebhook("", "default", defaultServer.URL, []EventType{UpdatePublishedEvent}, []string{"*"})
+	assert.Nil(t, err)
+	appWebhook, err := CreateWebhook("second", "second", appServer.URL, []EventType{UpdatePublishedEvent}, []string{"*"})
+	assert.Nil(t, err)
+	Dispatch(NewEvent("second", UpdatePublishedEvent, "main", "1", "1"))
+	Wait()
+	assert.Empty(t, defaultReceived())
+	assert.Len(t, appReceived(), 1)
+
+	webhooks, err := ListWebhooks("")
+	assert.Nil(t, err)
+	assert.Len(t, webhooks, 1)
+	_, err = GetWebhook("", appWebhook.Id)
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+	assert.ErrorIs(t, DeleteWebhook("", appWebhook.Id), ErrWebhookNotFound)
+	assert.Nil(t, DeleteWebhook("second", appWebhook.Id))
+}
+
+func TestPingRecordsDelivery(t *testing.T) {
+	useFileStore(t)
+	server, received := newReceiver(t)
+	webhook, err := CreateWebhook("", "qa", server.URL, []EventType{UpdatePublishedEvent}, []string{"main"})
+	assert.Nil(t, err)
+	delivery := Ping(webhook)
+	assert.True(t, delivery.Success)
+	assert.Equal(t, string(PingEvent), received()[0].header.Get("X-Expo-Open-Ota-Event"))
+	deliveries, err := GetWebhookStore().ListDeliveries(webhook.Id, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []Delivery{delivery}, deliveries)
+}
+
+func assertStore(t *testing.T, store WebhookStore) {
+	t.Helper()
+	webhook := Webhook{Id: "1", Name: "qa", Url: "https://example.com", Secret: "whsec_1", Events: []EventType{UpdatePublishedEvent}, Branches: []string{"*"}, CreatedAt: time.UnixMilli(1000).UTC()}
+	other := Webhook{Id: "2", App: "second", Name: "slack", Url: "https://example.com", Secret: "whsec_2", Events: []EventType{UpdateDeletedEvent}, Branches: []string{"main"}, CreatedAt: time.UnixMilli(2000).UTC()}
+	assert.Nil(t, store.Create(webhook))
+	assert.Nil(t, store.Create(other))
+
+	webhooks, err := store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, []Webhook{webhook, other}, webhooks)
+	found, err := store.Get("2")
+	assert.Nil(t, err)
+	assert.Equal(t, other, *found)
+	_, err = store.Get("3")
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+
+	start := time.Now().UTC()
+	for i := 0; i < maxDeliveriesPerWebhook+5; i++ {
+		delivery := Delivery{Id: fmt.Sprintf("delivery-%d", i), WebhookId: "1", EventId: "e", EventType: UpdatePublishedEvent, Attempt: i + 1, Time: start.Add(time.Duration(i) * time.Millisecond), Success: true}
+		assert.Nil(t, store.AddDelivery(delivery))
+	}
+	assert.Nil(t, store.AddDelivery(Delivery{Id: "other", WebhookId: "2", EventId: "e", EventType: UpdateDeletedEvent, Attempt: 1, Time: start}))
+	deliveries, err := store.ListDeliveries("1", 1000)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, maxDeliveriesPerWebhook)
+	assert.Equal(t, maxDeliveriesPerWebhook+5, deliveries[0].Attempt)
+	deliveries, err = store.ListDeliveries("1", 2)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 2)
+
+	assert.Nil(t, store.Delete("2"))
+	assert.ErrorIs(t, store.Delete("2"), ErrWebhookNotFound)
+	deliveries, err = store.ListDeliveries("2", 10)
+	assert.Nil(t, err)
+	assert.Empty(t, deliveries)
+}
+
+func TestFileWebhookStore(t *testing.T) {
+	assertStore(t, NewFileWebhookStore(filepath.Join(t.TempDir(), "webhooks.json")))
+}
+
+func TestSQLWebhookStore(t *testing.T) {
+	store, err := metadataStore.NewSQLMetadataStore(metadataStore.SQLiteMetadataStoreType, filepath.Join(t.TempDir(), "metadata.db"))
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	sqlStore, err := NewSQLWebhookStore(store)
+	assert.Nil(t, err)
+	assertStore(t, sqlStore)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/keyStore"
+	"expo-open-ota/internal/metadataStore"
+	"expo-open-ota/internal/services"
+	"time"
+)
+
+// Option configures a Server. The dependencies left unset are resolved from the environment variables,
+// like the standalone server does.
+type Option func(*settings)
+
+type settings struct {
+	bucket   bucket.Bucket
+	cache    cache2.Cache
+	keys     keyStore.KeysStorage
+	channels services.ChannelResolver
+	noCDN    bool
+	sessions auth.SessionStore
+	// the metadata store is opened by New, which can report its errors
+	metadataStoreType metadataStore.MetadataStoreType
+	metadataStoreDSN  string
+}
+
+// WithLocalStorage keeps the updates in a folder, as STORAGE_MODE=local does.
+func WithLocalStorage(basePath string) Option {
+	return func(s *settings) {
+		s.bucket = &bucket.LocalBucket{BasePath: basePath}
+	}
+}
+
+// WithS3Storage keeps the updates in an S3 bucket, the AWS credentials are still read from the environment.
+func WithS3Storage(bucketName string) Option {
+	return func(s *settings) {
+		s.bucket = &bucket.S3Bucket{BucketName: bucketName}
+	}
+}
+
+// WithMemoryStorage keeps the updates in memory, they are lost when the process exits.
+func WithMemoryStorage() Option {
+	return func(s *settings) {
+		s.bucket = bucket.NewMemoryBucket()
+	}
+}
+
+// WithLocalCache gives the server its own in-memory cache instead of the one configured by CACHE_MODE,
+// which is shared by every server of the process. Zero limits are unbounded.
+func WithLocalCache(maxEntries int, maxBytes int64) Option {
+	return func(s *settings) {
+		s.cache = cache2.NewLocalCache(maxEntries, maxBytes, time.Minute)
+	}
+}
+
+// WithSigningKeys signs the manifests with the given PEM encoded key pair.
+func WithSigningKeys(publicKey string, privateKey string) Option {
+	return func(s *settings) {
+		s.keys = &keyStore.StaticKeysStorage{PublicExpoKey: publicKey, PrivateExpoKey: privateKey}
+	}
+}
+
+// ChannelResolverFunc returns the branch a channel is mapped to, or an empty branch if it is not mapped.
+type ChannelResolverFunc func(channel string) (string, error)
+
+func (f ChannelResolverFunc) ResolveChannel(channelName string) (*services.ExpoChannelMapping, error) {
+	branch, err := f(channelName)
+	if err != nil || branch == "" {
+		return nil, err
+	}
+	return &services.ExpoChannelMapping{Id: channelName, BranchName: branch}, nil
+}
+
+// WithChannelResolver maps the channels to branches without asking the Expo API.
+func WithChannelResolver(resolver ChannelResolverFunc) Option {
+	return func(s *settings) {
+		s.channels = resolver
+	}
+}
+
+// WithoutCDN serves the assets directly even if a CDN is configured.
+func WithoutCDN() Option {
+	return func(s *settings) {
+		s.noCDN = true
+	}
+}
+
+// WithSQLiteMetadataStore indexes the updates in the SQLite database at path instead of the store configured by
+// METADATA_STORE_TYPE. The dashboard sessions are kept in it too, unless WithLocalSessions is set.
+func WithSQLiteMetadataStore(path string) Option {
+	return func(s *settings) {
+		s.metadataStoreType = metadataStore.SQLiteMetadataStoreType
+		s.metadataStoreDSN = path
+	}
+}
+
+// WithPostgresMetadataStore indexes the updates in the Postgres database at dsn instead of the store configured
+// by METADATA_STORE_TYPE. The dashboard sessions are kept in it too, unless WithLocalSessions is set.
+func WithPostgresMetadataStore(dsn string) Option {
+	return func(s *settings) {
+		s.metadataStoreType = metadataStore.PostgresMetadataStoreType
+		s.metadataStoreDSN = dsn
+	}
+}
+
+// WithLocalSessions keeps the dashboard sessions in the memory of the server instead of the store configured
+// by the environment, which is shared by every server of the process. They are lost when the process exits.
+func WithLocalSessions() Option {
+	return func(s *settings) {
+		s.sessions = auth.NewMemorySessionStore()
+	}
+}
@@ -0,0 +1,130 @@
+// Package server embeds expo-open-ota in another Go HTTP service. Its handlers serve the same routes as
+// the standalone server and can be composed with any router, authentication or middleware:
+//
+//	ota, err := server.New(server.WithLocalStorage("/var/lib/updates"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	mux := http.NewServeMux()
+//	mux.Handle("/ota/", http.StripPrefix("/ota", ota.Handler()))
+//
+// BASE_URL must then include the prefix, the manifests and upload URLs are built from it.
+package server
+
+import (
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/cdn"
+	"expo-open-ota/internal/keyStore"
+	"expo-open-ota/internal/metadataStore"
+	infrastructure "expo-open-ota/internal/router"
+	"expo-open-ota/internal/services"
+	"fmt"
+	"net/http"
+)
+
+type Server struct {
+	server *infrastructure.Server
+	// metadata is the store opened from the options, closed with the server
+	metadata *metadataStore.SQLMetadataStore
+}
+
+func New(options ...Option) (*Server, error) {
+	var s settings
+	for _, option := range options {
+		option(&s)
+	}
+	deps := infrastructure.Dependencies{
+		Bucket:   s.bucket,
+		Cache:    s.cache,
+		KeyStore: s.keys,
+		Channels: s.channels,
+		Sessions: s.sessions,
+	}
+	var metadata *metadataStore.SQLMetadataStore
+	if s.metadataStoreType != metadataStore.NoMetadataStoreType {
+		store, err := metadataStore.NewSQLMetadataStore(s.metadataStoreType, s.metadataStoreDSN)
+		if err != nil {
+			return nil, err
+		}
+		metadata = store
+		deps.MetadataStore = store
+		if deps.Sessions == nil {
+			sessions, err := auth.NewSQLSessionStore(store, "")
+			if err != nil {
+				store.Close()
+				return nil, err
+			}
+			deps.Sessions = sessions
+		}
+	}
+	if deps.Bucket == nil {
+		deps.Bucket = bucket.GetBucket()
+	}
+	if deps.Cache == nil {
+		deps.Cache = cache2.GetCache()
+	}
+	if deps.KeyStore == nil {
+		keys, err := keyStore.GetKeysStorage()
+		if err != nil {
+			return nil, fmt.Errorf("error resolving key store: %w", err)
+		}
+		deps.KeyStore = keys
+	}
+	if deps.Channels == nil {
+		deps.Channels = services.ExpoChannelResolver{}
+	}
+	if !s.noCDN {
+		deps.CDN = cdn.GetCDN()
+	}
+	server, err := infrastructure.NewServer(deps)
+	if err != nil {
+		if metadata != nil {
+			metadata.Close()
+		}
+		return nil, err
+	}
+	return &Server{server: server, metadata: metadata}, nil
+}
+
+// ManifestHandler serves the manifests requested by expo-updates, mount it where the apps expect /manifest.
+func (s *Server) ManifestHandler() http.Handler {
+	return s.server.ManifestHandler()
+}
+
+// AssetsHandler serves the assets linked by the manifests, mount it where BASE_URL expects /assets.
+func (s *Server) AssetsHandler() http.Handler {
+	return s.server.AssetsHandler()
+}
+
+// UploadHandler serves the /requestUploadUrl, /uploadLocalFile and /markUpdateAsUploaded routes eoas
+// publishes updates with.
+func (s *Server) UploadHandler() http.Handler {
+	return s.server.UploadRouter()
+}
+
+// DashboardAPIHandler serves the /auth and /api routes of the dashboard.
+func (s *Server) DashboardAPIHandler() http.Handler {
+	return s.server.DashboardApiRouter()
+}
+
+// Handler serves every route of the standalone server.
+func (s *Server) Handler() http.Handler {
+	return s.server.NewRouter()
+}
+
+// Drain makes the /ready route of Handler answer 503, so that the load balancers stop routing to the
+// embedding service before it shuts down.
+func (s *Server) Drain() {
+	s.server.Drain()
+}
+
+// Close closes the metadata store opened from the options, the stores configured by the environment are
+// left open for the other servers of the process.
+func (s *Server) Close() error {
+	if s.metadata == nil {
+		return nil
+	}
+	return s.metadata.Close()
+}
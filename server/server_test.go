@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/metadataStore"
+	"expo-open-ota/testkit"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func generateKeys(t *testing.T) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func newMemoryServer(t *testing.T, publicKey string, privateKey string, options ...Option) *Server {
+	ota, err := New(append([]Option{
+		WithMemoryStorage(),
+		WithLocalCache(0, 0),
+		WithSigningKeys(publicKey, privateKey),
+		WithoutCDN(),
+		WithChannelResolver(func(channel string) (string, error) {
+			switch channel {
+			case "production":
+				return "main", nil
+			case "broken":
+				return "", errors.New("resolver unavailable")
+			}
+			return "", nil
+		}),
+	}, options...)...)
+	assert.Nil(t, err)
+	t.Cleanup(func() { ota.Close() })
+	_, err = testkit.NewUpdate("main", "1", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)).
+		WithBundle("ios", "console.log('embedded')").
+		Build(ota.server.Updates().Bucket())
+	assert.Nil(t, err)
+	return ota
+}
+
+func TestManifestHandlerMountedUnderPrefix(t *testing.T) {
+	publicKey, privateKey := generateKeys(t)
+	ota := newMemoryServer(t, publicKey, privateKey)
+	mux := http.NewServeMux()
+	mux.Handle("/ota/", http.StripPrefix("/ota", ota.Handler()))
+
+	r := testkit.ManifestRequest("ios", "1", "production")
+	r.URL.Path = "/ota/manifest"
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	parts, err := testkit.ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	assert.Nil(t, err)
+	for _, part := range parts {
+		if testkit.IsMultipartPartWithName(part, "manifest") {
+			assert.Nil(t, testkit.VerifySignature(publicKey, part.Headers["Expo-Signature"], part.Body))
+		}
+	}
+
+	w = httptest.NewRecorder()
+	ota.ManifestHandler().ServeHTTP(w, testkit.ManifestRequest("ios", "1", "unknown"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	ota.ManifestHandler().ServeHTTP(w, testkit.ManifestRequest("ios", "1", "broken"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestHandlersServeOnlyTheirRoutes(t *testing.T) {
+	t.Setenv("USE_DASHBOARD", "true")
+	publicKey, privateKey := generateKeys(t)
+	ota := newMemoryServer(t, publicKey, privateKey)
+
+	w := httptest.NewRecorder()
+	ota.UploadHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/manifest", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	ota.UploadHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/markUpdateAsUploaded/main", nil))
+	assert.NotEqual(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	ota.DashboardAPIHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/methods", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	ota.DashboardAPIHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/branches", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAuditEventsAreKeptInTheServerBucket(t *testing.T) {
+	localPath := t.TempDir()
+	t.Setenv("LOCAL_BUCKET_BASE_PATH", localPath)
+	publicKey, privateKey := generateKeys(t)
+	ota := newMemoryServer(t, publicKey, privateKey)
+
+	r := httptest.NewRequest(http.MethodPost, "/requestUploadUrl/main?runtimeVersion=1&platform=ios", nil)
+	w := httptest.NewRecorder()
+	ota.UploadHandler().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	storage := ota.server.Updates().Bucket().(bucket.ObjectStorage)
+	keys, err := storage.ListObjects(bucket.InternalFolder + "/audit/")
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	entries, err := os.ReadDir(localPath)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func setupDashboard(t *testing.T) {
+	t.Setenv("USE_DASHBOARD", "true")
+	t.Setenv("ADMIN_PASSWORD", "admin")
+	t.Setenv("JWT_SECRET", "test_jwt_secret")
+	t.Setenv("EXPO_ACCESS_TOKEN", "expo_access_token")
+}
+
+func dashboardLogin(t *testing.T, ota *Server) string {
+	form := url.Values{}
+	form.Set("password", "admin")
+	r := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	ota.DashboardAPIHandler().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response auth.AuthResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Token
+}
+
+func getSettings(ota *Server, token string) int {
+	r := httptest.NewRequest(http.MethodGet, "/api/settings", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ota.DashboardAPIHandler().ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestServersKeepTheirOwnSessions(t *testing.T) {
+	setupDashboard(t)
+	publicKey, privateKey := generateKeys(t)
+	first := newMemoryServer(t, publicKey, privateKey, WithLocalSessions())
+	second := newMemoryServer(t, publicKey, privateKey, WithLocalSessions())
+
+	token := dashboardLogin(t, first)
+	assert.Equal(t, http.StatusOK, getSettings(first, token))
+	assert.Equal(t, http.StatusUnauthorized, getSettings(second, token))
+}
+
+func TestServerIndexesUpdatesInItsMetadataStore(t *testing.T) {
+	setupDashboard(t)
+	publicKey, privateKey := generateKeys(t)
+	ota := newMemoryServer(t, publicKey, privateKey, WithSQLiteMetadataStore(filepath.Join(t.TempDir(), "metadata.db")))
+	assert.Nil(t, metadataStore.GetMetadataStore())
+
+	store := ota.server.Updates().MetadataStore()
+	assert.NotNil(t, store)
+	synchronized, err := ota.server.Updates().SyncMetadataStoreFromBucket()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, synchronized)
+	count, err := store.CountUpdates()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	token := dashboardLogin(t, ota)
+	assert.Equal(t, http.StatusOK, getSettings(ota, token))
+	assert.Equal(t, http.StatusUnauthorized, getSettings(newMemoryServer(t, publicKey, privateKey), token))
+}
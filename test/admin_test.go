@@ -0,0 +1,242 @@
+package test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"expo-open-ota/testkit"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func adminHarness(t *testing.T) *testkit.Harness {
+	harness := testkit.New(t)
+	t.Setenv("USE_DASHBOARD", "true")
+	t.Setenv("ADMIN_PASSWORD", "admin")
+	return harness
+}
+
+func adminToken(t *testing.T, harness *testkit.Harness) string {
+	form := url.Values{}
+	form.Set("password", "admin")
+	r := httptest.NewRequest(http.MethodPost, "http://localhost:3000/auth/login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := harness.Do(r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response auth.AuthResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Token
+}
+
+func adminRequest(harness *testkit.Harness, token string, method string, path string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "http://localhost:3000"+path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	return harness.Do(r)
+}
+
+// servedPart returns the name and content of the manifest or directive served to a client.
+func servedPart(t *testing.T, harness *testkit.Harness, platform string, channel string) (string, map[string]interface{}) {
+	t.Helper()
+	r := testkit.ManifestRequest(platform, "1", channel)
+	// Clients only follow a rollback directive when they tell their embedded update
+	r.Header.Set("expo-embedded-update-id", "embedded")
+	w := harness.Do(r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	parts, err := testkit.ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	assert.Nil(t, err)
+	for _, part := range parts {
+		if testkit.IsMultipartPartWithName(part, "manifest") || testkit.IsMultipartPartWithName(part, "directive") {
+			var content map[string]interface{}
+			assert.Nil(t, json.Unmarshal([]byte(part.Body), &content))
+			return part.Name, content
+		}
+	}
+	t.Fatalf("no manifest nor directive served")
+	return "", nil
+}
+
+func bundleKey(platform string, content string) string {
+	hash := md5.Sum([]byte(content))
+	return url.QueryEscape("bundles/" + platform + "-" + hex.EncodeToString(hash[:]))
+}
+
+func TestPromoteUpdateToAnotherBranch(t *testing.T) {
+	harness := adminHarness(t)
+	harness.Expo.MapChannel("production", "production")
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, err := harness.AddUpdate(testkit.NewUpdate("production", "1", createdAt).WithBundle("ios", "old"))
+	assert.Nil(t, err)
+	staging, err := harness.AddUpdate(testkit.NewUpdate("staging", "1", createdAt.Add(time.Hour)).WithBundle("ios", "tested").WithCommitHash("abc"))
+	assert.Nil(t, err)
+
+	token := adminToken(t, harness)
+	w := adminRequest(harness, token, http.MethodPost, "/api/branch/staging/runtimeVersion/1/updates/"+staging.UpdateId+"/promote", `{"branch":"production"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var promoted types.Update
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &promoted))
+	assert.Equal(t, "production", promoted.Branch)
+	assert.NotEqual(t, staging.UpdateId, promoted.UpdateId)
+
+	name, manifest := servedPart(t, harness, "ios", "production")
+	assert.Equal(t, "manifest", name)
+	assert.Contains(t, launchAssetUrl(manifest), bundleKey("ios", "tested"))
+	commitHash, _, err := update.DefaultManager().RetrieveUpdateCommitHashAndPlatform(promoted)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", commitHash)
+
+	w = adminRequest(harness, token, http.MethodPost, "/api/branch/staging/runtimeVersion/1/updates/1/promote", `{"branch":"production"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = adminRequest(harness, token, http.MethodPost, "/api/branch/staging/runtimeVersion/1/updates/"+staging.UpdateId+"/promote", `{"branch":".hidden"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = adminRequest(harness, "", http.MethodPost, "/api/branch/staging/runtimeVersion/1/updates/"+staging.UpdateId+"/promote", `{"branch":"production"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestPromoteUpdateWithApiKey(t *testing.T) {
+	harness := adminHarness(t)
+	harness.Expo.MapChannel("production", "production")
+	staging, err := harness.AddUpdate(testkit.NewUpdate("staging", "1", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)).WithBundle("ios", "tested"))
+	assert.Nil(t, err)
+	token := adminToken(t, harness)
+	createKey := func(body string) string {
+		w := adminRequest(harness, token, http.MethodPost, "/api/apiKeys", body)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created handlers.CreateApiKeyResponse
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return created.Key
+	}
+	promoteKey := createKey(`{"name":"ci","branches":["production"],"actions":["promote"]}`)
+	publishKey := createKey(`{"name":"ci","branches":["*"],"actions":["publish"]}`)
+	path := "/promoteUpdate/staging?runtimeVersion=1&updateId=" + staging.UpdateId
+
+	w := adminRequest(harness, publishKey, http.MethodPost, path, `{"branch":"production"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = adminRequest(harness, promoteKey, http.MethodPost, path, `{"branch":"preview"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = adminRequest(harness, "eoota_invalid", http.MethodPost, path, `{"branch":"production"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = adminRequest(harness, promoteKey, http.MethodPost, path, `{"branch":"production"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	name, manifest := servedPart(t, harness, "ios", "production")
+	assert.Equal(t, "manifest", name)
+	assert.Contains(t, launchAssetUrl(manifest), bundleKey("ios", "tested"))
+
+	// The Expo account owning the app is allowed too, like on the upload endpoints
+	w = adminRequest(harness, testkit.AccessToken, http.MethodPost, path, `{"branch":"preview"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
+
+func TestRollbackToPreviousAndEmbeddedUpdate(t *testing.T) {
+	harness := adminHarness(t)
+	harness.Expo.MapChannel("production", "main")
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	previous, err := harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt).WithBundle("ios", "previous"))
+	assert.Nil(t, err)
+	_, err = harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt.Add(time.Hour)).WithBundle("ios", "broken"))
+	assert.Nil(t, err)
+
+	token := adminToken(t, harness)
+	w := adminRequest(harness, token, http.MethodPost, "/api/branch/main/runtimeVersion/1/rollback", `{"updateId":"`+previous.UpdateId+`"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	_, manifest := servedPart(t, harness, "ios", "production")
+	assert.Contains(t, launchAssetUrl(manifest), bundleKey("ios", "previous"))
+
+	w = adminRequest(harness, token, http.MethodPost, "/api/branch/main/runtimeVersion/1/rollback", "")
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	name, directive := servedPart(t, harness, "ios", "production")
+	assert.Equal(t, "directive", name)
+	assert.Equal(t, "rollBackToEmbedded", directive["type"])
+}
+
+func TestDeleteUpdate(t *testing.T) {
+	harness := adminHarness(t)
+	harness.Expo.MapChannel("production", "main")
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, err := harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt).WithBundle("ios", "previous"))
+	assert.Nil(t, err)
+	latest, err := harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt.Add(time.Hour)).WithBundle("ios", "latest"))
+	assert.Nil(t, err)
+	_, manifest := servedPart(t, harness, "ios", "production")
+	assert.Contains(t, launchAssetUrl(manifest), bundleKey("ios", "latest"))
+
+	path := "/api/branch/main/runtimeVersion/1/updates/" + latest.UpdateId
+	token := adminToken(t, harness)
+	w := adminRequest(harness, token, http.MethodDelete, path, "")
+	assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	_, manifest = servedPart(t, harness, "ios", "production")
+	assert.Contains(t, launchAssetUrl(manifest), bundleKey("ios", "previous"))
+
+	w = adminRequest(harness, token, http.MethodDelete, path, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCollectGarbage(t *testing.T) {
+	harness := adminHarness(t)
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		_, err := harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt.Add(time.Duration(i)*time.Hour)).WithBundle("ios", "bundle"))
+		assert.Nil(t, err)
+	}
+	abandoned, err := harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt.Add(5*time.Hour)).WithBundle("ios", "partial").Uncommitted())
+	assert.Nil(t, err)
+	recent, err := harness.AddUpdate(testkit.NewUpdate("main", "1", time.Now()).WithBundle("ios", "uploading").Uncommitted())
+	assert.Nil(t, err)
+
+	token := adminToken(t, harness)
+	w := adminRequest(harness, token, http.MethodPost, "/api/gc?keep=1&dryRun=true", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response handlers.GarbageCollectionResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.DryRun)
+	assert.Equal(t, 5, response.Scanned)
+	assert.Len(t, response.Deleted, 3)
+	assert.Equal(t, update.GCDeletion{Branch: "main", RuntimeVersion: "1", UpdateId: abandoned.UpdateId, Reason: update.UncommittedReason}, response.Deleted[0])
+	updates, err := harness.Bucket.GetUpdates("main", "1")
+	assert.Nil(t, err)
+	assert.Len(t, updates, 5)
+
+	w = adminRequest(harness, token, http.MethodPost, "/api/gc?keep=1", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	updates, err = harness.Bucket.GetUpdates("main", "1")
+	assert.Nil(t, err)
+	remaining := []string{}
+	for _, u := range updates {
+		remaining = append(remaining, u.UpdateId)
+	}
+	latest, err := update.DefaultManager().GetLatestUpdateBundlePathForRuntimeVersion("main", "1")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{latest.UpdateId, recent.UpdateId}, remaining)
+
+	w = adminRequest(harness, token, http.MethodPost, "/api/gc?keep=-1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestVerifyStorageOnlyReports(t *testing.T) {
+	harness := adminHarness(t)
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, err := harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt).WithBundle("ios", "bundle"))
+	assert.Nil(t, err)
+	unchecked, err := harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt.Add(time.Hour)).WithBundle("ios", "partial").Uncommitted())
+	assert.Nil(t, err)
+
+	token := adminToken(t, harness)
+	w := adminRequest(harness, token, http.MethodGet, "/api/verify", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report update.ReindexReport
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 2, report.Updates)
+	assert.Equal(t, 1, report.CheckedUpdates)
+	assert.Equal(t, 0, report.WarmedManifests)
+	assert.NotNil(t, findIssue(report, update.UncheckedUpdateIssue, "main", unchecked.UpdateId))
+}
@@ -0,0 +1,215 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupApiKeys(t *testing.T) {
+	t.Helper()
+	os.Setenv("API_KEYS_FILE_PATH", filepath.Join(t.TempDir(), "apiKeys.json"))
+	t.Cleanup(func() {
+		os.Unsetenv("API_KEYS_FILE_PATH")
+	})
+}
+
+func createApiKey(t *testing.T, body string) (*httptest.ResponseRecorder, handlers.CreateApiKeyResponse) {
+	t.Helper()
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/apiKeys", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
+	router.ServeHTTP(respRec, req)
+	var response handlers.CreateApiKeyResponse
+	_ = json.Unmarshal(respRec.Body.Bytes(), &response)
+	return respRec, response
+}
+
+func TestCreateAndListApiKeys(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupApiKeys(t)
+	respRec, created := createApiKey(t, `{"name":"ci","branches":["DO_NOT_USE"],"actions":["publish"]}`)
+	assert.Equal(t, http.StatusCreated, respRec.Code)
+	assert.True(t, strings.HasPrefix(created.Key, "eoota_"))
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	assert.Empty(t, created.Hash)
+
+	router := newRouter(t)
+	listRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/apiKeys", nil)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
+	router.ServeHTTP(listRec, req)
+	assert.Equal(t, http.StatusOK, listRec.Code)
+	assert.NotContains(t, listRec.Body.String(), "hash")
+	assert.NotContains(t, listRec.Body.String(), created.Key)
+	var keys []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(listRec.Body.Bytes(), &keys))
+	assert.Len(t, keys, 1)
+	assert.Equal(t, "ci", keys[0]["name"])
+	assert.Equal(t, created.Id, keys[0]["id"])
+}
+
+func TestCreateApiKeyWithInvalidScopes(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupApiKeys(t)
+	respRec, _ := createApiKey(t, `{"name":"ci","branches":["DO_NOT_USE"],"actions":["deleteEverything"]}`)
+	assert.Equal(t, http.StatusBadRequest, respRec.Code)
+	respRec, _ = createApiKey(t, `{"name":"ci","branches":[],"actions":["publish"]}`)
+	assert.Equal(t, http.StatusBadRequest, respRec.Code)
+}
+
+func TestApiKeysWithoutAuth(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/apiKeys", nil)
+	router.ServeHTTP(respRec, req)
+	assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+}
+
+func TestPublishWithApiKey(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupApiKeys(t)
+	mockExpoForRequestUploadUrlTest("staging")
+	_, created := createApiKey(t, `{"name":"ci","branches":["DO_NOT_USE"],"actions":["publish"]}`)
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "/test/test-updates/branch-1/1/1674170951")
+	updateId := performUploadWithAuthorization(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath, "Bearer "+created.Key)
+	w := markUpdateAsUploadedWithAuthorization(t, "DO_NOT_USE", "1", updateId, "Bearer "+created.Key)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestPublishWithApiKeyWhileExpoIsUnreachable(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupApiKeys(t)
+	_, created := createApiKey(t, `{"name":"ci","branches":["DO_NOT_USE"],"actions":["publish"]}`)
+	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql", httpmock.NewErrorResponder(errors.New("connection refused")))
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "/test/test-updates/branch-1/1/1674170951")
+	updateId := performUploadWithAuthorization(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath, "Bearer "+created.Key)
+	w := markUpdateAsUploadedWithAuthorization(t, "DO_NOT_USE", "1", updateId, "Bearer "+created.Key)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestMarkUpdateAsUploadedAuthenticatesBeforeCallingExpo(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupApiKeys(t)
+	mockExpoForRequestUploadUrlTest("staging")
+	w := markUpdateAsUploadedWithAuthorization(t, "DO_NOT_USE", "1", "1674170951", "Bearer eoota_unknown")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Zero(t, httpmock.GetTotalCallCount())
+}
+
+func TestApiKeyOutOfBranchScope(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupApiKeys(t)
+	mockExpoForRequestUploadUrlTest("staging")
+	_, created := createApiKey(t, `{"name":"ci","branches":["release-*"],"actions":["publish","rollback"]}`)
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "/test/test-updates/branch-1/1/1674170951")
+	w, _, _, r := createUploadRequest(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath, "Authorization", "Bearer "+created.Key)
+	envHandlers(t).RequestUploadUrlHandler(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "Api key is not allowed to publish on branch DO_NOT_USE\n", w.Body.String())
+}
+
+func TestApiKeyWithoutPublishAction(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupApiKeys(t)
+	mockExpoForRequestUploadUrlTest("staging")
+	_, created := createApiKey(t, `{"name":"ci","branches":["*"],"actions":["rollback"]}`)
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "/test/test-updates/branch-1/1/1674170951")
+	w, _, _, r := createUploadRequest(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath, "Authorization", "Bearer "+created.Key)
+	envHandlers(t).RequestUploadUrlHandler(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestRollbackApiKeyWithMetadataStore(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupApiKeys(t)
+	setupMetadataStore(t)
+	mockExpoForRequestUploadUrlTest("staging")
+	_, created := createApiKey(t, `{"name":"ci","branches":["*"],"actions":["rollback"]}`)
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := t.TempDir()
+	assert.Nil(t, os.CopyFS(sampleUpdatePath, os.DirFS(filepath.Join(projectRoot, "/test/test-updates/branch-1/1/1674170951"))))
+	assert.Nil(t, os.WriteFile(filepath.Join(sampleUpdatePath, "rollback"), nil, 0644))
+	input := ComputeUploadRequestsInput(sampleUpdatePath)
+	input.FileNames = append(input.FileNames, "rollback")
+	updateId := performUploadWithInput(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath, "Bearer "+created.Key, input)
+	// The record created with the upload URLs does not know yet that the update is a rollback
+	w := markUpdateAsUploadedWithAuthorization(t, "DO_NOT_USE", "1", updateId, "Bearer "+created.Key)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	currentUpdate := types.Update{Branch: "DO_NOT_USE", RuntimeVersion: "1", UpdateId: updateId}
+	assert.Equal(t, types.Rollback, update.DefaultManager().GetUpdateType(currentUpdate))
+}
+
+func TestRevokedApiKey(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupApiKeys(t)
+	mockExpoForRequestUploadUrlTest("staging")
+	_, created := createApiKey(t, `{"name":"ci","branches":["*"],"actions":["publish"]}`)
+
+	router := newRouter(t)
+	revokeRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/apiKeys/%s", created.Id), nil)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
+	router.ServeHTTP(revokeRec, req)
+	assert.Equal(t, http.StatusNoContent, revokeRec.Code)
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "/test/test-updates/branch-1/1/1674170951")
+	w, _, _, r := createUploadRequest(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath, "Authorization", "Bearer "+created.Key)
+	envHandlers(t).RequestUploadUrlHandler(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Invalid api key\n", w.Body.String())
+
+	notFoundRec := httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/apiKeys/unknown", nil)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
+	router.ServeHTTP(notFoundRec, req)
+	assert.Equal(t, http.StatusNotFound, notFoundRec.Code)
+}
@@ -0,0 +1,278 @@
+package test
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/apiKeys"
+	"expo-open-ota/internal/apps"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/handlers"
+	infrastructure "expo-open-ota/internal/router"
+	"expo-open-ota/internal/users"
+	"expo-open-ota/internal/webhooks"
+	"expo-open-ota/testkit"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeAppsConfig(t *testing.T, hostedApps []apps.App) string {
+	content, err := json.Marshal(hostedApps)
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "apps.json")
+	assert.Nil(t, os.WriteFile(path, content, 0644))
+	return path
+}
+
+func getManifest(t *testing.T, handler http.Handler, r *http.Request, publicKey string) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	parts, err := testkit.ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	assert.Nil(t, err)
+	var manifest map[string]interface{}
+	for _, part := range parts {
+		if testkit.IsMultipartPartWithName(part, "manifest") {
+			assert.Nil(t, testkit.VerifySignature(publicKey, part.Headers["Expo-Signature"], part.Body))
+			assert.Nil(t, json.Unmarshal([]byte(part.Body), &manifest))
+		}
+	}
+	return manifest
+}
+
+func launchAssetUrl(manifest map[string]interface{}) string {
+	launchAsset, _ := manifest["launchAsset"].(map[string]interface{})
+	assetUrl, _ := launchAsset["url"].(string)
+	return assetUrl
+}
+
+func TestAppsAreServedApartFromTheDefaultApp(t *testing.T) {
+	harness := testkit.New(t)
+	projectRoot, err := findProjectRoot()
+	assert.Nil(t, err)
+	second := apps.App{
+		Id:              "second",
+		ExpoAppId:       "SECOND_APP_ID",
+		ExpoAccessToken: testkit.AccessToken,
+		PublicKeyPath:   filepath.Join(projectRoot, "test/keys/public-key-test.pem"),
+		PrivateKeyPath:  filepath.Join(projectRoot, "test/keys/private-key-test.pem"),
+	}
+	t.Setenv("APPS_CONFIG_PATH", writeAppsConfig(t, []apps.App{second}))
+	hostedApps, err := apps.GetApps()
+	assert.Nil(t, err)
+	assert.Len(t, hostedApps, 1)
+
+	server, err := infrastructure.NewServer(envDependencies(t))
+	assert.Nil(t, err)
+	appServer, err := infrastructure.NewAppServerFromEnv(hostedApps[0])
+	assert.Nil(t, err)
+	router := server.NewAppsRouter([]*infrastructure.Server{appServer})
+
+	harness.Expo.MapChannel("production", "main")
+	harness.Expo.MapAppChannel("SECOND_APP_ID", "production", "second-main")
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, err = harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt).WithBundle("ios", "console.log('default')"))
+	assert.Nil(t, err)
+	_, err = testkit.NewUpdate("second-main", "1", createdAt).
+		WithBundle("ios", "console.log('second')").
+		Build(appServer.Updates().Bucket())
+	assert.Nil(t, err)
+	secondPublicKey, err := os.ReadFile(second.PublicKeyPath)
+	assert.Nil(t, err)
+
+	manifest := getManifest(t, router, testkit.ManifestRequest("ios", "1", "production"), harness.PublicKey)
+	assert.True(t, strings.HasPrefix(launchAssetUrl(manifest), "http://localhost:3000/assets?"))
+
+	r := testkit.ManifestRequest("ios", "1", "production")
+	r.URL.Path = "/apps/second/manifest"
+	manifest = getManifest(t, router, r, string(secondPublicKey))
+	assetUrl := launchAssetUrl(manifest)
+	assert.True(t, strings.HasPrefix(assetUrl, "http://localhost:3000/apps/second/assets?"), assetUrl)
+
+	r = testkit.ManifestRequest("ios", "1", "production")
+	r.Header.Set("expo-project-id", "SECOND_APP_ID")
+	assert.Equal(t, assetUrl, launchAssetUrl(getManifest(t, router, r, string(secondPublicKey))))
+
+	parsedUrl, err := url.Parse(assetUrl)
+	assert.Nil(t, err)
+	r = httptest.NewRequest(http.MethodGet, parsedUrl.RequestURI(), nil)
+	r.Header.Set("expo-channel-name", "production")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	body, err := io.ReadAll(w.Result().Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "console.log('second')", string(body))
+
+	branches, err := harness.Bucket.GetBranches()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"main"}, branches)
+	appBranches, err := appServer.Updates().Bucket().GetBranches()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"second-main"}, appBranches)
+}
+
+func TestAppUploadUrlsAreServedUnderTheAppPrefix(t *testing.T) {
+	testkit.New(t)
+	appBucket, err := bucket.NewAppBucket("second", "http://localhost:3000/apps/second")
+	assert.Nil(t, err)
+	uploadUrl, err := appBucket.RequestUploadUrlForFileUpdate("main", "1", "1000", "metadata.json", "apiKey:1")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(uploadUrl, "http://localhost:3000/apps/second/uploadLocalFile?token="), uploadUrl)
+
+	parsedUrl, err := url.Parse(uploadUrl)
+	assert.Nil(t, err)
+	token := parsedUrl.Query().Get("token")
+	_, err = bucket.ValidateUploadTokenAndResolveFilePath(appBucket, token, "apiKey:1")
+	assert.Nil(t, err)
+	// A token minted for an app cannot write into the bucket of another one
+	_, err = bucket.ValidateUploadTokenAndResolveFilePath(bucket.NewMemoryBucket(), token, "apiKey:1")
+	assert.NotNil(t, err)
+	// Nor be used by another principal
+	_, err = bucket.ValidateUploadTokenAndResolveFilePath(appBucket, token, "apiKey:2")
+	assert.NotNil(t, err)
+}
+
+func TestApiKeysOnlyPublishToTheirApp(t *testing.T) {
+	harness := adminHarness(t)
+	projectRoot, err := findProjectRoot()
+	assert.Nil(t, err)
+	second := apps.App{
+		Id:              "second",
+		ExpoAppId:       "SECOND_APP_ID",
+		ExpoAccessToken: testkit.AccessToken,
+		PublicKeyPath:   filepath.Join(projectRoot, "test/keys/public-key-test.pem"),
+		PrivateKeyPath:  filepath.Join(projectRoot, "test/keys/private-key-test.pem"),
+	}
+	server, err := infrastructure.NewServer(envDependencies(t))
+	assert.Nil(t, err)
+	appServer, err := infrastructure.NewAppServerFromEnv(second)
+	assert.Nil(t, err)
+	router := server.NewAppsRouter([]*infrastructure.Server{appServer})
+	token := adminToken(t, harness)
+	do := func(method string, path string, authorization string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://localhost:3000"+path, strings.NewReader(body))
+		r.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	appToken := appLogin(t, router, "/apps/second", url.Values{"password": {"admin"}})
+	tokens := map[string]string{"": token, "/apps/second": appToken}
+	createKey := func(prefix string) handlers.CreateApiKeyResponse {
+		w := do(http.MethodPost, prefix+"/api/apiKeys", "Bearer "+tokens[prefix], `{"name":"ci","branches":["*"],"actions":["publish"]}`)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created handlers.CreateApiKeyResponse
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return created
+	}
+	defaultKey := createKey("")
+	appKey := createKey("/apps/second")
+	assert.Equal(t, "second", appKey.App)
+
+	requestUploadUrl := func(prefix string, key string) int {
+		return do(http.MethodPost, prefix+"/requestUploadUrl/main?runtimeVersion=1&platform=android", "Bearer "+key, `{"fileNames":["metadata.json"]}`).Code
+	}
+	assert.Equal(t, http.StatusOK, requestUploadUrl("/apps/second", appKey.Key))
+	assert.Equal(t, http.StatusUnauthorized, requestUploadUrl("/apps/second", defaultKey.Key))
+	assert.Equal(t, http.StatusOK, requestUploadUrl("", defaultKey.Key))
+	assert.Equal(t, http.StatusUnauthorized, requestUploadUrl("", appKey.Key))
+
+	w := do(http.MethodGet, "/apps/second/api/apiKeys", "Bearer "+appToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var keys []apiKeys.ApiKey
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	assert.Len(t, keys, 1)
+	assert.Equal(t, appKey.Id, keys[0].Id)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/apps/second/api/apiKeys/"+defaultKey.Id, "Bearer "+appToken, "").Code)
+	assert.Equal(t, http.StatusOK, requestUploadUrl("", defaultKey.Key))
+}
+
+// appLogin signs in to the app served under prefix and returns the access token.
+func appLogin(t *testing.T, router http.Handler, prefix string, form url.Values) string {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "http://localhost:3000"+prefix+"/auth/login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response auth.AuthResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Token
+}
+
+func TestDashboardApiIsScopedToTheApp(t *testing.T) {
+	adminHarness(t)
+	t.Setenv("USERS_FILE_PATH", filepath.Join(t.TempDir(), "users.json"))
+	t.Setenv("WEBHOOKS_FILE_PATH", filepath.Join(t.TempDir(), "webhooks.json"))
+	projectRoot, err := findProjectRoot()
+	assert.Nil(t, err)
+	second := apps.App{
+		Id:              "second",
+		ExpoAppId:       "SECOND_APP_ID",
+		ExpoAccessToken: testkit.AccessToken,
+		PublicKeyPath:   filepath.Join(projectRoot, "test/keys/public-key-test.pem"),
+		PrivateKeyPath:  filepath.Join(projectRoot, "test/keys/private-key-test.pem"),
+	}
+	server, err := infrastructure.NewServer(envDependencies(t))
+	assert.Nil(t, err)
+	appServer, err := infrastructure.NewAppServerFromEnv(second)
+	assert.Nil(t, err)
+	router := server.NewAppsRouter([]*infrastructure.Server{appServer})
+	do := func(method string, path string, token string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://localhost:3000"+path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	defaultToken := appLogin(t, router, "", url.Values{"password": {"admin"}})
+	appToken := appLogin(t, router, "/apps/second", url.Values{"password": {"admin"}})
+
+	// A token is only accepted by the routes of the app it was issued for
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/apps/second/api/me", defaultToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/me", appToken, "").Code)
+
+	w := do(http.MethodPost, "/apps/second/api/webhooks", appToken, `{"name":"qa","url":"https://example.com","events":["update.published"],"branches":["*"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var webhook webhooks.Webhook
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &webhook))
+	assert.Equal(t, "second", webhook.App)
+	w = do(http.MethodGet, "/api/webhooks", defaultToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/webhooks/"+webhook.Id, defaultToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/webhooks/"+webhook.Id+"/deliveries", defaultToken, "").Code)
+
+	w = do(http.MethodPost, "/apps/second/api/users", appToken, `{"username":"alice","password":"password123","role":"publisher"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var user users.User
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &user))
+	w = do(http.MethodGet, "/api/users", defaultToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPatch, "/api/users/"+user.Id, defaultToken, `{"role":"admin"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/users/"+user.Id, defaultToken, "").Code)
+	credentials := url.Values{"username": {"alice"}, "password": {"password123"}}
+	r := httptest.NewRequest(http.MethodPost, "http://localhost:3000/auth/login", strings.NewReader(credentials.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	userToken := appLogin(t, router, "/apps/second", credentials)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/apps/second/api/me", userToken, "").Code)
+
+	// Revoking the sessions of an app leaves the other apps signed in
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/apps/second/api/sessions", appToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/apps/second/api/me", userToken, "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/me", defaultToken, "").Code)
+}
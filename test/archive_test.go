@@ -0,0 +1,165 @@
+package test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/update"
+	"expo-open-ota/testkit"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type archiveEntry struct {
+	name    string
+	content []byte
+}
+
+func readArchive(t *testing.T, archive []byte) []archiveEntry {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(archive))
+	assert.Nil(t, err)
+	tarReader := tar.NewReader(gzipReader)
+	var entries []archiveEntry
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries
+		}
+		assert.Nil(t, err)
+		content, err := io.ReadAll(tarReader)
+		assert.Nil(t, err)
+		entries = append(entries, archiveEntry{name: header.Name, content: content})
+	}
+}
+
+func writeArchive(t *testing.T, entries []archiveEntry) []byte {
+	var archive bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		assert.Nil(t, tarWriter.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}))
+		_, err := tarWriter.Write(entry.content)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tarWriter.Close())
+	assert.Nil(t, gzipWriter.Close())
+	return archive.Bytes()
+}
+
+func exportArchive(t *testing.T, harness *testkit.Harness, token string, path string) []byte {
+	w := adminRequest(harness, token, http.MethodGet, path+"/export", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	return w.Body.Bytes()
+}
+
+func importArchive(harness *testkit.Harness, token string, branch string, archive []byte) *httptest.ResponseRecorder {
+	return adminRequest(harness, token, http.MethodPost, "/api/branch/"+branch+"/import", string(archive))
+}
+
+func TestExportAndImportUpdate(t *testing.T) {
+	harness := adminHarness(t)
+	harness.Expo.MapChannel("production", "production")
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	staging, err := harness.AddUpdate(testkit.NewUpdate("staging", "1", createdAt).WithBundle("ios", "tested").WithAsset("ios", "png", "image").WithCommitHash("abc"))
+	assert.Nil(t, err)
+
+	token := adminToken(t, harness)
+	archive := exportArchive(t, harness, token, "/api/branch/staging/runtimeVersion/1/updates/"+staging.UpdateId)
+	entries := readArchive(t, archive)
+	assert.Equal(t, "manifest.json", entries[0].name)
+	assert.Equal(t, "manifest.json.sig", entries[1].name)
+	var manifest update.ArchiveManifest
+	assert.Nil(t, json.Unmarshal(entries[0].content, &manifest))
+	assert.Equal(t, staging.UpdateId, manifest.UpdateId)
+	assert.Len(t, manifest.Files, len(entries)-2)
+	for i, file := range manifest.Files {
+		assert.Equal(t, "files/"+file.Path, entries[i+2].name)
+		assert.NotEqual(t, update.CommitFile, file.Path)
+	}
+
+	w := importArchive(harness, token, "production", archive)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var response handlers.ImportUpdateResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "production", response.Update.Branch)
+	assert.Equal(t, "1", response.Update.RuntimeVersion)
+	assert.Equal(t, "staging", response.Source.Branch)
+
+	name, served := servedPart(t, harness, "ios", "production")
+	assert.Equal(t, "manifest", name)
+	assert.Contains(t, launchAssetUrl(served), bundleKey("ios", "tested"))
+	commitHash, _, err := update.DefaultManager().RetrieveUpdateCommitHashAndPlatform(response.Update)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", commitHash)
+
+	w = adminRequest(harness, token, http.MethodGet, "/api/branch/staging/runtimeVersion/1/updates/1/export", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = adminRequest(harness, "", http.MethodPost, "/api/branch/production/import", string(archive))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestImportRejectsInvalidArchives(t *testing.T) {
+	harness := adminHarness(t)
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	staging, err := harness.AddUpdate(testkit.NewUpdate("staging", "1", createdAt).WithBundle("ios", "tested"))
+	assert.Nil(t, err)
+	token := adminToken(t, harness)
+	archive := exportArchive(t, harness, token, "/api/branch/staging/runtimeVersion/1/updates/"+staging.UpdateId)
+
+	entries := readArchive(t, archive)
+	tampered := append([]archiveEntry{}, entries...)
+	last := len(tampered) - 1
+	tampered[last] = archiveEntry{name: tampered[last].name, content: append(append([]byte{}, tampered[last].content[:len(tampered[last].content)-1]...), '!')}
+	w := importArchive(harness, token, "production", writeArchive(t, tampered))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "checksum")
+	// The files written before the mismatch was found are removed
+	updates, err := harness.Bucket.GetUpdates("production", "1")
+	assert.Nil(t, err)
+	assert.Empty(t, updates)
+
+	w = importArchive(harness, token, "production", writeArchive(t, entries[:len(entries)-1]))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "missing")
+	w = importArchive(harness, token, "production", []byte("not an archive"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = importArchive(harness, token, ".hidden", archive)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	t.Setenv("ARCHIVE_MAX_BYTES", "64")
+	w = importArchive(harness, token, "production", archive)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestImportArchiveOfAnotherServer(t *testing.T) {
+	exporting := adminHarness(t)
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	staging, err := exporting.AddUpdate(testkit.NewUpdate("staging", "1", createdAt).WithBundle("android", "tested"))
+	assert.Nil(t, err)
+	archive := exportArchive(t, exporting, adminToken(t, exporting), "/api/branch/staging/runtimeVersion/1/updates/"+staging.UpdateId)
+	trustedKey := filepath.Join(t.TempDir(), "archive-public-key.pem")
+	assert.Nil(t, os.WriteFile(trustedKey, []byte(exporting.PublicKey), 0600))
+
+	importing := adminHarness(t)
+	token := adminToken(t, importing)
+	w := importArchive(importing, token, "main", archive)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "signature")
+
+	t.Setenv("ARCHIVE_PUBLIC_KEY_PATH", trustedKey)
+	w = importArchive(importing, token, "main", archive)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	updates, err := importing.Bucket.GetUpdates("main", "1")
+	assert.Nil(t, err)
+	assert.Len(t, updates, 1)
+}
@@ -5,7 +5,6 @@ import (
 	"compress/gzip"
 	"expo-open-ota/internal/assets"
 	"expo-open-ota/internal/cdn"
-	"expo-open-ota/internal/handlers"
 	"expo-open-ota/internal/update"
 	"github.com/andybalholm/brotli"
 	"github.com/gorilla/mux"
@@ -19,6 +18,10 @@ import (
 	"testing"
 )
 
+func handleAssetsWithFile(req assets.AssetsRequest) (assets.AssetsResponse, error) {
+	return assets.HandleAssetsWithFile(update.DefaultManager(), req)
+}
+
 func TestEmptyAssetNameForAssets(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
@@ -38,7 +41,7 @@ func TestEmptyAssetNameForAssets(t *testing.T) {
 		assert.Equal(t, "No asset name provided", string(response.Body), "Expected 'No asset name provided' message")
 	}
 	t.Run("Test HandleAssetsWithFile", func(t *testing.T) {
-		testEmptyAssetName(t, assets.HandleAssetsWithFile)
+		testEmptyAssetName(t, handleAssetsWithFile)
 	})
 
 	t.Run("Test HandleAssetsWithURL", func(t *testing.T) {
@@ -46,7 +49,7 @@ func TestEmptyAssetNameForAssets(t *testing.T) {
 			os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 			os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 			os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-			return assets.HandleAssetsWithURL(req, &cdn.CloudfrontCDN{})
+			return assets.HandleAssetsWithURL(update.DefaultManager(), req, &cdn.CloudfrontCDN{})
 		})
 	})
 }
@@ -70,14 +73,14 @@ func TestBadPlatformForAssets(t *testing.T) {
 		assert.Equal(t, "Invalid platform", string(response.Body), "Expected 'Invalid platform' message")
 	}
 	t.Run("Test HandleAssetsWithFile", func(t *testing.T) {
-		testInvalidPlatform(t, assets.HandleAssetsWithFile)
+		testInvalidPlatform(t, handleAssetsWithFile)
 	})
 	t.Run("Test HandleAssetsWithURL", func(t *testing.T) {
 		testInvalidPlatform(t, func(req assets.AssetsRequest) (assets.AssetsResponse, error) {
 			os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 			os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 			os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-			return assets.HandleAssetsWithURL(req, &cdn.CloudfrontCDN{})
+			return assets.HandleAssetsWithURL(update.DefaultManager(), req, &cdn.CloudfrontCDN{})
 		})
 	})
 }
@@ -101,14 +104,14 @@ func TestMissingRuntimeVersionForAssets(t *testing.T) {
 	}
 	projectRoot, _ := findProjectRoot()
 	t.Run("Test HandleAssetsWithFile", func(t *testing.T) {
-		testMissingRuntimeVersion(t, assets.HandleAssetsWithFile)
+		testMissingRuntimeVersion(t, handleAssetsWithFile)
 	})
 	t.Run("Test HandleAssetsWithURL", func(t *testing.T) {
 		testMissingRuntimeVersion(t, func(req assets.AssetsRequest) (assets.AssetsResponse, error) {
 			os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 			os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 			os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-			return assets.HandleAssetsWithURL(req, &cdn.CloudfrontCDN{})
+			return assets.HandleAssetsWithURL(update.DefaultManager(), req, &cdn.CloudfrontCDN{})
 		})
 	})
 }
@@ -132,14 +135,14 @@ func TestEmptyUpdatesForAssets(t *testing.T) {
 	}
 	projectRoot, _ := findProjectRoot()
 	t.Run("Test HandleAssetsWithFile", func(t *testing.T) {
-		testEmptyUpdates(t, assets.HandleAssetsWithFile)
+		testEmptyUpdates(t, handleAssetsWithFile)
 	})
 	t.Run("Test HandleAssetsWithURL", func(t *testing.T) {
 		testEmptyUpdates(t, func(req assets.AssetsRequest) (assets.AssetsResponse, error) {
 			os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 			os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 			os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-			return assets.HandleAssetsWithURL(req, &cdn.CloudfrontCDN{})
+			return assets.HandleAssetsWithURL(update.DefaultManager(), req, &cdn.CloudfrontCDN{})
 		})
 	})
 }
@@ -163,14 +166,14 @@ func TestBadRuntimeVersion(t *testing.T) {
 	}
 	projectRoot, _ := findProjectRoot()
 	t.Run("Test HandleAssetsWithFile", func(t *testing.T) {
-		testBadRuntimeVersion(t, assets.HandleAssetsWithFile)
+		testBadRuntimeVersion(t, handleAssetsWithFile)
 	})
 	t.Run("Test HandleAssetsWithURL", func(t *testing.T) {
 		testBadRuntimeVersion(t, func(req assets.AssetsRequest) (assets.AssetsResponse, error) {
 			os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 			os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 			os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-			return assets.HandleAssetsWithURL(req, &cdn.CloudfrontCDN{})
+			return assets.HandleAssetsWithURL(update.DefaultManager(), req, &cdn.CloudfrontCDN{})
 		})
 	})
 }
@@ -190,12 +193,12 @@ func TestToRetrieveBundleAsset(t *testing.T) {
 	os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 	os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 	os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-	response, err := assets.HandleAssetsWithFile(asset)
+	response, err := assets.HandleAssetsWithFile(update.DefaultManager(), asset)
 	assert.Nil(t, err, "Expected no error")
 	assert.Equal(t, 200, response.StatusCode, "Expected status code 200")
 	assert.Equal(t, "application/javascript", response.ContentType, "Expected content type 'application/javascript'")
 	assert.Empty(t, response.URL, "Expected URL to be empty")
-	responseWithUrl, err := assets.HandleAssetsWithURL(asset, &cdn.CloudfrontCDN{})
+	responseWithUrl, err := assets.HandleAssetsWithURL(update.DefaultManager(), asset, &cdn.CloudfrontCDN{})
 	assert.Nil(t, err, "Expected no error")
 	assert.Equal(t, 200, responseWithUrl.StatusCode, "Expected status code 200")
 	assert.Empty(t, responseWithUrl.Body, "Expected empty body")
@@ -221,7 +224,7 @@ func TestToRetrieveBundleAssetWithGzipCompression(t *testing.T) {
 	r.Header.Set("Accept-Encoding", "gzip")
 	r.Header.Set("expo-channel-name", "staging")
 
-	handlers.AssetsHandler(w, r)
+	envHandlers(t).AssetsHandler(w, r)
 
 	assert.Equal(t, 200, w.Code, "Expected status code 200")
 
@@ -266,7 +269,7 @@ func TestToRetrieveBundleAssetWithBrotliCompression(t *testing.T) {
 	r.Header.Set("Accept-Encoding", "br")
 	r.Header.Set("expo-channel-name", "staging")
 
-	handlers.AssetsHandler(w, r)
+	envHandlers(t).AssetsHandler(w, r)
 
 	assert.Equal(t, 200, w.Code, "Expected status code 200")
 
@@ -309,7 +312,7 @@ func TestToRetrievePNGAssetWithGzipCompression(t *testing.T) {
 		"BRANCH": "staging",
 	})
 
-	handlers.AssetsHandler(w, r)
+	envHandlers(t).AssetsHandler(w, r)
 
 	assert.Equal(t, 200, w.Code, "Expected status code 200")
 
@@ -340,7 +343,7 @@ func TestAutomaticUrlRedirectionIfCDNIsSet(t *testing.T) {
 	r.Header.Set("Accept-Encoding", "gzip")
 	r.Header.Set("expo-channel-name", "staging")
 
-	handlers.AssetsHandler(w, r)
+	envHandlers(t).AssetsHandler(w, r)
 
 	assert.Equal(t, 302, w.Code, "Expected status code 302")
 }
@@ -361,7 +364,7 @@ func TestPreventCDNRedirectionHeader(t *testing.T) {
 	r.Header.Set("prevent-cdn-redirection", "true")
 	r.Header.Set("expo-channel-name", "staging")
 
-	handlers.AssetsHandler(w, r)
+	envHandlers(t).AssetsHandler(w, r)
 
 	assert.Equal(t, 200, w.Code, "Expected status code 200")
 }
@@ -0,0 +1,147 @@
+package test
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/audit"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getAuditEvents(t *testing.T, token string, query string) []audit.Event {
+	t.Helper()
+	respRec := performAuthenticatedRequest(t, "GET", "/api/audit?"+query, token)
+	assert.Equal(t, http.StatusOK, respRec.Code, respRec.Body.String())
+	var events []audit.Event
+	assert.Nil(t, json.Unmarshal(respRec.Body.Bytes(), &events))
+	return events
+}
+
+func TestAuditRecordsLogins(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	token := login(t).Token
+	createUser(t, token, `{"username":"alice","password":"password123","role":"viewer"}`)
+	loginWithCredentials(t, "alice", "wrong-password")
+	loginWithCredentials(t, "alice", "password123")
+
+	events := getAuditEvents(t, token, "action=auth.login")
+	assert.Len(t, events, 3)
+	// Most recent first
+	assert.Equal(t, audit.SuccessOutcome, events[0].Outcome)
+	assert.Equal(t, "alice", events[0].Actor.Name)
+	assert.Equal(t, audit.DeniedOutcome, events[1].Outcome)
+	assert.Equal(t, http.StatusUnauthorized, events[1].StatusCode)
+	assert.Equal(t, audit.SuccessOutcome, events[2].Outcome)
+
+	events = getAuditEvents(t, token, "action=auth.login&outcome=denied")
+	assert.Len(t, events, 1)
+	events = getAuditEvents(t, token, "action=user.create")
+	assert.Len(t, events, 1)
+	assert.Equal(t, audit.UserActor, events[0].Actor.Type)
+}
+
+func TestAuditRecordsDeniedActions(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	token := login(t).Token
+	createUser(t, token, `{"username":"viewer","password":"password123","role":"viewer"}`)
+	_, response := loginWithCredentials(t, "viewer", "password123")
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "DELETE", "/api/branch/branch-1/runtimeVersion/1", response.Token).Code)
+
+	events := getAuditEvents(t, token, "action=runtimeVersion.delete")
+	assert.Len(t, events, 1)
+	assert.Equal(t, audit.DeniedOutcome, events[0].Outcome)
+	assert.Equal(t, "viewer", events[0].Actor.Name)
+	assert.Equal(t, "branch-1", events[0].Target.Branch)
+	assert.Equal(t, "1", events[0].Target.RuntimeVersion)
+
+	events = getAuditEvents(t, token, "actor=viewer")
+	assert.Len(t, events, 2)
+}
+
+func TestAuditRecordsRequestMetadata(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	token := login(t).Token
+	router := newRouter(t)
+	req := httptest.NewRequest("GET", "/api/settings", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Request-Id", "request-1")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	events := getAuditEvents(t, token, "action=settings.read")
+	assert.Len(t, events, 1)
+	assert.Equal(t, "request-1", events[0].RequestId)
+	assert.Equal(t, "203.0.113.7, 10.0.0.1", events[0].ForwardedFor)
+	assert.NotEmpty(t, events[0].Ip)
+}
+
+func TestAuditRecordsApiKeyActor(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupApiKeys(t)
+	mockExpoForRequestUploadUrlTest("staging")
+	_, created := createApiKey(t, `{"name":"ci","branches":["release-*"],"actions":["publish"]}`)
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "/test/test-updates/branch-1/1/1674170951")
+	w, _, _, r := createUploadRequest(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath, "Authorization", "Bearer "+created.Key)
+	newRouter(t).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	events := getAuditEvents(t, login(t).Token, "action=update.requestUploadUrl&branch=DO_NOT_USE")
+	assert.Len(t, events, 1)
+	assert.Equal(t, "1", events[0].Target.RuntimeVersion)
+	assert.Equal(t, audit.ApiKeyActor, events[0].Actor.Type)
+	assert.Equal(t, "ci", events[0].Actor.Name)
+	assert.Equal(t, audit.DeniedOutcome, events[0].Outcome)
+}
+
+func TestAuditQueryValidation(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	token := login(t).Token
+	assert.Equal(t, http.StatusBadRequest, performAuthenticatedRequest(t, "GET", "/api/audit?from=yesterday", token).Code)
+	assert.Equal(t, http.StatusBadRequest, performAuthenticatedRequest(t, "GET", "/api/audit?limit=-1", token).Code)
+	performAuthenticatedRequest(t, "GET", "/api/settings", token)
+	performAuthenticatedRequest(t, "GET", "/api/settings", token)
+	assert.Len(t, getAuditEvents(t, token, "action=settings.read&limit=1"), 1)
+	assert.Empty(t, getAuditEvents(t, token, "action=settings.read&to=2000-01-01T00:00:00Z"))
+}
+
+func TestAuditRequiresAdmin(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	createUser(t, login(t).Token, `{"username":"publisher","password":"password123","role":"publisher"}`)
+	_, response := loginWithCredentials(t, "publisher", "password123")
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "GET", "/api/audit", response.Token).Code)
+	assert.Equal(t, http.StatusUnauthorized, performAuthenticatedRequest(t, "GET", "/api/audit", "invalid").Code)
+}
+
+func TestAuditDisabled(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("AUDIT_LOG_SINK", "none")
+	defer os.Unsetenv("AUDIT_LOG_SINK")
+	assert.Equal(t, http.StatusNotImplemented, performAuthenticatedRequest(t, "GET", "/api/audit", login(t).Token).Code)
+}
+
+func TestAuditLogSinkCannotBeQueried(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("AUDIT_LOG_SINK", "log")
+	defer os.Unsetenv("AUDIT_LOG_SINK")
+	assert.Equal(t, http.StatusNotImplemented, performAuthenticatedRequest(t, "GET", "/api/audit", login(t).Token).Code)
+}
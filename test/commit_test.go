@@ -0,0 +1,61 @@
+package test
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkUpdateAsUploadedWritesCommit(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, sampleUpdatePath := sampleUpdate(t)
+	updateId := performUpload(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath)
+	uploaded := types.Update{Branch: "DO_NOT_USE", RuntimeVersion: "1", UpdateId: updateId}
+	// Uploaded files are not served before the update is committed
+	assert.False(t, update.DefaultManager().IsUpdateValid(uploaded))
+
+	assert.Equal(t, http.StatusOK, markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId).Code)
+	assert.True(t, update.DefaultManager().IsUpdateValid(uploaded))
+	content, err := os.ReadFile(filepath.Join(projectRoot, "updates", "DO_NOT_USE", "1", updateId, update.CommitFile))
+	assert.Nil(t, err)
+	var commit update.Commit
+	assert.Nil(t, json.Unmarshal(content, &commit))
+	assert.Equal(t, updateId, commit.UpdateId)
+	assert.Equal(t, "DO_NOT_USE", commit.Branch)
+	assert.False(t, commit.CommittedAt.IsZero())
+}
+
+func TestUpdatesWithoutValidCommitAreNotServed(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, sampleUpdatePath := sampleUpdate(t)
+	first := performUpload(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath)
+	assert.Equal(t, http.StatusOK, markUpdateAsUploaded(t, "DO_NOT_USE", "1", first).Code)
+	second := performUpload(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath)
+	commitPath := func(updateId string) string {
+		return filepath.Join(projectRoot, "updates", "DO_NOT_USE", "1", updateId, update.CommitFile)
+	}
+	content, err := os.ReadFile(commitPath(first))
+	assert.Nil(t, err)
+
+	// A commit interrupted mid-write, or copied from another update, does not commit the update
+	assert.Nil(t, os.WriteFile(commitPath(second), content[:len(content)/2], 0644))
+	_, err = update.DefaultManager().ReadCommit(types.Update{Branch: "DO_NOT_USE", RuntimeVersion: "1", UpdateId: second})
+	assert.ErrorIs(t, err, update.ErrUpdateNotCommitted)
+	assert.False(t, update.DefaultManager().IsUpdateValid(types.Update{Branch: "DO_NOT_USE", RuntimeVersion: "1", UpdateId: second}))
+	assert.Nil(t, os.WriteFile(commitPath(second), content, 0644))
+	assert.False(t, update.DefaultManager().IsUpdateValid(types.Update{Branch: "DO_NOT_USE", RuntimeVersion: "1", UpdateId: second}))
+
+	// Markers written by previous versions are still trusted
+	assert.Nil(t, os.WriteFile(commitPath(second), []byte(".check"), 0644))
+	assert.True(t, update.DefaultManager().IsUpdateValid(types.Update{Branch: "DO_NOT_USE", RuntimeVersion: "1", UpdateId: second}))
+}
@@ -5,7 +5,6 @@ import (
 	"expo-open-ota/internal/auth"
 	"expo-open-ota/internal/bucket"
 	"expo-open-ota/internal/handlers"
-	infrastructure "expo-open-ota/internal/router"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -21,7 +20,7 @@ func TestLoginDashboardNotEnabled(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
 	os.Setenv("USE_DASHBOARD", "false")
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/auth/login", nil)
 	router.ServeHTTP(respRec, req)
@@ -32,7 +31,7 @@ func TestLoginDashboardNotEnabled(t *testing.T) {
 func TestLoginInvalidPassword(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	formData := url.Values{}
 	formData.Set("password", "wrongpassword")
@@ -46,7 +45,7 @@ func TestShouldRejectLoginIfAdminPasswordNotSet(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
 	os.Setenv("ADMIN_PASSWORD", "")
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	formData := url.Values{}
 	formData.Set("password", "admin")
@@ -59,7 +58,7 @@ func TestShouldRejectLoginIfAdminPasswordNotSet(t *testing.T) {
 func TestLoginValidPassword(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	formData := url.Values{}
 	formData.Set("password", "admin")
@@ -77,8 +76,8 @@ func TestLoginValidPassword(t *testing.T) {
 	assert.NotEmpty(t, response.RefreshToken)
 }
 
-func login() auth.AuthResponse {
-	router := infrastructure.NewRouter()
+func login(t *testing.T) auth.AuthResponse {
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	formData := url.Values{}
 	formData.Set("password", "admin")
@@ -94,10 +93,10 @@ func login() auth.AuthResponse {
 func TestRefreshToken(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	formData := url.Values{}
-	formData.Set("refreshToken", login().RefreshToken)
+	formData.Set("refreshToken", login(t).RefreshToken)
 	req, _ := http.NewRequest("POST", "/auth/refreshToken", strings.NewReader(formData.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	router.ServeHTTP(respRec, req)
@@ -113,10 +112,10 @@ func TestRefreshToken(t *testing.T) {
 func TestSettings(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/api/settings", nil)
-	req.Header.Set("Authorization", "Bearer "+login().Token)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
 	router.ServeHTTP(respRec, req)
 
 	assert.Equal(t, http.StatusOK, respRec.Code)
@@ -130,7 +129,7 @@ func TestSettings(t *testing.T) {
 	responseBody = strings.ReplaceAll(responseBody, projectRoot+"/keys/public-key-test.pem", "{PROJECT_ROOT}/test/keys/public-key-test.pem")
 	responseBody = strings.ReplaceAll(responseBody, projectRoot+"/keys/private-key-test.pem", "{PROJECT_ROOT}/test/keys/private-key-test.pem")
 
-	expectedSnapshot := `{"BASE_URL":"http://localhost:3000","EXPO_APP_ID":"EXPO_APP_ID","EXPO_ACCESS_TOKEN":"***EXPO_","CACHE_MODE":"","REDIS_HOST":"","REDIS_PORT":"","STORAGE_MODE":"local","S3_BUCKET_NAME":"","LOCAL_BUCKET_BASE_PATH":"{PROJECT_ROOT}/test/test-updates","KEYS_STORAGE_TYPE":"local","AWSSM_EXPO_PUBLIC_KEY_SECRET_ID":"","AWSSM_EXPO_PRIVATE_KEY_SECRET_ID":"","PUBLIC_EXPO_KEY_B64":"","PUBLIC_LOCAL_EXPO_KEY_PATH":"{PROJECT_ROOT}/test/keys/public-key-test.pem","PRIVATE_LOCAL_EXPO_KEY_PATH":"{PROJECT_ROOT}/test/keys/private-key-test.pem","AWS_REGION":"eu-west-3","AWS_ACCESS_KEY_ID":"","CLOUDFRONT_DOMAIN":"","CLOUDFRONT_KEY_PAIR_ID":"","CLOUDFRONT_PRIVATE_KEY_B64":"","AWSSM_CLOUDFRONT_PRIVATE_KEY_SECRET_ID":"","PRIVATE_LOCAL_CLOUDFRONT_KEY_PATH":"","PROMETHEUS_ENABLED":""}`
+	expectedSnapshot := `{"BASE_URL":"http://localhost:3000","EXPO_APP_ID":"EXPO_APP_ID","EXPO_ACCESS_TOKEN":"***EXPO_","CACHE_MODE":"","REDIS_HOST":"","REDIS_PORT":"","REDIS_MODE":"standalone","REDIS_DB":"0","REDIS_KEY_PREFIX":"expo-open-ota","STORAGE_MODE":"local","S3_BUCKET_NAME":"","LOCAL_BUCKET_BASE_PATH":"{PROJECT_ROOT}/test/test-updates","KEYS_STORAGE_TYPE":"local","AWSSM_EXPO_PUBLIC_KEY_SECRET_ID":"","AWSSM_EXPO_PRIVATE_KEY_SECRET_ID":"","PUBLIC_EXPO_KEY_B64":"","PUBLIC_LOCAL_EXPO_KEY_PATH":"{PROJECT_ROOT}/test/keys/public-key-test.pem","PRIVATE_LOCAL_EXPO_KEY_PATH":"{PROJECT_ROOT}/test/keys/private-key-test.pem","AWS_REGION":"eu-west-3","AWS_ACCESS_KEY_ID":"","CLOUDFRONT_DOMAIN":"","CLOUDFRONT_KEY_PAIR_ID":"","CLOUDFRONT_PRIVATE_KEY_B64":"","AWSSM_CLOUDFRONT_PRIVATE_KEY_SECRET_ID":"","PRIVATE_LOCAL_CLOUDFRONT_KEY_PATH":"","PROMETHEUS_ENABLED":""}`
 
 	assert.Equal(t, expectedSnapshot, responseBody)
 }
@@ -138,7 +137,7 @@ func TestSettings(t *testing.T) {
 func TestSettingsWithoutAuth(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/api/settings", nil)
 	router.ServeHTTP(respRec, req)
@@ -148,14 +147,14 @@ func TestSettingsWithoutAuth(t *testing.T) {
 func TestBranches(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql",
 		func(req *http.Request) (*http.Response, error) {
 			return MockExpoBranchesMappingResponse([]map[string]interface{}{{"id": "branch-1", "name": "branch-1"}, {"id": "branch-2", "name": "branch-2"}}, []map[string]interface{}{{"id": "staging", "name": "staging", "branchMapping": "{\"data\":[{\"branchId\":\"branch-1\",\"branchMappingLogic\":\"true\"}],\"version\":0}"}})
 		})
 	req, _ := http.NewRequest("GET", "/api/branches", nil)
-	req.Header.Set("Authorization", "Bearer "+login().Token)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
 	router.ServeHTTP(respRec, req)
 	assert.Equal(t, http.StatusOK, respRec.Code)
 
@@ -168,7 +167,7 @@ func TestBranches(t *testing.T) {
 func TestBranchesWithoutAuth(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/api/branches", nil)
 	router.ServeHTTP(respRec, req)
@@ -178,7 +177,7 @@ func TestBranchesWithoutAuth(t *testing.T) {
 func TestRuntimeVersionsWithoutAuth(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/api/branch/branch-1/runtimeVersions", nil)
 	router.ServeHTTP(respRec, req)
@@ -188,14 +187,14 @@ func TestRuntimeVersionsWithoutAuth(t *testing.T) {
 func TestRuntimeVersions(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql",
 		func(req *http.Request) (*http.Response, error) {
 			return MockExpoBranchesMappingResponse([]map[string]interface{}{{"id": "branch-1", "name": "branch-1"}, {"id": "branch-2", "name": "branch-2"}}, []map[string]interface{}{{"id": "staging", "name": "staging", "branchMapping": "{\"data\":[{\"branchId\":\"branch-1\",\"branchMappingLogic\":\"true\"}],\"version\":0}"}})
 		})
 	req, _ := http.NewRequest("GET", "/api/branch/branch-1/runtimeVersions", nil)
-	req.Header.Set("Authorization", "Bearer "+login().Token)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
 	router.ServeHTTP(respRec, req)
 	assert.Equal(t, http.StatusOK, respRec.Code)
 	var response []bucket.RuntimeVersionWithStats
@@ -207,7 +206,7 @@ func TestRuntimeVersions(t *testing.T) {
 func TestUpdatesWithoutAuth(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/api/branch/branch-1/runtimeVersion/1/updates", nil)
 	router.ServeHTTP(respRec, req)
@@ -217,14 +216,14 @@ func TestUpdatesWithoutAuth(t *testing.T) {
 func TestUpdatesRegularBranch1(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql",
 		func(req *http.Request) (*http.Response, error) {
 			return MockExpoBranchesMappingResponse([]map[string]interface{}{{"id": "branch-1", "name": "branch-1"}, {"id": "branch-2", "name": "branch-2"}}, []map[string]interface{}{{"id": "staging", "name": "staging", "branchMapping": "{\"data\":[{\"branchId\":\"branch-1\",\"branchMappingLogic\":\"true\"}],\"version\":0}"}})
 		})
 	req, _ := http.NewRequest("GET", "/api/branch/branch-1/runtimeVersion/1/updates", nil)
-	req.Header.Set("Authorization", "Bearer "+login().Token)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
 	router.ServeHTTP(respRec, req)
 	assert.Equal(t, http.StatusOK, respRec.Code)
 	assert.Equal(t, "[{\"updateUUID\":\"aa0eb074-55ae-545b-9b47-11663ef7db32\",\"updateId\":\"1674170951\",\"createdAt\":\"1970-01-20T09:02:50Z\",\"commitHash\":\"1674170951\",\"platform\":\"ios\"}]", strings.TrimSpace(string(respRec.Body.Bytes())))
@@ -233,14 +232,14 @@ func TestUpdatesRegularBranch1(t *testing.T) {
 func TestUpdatesMultiBranch2(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql",
 		func(req *http.Request) (*http.Response, error) {
 			return MockExpoBranchesMappingResponse([]map[string]interface{}{{"id": "branch-1", "name": "branch-1"}, {"id": "branch-2", "name": "branch-2"}}, []map[string]interface{}{{"id": "staging", "name": "staging", "branchMapping": "{\"data\":[{\"branchId\":\"branch-1\",\"branchMappingLogic\":\"true\"}],\"version\":0}"}})
 		})
 	req, _ := http.NewRequest("GET", "/api/branch/branch-2/runtimeVersion/1/updates", nil)
-	req.Header.Set("Authorization", "Bearer "+login().Token)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
 	router.ServeHTTP(respRec, req)
 	assert.Equal(t, http.StatusOK, respRec.Code)
 	assert.Equal(t, "[{\"updateUUID\":\"50879d7b-580e-6a32-68eb-24a26c311c25\",\"updateId\":\"1737455526\",\"createdAt\":\"1970-01-21T02:37:35Z\",\"commitHash\":\"\",\"platform\":\"\"},{\"updateUUID\":\"e3b76fe6-807d-45e1-ad35-ee87470a3504\",\"updateId\":\"1674170951\",\"createdAt\":\"1970-01-20T09:02:50Z\",\"commitHash\":\"\",\"platform\":\"\"},{\"updateUUID\":\"2df153c5-153c-b143-a2ac-1f7eab2f0656\",\"updateId\":\"1666629107\",\"createdAt\":\"1970-01-20T06:57:09Z\",\"commitHash\":\"1674170951\",\"platform\":\"ios\"}]", strings.TrimSpace(string(respRec.Body.Bytes())))
@@ -249,14 +248,14 @@ func TestUpdatesMultiBranch2(t *testing.T) {
 func TestUpdatesSomeNotValidBranch4(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
-	router := infrastructure.NewRouter()
+	router := newRouter(t)
 	respRec := httptest.NewRecorder()
 	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql",
 		func(req *http.Request) (*http.Response, error) {
 			return MockExpoBranchesMappingResponse([]map[string]interface{}{{"id": "branch-1", "name": "branch-1"}, {"id": "branch-2", "name": "branch-2"}}, []map[string]interface{}{{"id": "staging", "name": "staging", "branchMapping": "{\"data\":[{\"branchId\":\"branch-1\",\"branchMappingLogic\":\"true\"}],\"version\":0}"}})
 		})
 	req, _ := http.NewRequest("GET", "/api/branch/branch-4/runtimeVersion/1/updates", nil)
-	req.Header.Set("Authorization", "Bearer "+login().Token)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
 	router.ServeHTTP(respRec, req)
 	assert.Equal(t, http.StatusOK, respRec.Code)
 	assert.Equal(t, "[{\"updateUUID\":\"1f79c9e4-fc05-1cd7-05d8-a823a2cb72d1\",\"updateId\":\"1674170951\",\"createdAt\":\"1970-01-20T09:02:50Z\",\"commitHash\":\"1674170951\",\"platform\":\"ios\"}]", strings.TrimSpace(string(respRec.Body.Bytes())))
@@ -1,13 +1,28 @@
 package test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"expo-open-ota/internal/apiKeys"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/auth"
 	"expo-open-ota/internal/bucket"
 	cache2 "expo-open-ota/internal/cache"
 	"expo-open-ota/internal/cdn"
 	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/keyStore"
+	"expo-open-ota/internal/metadataStore"
 	"expo-open-ota/internal/metrics"
+	infrastructure "expo-open-ota/internal/router"
+	"expo-open-ota/internal/services"
 	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/uploadSessions"
+	"expo-open-ota/internal/users"
+	"expo-open-ota/internal/webhooks"
+	"expo-open-ota/testkit"
+	"fmt"
+	"github.com/gorilla/mux"
 	"github.com/jarcoal/httpmock"
 	"net/http"
 	"os"
@@ -42,10 +57,23 @@ func GlobalAfterEach(t *testing.T) {
 	t.Cleanup(func() {
 		bucket.ResetBucketInstance()
 		cdn.ResetCDNInstance()
+		metadataStore.ResetMetadataStoreInstance()
+		apiKeys.ResetApiKeyStoreInstance()
+		users.ResetUserStoreInstance()
+		auth.ResetOIDCClientInstance()
+		auth.ResetSessionStoreInstance()
+		audit.ResetSinkInstance()
+		webhooks.Wait()
+		webhooks.ResetWebhookStoreInstance()
 		projectRoot, err := findProjectRoot()
 		if err != nil {
 			t.Errorf("Error finding project root: %v", err)
 		}
+		for _, bucketPath := range []string{"./test/test-updates", "./updates"} {
+			if err := os.RemoveAll(filepath.Join(projectRoot, bucketPath, bucket.InternalFolder)); err != nil {
+				t.Errorf("Error removing internal bucket folder: %v", err)
+			}
+		}
 		updatesPath := filepath.Join(projectRoot, "./updates/DO_NOT_USE")
 		updates, err := os.ReadDir(updatesPath)
 		if err != nil {
@@ -425,3 +453,63 @@ func SetValidConfiguration() {
 	os.Setenv("USE_DASHBOARD", "true")
 	os.Setenv("ADMIN_PASSWORD", "admin")
 }
+
+// ComputeUploadFilesInput declares the size and hash of every file, as recent clients do
+func ComputeUploadFilesInput(dirPath string) handlers.FileNamesRequest {
+	input := ComputeUploadRequestsInput(dirPath)
+	for _, fileName := range input.FileNames {
+		content, err := os.ReadFile(filepath.Join(dirPath, fileName))
+		if err != nil {
+			panic(err)
+		}
+		size := int64(len(content))
+		hash := sha256.Sum256(content)
+		input.Files = append(input.Files, uploadSessions.File{Path: fileName, Size: &size, Sha256: hex.EncodeToString(hash[:])})
+	}
+	return input
+}
+
+func ValidateSignatureHeader(signature string, content string) bool {
+	if err := testkit.VerifySignature(keyStore.GetPublicExpoKey(), signature, content); err != nil {
+		fmt.Println("Signature verification failed: ", err)
+		return false
+	}
+	return true
+}
+
+func envDependencies(t testing.TB) infrastructure.Dependencies {
+	t.Helper()
+	keys, err := keyStore.GetKeysStorage()
+	if err != nil {
+		t.Fatalf("error resolving key store: %v", err)
+	}
+	return infrastructure.Dependencies{
+		Bucket:   bucket.GetBucket(),
+		Cache:    cache2.GetCache(),
+		CDN:      cdn.GetCDN(),
+		KeyStore: keys,
+		Channels: services.ExpoChannelResolver{},
+	}
+}
+
+// newRouter serves the routes with the storages and services configured by the environment of the test.
+func newRouter(t testing.TB) *mux.Router {
+	t.Helper()
+	server, err := infrastructure.NewServer(envDependencies(t))
+	if err != nil {
+		t.Fatalf("error building server: %v", err)
+	}
+	return server.NewRouter()
+}
+
+func envHandlers(t testing.TB) *handlers.Handlers {
+	t.Helper()
+	deps := envDependencies(t)
+	return handlers.New(handlers.Dependencies{
+		Bucket:   deps.Bucket,
+		Cache:    deps.Cache,
+		CDN:      deps.CDN,
+		KeyStore: deps.KeyStore,
+		Channels: deps.Channels,
+	})
+}
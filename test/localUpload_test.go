@@ -0,0 +1,115 @@
+package test
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// requestLocalUploadToken returns the upload token of metadata.json along with the path it is written to.
+func requestLocalUploadToken(t *testing.T, projectRoot string) (string, string) {
+	t.Helper()
+	w := requestUploadUrlsWithBody(t, projectRoot, `{"fileNames":["metadata.json"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("RequestUploadUrlHandler returned status %d instead of 200", w.Code)
+	}
+	var responseBody struct {
+		UpdateId       int64                      `json:"updateId"`
+		UploadRequests []bucket.FileUploadRequest `json:"uploadRequests"`
+	}
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&responseBody))
+	parsedUrl, err := url.Parse(responseBody.UploadRequests[0].RequestUploadUrl)
+	assert.Nil(t, err)
+	filePath := filepath.Join(projectRoot, "updates", "DO_NOT_USE", "1", fmt.Sprintf("%d", responseBody.UpdateId), "metadata.json")
+	return parsedUrl.Query().Get("token"), filePath
+}
+
+func putLocalFile(t *testing.T, token string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "/uploadLocalFile?token="+url.QueryEscape(token), strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/octet-stream")
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+	envHandlers(t).RequestUploadLocalFileHandler(w, r)
+	return w
+}
+
+func TestUploadLocalFileRawBody(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, _ := sampleUpdate(t)
+	token, filePath := requestLocalUploadToken(t, projectRoot)
+
+	md5Sum := md5.Sum([]byte(`{"version":0}`))
+	sha256Sum := sha256.Sum256([]byte(`{"version":0}`))
+	w := putLocalFile(t, token, `{"version":0}`, map[string]string{
+		"Content-MD5":      base64.StdEncoding.EncodeToString(md5Sum[:]),
+		"X-Content-Sha256": hex.EncodeToString(sha256Sum[:]),
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	content, err := os.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"version":0}`, string(content))
+
+	w = putLocalFile(t, token, `{"version":1}`, map[string]string{"X-Content-Sha256": hex.EncodeToString(sha256Sum[:])})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = putLocalFile(t, token, `{"version":1}`, map[string]string{"Content-MD5": "not base64"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	content, err = os.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"version":0}`, string(content))
+
+	os.Setenv("LOCAL_UPLOAD_MAX_BYTES", "4")
+	defer os.Unsetenv("LOCAL_UPLOAD_MAX_BYTES")
+	w = putLocalFile(t, token, `{"version":1}`, nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestUploadLocalFileInChunks(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, _ := sampleUpdate(t)
+	token, filePath := requestLocalUploadToken(t, projectRoot)
+
+	w := putLocalFile(t, token, `{"vers`, map[string]string{"Content-Range": "bytes 0-5/13"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+
+	// A client losing track of the upload asks for the offset to resume from
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("HEAD", "/uploadLocalFile?token="+url.QueryEscape(token), nil)
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	envHandlers(t).LocalUploadOffsetHandler(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+
+	w = putLocalFile(t, token, `":0}`, map[string]string{"Content-Range": "bytes 9-12/13"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+	w = putLocalFile(t, token, `ion":0}`, map[string]string{"Content-Range": "bytes 6/13"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = putLocalFile(t, token, `ion":0}`, map[string]string{"Content-Range": "bytes 6-12/13"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "13", w.Header().Get("Upload-Offset"))
+	content, err := os.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"version":0}`, string(content))
+}
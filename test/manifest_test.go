@@ -4,9 +4,9 @@ import (
 	"encoding/json"
 	"expo-open-ota/internal/bucket"
 	cache2 "expo-open-ota/internal/cache"
-	"expo-open-ota/internal/handlers"
 	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/update"
+	"expo-open-ota/testkit"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -45,7 +45,7 @@ func TestNotValidChannelForManifest(t *testing.T) {
 			}
 			return nil, nil
 		})
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 	assert.Equal(t, 500, w.Code, "Expected status code 500 for an invalid branch")
 	assert.Equal(t, "Error fetching channel mapping\n", w.Body.String())
 }
@@ -94,7 +94,7 @@ func TestNotMappedChannelForManifest(t *testing.T) {
 			}
 			return nil, nil
 		})
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 	assert.Equal(t, 404, w.Code, "Expected status code 404 for an unmapped channel")
 	assert.Equal(t, "No branch mapping found\n", w.Body.String(), "Expected 'No branch mapping found' message")
 }
@@ -112,7 +112,7 @@ func TestNotValidProtocolVersionsForManifest(t *testing.T) {
 	r.Header.Add("expo-protocol-version", "invalid")
 	r.Header.Add("expo-expect-signature", "true")
 	mockWorkingExpoResponse("staging")
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 	assert.Equal(t, 400, w.Code, "Expected status code 400 for an invalid protocole version")
 	assert.Equal(t, "Invalid protocol version\n", w.Body.String(), "Expected 'Invalid protocol version' message")
 }
@@ -130,7 +130,7 @@ func TestNotValidPlatformForManifest(t *testing.T) {
 	r.Header.Add("expo-expect-signature", "true")
 	r.Header.Add("expo-channel-name", "staging")
 	mockWorkingExpoResponse("staging")
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 	assert.Equal(t, 400, w.Code, "Expected status code 400 for an invalid platform")
 	assert.Equal(t, "Invalid platform\n", w.Body.String(), "Expected 'IInvalid platform' message")
 }
@@ -149,7 +149,7 @@ func TestNotValidRuntimeVersionForManifest(t *testing.T) {
 	r.Header.Add("expo-channel-name", "staging")
 
 	mockWorkingExpoResponse("staging")
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 	assert.Equal(t, 400, w.Code, "Expected status code 400 when runtime version is not provided")
 	assert.Equal(t, "No runtime version provided\n", w.Body.String(), "Expected 'No runtime version provided' message")
 }
@@ -174,7 +174,7 @@ func TestNotValidCertificatesForManifest(t *testing.T) {
 	r.Header.Add("expo-expect-signature", "true")
 	r.Header.Add("expo-channel-name", "staging")
 	mockWorkingExpoResponse("staging")
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 
 	assert.Equal(t, 500, w.Code, "Expected status code 500 when certificates are not valid")
 	assert.Equal(t, "Error signing content\n", w.Body.String(), "Expected 'Error signing content' message")
@@ -193,9 +193,9 @@ func TestNoUpdatesForManifest(t *testing.T) {
 	r.Header.Add("expo-expect-signature", "true")
 	r.Header.Add("expo-channel-name", "staging")
 	mockWorkingExpoResponse("staging")
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 	assert.Equal(t, 200, w.Code, "Expected status code 200 when manifest is retrieved")
-	parts, err := ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	parts, err := testkit.ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
 	if err != nil {
 		t.Errorf("Error parsing response: %v", err)
 	}
@@ -203,7 +203,7 @@ func TestNoUpdatesForManifest(t *testing.T) {
 
 	manifestPart := parts[0]
 
-	assert.Equal(t, true, IsMultipartPartWithName(manifestPart, "directive"), "Expected a part with name 'manifest'")
+	assert.Equal(t, true, testkit.IsMultipartPartWithName(manifestPart, "directive"), "Expected a part with name 'manifest'")
 	body := manifestPart.Body
 
 	signature := manifestPart.Headers["Expo-Signature"]
@@ -274,7 +274,7 @@ func TestSkippingNotValidUpdatesAndCache(t *testing.T) {
 
 			return httpmock.NewStringResponse(404, "Unknown operation"), nil
 		})
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion("branch-4", "1")
+	lastUpdate, err := update.DefaultManager().GetLatestUpdateBundlePathForRuntimeVersion("branch-4", "1")
 	if err != nil {
 		t.Errorf("Error getting latest update: %v", err)
 	}
@@ -303,9 +303,9 @@ func TestValidRequestForStagingManifest(t *testing.T) {
 	r.Header.Add("expo-protocol-version", "1")
 	r.Header.Add("expo-expect-signature", "true")
 	r.Header.Add("expo-channel-name", "staging")
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 	assert.Equal(t, 200, w.Code, "Expected status code 200 when manifest is retrieved")
-	parts, err := ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	parts, err := testkit.ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
 	if err != nil {
 		t.Errorf("Error parsing response: %v", err)
 	}
@@ -313,7 +313,7 @@ func TestValidRequestForStagingManifest(t *testing.T) {
 
 	manifestPart := parts[0]
 
-	assert.Equal(t, true, IsMultipartPartWithName(manifestPart, "manifest"), "Expected a part with name 'manifest'")
+	assert.Equal(t, true, testkit.IsMultipartPartWithName(manifestPart, "manifest"), "Expected a part with name 'manifest'")
 	body := manifestPart.Body
 
 	signature := manifestPart.Headers["Expo-Signature"]
@@ -347,9 +347,9 @@ func TestNoUpdatesResponseForManifest(t *testing.T) {
 	r.Header.Add("expo-expect-signature", "true")
 	r.Header.Add("expo-current-update-id", "aa0eb074-55ae-545b-9b47-11663ef7db32")
 	r.Header.Add("expo-channel-name", "staging")
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 	assert.Equal(t, 200, w.Code, "Expected status code 200 when manifest is retrieved")
-	parts, err := ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	parts, err := testkit.ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
 	if err != nil {
 		t.Errorf("Error parsing response: %v", err)
 	}
@@ -357,7 +357,7 @@ func TestNoUpdatesResponseForManifest(t *testing.T) {
 
 	manifestPart := parts[0]
 
-	assert.Equal(t, true, IsMultipartPartWithName(manifestPart, "directive"), "Expected a part with name 'manifest'")
+	assert.Equal(t, true, testkit.IsMultipartPartWithName(manifestPart, "directive"), "Expected a part with name 'manifest'")
 	body := manifestPart.Body
 
 	signature := manifestPart.Headers["Expo-Signature"]
@@ -435,9 +435,9 @@ func TestRollbackResponseforManifest(t *testing.T) {
 	r.Header.Add("expo-current-update-id", "6a2b5fed-7a6a-9f73-78ae-30b6e31dfcc6")
 	r.Header.Add("expo-embedded-update-id", "embedded-update-id")
 	r.Header.Add("expo-channel-name", "rollbackenv")
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 	assert.Equal(t, 200, w.Code, "Expected status code 200 when manifest is retrieved")
-	parts, err := ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	parts, err := testkit.ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
 	if err != nil {
 		t.Errorf("Error parsing response: %v", err)
 	}
@@ -445,7 +445,7 @@ func TestRollbackResponseforManifest(t *testing.T) {
 
 	manifestPart := parts[0]
 
-	assert.Equal(t, true, IsMultipartPartWithName(manifestPart, "directive"), "Expected a part with name 'manifest'")
+	assert.Equal(t, true, testkit.IsMultipartPartWithName(manifestPart, "directive"), "Expected a part with name 'manifest'")
 	body := manifestPart.Body
 
 	signature := manifestPart.Headers["Expo-Signature"]
@@ -522,9 +522,9 @@ func TestValidRequestForProductionManifest(t *testing.T) {
 	r.Header.Add("expo-protocol-version", "1")
 	r.Header.Add("expo-expect-signature", "true")
 	r.Header.Add("expo-channel-name", "production")
-	handlers.ManifestHandler(w, r)
+	envHandlers(t).ManifestHandler(w, r)
 	assert.Equal(t, 200, w.Code, "Expected status code 200 when manifest is retrieved")
-	parts, err := ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	parts, err := testkit.ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
 	if err != nil {
 		t.Errorf("Error parsing response: %v", err)
 	}
@@ -532,7 +532,7 @@ func TestValidRequestForProductionManifest(t *testing.T) {
 
 	manifestPart := parts[0]
 
-	assert.Equal(t, true, IsMultipartPartWithName(manifestPart, "manifest"), "Expected a part with name 'manifest'")
+	assert.Equal(t, true, testkit.IsMultipartPartWithName(manifestPart, "manifest"), "Expected a part with name 'manifest'")
 	body := manifestPart.Body
 
 	signature := manifestPart.Headers["Expo-Signature"]
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/update"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupMetadataStore(t *testing.T) {
+	t.Helper()
+	os.Setenv("METADATA_STORE_TYPE", "sqlite")
+	os.Setenv("METADATA_STORE_DSN", filepath.Join(t.TempDir(), "metadata.db"))
+	t.Cleanup(func() {
+		os.Unsetenv("METADATA_STORE_TYPE")
+		os.Unsetenv("METADATA_STORE_DSN")
+	})
+	synchronized, err := update.DefaultManager().SyncMetadataStoreFromBucket()
+	assert.Nil(t, err)
+	assert.Greater(t, synchronized, 0)
+}
+
+func TestUpdatesFromMetadataStore(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupMetadataStore(t)
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql",
+		func(req *http.Request) (*http.Response, error) {
+			return MockExpoBranchesMappingResponse([]map[string]interface{}{{"id": "branch-1", "name": "branch-1"}, {"id": "branch-2", "name": "branch-2"}}, []map[string]interface{}{{"id": "staging", "name": "staging", "branchMapping": "{\"data\":[{\"branchId\":\"branch-1\",\"branchMappingLogic\":\"true\"}],\"version\":0}"}})
+		})
+	req, _ := http.NewRequest("GET", "/api/branch/branch-2/runtimeVersion/1/updates", nil)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
+	router.ServeHTTP(respRec, req)
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	assert.Equal(t, "[{\"updateUUID\":\"50879d7b-580e-6a32-68eb-24a26c311c25\",\"updateId\":\"1737455526\",\"createdAt\":\"1970-01-21T02:37:35Z\",\"commitHash\":\"\",\"platform\":\"\"},{\"updateUUID\":\"e3b76fe6-807d-45e1-ad35-ee87470a3504\",\"updateId\":\"1674170951\",\"createdAt\":\"1970-01-20T09:02:50Z\",\"commitHash\":\"\",\"platform\":\"\"},{\"updateUUID\":\"2df153c5-153c-b143-a2ac-1f7eab2f0656\",\"updateId\":\"1666629107\",\"createdAt\":\"1970-01-20T06:57:09Z\",\"commitHash\":\"1674170951\",\"platform\":\"ios\"}]", strings.TrimSpace(respRec.Body.String()))
+}
+
+func TestSearchUpdatesByCommitHash(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupMetadataStore(t)
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/updates?commitHash=1674170951", nil)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
+	router.ServeHTTP(respRec, req)
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	var response []handlers.UpdateSearchItem
+	assert.Nil(t, json.Unmarshal(respRec.Body.Bytes(), &response))
+	assert.Len(t, response, 8)
+	var branch1Update *handlers.UpdateSearchItem
+	for i, item := range response {
+		assert.Equal(t, "1674170951", item.CommitHash)
+		if item.Branch == "branch-1" {
+			branch1Update = &response[i]
+		}
+	}
+	assert.NotNil(t, branch1Update)
+	assert.Equal(t, "1674170951", branch1Update.UpdateId)
+	assert.Equal(t, "1", branch1Update.RuntimeVersion)
+	assert.Equal(t, "aa0eb074-55ae-545b-9b47-11663ef7db32", branch1Update.UpdateUUID)
+	assert.Equal(t, "checked", branch1Update.Status)
+}
+
+func TestSearchUpdatesWithoutMetadataStore(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/updates?commitHash=1674170951", nil)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
+	router.ServeHTTP(respRec, req)
+	assert.Equal(t, http.StatusNotImplemented, respRec.Code)
+}
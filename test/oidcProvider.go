@@ -0,0 +1,179 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jarcoal/httpmock"
+)
+
+const mockOIDCKeyId = "mock-oidc-key"
+
+type mockOIDCAuthorization struct {
+	redirectUri   string
+	codeChallenge string
+	nonce         string
+}
+
+// MockOIDCProvider is a minimal OpenID Connect provider (discovery, JWKS, authorization code
+// with PKCE) served through httpmock. Every authorization request is granted to Subject with Claims.
+type MockOIDCProvider struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	Subject      string
+	Claims       map[string]interface{}
+	key          *rsa.PrivateKey
+	mu           sync.Mutex
+	codes        map[string]mockOIDCAuthorization
+}
+
+func NewMockOIDCProvider(issuer string, clientId string, clientSecret string) *MockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return &MockOIDCProvider{
+		Issuer:       issuer,
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Subject:      "mock-user",
+		Claims:       map[string]interface{}{},
+		key:          key,
+		codes:        map[string]mockOIDCAuthorization{},
+	}
+}
+
+func (p *MockOIDCProvider) Register() {
+	responder := func(req *http.Request) (*http.Response, error) {
+		respRec := httptest.NewRecorder()
+		p.ServeHTTP(respRec, req)
+		return respRec.Result(), nil
+	}
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(p.Issuer))
+	httpmock.RegisterRegexpResponder(http.MethodGet, pattern, responder)
+	httpmock.RegisterRegexpResponder(http.MethodPost, pattern, responder)
+}
+
+func (p *MockOIDCProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                p.Issuer,
+			"authorization_endpoint":                p.Issuer + "/authorize",
+			"token_endpoint":                        p.Issuer + "/token",
+			"jwks_uri":                              p.Issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	case "/jwks":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": mockOIDCKeyId,
+				"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+			}},
+		})
+	case "/authorize":
+		p.authorize(w, r)
+	case "/token":
+		p.token(w, r)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (p *MockOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != p.ClientId || query.Get("response_type") != "code" {
+		http.Error(w, "invalid client", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE is required", http.StatusBadRequest)
+		return
+	}
+	code := uuid.New().String()
+	p.mu.Lock()
+	p.codes[code] = mockOIDCAuthorization{
+		redirectUri:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+	}
+	p.mu.Unlock()
+	callback, _ := url.Parse(query.Get("redirect_uri"))
+	callbackQuery := url.Values{"code": {code}, "state": {query.Get("state")}}
+	callback.RawQuery = callbackQuery.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+func (p *MockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientId, clientSecret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+	if clientId != p.ClientId || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	p.mu.Lock()
+	authorization, found := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	p.mu.Unlock()
+	if !found || authorization.redirectUri != r.FormValue("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss":   p.Issuer,
+		"sub":   p.Subject,
+		"aud":   p.ClientId,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": authorization.nonce,
+	}
+	for key, value := range p.Claims {
+		claims[key] = value
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = mockOIDCKeyId
+	signedIdToken, err := idToken.SignedString(p.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": uuid.New().String(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signedIdToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,260 @@
+package test
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/users"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupOIDC(t *testing.T) *MockOIDCProvider {
+	t.Helper()
+	provider := NewMockOIDCProvider("https://oidc.example.test", "expo-open-ota", "oidc-secret")
+	provider.Register()
+	env := map[string]string{
+		"OIDC_ISSUER_URL":       provider.Issuer,
+		"OIDC_CLIENT_ID":        provider.ClientId,
+		"OIDC_CLIENT_SECRET":    provider.ClientSecret,
+		"OIDC_SCOPES":           "openid profile groups",
+		"OIDC_ADMIN_GROUPS":     "ota-admins",
+		"OIDC_PUBLISHER_GROUPS": "ota-publishers, release-managers",
+		"OIDC_VIEWER_GROUPS":    "developers",
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+	}
+	t.Cleanup(func() {
+		for key := range env {
+			os.Unsetenv(key)
+		}
+		os.Unsetenv("OIDC_DEFAULT_ROLE")
+		auth.ResetOIDCClientInstance()
+	})
+	return provider
+}
+
+// startOIDCLogin signs in on the identity provider and returns the callback it redirects to, with the
+// cookie the login page set in the browser.
+func startOIDCLogin(t *testing.T, provider *MockOIDCProvider) (*url.URL, *http.Cookie) {
+	t.Helper()
+	router := newRouter(t)
+	loginRec := httptest.NewRecorder()
+	router.ServeHTTP(loginRec, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+	assert.Equal(t, http.StatusFound, loginRec.Code)
+	authorizationUrl := loginRec.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(authorizationUrl, provider.Issuer+"/authorize?"))
+	cookies := loginRec.Result().Cookies()
+	assert.Len(t, cookies, 1)
+
+	authorizeRec := httptest.NewRecorder()
+	provider.ServeHTTP(authorizeRec, httptest.NewRequest("GET", authorizationUrl, nil))
+	assert.Equal(t, http.StatusFound, authorizeRec.Code)
+	callbackUrl, err := url.Parse(authorizeRec.Header().Get("Location"))
+	assert.Nil(t, err)
+	assert.Equal(t, "/auth/oidc/callback", callbackUrl.Path)
+	return callbackUrl, cookies[0]
+}
+
+func oidcCallback(t *testing.T, callbackUrl *url.URL, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	router := newRouter(t)
+	callbackRec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", callbackUrl.RequestURI(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	router.ServeHTTP(callbackRec, req)
+	return callbackRec
+}
+
+// followOIDCLogin goes through the whole browser flow and returns where the dashboard login page is
+// finally redirected to.
+func followOIDCLogin(t *testing.T, provider *MockOIDCProvider) *url.URL {
+	t.Helper()
+	callbackUrl, cookie := startOIDCLogin(t, provider)
+	callbackRec := oidcCallback(t, callbackUrl, cookie)
+	assert.Equal(t, http.StatusFound, callbackRec.Code)
+	dashboardUrl, err := url.Parse(callbackRec.Header().Get("Location"))
+	assert.Nil(t, err)
+	assert.Equal(t, "/dashboard/login", dashboardUrl.Path)
+	return dashboardUrl
+}
+
+func exchangeLoginCode(t *testing.T, code string) (*httptest.ResponseRecorder, auth.AuthResponse) {
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	formData := url.Values{}
+	formData.Set("code", code)
+	req, _ := http.NewRequest("POST", "/auth/oidc/token", strings.NewReader(formData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(respRec, req)
+	var response auth.AuthResponse
+	_ = json.Unmarshal(respRec.Body.Bytes(), &response)
+	return respRec, response
+}
+
+func getMe(t *testing.T, token string) auth.Principal {
+	t.Helper()
+	meRec := performAuthenticatedRequest(t, "GET", "/api/me", token)
+	assert.Equal(t, http.StatusOK, meRec.Code)
+	var principal auth.Principal
+	assert.Nil(t, json.Unmarshal(meRec.Body.Bytes(), &principal))
+	return principal
+}
+
+func TestAuthMethods(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	router.ServeHTTP(respRec, httptest.NewRequest("GET", "/auth/methods", nil))
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	assert.JSONEq(t, `{"password":true,"oidc":false}`, respRec.Body.String())
+
+	setupOIDC(t)
+	respRec = httptest.NewRecorder()
+	router.ServeHTTP(respRec, httptest.NewRequest("GET", "/auth/methods", nil))
+	assert.JSONEq(t, `{"password":true,"oidc":true}`, respRec.Body.String())
+}
+
+func TestOIDCLoginDisabled(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	router.ServeHTTP(respRec, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+	assert.Equal(t, http.StatusNotFound, respRec.Code)
+}
+
+func TestOIDCLoginMapsGroupsToRole(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	provider := setupOIDC(t)
+	provider.Claims = map[string]interface{}{
+		"preferred_username": "jane",
+		"groups":             []string{"developers", "release-managers"},
+	}
+	dashboardUrl := followOIDCLogin(t, provider)
+	code := dashboardUrl.Query().Get("code")
+	assert.NotEmpty(t, code)
+
+	respRec, response := exchangeLoginCode(t, code)
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	principal := getMe(t, response.Token)
+	assert.Equal(t, "jane", principal.Username)
+	assert.Equal(t, users.PublisherRole, principal.Role)
+	assert.Equal(t, "oidc:mock-user", principal.Subject)
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/apiKeys", response.Token).Code)
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "GET", "/api/users", response.Token).Code)
+
+	refreshed, err := auth.NewAuth().RefreshToken(response.RefreshToken)
+	assert.Nil(t, err)
+	assert.Equal(t, users.PublisherRole, getMe(t, refreshed.Token).Role)
+}
+
+func TestOIDCLoginCodeIsSingleUse(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	provider := setupOIDC(t)
+	provider.Claims = map[string]interface{}{"groups": []string{"ota-admins"}}
+	code := followOIDCLogin(t, provider).Query().Get("code")
+	respRec, _ := exchangeLoginCode(t, code)
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	respRec, _ = exchangeLoginCode(t, code)
+	assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+}
+
+func TestOIDCLoginWithoutMappedGroup(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	provider := setupOIDC(t)
+	provider.Claims = map[string]interface{}{"groups": []string{"marketing"}}
+	dashboardUrl := followOIDCLogin(t, provider)
+	assert.Equal(t, "sso", dashboardUrl.Query().Get("error"))
+	assert.Empty(t, dashboardUrl.Query().Get("code"))
+}
+
+func TestOIDCLoginWithDefaultRole(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	provider := setupOIDC(t)
+	os.Setenv("OIDC_DEFAULT_ROLE", "viewer")
+	provider.Claims = map[string]interface{}{"email": "john@example.com"}
+	code := followOIDCLogin(t, provider).Query().Get("code")
+	_, response := exchangeLoginCode(t, code)
+	principal := getMe(t, response.Token)
+	assert.Equal(t, "john@example.com", principal.Username)
+	assert.Equal(t, users.ViewerRole, principal.Role)
+}
+
+func TestOIDCCallbackRejectsUnknownState(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupOIDC(t)
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	router.ServeHTTP(respRec, httptest.NewRequest("GET", "/auth/oidc/callback?code=forged&state=forged", nil))
+	assert.Equal(t, http.StatusFound, respRec.Code)
+	assert.Equal(t, "/dashboard/login?error=sso", respRec.Header().Get("Location"))
+}
+
+func TestOIDCStateCookie(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	provider := setupOIDC(t)
+	provider.Claims = map[string]interface{}{"groups": []string{"ota-admins"}}
+	callbackUrl, cookie := startOIDCLogin(t, provider)
+	assert.Equal(t, "ota_oidc_state", cookie.Name)
+	assert.NotEqual(t, callbackUrl.Query().Get("state"), cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.Equal(t, "/auth/oidc/callback", cookie.Path)
+
+	callbackRec := oidcCallback(t, callbackUrl, cookie)
+	assert.NotEmpty(t, callbackRec.Header().Get("Location"))
+	cleared := callbackRec.Result().Cookies()
+	assert.Len(t, cleared, 1)
+	assert.Equal(t, "ota_oidc_state", cleared[0].Name)
+	assert.True(t, cleared[0].MaxAge < 0)
+}
+
+func TestOIDCCallbackRequiresTheBrowserThatStartedTheLogin(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	provider := setupOIDC(t)
+	provider.Claims = map[string]interface{}{"groups": []string{"ota-admins"}}
+
+	callbackUrl, _ := startOIDCLogin(t, provider)
+	callbackRec := oidcCallback(t, callbackUrl, nil)
+	assert.Equal(t, "/dashboard/login?error=sso", callbackRec.Header().Get("Location"))
+
+	callbackUrl, _ = startOIDCLogin(t, provider)
+	_, otherCookie := startOIDCLogin(t, provider)
+	callbackRec = oidcCallback(t, callbackUrl, otherCookie)
+	assert.Equal(t, "/dashboard/login?error=sso", callbackRec.Header().Get("Location"))
+}
+
+func TestOIDCCallbackWithProviderError(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupOIDC(t)
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	router.ServeHTTP(respRec, httptest.NewRequest("GET", "/auth/oidc/callback?error=access_denied", nil))
+	assert.Equal(t, http.StatusFound, respRec.Code)
+	assert.Equal(t, "/dashboard/login?error=sso", respRec.Header().Get("Location"))
+}
+
+func TestPasswordLoginWithOIDCEnabled(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupOIDC(t)
+	assert.Equal(t, users.AdminRole, getMe(t, login(t).Token).Role)
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"bytes"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/assets"
+	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/update"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestUploadUrlRejectsTraversal(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, _ := sampleUpdate(t)
+	w := requestUploadUrlsWithBody(t, projectRoot, `{"fileNames":["../../../escaped.js"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	for _, runtimeVersion := range []string{"..", ".hidden", "1%2F..%2F..", "1%00"} {
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "http://localhost:3000/requestUploadUrl/DO_NOT_USE?platform=android&runtimeVersion="+runtimeVersion, bytes.NewBufferString(`{"fileNames":["metadata.json"]}`))
+		r = mux.SetURLVars(r, map[string]string{"BRANCH": "DO_NOT_USE"})
+		r.Header.Set("Authorization", "Bearer expo_test_token")
+		envHandlers(t).RequestUploadUrlHandler(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code, runtimeVersion)
+	}
+	_, err := os.Stat(filepath.Join(projectRoot, "escaped.js"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMarkUpdateAsUploadedRejectsTraversal(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	assert.Equal(t, http.StatusBadRequest, markUpdateAsUploaded(t, "DO_NOT_USE", "..", "1").Code)
+	assert.Equal(t, http.StatusBadRequest, markUpdateAsUploaded(t, "DO_NOT_USE", "1", "..%2F1").Code)
+	assert.Equal(t, http.StatusBadRequest, markUpdateAsUploaded(t, "..", "1", "1").Code)
+}
+
+func TestAssetsRejectTraversal(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockWorkingExpoResponse("staging")
+	for _, assetName := range []string{"../../../../go.mod", "assets/../../metadata.json", `..\..\go.mod`} {
+		response, err := assets.HandleAssetsWithFile(update.DefaultManager(), assets.AssetsRequest{
+			Branch:         "branch-1",
+			AssetName:      assetName,
+			RuntimeVersion: "1",
+			Platform:       "ios",
+			RequestID:      "test",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, assetName)
+	}
+	response, err := assets.HandleAssetsWithFile(update.DefaultManager(), assets.AssetsRequest{
+		Branch:         "branch-1",
+		AssetName:      "/assets/4f1cb2cac2370cd5050681232e8575a8",
+		RuntimeVersion: "../branch-2/1",
+		Platform:       "ios",
+		RequestID:      "test",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func TestUploadTokenOutsideBucket(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, _ := sampleUpdate(t)
+	os.Setenv("LOCAL_BUCKET_BASE_PATH", filepath.Join(projectRoot, "./updates"))
+	escaped := filepath.Join(projectRoot, "escaped.js")
+	// A token signed with the right secret but pointing outside of the bucket
+	token, err := services.GenerateJWTToken(config.GetEnv("JWT_SECRET"), jwt.MapClaims{
+		"sub":      services.FetchSelfExpoUsername(),
+		"exp":      time.Now().Add(time.Minute).Unix(),
+		"filePath": escaped,
+		"action":   "uploadLocalFile",
+	})
+	assert.Nil(t, err)
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("escaped.js", "escaped.js")
+	_, _ = part.Write([]byte("alert(1)"))
+	_ = writer.Close()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "/uploadLocalFile?token="+url.QueryEscape(token), body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	envHandlers(t).RequestUploadLocalFileHandler(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	_, err = os.Stat(escaped)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,141 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"expo-open-ota/internal/cache"
+	"expo-open-ota/internal/metadataStore"
+	"expo-open-ota/internal/update"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func requestReindex(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/reindex"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+login(t).Token)
+	router.ServeHTTP(respRec, req)
+	return respRec
+}
+
+func findIssue(report update.ReindexReport, issueType update.ReindexIssueType, branch string, updateId string) *update.ReindexIssue {
+	for i, issue := range report.Issues {
+		if issue.Type == issueType && issue.Branch == branch && issue.UpdateId == updateId {
+			return &report.Issues[i]
+		}
+	}
+	return nil
+}
+
+func TestReindexWithoutAuth(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/reindex", nil)
+	router.ServeHTTP(respRec, req)
+	assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+}
+
+func TestReindexReportsConsistencyErrors(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	projectRoot, _ := findProjectRoot()
+	orphanPath := filepath.Join(projectRoot, "test/test-updates/branch-1/1/1700000000")
+	assert.Nil(t, os.MkdirAll(orphanPath, os.ModePerm))
+	assert.Nil(t, os.WriteFile(filepath.Join(orphanPath, "update-metadata.json"), []byte(`{"platform":"ios","commitHash":"abc"}`), 0644))
+
+	respRec := requestReindex(t, "")
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	var report update.ReindexReport
+	assert.Nil(t, json.Unmarshal(respRec.Body.Bytes(), &report))
+	assert.Equal(t, 4, report.Branches)
+	assert.Equal(t, 4, report.RuntimeVersions)
+	assert.Equal(t, 11, report.Updates)
+	assert.Equal(t, 9, report.CheckedUpdates)
+	assert.Equal(t, 10, report.WarmedManifests)
+
+	orphan := findIssue(report, update.OrphanFolderIssue, "branch-1", "1700000000")
+	assert.NotNil(t, orphan)
+	missingConfig := findIssue(report, update.MissingFileIssue, "branch-2", "1666629107")
+	assert.NotNil(t, missingConfig)
+	assert.Equal(t, "expoConfig.json", missingConfig.File)
+	unparsable := findIssue(report, update.UnparsableMetadataIssue, "branch-2", "1674170951")
+	assert.NotNil(t, unparsable)
+	assert.Equal(t, "update-metadata.json", unparsable.File)
+	assert.NotNil(t, findIssue(report, update.UncheckedUpdateIssue, "branch-4", "1674170952"))
+}
+
+func TestReindexWarmsCaches(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	respRec := requestReindex(t, "")
+	assert.Equal(t, http.StatusOK, respRec.Code)
+
+	resolvedCache := cache.GetCache()
+	assert.NotEmpty(t, resolvedCache.Get(update.ComputeLastUpdateCacheKey("branch-1", "1")))
+	assert.NotEmpty(t, resolvedCache.Get(update.ComputeMetadataCacheKey("branch-1", "1", "1674170951")))
+	assert.NotEmpty(t, resolvedCache.Get(update.ComputeUpdataManifestCacheKey("branch-1", "1", "1674170951", "ios")))
+	assert.NotEmpty(t, resolvedCache.Get(update.ComputeUpdataManifestCacheKey("branch-1", "1", "1674170951", "android")))
+}
+
+func TestReindexStreamsProgress(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	respRec := requestReindex(t, "?stream=true")
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	assert.Equal(t, "application/x-ndjson", respRec.Header().Get("Content-Type"))
+
+	type event struct {
+		Progress *update.ReindexProgress `json:"progress"`
+		Report   *update.ReindexReport   `json:"report"`
+	}
+	var events []event
+	scanner := bufio.NewScanner(respRec.Body)
+	for scanner.Scan() {
+		var e event
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	assert.Greater(t, len(events), 2)
+	assert.Equal(t, 1, events[0].Progress.Updates)
+	last := events[len(events)-1]
+	assert.NotNil(t, last.Report)
+	assert.Equal(t, 10, last.Report.Updates)
+}
+
+func TestReindexRebuildsMetadataStore(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("METADATA_STORE_TYPE", "sqlite")
+	os.Setenv("METADATA_STORE_DSN", filepath.Join(t.TempDir(), "metadata.db"))
+	defer os.Unsetenv("METADATA_STORE_TYPE")
+	defer os.Unsetenv("METADATA_STORE_DSN")
+	store := metadataStore.GetMetadataStore()
+	assert.Nil(t, store.UpsertUpdate(metadataStore.NewUpdateRecord("deleted-branch", "1", "1000", time.UnixMilli(1000))))
+
+	respRec := requestReindex(t, "")
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	var report update.ReindexReport
+	assert.Nil(t, json.Unmarshal(respRec.Body.Bytes(), &report))
+	assert.NotNil(t, findIssue(report, update.StaleRecordIssue, "deleted-branch", "1000"))
+
+	count, err := store.CountUpdates()
+	assert.Nil(t, err)
+	assert.Equal(t, 10, count)
+	record, err := store.GetUpdate("branch-4", "1", "1674170952")
+	assert.Nil(t, err)
+	assert.Equal(t, metadataStore.PendingStatus, record.Status)
+	record, err = store.GetUpdate("branch-1", "1", "1674170951")
+	assert.Nil(t, err)
+	assert.Equal(t, metadataStore.CheckedStatus, record.Status)
+	assert.Equal(t, "1674170951", record.CommitHash)
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/keyStore"
+	infrastructure "expo-open-ota/internal/router"
+	"expo-open-ota/internal/services"
+	"expo-open-ota/testkit"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticChannels map[string]string
+
+func (c staticChannels) ResolveChannel(channelName string) (*services.ExpoChannelMapping, error) {
+	branch, ok := c[channelName]
+	if !ok {
+		return nil, nil
+	}
+	return &services.ExpoChannelMapping{Id: channelName, BranchName: branch}, nil
+}
+
+func TestNewServerRequiresDependencies(t *testing.T) {
+	_, err := infrastructure.NewServer(infrastructure.Dependencies{})
+	assert.NotNil(t, err)
+	_, err = infrastructure.NewServer(infrastructure.Dependencies{
+		Bucket: bucket.NewMemoryBucket(),
+		Cache:  cache2.NewLocalCache(0, 0, 0),
+	})
+	assert.NotNil(t, err)
+}
+
+func TestServersWithDistinctBucketsInOneProcess(t *testing.T) {
+	harness := testkit.New(t)
+	keys, err := keyStore.GetKeysStorage()
+	assert.Nil(t, err)
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	launchAssetUrls := make([]string, 0, 2)
+	for _, bundle := range []string{"console.log('first')", "console.log('second')"} {
+		storage := bucket.NewMemoryBucket()
+		_, err := testkit.NewUpdate("main", "1", createdAt).WithBundle("ios", bundle).Build(storage)
+		assert.Nil(t, err)
+		server, err := infrastructure.NewServer(infrastructure.Dependencies{
+			Bucket:   storage,
+			Cache:    cache2.NewLocalCache(0, 0, 0),
+			KeyStore: keys,
+			Channels: staticChannels{"production": "main"},
+		})
+		assert.Nil(t, err)
+
+		w := httptest.NewRecorder()
+		server.NewRouter().ServeHTTP(w, testkit.ManifestRequest("ios", "1", "production"))
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		parts, err := testkit.ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+		assert.Nil(t, err)
+		var manifest map[string]interface{}
+		for _, part := range parts {
+			if testkit.IsMultipartPartWithName(part, "manifest") {
+				assert.Nil(t, testkit.VerifySignature(harness.PublicKey, part.Headers["Expo-Signature"], part.Body))
+				assert.Nil(t, json.Unmarshal([]byte(part.Body), &manifest))
+			}
+		}
+		launchAsset, _ := manifest["launchAsset"].(map[string]interface{})
+		bundleHash := md5.Sum([]byte(bundle))
+		assert.Contains(t, launchAsset["url"], url.QueryEscape("bundles/ios-"+hex.EncodeToString(bundleHash[:])))
+		launchAssetUrls = append(launchAssetUrls, launchAsset["url"].(string))
+	}
+	assert.NotEqual(t, launchAssetUrls[0], launchAssetUrls[1])
+	branches, err := harness.Bucket.GetBranches()
+	assert.Nil(t, err)
+	assert.Empty(t, branches)
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"encoding/json"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/auth"
+	cache2 "expo-open-ota/internal/cache"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func refreshTokens(t *testing.T, refreshToken string) (*httptest.ResponseRecorder, auth.AuthResponse) {
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	formData := url.Values{}
+	formData.Set("refreshToken", refreshToken)
+	req, _ := http.NewRequest("POST", "/auth/refreshToken", strings.NewReader(formData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(respRec, req)
+	var response auth.AuthResponse
+	_ = json.Unmarshal(respRec.Body.Bytes(), &response)
+	return respRec, response
+}
+
+func logout(t *testing.T, refreshToken string, accessToken string) *httptest.ResponseRecorder {
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	formData := url.Values{}
+	if refreshToken != "" {
+		formData.Set("refreshToken", refreshToken)
+	}
+	req, _ := http.NewRequest("POST", "/auth/logout", strings.NewReader(formData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	router.ServeHTTP(respRec, req)
+	return respRec
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	session := login(t)
+	respRec, rotated := refreshTokens(t, session.RefreshToken)
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	assert.NotEqual(t, session.RefreshToken, rotated.RefreshToken)
+
+	respRec, rotatedAgain := refreshTokens(t, rotated.RefreshToken)
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/me", rotatedAgain.Token).Code)
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	session := login(t)
+	other := login(t)
+	_, rotated := refreshTokens(t, session.RefreshToken)
+
+	// The first refresh token leaked and is replayed
+	respRec, _ := refreshTokens(t, session.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+
+	// The whole session is revoked, including the tokens of the legitimate holder
+	respRec, _ = refreshTokens(t, rotated.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+	assert.Equal(t, http.StatusUnauthorized, performAuthenticatedRequest(t, "GET", "/api/me", rotated.Token).Code)
+
+	// Other sessions are left untouched
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/me", other.Token).Code)
+}
+
+func TestLogoutWithRefreshToken(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	session := login(t)
+	assert.Equal(t, http.StatusNoContent, logout(t, session.RefreshToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, performAuthenticatedRequest(t, "GET", "/api/me", session.Token).Code)
+	respRec, _ := refreshTokens(t, session.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+}
+
+func TestLogoutWithAccessToken(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	session := login(t)
+	assert.Equal(t, http.StatusNoContent, logout(t, "", session.Token).Code)
+	respRec, _ := refreshTokens(t, session.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+}
+
+func TestLogoutWithInvalidToken(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	assert.Equal(t, http.StatusBadRequest, logout(t, "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, logout(t, "not-a-token", "").Code)
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	admin := login(t)
+	other := login(t)
+	createUser(t, admin.Token, `{"username":"viewer","password":"password123","role":"viewer"}`)
+	_, viewer := loginWithCredentials(t, "viewer", "password123")
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "DELETE", "/api/sessions", viewer.Token).Code)
+
+	assert.Equal(t, http.StatusNoContent, performAuthenticatedRequest(t, "DELETE", "/api/sessions", admin.Token).Code)
+	for _, session := range []auth.AuthResponse{admin, other, viewer} {
+		assert.Equal(t, http.StatusUnauthorized, performAuthenticatedRequest(t, "GET", "/api/me", session.Token).Code)
+		respRec, _ := refreshTokens(t, session.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+	}
+
+	// New logins are not affected
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/me", login(t).Token).Code)
+}
+
+func TestRevokedSessionsSurviveCacheEviction(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	revoked := login(t)
+	assert.Equal(t, http.StatusNoContent, performAuthenticatedRequest(t, "DELETE", "/api/sessions", revoked.Token).Code)
+	active := login(t)
+
+	cache := cache2.GetCache()
+	maxEntries := int(config.GetIntEnv("LOCAL_CACHE_MAX_ENTRIES", 0))
+	for i := 0; i <= maxEntries; i++ {
+		assert.Nil(t, cache.Set("filler:"+strconv.Itoa(i), "value", nil))
+	}
+	// The cache overflowed and dropped its oldest entries
+	assert.Equal(t, "", cache.Get("filler:0"))
+
+	respRec, _ := refreshTokens(t, revoked.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+	assert.Equal(t, http.StatusUnauthorized, performAuthenticatedRequest(t, "GET", "/api/me", revoked.Token).Code)
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/me", active.Token).Code)
+	respRec, _ = refreshTokens(t, active.RefreshToken)
+	assert.Equal(t, http.StatusOK, respRec.Code)
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"context"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/keyStore"
+	infrastructure "expo-open-ota/internal/router"
+	"expo-open-ota/testkit"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newMemoryInfrastructureServer(t *testing.T) *infrastructure.Server {
+	testkit.New(t)
+	keys, err := keyStore.GetKeysStorage()
+	assert.Nil(t, err)
+	server, err := infrastructure.NewServer(infrastructure.Dependencies{
+		Bucket:   bucket.NewMemoryBucket(),
+		Cache:    cache2.NewLocalCache(0, 0, 0),
+		KeyStore: keys,
+		Channels: staticChannels{},
+	})
+	assert.Nil(t, err)
+	return server
+}
+
+func TestReadinessFlipsWhenDraining(t *testing.T) {
+	server := newMemoryInfrastructureServer(t)
+	router := server.NewRouter()
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, get("/ready"))
+	server.Drain()
+	assert.Equal(t, http.StatusServiceUnavailable, get("/ready"))
+	assert.Equal(t, http.StatusOK, get("/hc"))
+}
+
+func TestServeDrainsRequestsInFlight(t *testing.T) {
+	server := newMemoryInfrastructureServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	baseURL := "http://" + listener.Addr().String()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	mux.Handle("/", server.NewRouter())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Serve(ctx, listener, mux, infrastructure.HTTPServerOptions{
+			ReadHeaderTimeout: time.Second,
+			ShutdownDelay:     300 * time.Millisecond,
+			ShutdownTimeout:   5 * time.Second,
+		})
+	}()
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-started
+	cancel()
+
+	// The load balancers are told to stop routing before new connections are refused
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get(baseURL + "/ready")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusServiceUnavailable
+	}, time.Second, 20*time.Millisecond)
+
+	close(release)
+	assert.Equal(t, "done", <-slow)
+	assert.Nil(t, <-stopped)
+	_, err = http.Get(baseURL + "/hc")
+	assert.NotNil(t, err)
+}
+
+func TestServeGivesUpDrainingAfterTimeout(t *testing.T) {
+	server := newMemoryInfrastructureServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Serve(ctx, listener, handler, infrastructure.HTTPServerOptions{ShutdownTimeout: 100 * time.Millisecond})
+	}()
+	go http.Get("http://" + listener.Addr().String() + "/stuck")
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-stopped, context.DeadlineExceeded)
+}
+
+func TestUploadRoutesLimitBody(t *testing.T) {
+	harness := testkit.New(t)
+	t.Setenv("MAX_REQUEST_BODY_BYTES", "64")
+	body := `{"fileNames":["` + strings.Repeat("a", 64) + `.js"]}`
+	r := httptest.NewRequest(http.MethodPost, "http://localhost:3000/requestUploadUrl/main?runtimeVersion=1&platform=android", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testkit.AccessToken)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, harness.Do(r).Code)
+
+	// Bodies of unknown length are cut at the limit
+	r = httptest.NewRequest(http.MethodPost, "http://localhost:3000/requestUploadUrl/main?runtimeVersion=1&platform=android", io.MultiReader(strings.NewReader(body)))
+	r.ContentLength = -1
+	r.Header.Set("Authorization", "Bearer "+testkit.AccessToken)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, harness.Do(r).Code)
+
+	r = httptest.NewRequest(http.MethodPost, "http://localhost:3000/requestUploadUrl/main?runtimeVersion=1&platform=android", strings.NewReader(`{"fileNames":["metadata.json"]}`))
+	r.Header.Set("Authorization", "Bearer "+testkit.AccessToken)
+	assert.Equal(t, http.StatusOK, harness.Do(r).Code)
+
+	t.Setenv("LOCAL_UPLOAD_MAX_BYTES", "16")
+	r = httptest.NewRequest(http.MethodPut, "http://localhost:3000/uploadLocalFile?token=unchecked", strings.NewReader(strings.Repeat("a", 128)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, harness.Do(r).Code)
+}
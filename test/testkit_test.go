@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"expo-open-ota/testkit"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarnessServesBuiltUpdates(t *testing.T) {
+	harness := testkit.New(t)
+	harness.Expo.MapChannel("production", "main")
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, err := harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt.Add(-time.Hour)).WithBundle("ios", "old"))
+	assert.Nil(t, err)
+	_, err = harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt).
+		WithBundle("ios", "console.log('hello')").
+		WithAsset("ios", "png", "image"))
+	assert.Nil(t, err)
+	_, err = harness.AddUpdate(testkit.NewUpdate("main", "1", createdAt.Add(time.Hour)).WithBundle("ios", "partial").Uncommitted())
+	assert.Nil(t, err)
+
+	parts, err := harness.GetManifest("ios", "1", "production")
+	assert.Nil(t, err)
+	var manifest map[string]interface{}
+	for _, part := range parts {
+		if testkit.IsMultipartPartWithName(part, "manifest") {
+			assert.Nil(t, json.Unmarshal([]byte(part.Body), &manifest))
+		}
+	}
+	assert.NotNil(t, manifest)
+	assert.Equal(t, "1", manifest["runtimeVersion"])
+	assets, _ := manifest["assets"].([]interface{})
+	assert.Len(t, assets, 1)
+	launchAsset, _ := manifest["launchAsset"].(map[string]interface{})
+	bundleHash := md5.Sum([]byte("console.log('hello')"))
+	assert.Contains(t, launchAsset["url"], url.QueryEscape("bundles/ios-"+hex.EncodeToString(bundleHash[:])))
+
+	w := harness.Do(testkit.ManifestRequest("ios", "1", "unknown"))
+	assert.NotEqual(t, http.StatusOK, w.Code)
+}
+
+func TestHarnessPublishesIntoMemoryBucket(t *testing.T) {
+	harness := testkit.New(t)
+	files := map[string]string{
+		"metadata.json":      `{"version":0,"bundler":"metro","fileMetadata":{"android":{"bundle":"bundles/android.js","assets":[]}}}`,
+		"bundles/android.js": "console.log('hello')",
+		"expoConfig.json":    "{}",
+	}
+	fileNames := make([]string, 0, len(files))
+	for name := range files {
+		fileNames = append(fileNames, name)
+	}
+	body, err := json.Marshal(map[string][]string{"fileNames": fileNames})
+	assert.Nil(t, err)
+	r := httptest.NewRequest("POST", "http://localhost:3000/requestUploadUrl/main?runtimeVersion=1&platform=android", bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testkit.AccessToken)
+	w := harness.Do(r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		UpdateId       int64                      `json:"updateId"`
+		UploadRequests []bucket.FileUploadRequest `json:"uploadRequests"`
+	}
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Len(t, response.UploadRequests, len(files))
+	assert.Contains(t, harness.Expo.Branches(), "main")
+
+	for _, request := range response.UploadRequests {
+		uploadUrl, err := url.Parse(request.RequestUploadUrl)
+		assert.Nil(t, err)
+		r := httptest.NewRequest("PUT", "http://localhost:3000/uploadLocalFile?"+uploadUrl.RawQuery, strings.NewReader(files[request.FileName]))
+		r.Header.Set("Content-Type", "application/octet-stream")
+		r.Header.Set("Authorization", "Bearer "+testkit.AccessToken)
+		w := harness.Do(r)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	r = httptest.NewRequest("PUT", "http://localhost:3000/uploadLocalFile?"+mustQuery(t, response.UploadRequests[0].RequestUploadUrl), strings.NewReader("chunk"))
+	r.Header.Set("Content-Range", "bytes 0-4/10")
+	r.Header.Set("Authorization", "Bearer "+testkit.AccessToken)
+	assert.Equal(t, http.StatusBadRequest, harness.Do(r).Code)
+
+	updateId := fmt.Sprintf("%d", response.UpdateId)
+	r = httptest.NewRequest("POST", "http://localhost:3000/markUpdateAsUploaded/main?platform=android&runtimeVersion=1&updateId="+updateId, nil)
+	r.Header.Set("Authorization", "Bearer "+testkit.AccessToken)
+	w = harness.Do(r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	commit, err := update.DefaultManager().ReadCommit(types.Update{Branch: "main", RuntimeVersion: "1", UpdateId: updateId})
+	assert.Nil(t, err)
+	assert.Equal(t, updateId, commit.UpdateId)
+
+	harness.Expo.MapChannel("production", "main")
+	_, err = harness.GetManifest("android", "1", "production")
+	assert.Nil(t, err)
+}
+
+func mustQuery(t *testing.T, rawUrl string) string {
+	t.Helper()
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		t.Fatalf("invalid upload url %s: %v", rawUrl, err)
+	}
+	return parsedUrl.RawQuery
+}
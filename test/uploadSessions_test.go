@@ -0,0 +1,119 @@
+package test
+
+import (
+	"bytes"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/uploadSessions"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleUpdate(t *testing.T) (string, string) {
+	t.Helper()
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	return projectRoot, filepath.Join(projectRoot, "test", "test-updates", "branch-4", "1", "1674170952")
+}
+
+func requestUploadUrlsWithBody(t *testing.T, projectRoot string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	os.Setenv("LOCAL_BUCKET_BASE_PATH", filepath.Join(projectRoot, "./updates"))
+	bucket.ResetBucketInstance()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "http://localhost:3000/requestUploadUrl/DO_NOT_USE?runtimeVersion=1&platform=android", bytes.NewBufferString(body))
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "DO_NOT_USE"})
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	envHandlers(t).RequestUploadUrlHandler(w, r)
+	return w
+}
+
+func TestUploadWithDeclaredHashes(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, sampleUpdatePath := sampleUpdate(t)
+	updateId := performUploadWithInput(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath, "Bearer expo_test_token", ComputeUploadFilesInput(sampleUpdatePath))
+	session, err := uploadSessions.Get(bucket.GetBucket(), "DO_NOT_USE", "1", updateId)
+	assert.Nil(t, err)
+	assert.NotNil(t, session.Files[0].Size)
+	assert.Equal(t, "android", session.Platform)
+
+	assert.Equal(t, http.StatusOK, markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId).Code)
+	// Marking twice must not discard the published update
+	assert.Equal(t, http.StatusOK, markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId).Code)
+}
+
+func TestUploadRejectsMismatchedHash(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, sampleUpdatePath := sampleUpdate(t)
+	input := ComputeUploadFilesInput(sampleUpdatePath)
+	input.Files[0].Sha256 = strings.Repeat("0", 64)
+	updateId := performUploadWithInput(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath, "Bearer expo_test_token", input)
+
+	w := markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "sha256 mismatch for "+input.Files[0].Path)
+	_, err := os.Stat(filepath.Join(projectRoot, "updates", "DO_NOT_USE", "1", updateId))
+	assert.True(t, os.IsNotExist(err))
+	_, err = uploadSessions.Get(bucket.GetBucket(), "DO_NOT_USE", "1", updateId)
+	assert.ErrorIs(t, err, uploadSessions.ErrSessionNotFound)
+}
+
+func TestUploadRejectsUnexpectedFile(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, sampleUpdatePath := sampleUpdate(t)
+	updateId := performUpload(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath)
+	extraFile := filepath.Join(projectRoot, "updates", "DO_NOT_USE", "1", updateId, "_expo", "extra.js")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(extraFile), os.ModePerm))
+	assert.Nil(t, os.WriteFile(extraFile, []byte("alert(1)"), 0644))
+
+	w := markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unexpected file: _expo/extra.js")
+}
+
+func TestMarkUpdateWithoutSession(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, sampleUpdatePath := sampleUpdate(t)
+	updateId := performUpload(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath)
+	assert.Nil(t, uploadSessions.Delete(bucket.GetBucket(), "DO_NOT_USE", "1", updateId))
+
+	w := markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), uploadSessions.ErrSessionNotFound.Error())
+}
+
+func TestRequestUploadUrlRejectsInvalidDeclarations(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, _ := sampleUpdate(t)
+	bodies := []string{
+		`{"files":[{"path":"update-metadata.json"}]}`,
+		`{"files":[{"path":"../metadata.json"}]}`,
+		`{"files":[{"path":"metadata.json","sha256":"not-a-hash"}]}`,
+		`{"fileNames":["metadata.json","expoConfig.json"],"files":[{"path":"metadata.json"}]}`,
+	}
+	for _, body := range bodies {
+		w := requestUploadUrlsWithBody(t, projectRoot, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+	w := requestUploadUrlsWithBody(t, projectRoot, `{"fileNames":["metadata.json"],"files":[{"path":"metadata.json","size":2}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"uploadSession":{"expiresAt"`)
+}
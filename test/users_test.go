@@ -0,0 +1,228 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/users"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupUsers(t *testing.T) {
+	t.Helper()
+	os.Setenv("USERS_FILE_PATH", filepath.Join(t.TempDir(), "users.json"))
+	t.Cleanup(func() {
+		os.Unsetenv("USERS_FILE_PATH")
+	})
+}
+
+func createUser(t *testing.T, token string, body string) (*httptest.ResponseRecorder, users.User) {
+	t.Helper()
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/users", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(respRec, req)
+	var user users.User
+	_ = json.Unmarshal(respRec.Body.Bytes(), &user)
+	return respRec, user
+}
+
+func loginWithCredentials(t *testing.T, username string, password string) (*httptest.ResponseRecorder, auth.AuthResponse) {
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	formData := url.Values{}
+	formData.Set("username", username)
+	formData.Set("password", password)
+	req, _ := http.NewRequest("POST", "/auth/login", strings.NewReader(formData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(respRec, req)
+	var response auth.AuthResponse
+	_ = json.Unmarshal(respRec.Body.Bytes(), &response)
+	return respRec, response
+}
+
+func performAuthenticatedRequest(t *testing.T, method string, path string, token string) *httptest.ResponseRecorder {
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(respRec, req)
+	return respRec
+}
+
+func TestCreateUserAndLogin(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	respRec, created := createUser(t, login(t).Token, `{"username":"alice","password":"password123","role":"publisher"}`)
+	assert.Equal(t, http.StatusCreated, respRec.Code)
+	assert.Equal(t, "alice", created.Username)
+	assert.NotContains(t, respRec.Body.String(), "password")
+
+	loginRec, response := loginWithCredentials(t, "alice", "password123")
+	assert.Equal(t, http.StatusOK, loginRec.Code)
+	assert.NotEmpty(t, response.Token)
+
+	meRec := performAuthenticatedRequest(t, "GET", "/api/me", response.Token)
+	assert.Equal(t, http.StatusOK, meRec.Code)
+	var principal auth.Principal
+	assert.Nil(t, json.Unmarshal(meRec.Body.Bytes(), &principal))
+	assert.Equal(t, "alice", principal.Username)
+	assert.Equal(t, users.PublisherRole, principal.Role)
+}
+
+func TestLoginWithWrongCredentials(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	createUser(t, login(t).Token, `{"username":"alice","password":"password123","role":"viewer"}`)
+	respRec, _ := loginWithCredentials(t, "alice", "wrong-password")
+	assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+	respRec, _ = loginWithCredentials(t, "bob", "password123")
+	assert.Equal(t, http.StatusUnauthorized, respRec.Code)
+}
+
+func TestCreateDuplicateUser(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	token := login(t).Token
+	respRec, _ := createUser(t, token, `{"username":"alice","password":"password123","role":"viewer"}`)
+	assert.Equal(t, http.StatusCreated, respRec.Code)
+	respRec, _ = createUser(t, token, `{"username":"alice","password":"password123","role":"admin"}`)
+	assert.Equal(t, http.StatusConflict, respRec.Code)
+	respRec, _ = createUser(t, token, `{"username":"bob","password":"password123","role":"owner"}`)
+	assert.Equal(t, http.StatusBadRequest, respRec.Code)
+}
+
+func TestViewerPermissions(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	createUser(t, login(t).Token, `{"username":"viewer","password":"password123","role":"viewer"}`)
+	_, response := loginWithCredentials(t, "viewer", "password123")
+
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/settings", response.Token).Code)
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "DELETE", "/api/branch/branch-1/runtimeVersion/1", response.Token).Code)
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "GET", "/api/apiKeys", response.Token).Code)
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "GET", "/api/users", response.Token).Code)
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "POST", "/api/reindex", response.Token).Code)
+}
+
+func TestPublisherPermissions(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	setupApiKeys(t)
+	createUser(t, login(t).Token, `{"username":"publisher","password":"password123","role":"publisher"}`)
+	_, response := loginWithCredentials(t, "publisher", "password123")
+
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/apiKeys", response.Token).Code)
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "GET", "/api/users", response.Token).Code)
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "DELETE", "/api/branch/branch-1/runtimeVersion/1", response.Token).Code)
+}
+
+func updateUser(t *testing.T, token string, id string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/api/users/"+id, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(respRec, req)
+	return respRec
+}
+
+func TestUpdateUserRoleAppliesOnRefresh(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	adminToken := login(t).Token
+	_, created := createUser(t, adminToken, `{"username":"alice","password":"password123","role":"viewer"}`)
+	_, response := loginWithCredentials(t, "alice", "password123")
+
+	assert.Equal(t, http.StatusOK, updateUser(t, adminToken, created.Id, `{"role":"admin"}`).Code)
+
+	refreshed, err := auth.NewAuth().RefreshToken(response.RefreshToken)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/users", refreshed.Token).Code)
+}
+
+func TestDeletedUserCannotRefresh(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	adminToken := login(t).Token
+	_, created := createUser(t, adminToken, `{"username":"alice","password":"password123","role":"viewer"}`)
+	_, response := loginWithCredentials(t, "alice", "password123")
+
+	deleteRec := performAuthenticatedRequest(t, "DELETE", "/api/users/"+created.Id, adminToken)
+	assert.Equal(t, http.StatusNoContent, deleteRec.Code)
+	assert.Equal(t, http.StatusNotFound, performAuthenticatedRequest(t, "DELETE", "/api/users/"+created.Id, adminToken).Code)
+
+	_, err := auth.NewAuth().RefreshToken(response.RefreshToken)
+	assert.NotNil(t, err)
+}
+
+func TestDeletedUserTokenIsRejected(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	adminToken := login(t).Token
+	_, created := createUser(t, adminToken, `{"username":"alice","password":"password123","role":"viewer"}`)
+	_, response := loginWithCredentials(t, "alice", "password123")
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/settings", response.Token).Code)
+
+	assert.Equal(t, http.StatusNoContent, performAuthenticatedRequest(t, "DELETE", "/api/users/"+created.Id, adminToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, performAuthenticatedRequest(t, "GET", "/api/settings", response.Token).Code)
+}
+
+func TestDemotedUserLosesRoleImmediately(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	adminToken := login(t).Token
+	_, created := createUser(t, adminToken, `{"username":"alice","password":"password123","role":"admin"}`)
+	_, response := loginWithCredentials(t, "alice", "password123")
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/users", response.Token).Code)
+
+	assert.Equal(t, http.StatusOK, updateUser(t, adminToken, created.Id, `{"role":"viewer"}`).Code)
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "GET", "/api/users", response.Token).Code)
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/settings", response.Token).Code)
+}
+
+func TestPasswordChangeRejectsPreviousTokens(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	adminToken := login(t).Token
+	_, created := createUser(t, adminToken, `{"username":"alice","password":"password123","role":"viewer"}`)
+	_, response := loginWithCredentials(t, "alice", "password123")
+
+	assert.Equal(t, http.StatusOK, updateUser(t, adminToken, created.Id, `{"password":"newpassword123"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, performAuthenticatedRequest(t, "GET", "/api/settings", response.Token).Code)
+	_, err := auth.NewAuth().RefreshToken(response.RefreshToken)
+	assert.NotNil(t, err)
+
+	_, renewed := loginWithCredentials(t, "alice", "newpassword123")
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "GET", "/api/settings", renewed.Token).Code)
+}
+
+func TestLegacyPasswordLoginIsAdmin(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupUsers(t)
+	meRec := performAuthenticatedRequest(t, "GET", "/api/me", login(t).Token)
+	assert.Equal(t, http.StatusOK, meRec.Code)
+	var principal auth.Principal
+	assert.Nil(t, json.Unmarshal(meRec.Body.Bytes(), &principal))
+	assert.Equal(t, users.AdminRole, principal.Role)
+}
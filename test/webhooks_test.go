@@ -0,0 +1,218 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"expo-open-ota/internal/webhooks"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookReceiver is a local HTTP endpoint recording the events it receives, after checking their signature
+type webhookReceiver struct {
+	server *httptest.Server
+	secret string
+	mu     sync.Mutex
+	events []webhooks.Event
+}
+
+func setupWebhooks(t *testing.T) *webhookReceiver {
+	t.Helper()
+	os.Setenv("WEBHOOKS_FILE_PATH", filepath.Join(t.TempDir(), "webhooks.json"))
+	os.Setenv("WEBHOOKS_RETRY_DELAY_MS", "1")
+	// Let the deliveries reach the local receiver through the mocked transport
+	httpmock.RegisterNoResponder(httpmock.InitialTransport.RoundTrip)
+	receiver := &webhookReceiver{}
+	receiver.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		if webhooks.Sign(receiver.secret, r.Header.Get("X-Expo-Open-Ota-Timestamp"), body) != r.Header.Get("X-Expo-Open-Ota-Signature") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event webhooks.Event
+		_ = json.Unmarshal(body, &event)
+		receiver.events = append(receiver.events, event)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(func() {
+		webhooks.Wait()
+		receiver.server.Close()
+		os.Unsetenv("WEBHOOKS_FILE_PATH")
+		os.Unsetenv("WEBHOOKS_RETRY_DELAY_MS")
+	})
+	return receiver
+}
+
+func (receiver *webhookReceiver) received() []webhooks.Event {
+	webhooks.Wait()
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return append([]webhooks.Event{}, receiver.events...)
+}
+
+func createWebhook(t *testing.T, token string, body string) (*httptest.ResponseRecorder, webhooks.Webhook) {
+	t.Helper()
+	router := newRouter(t)
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/webhooks", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(respRec, req)
+	var webhook webhooks.Webhook
+	_ = json.Unmarshal(respRec.Body.Bytes(), &webhook)
+	return respRec, webhook
+}
+
+func (receiver *webhookReceiver) subscribe(t *testing.T, token string, events string, branches string) webhooks.Webhook {
+	t.Helper()
+	respRec, webhook := createWebhook(t, token, `{"name":"receiver","url":"`+receiver.server.URL+`","events":`+events+`,"branches":`+branches+`}`)
+	assert.Equal(t, http.StatusCreated, respRec.Code, respRec.Body.String())
+	receiver.secret = webhook.Secret
+	return webhook
+}
+
+func getWebhookDeliveries(t *testing.T, token string, webhookId string) []webhooks.Delivery {
+	t.Helper()
+	respRec := performAuthenticatedRequest(t, "GET", "/api/webhooks/"+webhookId+"/deliveries", token)
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	var deliveries []webhooks.Delivery
+	assert.Nil(t, json.Unmarshal(respRec.Body.Bytes(), &deliveries))
+	return deliveries
+}
+
+func TestCreateAndListWebhooks(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupWebhooks(t)
+	token := login(t).Token
+	respRec, created := createWebhook(t, token, `{"name":"slack","url":"https://hooks.example.com/1","events":["update.published"],"branches":["*"]}`)
+	assert.Equal(t, http.StatusCreated, respRec.Code)
+	assert.NotEmpty(t, created.Secret)
+
+	listRec := performAuthenticatedRequest(t, "GET", "/api/webhooks", token)
+	assert.Equal(t, http.StatusOK, listRec.Code)
+	var list []webhooks.Webhook
+	assert.Nil(t, json.Unmarshal(listRec.Body.Bytes(), &list))
+	assert.Len(t, list, 1)
+	assert.Equal(t, created.Id, list[0].Id)
+	assert.NotContains(t, listRec.Body.String(), created.Secret)
+
+	respRec, _ = createWebhook(t, token, `{"name":"slack","url":"https://hooks.example.com/1","events":["update.created"],"branches":["*"]}`)
+	assert.Equal(t, http.StatusBadRequest, respRec.Code)
+
+	assert.Equal(t, http.StatusNoContent, performAuthenticatedRequest(t, "DELETE", "/api/webhooks/"+created.Id, token).Code)
+	assert.Equal(t, http.StatusNotFound, performAuthenticatedRequest(t, "DELETE", "/api/webhooks/"+created.Id, token).Code)
+	assert.Equal(t, http.StatusNotFound, performAuthenticatedRequest(t, "GET", "/api/webhooks/"+created.Id+"/deliveries", token).Code)
+}
+
+func TestWebhooksRequireAdmin(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	setupWebhooks(t)
+	setupUsers(t)
+	createUser(t, login(t).Token, `{"username":"publisher","password":"password123","role":"publisher"}`)
+	_, response := loginWithCredentials(t, "publisher", "password123")
+	assert.Equal(t, http.StatusForbidden, performAuthenticatedRequest(t, "GET", "/api/webhooks", response.Token).Code)
+	respRec, _ := createWebhook(t, response.Token, `{"name":"slack","url":"https://hooks.example.com/1","events":["update.published"],"branches":["*"]}`)
+	assert.Equal(t, http.StatusForbidden, respRec.Code)
+}
+
+func TestWebhookPing(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	receiver := setupWebhooks(t)
+	token := login(t).Token
+	webhook := receiver.subscribe(t, token, `["update.published"]`, `["main"]`)
+	respRec := performAuthenticatedRequest(t, "POST", "/api/webhooks/"+webhook.Id+"/ping", token)
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	var delivery webhooks.Delivery
+	assert.Nil(t, json.Unmarshal(respRec.Body.Bytes(), &delivery))
+	assert.True(t, delivery.Success)
+	assert.Equal(t, http.StatusNoContent, delivery.StatusCode)
+	assert.Equal(t, webhooks.PingEvent, receiver.received()[0].Type)
+}
+
+func TestWebhookOnPublishedUpdate(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	receiver := setupWebhooks(t)
+	mockExpoForRequestUploadUrlTest("staging")
+	token := login(t).Token
+	webhook := receiver.subscribe(t, token, `["update.published","update.deleted"]`, `["DO_NOT_USE"]`)
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "test", "test-updates", "branch-4", "1", "1674170952")
+	updateId := performUpload(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath)
+	assert.Equal(t, http.StatusOK, markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId).Code)
+
+	events := receiver.received()
+	assert.Len(t, events, 1)
+	assert.Equal(t, webhooks.UpdatePublishedEvent, events[0].Type)
+	assert.Equal(t, "DO_NOT_USE", events[0].Branch)
+	assert.Equal(t, "1", events[0].RuntimeVersion)
+	assert.Equal(t, updateId, events[0].UpdateId)
+	assert.Equal(t, "android", events[0].Platform)
+
+	assert.Equal(t, http.StatusOK, performAuthenticatedRequest(t, "DELETE", "/api/branch/DO_NOT_USE/runtimeVersion/1", token).Code)
+	events = receiver.received()
+	assert.Len(t, events, 2)
+	assert.Equal(t, webhooks.UpdateDeletedEvent, events[1].Type)
+	assert.Equal(t, updateId, events[1].UpdateId)
+
+	deliveries := getWebhookDeliveries(t, token, webhook.Id)
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, webhooks.UpdateDeletedEvent, deliveries[0].EventType)
+	assert.True(t, deliveries[0].Success)
+}
+
+func TestWebhookOnFailedVerification(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	receiver := setupWebhooks(t)
+	mockExpoForRequestUploadUrlTest("staging")
+	receiver.subscribe(t, login(t).Token, `["update.verificationFailed"]`, `["*"]`)
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	// Upload URLs are requested but the files are never uploaded
+	sampleUpdatePath := filepath.Join(projectRoot, "test", "test-updates", "branch-4", "1", "1674170952")
+	w, _, _, r := createUploadRequest(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath, "Authorization", "Bearer expo_test_token")
+	envHandlers(t).RequestUploadUrlHandler(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	updateId := w.Header().Get("expo-update-id")
+	assert.Equal(t, http.StatusBadRequest, markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId).Code)
+
+	events := receiver.received()
+	assert.Len(t, events, 1)
+	assert.Equal(t, webhooks.UpdateVerificationFailedEvent, events[0].Type)
+	assert.Equal(t, updateId, events[0].UpdateId)
+	assert.NotEmpty(t, events[0].Reason)
+}
+
+func TestWebhookBranchFilter(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	receiver := setupWebhooks(t)
+	mockExpoForRequestUploadUrlTest("staging")
+	receiver.subscribe(t, login(t).Token, `["update.published"]`, `["release-*"]`)
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "test", "test-updates", "branch-4", "1", "1674170952")
+	updateId := performUpload(t, projectRoot, "DO_NOT_USE", "1", sampleUpdatePath)
+	assert.Equal(t, http.StatusOK, markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId).Code)
+	assert.Empty(t, receiver.received())
+}
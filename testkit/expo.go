@@ -0,0 +1,179 @@
+package testkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ExpoServer is a fake of the Expo GraphQL API, answering the queries made by expo-open-ota from the
+// accounts, branches and channels it was given.
+type ExpoServer struct {
+	*httptest.Server
+	mu sync.Mutex
+	// accounts maps the access tokens and session secrets accepted by the server to their username
+	accounts map[string]string
+	branches []string
+	channels map[string]string
+	// appChannels holds the channels of the apps other than EXPO_APP_ID, by Expo app id
+	appChannels map[string]map[string]string
+}
+
+func NewExpoServer(t testing.TB) *ExpoServer {
+	t.Helper()
+	server := &ExpoServer{accounts: map[string]string{}, channels: map[string]string{}, appChannels: map[string]map[string]string{}}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// GraphQLURL is the value of EXPO_GRAPHQL_URL pointing expo-open-ota to this server.
+func (s *ExpoServer) GraphQLURL() string {
+	return s.URL + "/graphql"
+}
+
+// AddAccount accepts the given access token or session secret as the account of username.
+func (s *ExpoServer) AddAccount(credential string, username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[credential] = username
+}
+
+func (s *ExpoServer) AddBranch(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addBranch(name)
+}
+
+func (s *ExpoServer) addBranch(name string) {
+	for _, branch := range s.branches {
+		if branch == name {
+			return
+		}
+	}
+	s.branches = append(s.branches, name)
+}
+
+// MapChannel points a channel to a branch, creating both if needed.
+func (s *ExpoServer) MapChannel(channel string, branch string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addBranch(branch)
+	s.channels[channel] = branch
+}
+
+// MapAppChannel points a channel of another Expo app than EXPO_APP_ID to a branch, creating the branch if needed.
+func (s *ExpoServer) MapAppChannel(appId string, channel string, branch string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addBranch(branch)
+	if s.appChannels[appId] == nil {
+		s.appChannels[appId] = map[string]string{}
+	}
+	s.appChannels[appId][channel] = branch
+}
+
+func (s *ExpoServer) channelsOf(appId string) map[string]string {
+	if channels, ok := s.appChannels[appId]; ok {
+		return channels
+	}
+	return s.channels
+}
+
+func (s *ExpoServer) Branches() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.branches...)
+}
+
+func branchId(name string) string {
+	return name + "-id"
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+func (s *ExpoServer) handle(w http.ResponseWriter, r *http.Request) {
+	var request graphQLRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid GraphQL request", http.StatusBadRequest)
+		return
+	}
+	credential := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if credential == "" {
+		credential = r.Header.Get("expo-session")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	username, ok := s.accounts[credential]
+	if !ok {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	appId, _ := request.Variables["appId"].(string)
+	channels := s.channelsOf(appId)
+	var data map[string]interface{}
+	switch {
+	case strings.Contains(request.Query, "createUpdateBranchForApp"):
+		name, _ := request.Variables["name"].(string)
+		s.addBranch(name)
+		data = map[string]interface{}{
+			"updateBranch": map[string]interface{}{
+				"createUpdateBranchForApp": map[string]interface{}{"id": branchId(name), "name": name},
+			},
+		}
+	case strings.Contains(request.Query, "me {"):
+		data = map[string]interface{}{
+			"me": map[string]interface{}{"id": username + "-id", "username": username, "email": username + "@example.com"},
+		}
+	case strings.Contains(request.Query, "updateChannelByName"):
+		channelName, _ := request.Variables["channelName"].(string)
+		data = s.app(map[string]interface{}{"updateChannelByName": channel(channels, channelName)})
+	case strings.Contains(request.Query, "updateChannels"):
+		names := make([]string, 0, len(channels))
+		for name := range channels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		updateChannels := make([]map[string]interface{}, 0, len(names))
+		for _, name := range names {
+			updateChannels = append(updateChannels, channel(channels, name))
+		}
+		data = s.app(map[string]interface{}{"updateChannels": updateChannels})
+	case strings.Contains(request.Query, "updateBranches"):
+		data = s.app(nil)
+	default:
+		http.Error(w, "unknown GraphQL operation", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// app wraps fields along with the branches of the app, which every app query asks for.
+func (s *ExpoServer) app(fields map[string]interface{}) map[string]interface{} {
+	branches := make([]map[string]interface{}, 0, len(s.branches))
+	for _, name := range s.branches {
+		branches = append(branches, map[string]interface{}{"id": branchId(name), "name": name})
+	}
+	byId := map[string]interface{}{"id": "EXPO_APP_ID", "updateBranches": branches}
+	for key, value := range fields {
+		byId[key] = value
+	}
+	return map[string]interface{}{"app": map[string]interface{}{"byId": byId}}
+}
+
+func channel(channels map[string]string, name string) map[string]interface{} {
+	mapping := []map[string]interface{}{}
+	if branch, ok := channels[name]; ok {
+		mapping = append(mapping, map[string]interface{}{"branchId": branchId(branch), "branchMappingLogic": "true"})
+	}
+	branchMapping, _ := json.Marshal(map[string]interface{}{"version": 0, "data": mapping})
+	return map[string]interface{}{"id": name + "-id", "name": name, "branchMapping": string(branchMapping)}
+}
@@ -0,0 +1,192 @@
+// Package testkit runs expo-open-ota in-process for integration tests: updates are kept in a memory bucket,
+// Expo is replaced by a fake GraphQL server and the signed multipart manifests can be parsed and verified.
+package testkit
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"expo-open-ota/internal/apiKeys"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/cdn"
+	"expo-open-ota/internal/keyStore"
+	"expo-open-ota/internal/metadataStore"
+	infrastructure "expo-open-ota/internal/router"
+	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/users"
+	"expo-open-ota/internal/webhooks"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	// AccessToken is the EXPO_ACCESS_TOKEN of the harness, also accepted from publishers
+	AccessToken = "testkit-access-token"
+	Username    = "testkit"
+)
+
+// Harness is a server wired to a memory bucket and a fake Expo API. Harnesses configure the process
+// environment, they cannot run in parallel tests.
+type Harness struct {
+	Bucket    *bucket.MemoryBucket
+	Expo      *ExpoServer
+	PublicKey string
+	handler   http.Handler
+}
+
+func generateKeys(t testing.TB) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating signing key: %v", err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("error encoding public key: %v", err)
+	}
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes})
+	return string(privateKey), string(publicKey)
+}
+
+func randomSecret(t testing.TB) string {
+	t.Helper()
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatalf("error generating secret: %v", err)
+	}
+	return hex.EncodeToString(secret)
+}
+
+func resetInstances() {
+	webhooks.Wait()
+	bucket.ResetBucketInstance()
+	cdn.ResetCDNInstance()
+	metadataStore.ResetMetadataStoreInstance()
+	apiKeys.ResetApiKeyStoreInstance()
+	users.ResetUserStoreInstance()
+	auth.ResetOIDCClientInstance()
+	auth.ResetSessionStoreInstance()
+	audit.ResetSinkInstance()
+	webhooks.ResetWebhookStoreInstance()
+	_ = cache2.GetCache().Clear()
+}
+
+// New starts a harness torn down with the test.
+func New(t testing.TB) *Harness {
+	t.Helper()
+	expo := NewExpoServer(t)
+	expo.AddAccount(AccessToken, Username)
+	privateKey, publicKey := generateKeys(t)
+	folder := t.TempDir()
+	env := map[string]string{
+		"STORAGE_MODE":           string(bucket.MemoryBucketType),
+		"BASE_URL":               "http://localhost:3000",
+		"EXPO_GRAPHQL_URL":       expo.GraphQLURL(),
+		"EXPO_APP_ID":            "EXPO_APP_ID",
+		"EXPO_ACCESS_TOKEN":      AccessToken,
+		"JWT_SECRET":             randomSecret(t),
+		"KEYS_STORAGE_TYPE":      "environment",
+		"PUBLIC_EXPO_KEY_B64":    base64.StdEncoding.EncodeToString([]byte(publicKey)),
+		"PRIVATE_EXPO_KEY_B64":   base64.StdEncoding.EncodeToString([]byte(privateKey)),
+		"LOCAL_BUCKET_BASE_PATH": filepath.Join(folder, "bucket"),
+		"API_KEYS_FILE_PATH":     filepath.Join(folder, "apiKeys.json"),
+		"USERS_FILE_PATH":        filepath.Join(folder, "users.json"),
+		"WEBHOOKS_FILE_PATH":     filepath.Join(folder, "webhooks.json"),
+		"METADATA_STORE_TYPE":    "",
+		"CACHE_MODE":             "",
+		"CLOUDFRONT_DOMAIN":      "",
+		"USE_DASHBOARD":          "false",
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	resetInstances()
+	harness := &Harness{
+		Bucket:    bucket.NewMemoryBucket(),
+		Expo:      expo,
+		PublicKey: publicKey,
+	}
+	bucket.SetBucketInstance(harness.Bucket)
+	keys, err := keyStore.GetKeysStorage()
+	if err != nil {
+		t.Fatalf("error resolving key store: %v", err)
+	}
+	server, err := infrastructure.NewServer(infrastructure.Dependencies{
+		Bucket:   harness.Bucket,
+		Cache:    cache2.GetCache(),
+		KeyStore: keys,
+		Channels: services.ExpoChannelResolver{},
+	})
+	if err != nil {
+		t.Fatalf("error building server: %v", err)
+	}
+	harness.handler = server.NewRouter()
+	t.Cleanup(resetInstances)
+	return harness
+}
+
+// AddUpdate builds an update into the bucket of the harness, making it the latest one of its runtime version.
+func (h *Harness) AddUpdate(builder *UpdateBuilder) (types.Update, error) {
+	update, err := builder.Build(h.Bucket)
+	if err != nil {
+		return update, err
+	}
+	h.Expo.AddBranch(update.Branch)
+	return update, cache2.GetCache().Clear()
+}
+
+// Handler serves the routes of the server, for example behind an httptest.Server.
+func (h *Harness) Handler() http.Handler {
+	return h.handler
+}
+
+// Do serves a request through the routes of the server.
+func (h *Harness) Do(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.handler.ServeHTTP(w, r)
+	return w
+}
+
+// ManifestRequest is the request an expo-updates client makes on launch.
+func ManifestRequest(platform string, runtimeVersion string, channel string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "http://localhost:3000/manifest", nil)
+	r.Header.Set("expo-platform", platform)
+	r.Header.Set("expo-runtime-version", runtimeVersion)
+	r.Header.Set("expo-protocol-version", "1")
+	r.Header.Set("expo-expect-signature", "true")
+	r.Header.Set("expo-channel-name", channel)
+	return r
+}
+
+// GetManifest requests a manifest and returns its verified parts.
+func (h *Harness) GetManifest(platform string, runtimeVersion string, channel string) ([]MultipartPart, error) {
+	w := h.Do(ManifestRequest(platform, runtimeVersion, channel))
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("manifest request returned status %d: %s", w.Code, w.Body.String())
+	}
+	parts, err := ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		signature := part.Headers["Expo-Signature"]
+		if signature == "" {
+			continue
+		}
+		if err := VerifySignature(h.PublicKey, signature, part.Body); err != nil {
+			return nil, fmt.Errorf("invalid signature of the %s part: %w", part.Name, err)
+		}
+	}
+	return parts, nil
+}
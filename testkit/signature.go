@@ -0,0 +1,58 @@
+package testkit
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseSignatureHeader reads the sig and keyid of an expo-signature header, `sig="...", keyid="main"`.
+func ParseSignatureHeader(header string) (map[string]string, error) {
+	parameters := map[string]string{}
+	for _, item := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid signature parameter %q", item)
+		}
+		parameters[key] = strings.Trim(value, `"`)
+	}
+	if parameters["sig"] == "" {
+		return nil, errors.New("signature header has no sig")
+	}
+	return parameters, nil
+}
+
+// VerifySignature checks an expo-signature header against the content it signs and the PEM encoded public key.
+func VerifySignature(publicKeyPEM string, header string, content string) error {
+	parameters, err := ParseSignatureHeader(header)
+	if err != nil {
+		return err
+	}
+	if parameters["keyid"] != "main" {
+		return fmt.Errorf("unexpected keyid %q", parameters["keyid"])
+	}
+	signature, err := base64.StdEncoding.DecodeString(parameters["sig"])
+	if err != nil {
+		return fmt.Errorf("error decoding signature: %w", err)
+	}
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return errors.New("invalid public key PEM")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing public key: %w", err)
+	}
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("public key is not an RSA key")
+	}
+	hash := sha256.Sum256([]byte(content))
+	return rsa.VerifyPKCS1v15(rsaPublicKey, crypto.SHA256, hash[:], signature)
+}
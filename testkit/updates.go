@@ -0,0 +1,145 @@
+package testkit
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// UpdateBuilder writes the files of an update the way requestUploadUrl and markUpdateAsUploaded would.
+type UpdateBuilder struct {
+	update      types.Update
+	metadata    types.MetadataObject
+	files       map[string][]byte
+	platform    string
+	commitHash  string
+	rollback    bool
+	uncommitted bool
+}
+
+// NewUpdate starts an update of the branch and runtime version, its id is derived from createdAt.
+func NewUpdate(branch string, runtimeVersion string, createdAt time.Time) *UpdateBuilder {
+	return &UpdateBuilder{
+		update: types.Update{
+			Branch:         branch,
+			RuntimeVersion: runtimeVersion,
+			UpdateId:       strconv.FormatInt(createdAt.UnixMilli(), 10),
+			CreatedAt:      time.Duration(createdAt.UnixMilli()) * time.Millisecond,
+		},
+		metadata: types.MetadataObject{Version: 0, Bundler: "metro"},
+		files:    map[string][]byte{"expoConfig.json": []byte("{}")},
+	}
+}
+
+func contentHash(content string) string {
+	hash := md5.Sum([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+func (b *UpdateBuilder) platformMetadata(platform string) *types.PlatformMetadata {
+	if platform == "ios" {
+		return &b.metadata.FileMetadata.IOS
+	}
+	return &b.metadata.FileMetadata.Android
+}
+
+// WithBundle adds the JavaScript bundle of "ios" or "android".
+func (b *UpdateBuilder) WithBundle(platform string, content string) *UpdateBuilder {
+	path := fmt.Sprintf("bundles/%s-%s.js", platform, contentHash(content))
+	b.platformMetadata(platform).Bundle = path
+	b.files[path] = []byte(content)
+	if b.platform == "" {
+		b.platform = platform
+	}
+	return b
+}
+
+func (b *UpdateBuilder) WithAsset(platform string, ext string, content string) *UpdateBuilder {
+	path := "assets/" + contentHash(content)
+	metadata := b.platformMetadata(platform)
+	metadata.Assets = append(metadata.Assets, types.Asset{Path: path, Ext: ext})
+	b.files[path] = []byte(content)
+	return b
+}
+
+func (b *UpdateBuilder) WithExpoConfig(expoConfig map[string]interface{}) *UpdateBuilder {
+	content, err := json.Marshal(expoConfig)
+	if err != nil {
+		panic(err)
+	}
+	b.files["expoConfig.json"] = content
+	return b
+}
+
+func (b *UpdateBuilder) WithCommitHash(commitHash string) *UpdateBuilder {
+	b.commitHash = commitHash
+	return b
+}
+
+// AsRollback makes the update a rollback to the embedded update, published for the given platform.
+func (b *UpdateBuilder) AsRollback(platform string) *UpdateBuilder {
+	b.rollback = true
+	b.platform = platform
+	return b
+}
+
+// Uncommitted leaves the update as if it was never marked as uploaded.
+func (b *UpdateBuilder) Uncommitted() *UpdateBuilder {
+	b.uncommitted = true
+	return b
+}
+
+func (b *UpdateBuilder) Update() types.Update {
+	return b.update
+}
+
+// Build writes the update into the bucket, committing it last. Servers using a metadata store must be reindexed.
+func (b *UpdateBuilder) Build(target bucket.Bucket) (types.Update, error) {
+	files := map[string][]byte{}
+	if b.rollback {
+		files["rollback"] = []byte("rollback")
+	} else {
+		for path, content := range b.files {
+			files[path] = content
+		}
+		metadata, err := json.Marshal(b.metadata)
+		if err != nil {
+			return b.update, err
+		}
+		files["metadata.json"] = metadata
+	}
+	updateMetadata, err := json.Marshal(map[string]string{"platform": b.platform, "commitHash": b.commitHash})
+	if err != nil {
+		return b.update, err
+	}
+	files["update-metadata.json"] = updateMetadata
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := target.UploadFileIntoUpdate(b.update, path, bytes.NewReader(files[path])); err != nil {
+			return b.update, fmt.Errorf("error writing %s: %w", path, err)
+		}
+	}
+	if b.uncommitted {
+		return b.update, nil
+	}
+	commit, err := json.Marshal(update.NewCommit(b.update))
+	if err != nil {
+		return b.update, err
+	}
+	if err := target.UploadFileIntoUpdate(b.update, update.CommitFile, bytes.NewReader(commit)); err != nil {
+		return b.update, fmt.Errorf("error committing update: %w", err)
+	}
+	return b.update, nil
+}